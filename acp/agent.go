@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+	"golang.org/x/exp/jsonrpc2"
 )
 
 // Errors for connection and notification handling.
@@ -19,93 +22,96 @@ var (
 // to make re-entrant calls from handlers.
 type AgentConnection struct {
 	core *ConnectionCore
+
+	// Per-session prompt turn serialization
+	turns *promptTurnTracker
+
+	// Running TurnContexts by session, and the counter for generated IDs
+	turnContexts *util.SyncMap[api.SessionId, *TurnContext]
+	ids          atomic.Uint64
+
+	// Opt-in coalescing of outgoing session updates
+	coalescer atomic.Pointer[updateCoalescer]
+
+	// "Always" permission answers remembered by AskPermission
+	permissions *rememberedPermissions
 }
 
 // NewAgentConnectionStdio creates a new agent connection using stdio transport.
+// A HandlerRegistry passed as handler must be created for RoleAgent.
 func NewAgentConnectionStdio(
 	ctx context.Context,
 	rwc io.ReadWriteCloser,
 	handler Handler,
 	timeout time.Duration,
 ) (*AgentConnection, error) {
-	core, err := NewConnectionCore(ctx, rwc, handler, timeout)
-	if err != nil {
+	if err := checkHandlerRole(handler, RoleAgent); err != nil {
 		return nil, err
 	}
 
-	return &AgentConnection{core: core}, nil
-}
-
-// Close closes the connection.
-func (a *AgentConnection) Close() error {
-	return a.core.Close()
-}
-
-// Wait waits for the connection to close.
-func (a *AgentConnection) Wait() error {
-	return a.core.Wait()
-}
-
-// Agent method helpers.
-
-// Initialize sends an initialize request to the client.
-func (a *AgentConnection) Initialize(
-	ctx context.Context,
-	params *api.InitializeRequest,
-) (*api.InitializeResponse, error) {
-	var result api.InitializeResponse
-	err := a.core.Call(ctx, api.MethodInitialize, params, &result)
+	a := &AgentConnection{
+		turns:        newPromptTurnTracker(),
+		turnContexts: util.NewSyncMap[api.SessionId, *TurnContext](),
+		permissions:  util.NewSyncMap[api.SessionId, *util.SyncMap[string, PermissionAction]](),
+	}
+	_, err := newConnectionCore(ctx, rwc, handler, timeout, func(core *ConnectionCore) serveFunc {
+		a.core = core
+		return a.serve
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &result, nil
+	return a, nil
 }
 
-// Authenticate sends an authenticate request to the client.
-func (a *AgentConnection) Authenticate(ctx context.Context, params *api.AuthenticateRequest) error {
-	return a.core.Call(ctx, api.MethodAuthenticate, params, nil)
-}
-
-// SessionNew sends a session/new request to the client.
-func (a *AgentConnection) SessionNew(
+// serve serves a request or notification from the client. Handlers find the
+// connection in their context.
+func (a *AgentConnection) serve(
 	ctx context.Context,
-	params *api.NewSessionRequest,
-) (*api.NewSessionResponse, error) {
-	var result api.NewSessionResponse
-	err := a.core.Call(ctx, api.MethodSessionNew, params, &result)
-	if err != nil {
-		return nil, err
+	conn *jsonrpc2.Connection,
+	req *jsonrpc2.Request,
+	handle dispatchFunc,
+) (interface{}, error) {
+	ctx = withAgentConnection(ctx, a)
+
+	if !req.IsCall() && req.Method == api.MethodSessionCancel {
+		a.cancelTurnContext(req)
 	}
-	return &result, nil
+
+	// Prompt turns run asynchronously so the connection keeps serving
+	// other messages, such as session/cancel, while a turn is in progress.
+	if req.IsCall() && req.Method == api.MethodSessionPrompt {
+		return a.dispatchPrompt(ctx, conn, req, handle)
+	}
+	return a.core.dispatch(ctx, req, handle)
 }
 
-// SessionLoad sends a session/load request to the client.
-func (a *AgentConnection) SessionLoad(ctx context.Context, params *api.LoadSessionRequest) error {
-	return a.core.Call(ctx, api.MethodSessionLoad, params, nil)
+// call makes a request to the client once the updates held back for
+// coalescing have been sent, so they reach the client first.
+func (a *AgentConnection) call(ctx context.Context, method string, params, result any) error {
+	a.flushUpdates()
+	return a.core.Call(ctx, method, params, result)
 }
 
-// SessionPrompt sends a session/prompt request to the client.
-func (a *AgentConnection) SessionPrompt(ctx context.Context, params *api.PromptRequest) (*api.PromptResponse, error) {
-	var result api.PromptResponse
-	err := a.core.Call(ctx, api.MethodSessionPrompt, params, &result)
-	if err != nil {
-		return nil, err
-	}
-	return &result, nil
+// Close closes the connection.
+func (a *AgentConnection) Close() error {
+	return a.core.Close()
 }
 
-// SessionCancel sends a session/cancel notification to the client.
-func (a *AgentConnection) SessionCancel(ctx context.Context, params *api.CancelNotification) error {
-	return a.core.Notify(ctx, api.MethodSessionCancel, params)
+// Wait waits for the connection to close.
+func (a *AgentConnection) Wait() error {
+	return a.core.Wait()
 }
 
+// Client method helpers - these are methods the Agent calls on the Client.
+
 // SessionRequestPermission sends a session/request_permission request to the client.
 func (a *AgentConnection) SessionRequestPermission(
 	ctx context.Context,
 	params *api.RequestPermissionRequest,
 ) (*api.RequestPermissionResponse, error) {
 	var result api.RequestPermissionResponse
-	err := a.core.Call(ctx, api.MethodSessionRequestPermission, params, &result)
+	err := a.call(ctx, api.MethodSessionRequestPermission, params, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -114,18 +120,19 @@ func (a *AgentConnection) SessionRequestPermission(
 
 // SendSessionUpdate sends a session/update notification to the client.
 func (a *AgentConnection) SendSessionUpdate(ctx context.Context, params *api.SessionNotification) error {
+	if coalescer := a.coalescer.Load(); coalescer != nil {
+		return coalescer.send(ctx, params)
+	}
 	return a.core.Notify(ctx, api.MethodSessionUpdate, params)
 }
 
-// Client method helpers - these are methods the Agent calls on the Client.
-
 // FsReadTextFile sends a fs/read_text_file request to the client.
 func (a *AgentConnection) FsReadTextFile(
 	ctx context.Context,
 	params *api.ReadTextFileRequest,
 ) (*api.ReadTextFileResponse, error) {
 	var result api.ReadTextFileResponse
-	err := a.core.Call(ctx, api.MethodFsReadTextFile, params, &result)
+	err := a.call(ctx, api.MethodFsReadTextFile, params, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -134,7 +141,7 @@ func (a *AgentConnection) FsReadTextFile(
 
 // FsWriteTextFile sends a fs/write_text_file request to the client.
 func (a *AgentConnection) FsWriteTextFile(ctx context.Context, params *api.WriteTextFileRequest) error {
-	return a.core.Call(ctx, api.MethodFsWriteTextFile, params, nil)
+	return a.call(ctx, api.MethodFsWriteTextFile, params, nil)
 }
 
 // Terminal method helpers - these are experimental/unstable methods the Agent calls on the Client.
@@ -145,7 +152,7 @@ func (a *AgentConnection) TerminalCreate(
 	params *api.CreateTerminalRequest,
 ) (*api.CreateTerminalResponse, error) {
 	var result api.CreateTerminalResponse
-	err := a.core.Call(ctx, api.MethodTerminalCreate, params, &result)
+	err := a.call(ctx, api.MethodTerminalCreate, params, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -158,7 +165,7 @@ func (a *AgentConnection) TerminalOutput(
 	params *api.TerminalOutputRequest,
 ) (*api.TerminalOutputResponse, error) {
 	var result api.TerminalOutputResponse
-	err := a.core.Call(ctx, api.MethodTerminalOutput, params, &result)
+	err := a.call(ctx, api.MethodTerminalOutput, params, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -167,7 +174,7 @@ func (a *AgentConnection) TerminalOutput(
 
 // TerminalRelease sends a terminal/release request to the client.
 func (a *AgentConnection) TerminalRelease(ctx context.Context, params *api.ReleaseTerminalRequest) error {
-	return a.core.Call(ctx, api.MethodTerminalRelease, params, nil)
+	return a.call(ctx, api.MethodTerminalRelease, params, nil)
 }
 
 // TerminalWaitForExit sends a terminal/wait_for_exit request to the client.
@@ -176,7 +183,7 @@ func (a *AgentConnection) TerminalWaitForExit(
 	params *api.WaitForTerminalExitRequest,
 ) (*api.WaitForTerminalExitResponse, error) {
 	var result api.WaitForTerminalExitResponse
-	err := a.core.Call(ctx, api.MethodTerminalWaitForExit, params, &result)
+	err := a.call(ctx, api.MethodTerminalWaitForExit, params, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -185,5 +192,5 @@ func (a *AgentConnection) TerminalWaitForExit(
 
 // TerminalKill sends a terminal/kill request to the client.
 func (a *AgentConnection) TerminalKill(ctx context.Context, params *api.KillTerminalRequest) error {
-	return a.core.Call(ctx, api.MethodTerminalKill, params, nil)
+	return a.call(ctx, api.MethodTerminalKill, params, nil)
 }
@@ -0,0 +1,237 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+)
+
+// Option IDs of the standard permission options.
+const (
+	PermissionOptionAllowOnce    api.PermissionOptionId = "allow_once"
+	PermissionOptionAllowAlways  api.PermissionOptionId = "allow_always"
+	PermissionOptionRejectOnce   api.PermissionOptionId = "reject_once"
+	PermissionOptionRejectAlways api.PermissionOptionId = "reject_always"
+)
+
+// StandardPermissionOptions returns one option of each kind: allow once,
+// always allow, reject once and always reject.
+func StandardPermissionOptions() []api.PermissionOption {
+	return []api.PermissionOption{
+		{Kind: api.PermissionOptionKindAllowOnce, Name: "Allow", OptionId: PermissionOptionAllowOnce},
+		{Kind: api.PermissionOptionKindAllowAlways, Name: "Always allow", OptionId: PermissionOptionAllowAlways},
+		{Kind: api.PermissionOptionKindRejectOnce, Name: "Reject", OptionId: PermissionOptionRejectOnce},
+		{Kind: api.PermissionOptionKindRejectAlways, Name: "Always reject", OptionId: PermissionOptionRejectAlways},
+	}
+}
+
+// OncePermissionOptions returns allow once and reject once options, for
+// requests whose answer should not be remembered.
+func OncePermissionOptions() []api.PermissionOption {
+	return []api.PermissionOption{
+		{Kind: api.PermissionOptionKindAllowOnce, Name: "Allow", OptionId: PermissionOptionAllowOnce},
+		{Kind: api.PermissionOptionKindRejectOnce, Name: "Reject", OptionId: PermissionOptionRejectOnce},
+	}
+}
+
+// PermissionOutcome is the outcome of a permission request.
+type PermissionOutcome int
+
+const (
+	// PermissionOutcomeCancelled means the request was cancelled without a choice.
+	PermissionOutcomeCancelled PermissionOutcome = iota
+	// PermissionOutcomeAllowed means an allow option was selected.
+	PermissionOutcomeAllowed
+	// PermissionOutcomeRejected means a reject option was selected.
+	PermissionOutcomeRejected
+)
+
+// String returns the string representation of the outcome.
+func (o PermissionOutcome) String() string {
+	switch o {
+	case PermissionOutcomeCancelled:
+		return "cancelled"
+	case PermissionOutcomeAllowed:
+		return "allowed"
+	case PermissionOutcomeRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// PermissionDecision is the typed answer to a permission request.
+type PermissionDecision struct {
+	// Outcome is whether the tool call was allowed, rejected or the request cancelled.
+	Outcome PermissionOutcome
+	// Always is true if the answer applies to later requests as well.
+	Always bool
+	// OptionID is the selected option, if any.
+	OptionID api.PermissionOptionId
+	// Remembered is true if the answer came from an earlier "always" answer
+	// and the client was not asked.
+	Remembered bool
+}
+
+// Allowed reports whether the tool call may run.
+func (d PermissionDecision) Allowed() bool {
+	return d.Outcome == PermissionOutcomeAllowed
+}
+
+// DecodePermissionDecision decodes the outcome of a permission request made
+// with the given options.
+func DecodePermissionDecision(
+	outcome api.RequestPermissionResponseOutcome,
+	options []api.PermissionOption,
+) (PermissionDecision, error) {
+	var decoded struct {
+		Outcome  string                 `json:"outcome"`
+		OptionID api.PermissionOptionId `json:"optionId"`
+	}
+	if err := remarshal(outcome, &decoded); err != nil {
+		return PermissionDecision{}, fmt.Errorf("failed to decode permission outcome: %w", err)
+	}
+
+	switch decoded.Outcome {
+	case "cancelled":
+		return PermissionDecision{Outcome: PermissionOutcomeCancelled}, nil
+	case "selected":
+	default:
+		return PermissionDecision{}, fmt.Errorf("unknown permission outcome %q", decoded.Outcome)
+	}
+
+	for _, option := range options {
+		if option.OptionId != decoded.OptionID {
+			continue
+		}
+		decision := PermissionDecision{OptionID: option.OptionId}
+		switch option.Kind {
+		case api.PermissionOptionKindAllowOnce:
+			decision.Outcome = PermissionOutcomeAllowed
+		case api.PermissionOptionKindAllowAlways:
+			decision.Outcome, decision.Always = PermissionOutcomeAllowed, true
+		case api.PermissionOptionKindRejectOnce:
+			decision.Outcome = PermissionOutcomeRejected
+		case api.PermissionOptionKindRejectAlways:
+			decision.Outcome, decision.Always = PermissionOutcomeRejected, true
+		default:
+			return PermissionDecision{}, fmt.Errorf("option %q has unknown kind %q", option.OptionId, option.Kind)
+		}
+		return decision, nil
+	}
+	return PermissionDecision{}, fmt.Errorf("client selected unknown option %q", decoded.OptionID)
+}
+
+// rememberedPermissions holds "always" answers per session, keyed by
+// rememberedPermissionKey.
+type rememberedPermissions = util.SyncMap[api.SessionId, *util.SyncMap[string, PermissionAction]]
+
+// AskPermission asks the client for permission to run a tool call and
+// returns the typed decision.
+//
+// Without options, StandardPermissionOptions are offered. Once the client
+// answers with an allow_always or reject_always option, later requests in the
+// session for the same tool kind (or the same title, for tool calls without a
+// kind) are answered from memory without asking, provided the options include
+// an option with the remembered answer. The answers are kept until
+// ForgetPermissions is called or the session is removed from a SessionManager
+// bound with BindSessionManager.
+func (a *AgentConnection) AskPermission(
+	ctx context.Context,
+	sessionID api.SessionId,
+	toolCall api.ToolCallUpdate,
+	options ...api.PermissionOption,
+) (PermissionDecision, error) {
+	if len(options) == 0 {
+		options = StandardPermissionOptions()
+	}
+	key := rememberedPermissionKey(&toolCall)
+
+	if remembered, exists := a.permissions.Load(sessionID); exists && key != "" {
+		if action, found := remembered.Load(key); found {
+			if option := selectRememberedOption(options, action); option != nil {
+				return PermissionDecision{
+					Outcome:    permissionOutcomeFor(action),
+					Always:     true,
+					OptionID:   option.OptionId,
+					Remembered: true,
+				}, nil
+			}
+		}
+	}
+
+	resp, err := a.SessionRequestPermission(ctx, &api.RequestPermissionRequest{
+		SessionId: sessionID,
+		ToolCall:  toolCall,
+		Options:   options,
+	})
+	if err != nil {
+		return PermissionDecision{}, err
+	}
+
+	decision, err := DecodePermissionDecision(resp.Outcome, options)
+	if err != nil {
+		return PermissionDecision{}, err
+	}
+	if decision.Always && key != "" {
+		action := PermissionActionReject
+		if decision.Allowed() {
+			action = PermissionActionAllow
+		}
+		remembered, _ := a.permissions.LoadOrStore(sessionID, util.NewSyncMap[string, PermissionAction]())
+		remembered.Store(key, action)
+	}
+	return decision, nil
+}
+
+// rememberedPermissionKey identifies the tool calls an "always" answer applies
+// to: the tool kind, or the title for tool calls without a kind. It returns ""
+// for tool calls with neither, whose answers are not remembered.
+func rememberedPermissionKey(toolCall *api.ToolCallUpdate) string {
+	if kind := toolKindValue(toolCall.Kind); kind != "" {
+		return "kind:" + string(kind)
+	}
+	if toolCall.Title != nil && *toolCall.Title != "" {
+		return "title:" + *toolCall.Title
+	}
+	return ""
+}
+
+// ForgetPermissions drops the "always" answers remembered for a session.
+func (a *AgentConnection) ForgetPermissions(sessionID api.SessionId) {
+	a.permissions.Delete(sessionID)
+}
+
+// AskPermission asks the client for permission to run a tool call in the
+// turn's session. See AgentConnection.AskPermission.
+func (t *TurnContext) AskPermission(
+	toolCall api.ToolCallUpdate,
+	options ...api.PermissionOption,
+) (PermissionDecision, error) {
+	return t.conn.AskPermission(t.ctx, t.sessionID, toolCall, options...)
+}
+
+// selectRememberedOption returns the option that carries out a remembered
+// action, preferring the "always" option.
+func selectRememberedOption(options []api.PermissionOption, action PermissionAction) *api.PermissionOption {
+	kind := api.PermissionOptionKindRejectAlways
+	if action == PermissionActionAllow {
+		kind = api.PermissionOptionKindAllowAlways
+	}
+	for i := range options {
+		if options[i].Kind == kind {
+			return &options[i]
+		}
+	}
+	return selectPermissionOption(options, action)
+}
+
+// permissionOutcomeFor returns the outcome of a remembered action.
+func permissionOutcomeFor(action PermissionAction) PermissionOutcome {
+	if action == PermissionActionAllow {
+		return PermissionOutcomeAllowed
+	}
+	return PermissionOutcomeRejected
+}
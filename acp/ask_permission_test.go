@@ -0,0 +1,222 @@
+package acp
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPermissionPair creates a connection pair whose client answers permission
+// requests with answer and counts them.
+func newPermissionPair(
+	t *testing.T,
+	answer func(params *api.RequestPermissionRequest) api.RequestPermissionResponseOutcome,
+) (*AgentConnection, *atomic.Int32) {
+	t.Helper()
+
+	var asked atomic.Int32
+	clientHandler := NewClientHandlerRegistry()
+	clientHandler.RegisterSessionRequestPermissionHandler(
+		func(_ context.Context, params *api.RequestPermissionRequest) (*api.RequestPermissionResponse, error) {
+			asked.Add(1)
+			return &api.RequestPermissionResponse{Outcome: answer(params)}, nil
+		},
+	)
+	agentConn, _ := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+	return agentConn, &asked
+}
+
+// editToolCall returns a tool call update for an edit.
+func editToolCall(kind api.ToolKind) api.ToolCallUpdate {
+	return NewToolCallUpdate("call-1").WithTitle("Edit main.go").WithKind(string(kind)).Build()
+}
+
+func TestAskPermission(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("StandardOptions", func(t *testing.T) {
+		var offered []api.PermissionOption
+		agentConn, _ := newPermissionPair(t, func(params *api.RequestPermissionRequest) api.RequestPermissionResponseOutcome {
+			offered = params.Options
+			return NewPermissionSelectedOutcome(string(PermissionOptionAllowOnce))
+		})
+
+		decision, err := agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindEdit))
+		require.NoError(t, err)
+		assert.Equal(t, StandardPermissionOptions(), offered)
+		assert.Equal(t, PermissionDecision{
+			Outcome:  PermissionOutcomeAllowed,
+			OptionID: PermissionOptionAllowOnce,
+		}, decision)
+		assert.True(t, decision.Allowed())
+	})
+
+	t.Run("RemembersAlwaysAnswers", func(t *testing.T) {
+		agentConn, asked := newPermissionPair(t, func(
+			params *api.RequestPermissionRequest,
+		) api.RequestPermissionResponseOutcome {
+			if params.SessionId == "s1" {
+				return NewPermissionSelectedOutcome(string(PermissionOptionRejectAlways))
+			}
+			return NewPermissionSelectedOutcome(string(PermissionOptionAllowOnce))
+		})
+
+		decision, err := agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindEdit))
+		require.NoError(t, err)
+		assert.Equal(t, PermissionOutcomeRejected, decision.Outcome)
+		assert.True(t, decision.Always)
+		assert.False(t, decision.Remembered)
+
+		decision, err = agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindEdit))
+		require.NoError(t, err)
+		assert.Equal(t, PermissionDecision{
+			Outcome:    PermissionOutcomeRejected,
+			Always:     true,
+			OptionID:   PermissionOptionRejectAlways,
+			Remembered: true,
+		}, decision)
+		assert.Equal(t, int32(1), asked.Load())
+
+		// Tool calls of the same kind share the answer, whatever their title.
+		decision, err = agentConn.AskPermission(ctx, "s1",
+			NewToolCallUpdate("call-2").WithTitle("Edit util.go").WithKind(string(api.ToolKindEdit)).Build())
+		require.NoError(t, err)
+		assert.True(t, decision.Remembered)
+		assert.Equal(t, int32(1), asked.Load())
+
+		// Other tool kinds and sessions are still asked.
+		_, err = agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindExecute))
+		require.NoError(t, err)
+		decision, err = agentConn.AskPermission(ctx, "s2", editToolCall(api.ToolKindEdit))
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed())
+		assert.Equal(t, int32(3), asked.Load())
+
+		agentConn.ForgetPermissions("s1")
+		_, err = agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindEdit))
+		require.NoError(t, err)
+		assert.Equal(t, int32(4), asked.Load())
+	})
+
+	t.Run("RemembersByTitleWithoutKind", func(t *testing.T) {
+		agentConn, asked := newPermissionPair(t, func(
+			*api.RequestPermissionRequest,
+		) api.RequestPermissionResponseOutcome {
+			return NewPermissionSelectedOutcome(string(PermissionOptionAllowAlways))
+		})
+
+		_, err := agentConn.AskPermission(ctx, "s1", editToolCall(""))
+		require.NoError(t, err)
+		decision, err := agentConn.AskPermission(ctx, "s1", editToolCall(""))
+		require.NoError(t, err)
+		assert.True(t, decision.Remembered)
+		assert.Equal(t, int32(1), asked.Load())
+
+		_, err = agentConn.AskPermission(ctx, "s1", NewToolCallUpdate("call-2").WithTitle("Edit util.go").Build())
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), asked.Load())
+	})
+
+	t.Run("ForgetsRemovedSessions", func(t *testing.T) {
+		agentConn, asked := newPermissionPair(t, func(
+			*api.RequestPermissionRequest,
+		) api.RequestPermissionResponseOutcome {
+			return NewPermissionSelectedOutcome(string(PermissionOptionAllowAlways))
+		})
+		manager := NewSessionManager()
+		agentConn.BindSessionManager(manager)
+		_, err := manager.CreateSession("s1")
+		require.NoError(t, err)
+
+		_, err = agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindEdit))
+		require.NoError(t, err)
+		_, remembered := agentConn.permissions.Load("s1")
+		require.True(t, remembered)
+
+		require.NoError(t, manager.DeleteSession("s1"))
+		require.Eventually(t, func() bool {
+			_, remembered = agentConn.permissions.Load("s1")
+			return !remembered
+		}, 5*time.Second, 10*time.Millisecond)
+
+		_, err = agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindEdit))
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), asked.Load())
+	})
+
+	t.Run("CustomOptions", func(t *testing.T) {
+		options := []api.PermissionOption{
+			{Kind: api.PermissionOptionKindAllowOnce, Name: "Write", OptionId: "write"},
+			{Kind: api.PermissionOptionKindRejectOnce, Name: "Skip", OptionId: "skip"},
+		}
+		agentConn, _ := newPermissionPair(t, func(_ *api.RequestPermissionRequest) api.RequestPermissionResponseOutcome {
+			return NewPermissionSelectedOutcome("skip")
+		})
+
+		decision, err := agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindEdit), options...)
+		require.NoError(t, err)
+		assert.Equal(t, PermissionOutcomeRejected, decision.Outcome)
+		assert.Equal(t, api.PermissionOptionId("skip"), decision.OptionID)
+		assert.False(t, decision.Always)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		agentConn, _ := newPermissionPair(t, func(_ *api.RequestPermissionRequest) api.RequestPermissionResponseOutcome {
+			return NewPermissionCancelledOutcome()
+		})
+
+		decision, err := agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindEdit))
+		require.NoError(t, err)
+		assert.Equal(t, PermissionOutcomeCancelled, decision.Outcome)
+		assert.False(t, decision.Allowed())
+	})
+
+	t.Run("UnknownOption", func(t *testing.T) {
+		agentConn, _ := newPermissionPair(t, func(_ *api.RequestPermissionRequest) api.RequestPermissionResponseOutcome {
+			return NewPermissionSelectedOutcome("bogus")
+		})
+
+		_, err := agentConn.AskPermission(ctx, "s1", editToolCall(api.ToolKindEdit))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "bogus")
+	})
+
+	t.Run("TurnContext", func(t *testing.T) {
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionRequestPermissionHandler(NewPermissionPolicy(nil,
+			PermissionRule{Kind: api.ToolKindEdit, Action: PermissionActionAllow},
+		).HandleRequestPermission)
+
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			decision, err := turn.AskPermission(editToolCall(api.ToolKindEdit))
+			require.NoError(t, err)
+			assert.True(t, decision.Allowed())
+			return api.StopReasonEndTurn, nil
+		}, clientHandler)
+
+		events := streamEvents(ctx, clientConn, "s1")
+		assert.Equal(t, api.StopReasonEndTurn, events[len(events)-1].StopReason)
+	})
+}
+
+func TestDecodePermissionDecision(t *testing.T) {
+	options := StandardPermissionOptions()
+
+	decision, err := DecodePermissionDecision(api.RequestPermissionResponseOutcome(map[string]interface{}{
+		"outcome": "selected", "optionId": "allow_always",
+	}), options)
+	require.NoError(t, err)
+	assert.Equal(t, PermissionDecision{
+		Outcome:  PermissionOutcomeAllowed,
+		Always:   true,
+		OptionID: PermissionOptionAllowAlways,
+	}, decision)
+
+	_, err = DecodePermissionDecision(map[string]interface{}{"outcome": "maybe"}, options)
+	require.Error(t, err)
+}
@@ -6,26 +6,93 @@ import (
 	"time"
 
 	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+	"golang.org/x/exp/jsonrpc2"
 )
 
 // ClientConnection represents a connection from a client to an agent.
 type ClientConnection struct {
 	core *ConnectionCore
+
+	// Active PromptStream turns by session
+	streams *util.SyncMap[api.SessionId, *promptStream]
+
+	// Incoming permission requests not answered yet, cancelled by session/cancel
+	permissionRequests *permissionTracker
+
+	// Working directories of the sessions the client created or loaded, used
+	// as the default roots of FSHandlers and TerminalHost
+	sessionCwds *util.SyncMap[api.SessionId, string]
+
+	// Commands the agent advertised for the sessions the client created
+	sessionCommands *util.SyncMap[api.SessionId, []api.AvailableCommand]
+}
+
+// clientConnectionKey is the context key for the client connection serving a
+// request.
+type clientConnectionKey struct{}
+
+// withClientConnection returns a context carrying the client connection
+// serving a request.
+func withClientConnection(ctx context.Context, conn *ClientConnection) context.Context {
+	return context.WithValue(ctx, clientConnectionKey{}, conn)
+}
+
+// ClientConnectionFromContext returns the client connection serving a
+// request, if any. Handlers use it to call back to the agent.
+func ClientConnectionFromContext(ctx context.Context) *ClientConnection {
+	conn, _ := ctx.Value(clientConnectionKey{}).(*ClientConnection)
+	return conn
 }
 
 // NewClientConnectionStdio creates a new client connection using stdio transport.
+// A HandlerRegistry passed as handler must be created for RoleClient.
 func NewClientConnectionStdio(
 	ctx context.Context,
 	rwc io.ReadWriteCloser,
 	handler Handler,
 	timeout time.Duration,
 ) (*ClientConnection, error) {
-	core, err := NewConnectionCore(ctx, rwc, handler, timeout)
+	if err := checkHandlerRole(handler, RoleClient); err != nil {
+		return nil, err
+	}
+
+	c := &ClientConnection{
+		streams:            util.NewSyncMap[api.SessionId, *promptStream](),
+		permissionRequests: newPermissionTracker(),
+		sessionCwds:        util.NewSyncMap[api.SessionId, string](),
+		sessionCommands:    util.NewSyncMap[api.SessionId, []api.AvailableCommand](),
+	}
+	_, err := newConnectionCore(ctx, rwc, handler, timeout, func(core *ConnectionCore) serveFunc {
+		c.core = core
+		core.intercept(c.routeStreamUpdate)
+		core.intercept(c.trackCommandsUpdate)
+		return c.serve
+	})
 	if err != nil {
 		return nil, err
 	}
+	return c, nil
+}
 
-	return &ClientConnection{core: core}, nil
+// serve serves a request or notification from the agent. Handlers find the
+// connection in their context.
+func (c *ClientConnection) serve(
+	ctx context.Context,
+	conn *jsonrpc2.Connection,
+	req *jsonrpc2.Request,
+	handle dispatchFunc,
+) (interface{}, error) {
+	ctx = withClientConnection(ctx, c)
+
+	if req.IsCall() && req.Method == api.MethodSessionRequestPermission {
+		return c.dispatchPermission(ctx, conn, req, handle)
+	}
+	// Waiting for a terminal to exit can take arbitrarily long.
+	if req.IsCall() && req.Method == api.MethodTerminalWaitForExit {
+		return c.core.dispatchAsync(ctx, conn, req, handle)
+	}
+	return c.core.dispatch(ctx, req, handle)
 }
 
 // Close closes the connection.
@@ -38,38 +105,7 @@ func (c *ClientConnection) Wait() error {
 	return c.core.Wait()
 }
 
-// Client method helpers.
-
-// FsReadTextFile sends a fs/read_text_file request to the agent.
-func (c *ClientConnection) FsReadTextFile(
-	ctx context.Context,
-	params *api.ReadTextFileRequest,
-) (*api.ReadTextFileResponse, error) {
-	var result api.ReadTextFileResponse
-	err := c.core.Call(ctx, api.MethodFsReadTextFile, params, &result)
-	if err != nil {
-		return nil, err
-	}
-	return &result, nil
-}
-
-// FsWriteTextFile sends a fs/write_text_file request to the agent.
-func (c *ClientConnection) FsWriteTextFile(ctx context.Context, params *api.WriteTextFileRequest) error {
-	return c.core.Call(ctx, api.MethodFsWriteTextFile, params, nil)
-}
-
-// SessionRequestPermission sends a session/request_permission request to the agent.
-func (c *ClientConnection) SessionRequestPermission(
-	ctx context.Context,
-	params *api.RequestPermissionRequest,
-) (*api.RequestPermissionResponse, error) {
-	var result api.RequestPermissionResponse
-	err := c.core.Call(ctx, api.MethodSessionRequestPermission, params, &result)
-	if err != nil {
-		return nil, err
-	}
-	return &result, nil
-}
+// Agent method helpers - these are methods the Client calls on the Agent.
 
 // Initialize sends an initialize request to the agent.
 func (c *ClientConnection) Initialize(
@@ -84,7 +120,13 @@ func (c *ClientConnection) Initialize(
 	return &result, nil
 }
 
-// SessionNew sends a session/new request to the agent.
+// Authenticate sends an authenticate request to the agent.
+func (c *ClientConnection) Authenticate(ctx context.Context, params *api.AuthenticateRequest) error {
+	return c.core.Call(ctx, api.MethodAuthenticate, params, nil)
+}
+
+// SessionNew sends a session/new request to the agent. The session's Cwd is
+// remembered as the default root of FSHandlers.
 func (c *ClientConnection) SessionNew(
 	ctx context.Context,
 	params *api.NewSessionRequest,
@@ -94,61 +136,50 @@ func (c *ClientConnection) SessionNew(
 	if err != nil {
 		return nil, err
 	}
+	if result.SessionId != "" && params.Cwd != "" {
+		c.sessionCwds.Store(result.SessionId, params.Cwd)
+	}
+	if result.SessionId != "" && len(result.AvailableCommands) > 0 {
+		c.sessionCommands.Store(result.SessionId, result.AvailableCommands)
+	}
 	return &result, nil
 }
 
-// SessionPrompt sends a session/prompt request to the agent.
-func (c *ClientConnection) SessionPrompt(ctx context.Context, params *api.PromptRequest) (*api.PromptResponse, error) {
-	var result api.PromptResponse
-	err := c.core.Call(ctx, api.MethodSessionPrompt, params, &result)
-	if err != nil {
-		return nil, err
+// SessionLoad sends a session/load request to the agent.
+func (c *ClientConnection) SessionLoad(ctx context.Context, params *api.LoadSessionRequest) error {
+	if err := c.core.Call(ctx, api.MethodSessionLoad, params, nil); err != nil {
+		return err
 	}
-	return &result, nil
+	if params.SessionId != "" && params.Cwd != "" {
+		c.sessionCwds.Store(params.SessionId, params.Cwd)
+	}
+	return nil
 }
 
-// SessionCancel sends a session/cancel notification to the agent.
-func (c *ClientConnection) SessionCancel(ctx context.Context, params *api.CancelNotification) error {
-	return c.core.Notify(ctx, api.MethodSessionCancel, params)
+// ForgetSession drops what the connection tracks for a session: its Cwd, which
+// FSHandlers and TerminalHost use as the session's default root, and the
+// commands the agent advertised. Call it once the session is no longer used.
+func (c *ClientConnection) ForgetSession(sessionID api.SessionId) {
+	c.sessionCwds.Delete(sessionID)
+	c.sessionCommands.Delete(sessionID)
 }
 
-// TerminalCreate sends a terminal/create request to the agent.
-func (c *ClientConnection) TerminalCreate(
-	ctx context.Context,
-	params *api.CreateTerminalRequest,
-) (*api.CreateTerminalResponse, error) {
-	var result api.CreateTerminalResponse
-	err := c.core.Call(ctx, api.MethodTerminalCreate, params, &result)
+// SessionPrompt sends a session/prompt request to the agent.
+func (c *ClientConnection) SessionPrompt(ctx context.Context, params *api.PromptRequest) (*api.PromptResponse, error) {
+	var result api.PromptResponse
+	err := c.core.Call(ctx, api.MethodSessionPrompt, params, &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
-// TerminalOutput sends a terminal/output notification to the agent.
-func (c *ClientConnection) TerminalOutput(ctx context.Context, params *api.TerminalOutputRequest) error {
-	return c.core.Notify(ctx, api.MethodTerminalOutput, params)
-}
-
-// TerminalRelease sends a terminal/release request to the agent.
-func (c *ClientConnection) TerminalRelease(ctx context.Context, params *api.ReleaseTerminalRequest) error {
-	return c.core.Call(ctx, api.MethodTerminalRelease, params, nil)
-}
-
-// TerminalKill sends a terminal/kill request to the agent.
-func (c *ClientConnection) TerminalKill(ctx context.Context, params *api.KillTerminalRequest) error {
-	return c.core.Call(ctx, api.MethodTerminalKill, params, nil)
-}
-
-// TerminalWaitForExit sends a terminal/wait_for_exit request to the agent.
-func (c *ClientConnection) TerminalWaitForExit(
-	ctx context.Context,
-	params *api.WaitForTerminalExitRequest,
-) (*api.WaitForTerminalExitResponse, error) {
-	var result api.WaitForTerminalExitResponse
-	err := c.core.Call(ctx, api.MethodTerminalWaitForExit, params, &result)
-	if err != nil {
-		return nil, err
-	}
-	return &result, nil
+// SessionCancel sends a session/cancel notification to the agent. Pending
+// session/request_permission requests for the session are then answered with
+// the cancelled outcome, as the protocol requires, and their handlers' contexts
+// are cancelled.
+func (c *ClientConnection) SessionCancel(ctx context.Context, params *api.CancelNotification) error {
+	err := c.core.Notify(ctx, api.MethodSessionCancel, params)
+	c.cancelPermissions(params.SessionId)
+	return err
 }
@@ -0,0 +1,327 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+)
+
+// DefaultCoalesceWindow is the coalescing window used when CoalesceOptions
+// does not set one.
+const DefaultCoalesceWindow = 50 * time.Millisecond
+
+// CoalesceOptions configures the coalescing of session updates enabled with
+// AgentConnection.EnableCoalescing.
+type CoalesceOptions struct {
+	// Window is the longest time an update is held back waiting for more
+	// updates to merge. Zero uses DefaultCoalesceWindow.
+	Window time.Duration
+	// MaxBytes sends a merged message or thought chunk as soon as its text
+	// reaches this many bytes. Zero means no byte budget.
+	MaxBytes int
+}
+
+// updateCoalescer merges consecutive session updates before they are sent.
+//
+// At most one update per session is held back. A new update is merged into it
+// if both are text chunks of the same kind, or tool call updates for the same
+// tool call. Any other update first sends the held one, so the client always
+// sees updates in the order they were produced.
+//
+// Held updates sent in the background, when their window elapses or before an
+// outgoing request, cannot report errors to anyone. The first such error of a
+// session is kept until the session, or every session, is flushed explicitly.
+type updateCoalescer struct {
+	options CoalesceOptions
+	notify  func(ctx context.Context, params *api.SessionNotification) error
+
+	mu      sync.Mutex
+	pending map[api.SessionId]*pendingUpdate
+	errs    map[api.SessionId]error
+}
+
+// pendingUpdate is an update held back by the coalescer.
+type pendingUpdate struct {
+	ctx    context.Context
+	update *api.SessionUpdate
+	timer  *time.Timer
+}
+
+// newUpdateCoalescer creates a coalescer that sends merged updates with notify.
+func newUpdateCoalescer(
+	options CoalesceOptions,
+	notify func(ctx context.Context, params *api.SessionNotification) error,
+) *updateCoalescer {
+	if options.Window <= 0 {
+		options.Window = DefaultCoalesceWindow
+	}
+	return &updateCoalescer{
+		options: options,
+		notify:  notify,
+		pending: make(map[api.SessionId]*pendingUpdate),
+		errs:    make(map[api.SessionId]error),
+	}
+}
+
+// send merges, holds or sends a session notification.
+func (c *updateCoalescer) send(ctx context.Context, params *api.SessionNotification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sessionID := params.SessionId
+	update, ok := params.Update.(*api.SessionUpdate)
+	if !ok || !coalescable(update) {
+		if err := c.flushLocked(sessionID); err != nil {
+			return err
+		}
+		return c.notify(ctx, params)
+	}
+
+	if p, exists := c.pending[sessionID]; exists && mergeUpdates(p.update, update) {
+		if c.overBudget(p.update) {
+			return c.flushLocked(sessionID)
+		}
+		return nil
+	}
+
+	if err := c.flushLocked(sessionID); err != nil {
+		return err
+	}
+
+	if c.overBudget(update) {
+		return c.notify(ctx, params)
+	}
+	p := &pendingUpdate{ctx: context.WithoutCancel(ctx), update: copyUpdate(update)}
+	p.timer = time.AfterFunc(c.options.Window, func() { c.flushExpired(sessionID, p) })
+	c.pending[sessionID] = p
+	return nil
+}
+
+// overBudget reports whether a held text chunk reached the byte budget.
+func (c *updateCoalescer) overBudget(update *api.SessionUpdate) bool {
+	if c.options.MaxBytes <= 0 {
+		return false
+	}
+	text := chunkText(update)
+	return text != nil && len(text.Text) >= c.options.MaxBytes
+}
+
+// flushExpired sends a held update whose window elapsed. Errors are reported
+// by the next explicit flush of the session.
+func (c *updateCoalescer) flushExpired(sessionID api.SessionId, p *pendingUpdate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending[sessionID] != p {
+		return
+	}
+	c.recordLocked(sessionID, c.flushLocked(sessionID))
+}
+
+// recordLocked keeps the first background error of a session.
+func (c *updateCoalescer) recordLocked(sessionID api.SessionId, err error) {
+	if _, exists := c.errs[sessionID]; err != nil && !exists {
+		c.errs[sessionID] = err
+	}
+}
+
+// takeErrLocked returns and forgets the background error of a session.
+func (c *updateCoalescer) takeErrLocked(sessionID api.SessionId) error {
+	err := c.errs[sessionID]
+	delete(c.errs, sessionID)
+	return err
+}
+
+// flushLocked sends the held update of a session, if any.
+func (c *updateCoalescer) flushLocked(sessionID api.SessionId) error {
+	p, exists := c.pending[sessionID]
+	if !exists {
+		return nil
+	}
+	delete(c.pending, sessionID)
+	p.timer.Stop()
+	return c.notify(p.ctx, &api.SessionNotification{SessionId: sessionID, Update: p.update})
+}
+
+// flushSession sends the held update of a session, if any, and returns any
+// error from earlier background flushes of the session.
+func (c *updateCoalescer) flushSession(sessionID api.SessionId) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.flushLocked(sessionID)
+	return errors.Join(c.takeErrLocked(sessionID), err)
+}
+
+// flush sends every held update and returns any error from earlier
+// background flushes.
+func (c *updateCoalescer) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for sessionID := range c.pending {
+		errs = append(errs, c.flushLocked(sessionID))
+	}
+	for sessionID := range c.errs {
+		errs = append(errs, c.takeErrLocked(sessionID))
+	}
+	return errors.Join(errs...)
+}
+
+// flushBackground sends every held update in the background, keeping errors
+// for the explicit flushes of their sessions.
+func (c *updateCoalescer) flushBackground() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for sessionID := range c.pending {
+		c.recordLocked(sessionID, c.flushLocked(sessionID))
+	}
+}
+
+// coalescable reports whether an update may be held back for merging.
+func coalescable(update *api.SessionUpdate) bool {
+	switch update.Type {
+	case api.SessionUpdateTypeAgentMessageChunk, api.SessionUpdateTypeAgentThoughtChunk:
+		return chunkText(update) != nil
+	case api.SessionUpdateTypeToolCallUpdate:
+		return update.ToolCallUpdate != nil && update.ToolCallUpdate.Toolcallid != nil
+	default:
+		return false
+	}
+}
+
+// chunkText returns the unannotated text of a message or thought chunk, or nil
+// if the update is not such a chunk.
+func chunkText(update *api.SessionUpdate) *api.ContentBlockText {
+	var content *api.ContentBlock
+	switch {
+	case update.Type == api.SessionUpdateTypeAgentMessageChunk && update.AgentMessageChunk != nil:
+		content = update.AgentMessageChunk.Content
+	case update.Type == api.SessionUpdateTypeAgentThoughtChunk && update.AgentThoughtChunk != nil:
+		content = update.AgentThoughtChunk.Content
+	}
+	if content == nil || content.Text == nil || content.Text.Annotations != nil {
+		return nil
+	}
+	return content.Text
+}
+
+// copyUpdate copies the parts of a coalescable update that merging modifies,
+// so the caller's update is never changed.
+func copyUpdate(update *api.SessionUpdate) *api.SessionUpdate {
+	if text := chunkText(update); text != nil {
+		content := api.NewContentBlockText(nil, text.Text)
+		if update.Type == api.SessionUpdateTypeAgentThoughtChunk {
+			return api.NewSessionUpdateAgentThoughtChunk(content)
+		}
+		return api.NewSessionUpdateAgentMessageChunk(content)
+	}
+
+	toolCallUpdate := *update.ToolCallUpdate
+	return &api.SessionUpdate{Type: update.Type, ToolCallUpdate: &toolCallUpdate}
+}
+
+// mergeUpdates merges next into the held update and reports whether it could.
+// Text chunks are concatenated; for tool call updates, fields set by next
+// replace the held ones.
+func mergeUpdates(held, next *api.SessionUpdate) bool {
+	if held.Type != next.Type {
+		return false
+	}
+
+	if text := chunkText(held); text != nil {
+		text.Text += chunkText(next).Text
+		return true
+	}
+
+	current, update := held.ToolCallUpdate, next.ToolCallUpdate
+	if *current.Toolcallid != *update.Toolcallid {
+		return false
+	}
+	mergeField(&current.Content, update.Content)
+	mergeField(&current.Kind, update.Kind)
+	mergeField(&current.Locations, update.Locations)
+	mergeField(&current.Rawinput, update.Rawinput)
+	mergeField(&current.Rawoutput, update.Rawoutput)
+	mergeField(&current.Status, update.Status)
+	mergeField(&current.Title, update.Title)
+	return true
+}
+
+// mergeField replaces a held tool call update field if the next update sets it.
+func mergeField(field *interface{}, value interface{}) {
+	if !isUnset(value) {
+		*field = value
+	}
+}
+
+// isUnset reports whether an update field holds no value, including typed nil
+// pointers and slices.
+func isUnset(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// flushUpdates sends the updates held by the connection's coalescer, if any.
+// Errors are kept for FlushUpdates or the flush of the failed session.
+func (a *AgentConnection) flushUpdates() {
+	if coalescer := a.coalescer.Load(); coalescer != nil {
+		coalescer.flushBackground()
+	}
+}
+
+// flushSessionUpdates sends the update held for a session, if any.
+func (a *AgentConnection) flushSessionUpdates(sessionID api.SessionId) error {
+	if coalescer := a.coalescer.Load(); coalescer != nil {
+		return coalescer.flushSession(sessionID)
+	}
+	return nil
+}
+
+// Integration with AgentConnection
+
+// EnableCoalescing merges high-frequency session updates before they are sent.
+//
+// Consecutive AgentMessageChunk or AgentThoughtChunk text and successive
+// ToolCallUpdates for the same tool call are merged for up to the configured
+// window or byte budget. Any other update, outgoing request or prompt response
+// first sends the held updates, so ordering is preserved.
+func (a *AgentConnection) EnableCoalescing(options CoalesceOptions) {
+	coalescer := newUpdateCoalescer(options, func(ctx context.Context, params *api.SessionNotification) error {
+		return a.core.Notify(ctx, api.MethodSessionUpdate, params)
+	})
+	if previous := a.coalescer.Swap(coalescer); previous != nil {
+		_ = previous.flush()
+	}
+}
+
+// DisableCoalescing sends any held updates and stops coalescing.
+func (a *AgentConnection) DisableCoalescing() error {
+	if previous := a.coalescer.Swap(nil); previous != nil {
+		return previous.flush()
+	}
+	return nil
+}
+
+// FlushUpdates sends any updates held by the coalescer. It also returns
+// errors from held updates that were sent in the background, when their window
+// elapsed or before an outgoing request.
+func (a *AgentConnection) FlushUpdates() error {
+	if coalescer := a.coalescer.Load(); coalescer != nil {
+		return coalescer.flush()
+	}
+	return nil
+}
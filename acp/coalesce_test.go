@@ -0,0 +1,248 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCoalescingPair creates a connection pair whose agent coalesces updates
+// and handles prompts with a PromptTurnHandler.
+func newCoalescingPair(
+	t *testing.T,
+	options CoalesceOptions,
+	handler PromptTurnHandler,
+	clientHandler Handler,
+) (*AgentConnection, *ClientConnection) {
+	t.Helper()
+
+	agentHandler := NewAgentHandlerRegistry()
+	agentHandler.RegisterPromptTurnHandler(handler)
+	agentConn, clientConn := NewRolePair(t, agentHandler, clientHandler)
+	agentConn.EnableCoalescing(options)
+	return agentConn, clientConn
+}
+
+// updateTypes returns the update types of a streamed turn.
+func updateTypes(events []PromptEvent) []api.SessionUpdateType {
+	var types []api.SessionUpdateType
+	for _, event := range events {
+		if event.Update != nil {
+			types = append(types, event.Update.Type)
+		}
+	}
+	return types
+}
+
+func TestCoalescing(t *testing.T) {
+	ctx := context.Background()
+	// A window that never elapses during a test, so only flushes send updates.
+	held := CoalesceOptions{Window: time.Hour}
+
+	t.Run("MergesTextChunks", func(t *testing.T) {
+		_, clientConn := newCoalescingPair(t, held, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			for range 100 {
+				require.NoError(t, turn.SendText("token "))
+			}
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		events := streamEvents(ctx, clientConn, "s1")
+		require.Len(t, events, 2)
+		assert.Equal(t, strings.Repeat("token ", 100), collectText(events))
+		assert.Equal(t, api.StopReasonEndTurn, events[1].StopReason)
+	})
+
+	t.Run("FlushesBeforeOtherUpdates", func(t *testing.T) {
+		_, clientConn := newCoalescingPair(t, held, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			require.NoError(t, turn.SendText("a"))
+			require.NoError(t, turn.SendText("b"))
+			require.NoError(t, turn.SendThought("c"))
+			require.NoError(t, turn.SendThought("d"))
+
+			call, err := turn.StartToolCall("Run", api.ToolKindExecute)
+			require.NoError(t, err)
+			require.NoError(t, call.Start())
+			require.NoError(t, call.SetContent("running"))
+			require.NoError(t, call.Complete())
+
+			other, err := turn.StartToolCall("Other", api.ToolKindRead)
+			require.NoError(t, err)
+			require.NoError(t, other.Complete())
+
+			require.NoError(t, turn.SendText("e"))
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		events := streamEvents(ctx, clientConn, "s1")
+		assert.Equal(t, []api.SessionUpdateType{
+			api.SessionUpdateTypeAgentMessageChunk,
+			api.SessionUpdateTypeAgentThoughtChunk,
+			api.SessionUpdateTypeToolCall,
+			api.SessionUpdateTypeToolCallUpdate,
+			api.SessionUpdateTypeToolCall,
+			api.SessionUpdateTypeToolCallUpdate,
+			api.SessionUpdateTypeAgentMessageChunk,
+		}, updateTypes(events))
+
+		assert.Equal(t, "ab", events[0].Update.AgentMessageChunk.Content.Text.Text)
+		assert.Equal(t, "cd", events[1].Update.AgentThoughtChunk.Content.Text.Text)
+
+		merged := events[3].Update.ToolCallUpdate
+		assert.Equal(t, string(api.ToolCallStatusCompleted), merged.Status)
+		assert.Equal(t, []interface{}{"running"}, merged.Content)
+	})
+
+	t.Run("ByteBudget", func(t *testing.T) {
+		options := CoalesceOptions{Window: time.Hour, MaxBytes: 10}
+		_, clientConn := newCoalescingPair(t, options, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			for range 5 {
+				require.NoError(t, turn.SendText("12345"))
+			}
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		events := streamEvents(ctx, clientConn, "s1")
+		var chunks []string
+		for _, event := range events[:len(events)-1] {
+			chunks = append(chunks, event.Update.AgentMessageChunk.Content.Text.Text)
+		}
+		assert.Equal(t, []string{"1234512345", "1234512345", "12345"}, chunks)
+	})
+
+	t.Run("FlushesBeforeRequests", func(t *testing.T) {
+		var mu sync.Mutex
+		var order []string
+		record := func(event string) {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, event)
+		}
+
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionUpdateHandler(func(_ context.Context, _ *api.SessionNotification) error {
+			record("update")
+			return nil
+		})
+		clientHandler.RegisterSessionRequestPermissionHandler(
+			func(_ context.Context, _ *api.RequestPermissionRequest) (*api.RequestPermissionResponse, error) {
+				record("permission")
+				return &api.RequestPermissionResponse{Outcome: NewPermissionSelectedOutcome("allow")}, nil
+			},
+		)
+
+		_, clientConn := newCoalescingPair(t, held, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			require.NoError(t, turn.SendText("about to ask"))
+			_, err := turn.RequestPermission(
+				NewToolCallUpdate("call").Build(),
+				[]api.PermissionOption{{Kind: api.PermissionOptionKindAllowOnce, Name: "Allow", OptionId: "allow"}},
+			)
+			require.NoError(t, err)
+			return api.StopReasonEndTurn, nil
+		}, clientHandler)
+
+		_, err := clientConn.SessionPrompt(ctx, SamplePromptRequest("s1"))
+		require.NoError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{"update", "permission"}, order)
+	})
+
+	t.Run("WindowElapses", func(t *testing.T) {
+		received := make(chan *api.SessionNotification, 10)
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionUpdateHandler(func(_ context.Context, params *api.SessionNotification) error {
+			received <- params
+			return nil
+		})
+
+		agentConn, _ := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+		agentConn.EnableCoalescing(CoalesceOptions{Window: 10 * time.Millisecond})
+
+		update := api.NewSessionUpdateAgentMessageChunk(textChunk("hel"))
+		require.NoError(t, agentConn.SendSessionUpdate(ctx, &api.SessionNotification{SessionId: "s1", Update: update}))
+		require.NoError(t, agentConn.SendSessionUpdate(ctx, &api.SessionNotification{
+			SessionId: "s1",
+			Update:    api.NewSessionUpdateAgentMessageChunk(textChunk("lo")),
+		}))
+		// The caller's update is not modified by merging.
+		assert.Equal(t, "hel", update.AgentMessageChunk.Content.Text.Text)
+
+		select {
+		case notification := <-received:
+			decoded, err := DecodeSessionUpdate(notification)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", decoded.AgentMessageChunk.Content.Text.Text)
+		case <-time.After(time.Second):
+			t.Fatal("held update was not sent after the window elapsed")
+		}
+		require.NoError(t, agentConn.FlushUpdates())
+	})
+
+	t.Run("DisableFlushes", func(t *testing.T) {
+		received := make(chan *api.SessionNotification, 10)
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionUpdateHandler(func(_ context.Context, params *api.SessionNotification) error {
+			received <- params
+			return nil
+		})
+
+		agentConn, _ := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+		agentConn.EnableCoalescing(held)
+
+		for _, sessionID := range []api.SessionId{"s1", "s2"} {
+			require.NoError(t, agentConn.SendSessionUpdate(ctx, &api.SessionNotification{
+				SessionId: sessionID,
+				Update:    api.NewSessionUpdateAgentThoughtChunk(textChunk("thinking")),
+			}))
+		}
+		require.NoError(t, agentConn.DisableCoalescing())
+
+		sessions := map[api.SessionId]bool{}
+		for range 2 {
+			select {
+			case notification := <-received:
+				sessions[notification.SessionId] = true
+			case <-time.After(time.Second):
+				t.Fatal("held updates were not sent")
+			}
+		}
+		assert.Len(t, sessions, 2)
+	})
+	t.Run("ReportsBackgroundErrorsPerSession", func(t *testing.T) {
+		errSend := errors.New("send failed")
+		coalescer := newUpdateCoalescer(held, func(_ context.Context, params *api.SessionNotification) error {
+			if params.SessionId == "s1" {
+				return errSend
+			}
+			return nil
+		})
+		for _, sessionID := range []api.SessionId{"s1", "s2"} {
+			require.NoError(t, coalescer.send(ctx, &api.SessionNotification{
+				SessionId: sessionID,
+				Update:    api.NewSessionUpdateAgentMessageChunk(textChunk("text")),
+			}))
+		}
+
+		// Flushing before a request does not fail the request.
+		coalescer.flushBackground()
+		require.NoError(t, coalescer.flushSession("s2"))
+		require.ErrorIs(t, coalescer.flushSession("s1"), errSend)
+		require.NoError(t, coalescer.flushSession("s1"))
+
+		require.NoError(t, coalescer.send(ctx, &api.SessionNotification{
+			SessionId: "s1",
+			Update:    api.NewSessionUpdateAgentMessageChunk(textChunk("text")),
+		}))
+		coalescer.flushBackground()
+		require.ErrorIs(t, coalescer.flush(), errSend)
+		require.NoError(t, coalescer.flush())
+	})
+}
@@ -0,0 +1,352 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// SessionUpdateTypeAvailableCommandsUpdate is the session update that
+// replaces the commands available in a session. The schema the api package
+// is generated from predates it, so DecodeSessionUpdate reports it as
+// unsupported; ClientConnection tracks it for AvailableCommands.
+const SessionUpdateTypeAvailableCommandsUpdate api.SessionUpdateType = "available_commands_update"
+
+// availableCommandsUpdate is the body of an available_commands_update
+// session update.
+type availableCommandsUpdate struct {
+	Type              api.SessionUpdateType  `json:"sessionUpdate"`
+	AvailableCommands []api.AvailableCommand `json:"availableCommands"`
+}
+
+// Command is a slash command parsed from a prompt.
+type Command struct {
+	// Name is the command name, without the leading slash.
+	Name string
+	// Input is the text typed after the command name, with surrounding
+	// whitespace removed.
+	Input string
+}
+
+// CommandHandler runs a slash command as a prompt turn. params is the full
+// prompt, including any content blocks after the command text.
+type CommandHandler func(turn *TurnContext, command Command, params *api.PromptRequest) (api.StopReason, error)
+
+// ParseCommand parses a slash command of the form "/name input" from the
+// first content block of a prompt, which must be text. It does not check
+// whether the command exists.
+func ParseCommand(params *api.PromptRequest) (Command, bool) {
+	if len(params.Prompt) == 0 {
+		return Command{}, false
+	}
+	var block api.ContentBlock
+	switch v := params.Prompt[0].(type) {
+	case string:
+		block = NewTextContent(v)
+	default:
+		if err := remarshal(v, &block); err != nil {
+			return Command{}, false
+		}
+	}
+	if block.Type != api.ContentBlockTypeText || block.Text == nil {
+		return Command{}, false
+	}
+
+	text, found := strings.CutPrefix(strings.TrimLeftFunc(block.Text.Text, unicode.IsSpace), "/")
+	if !found {
+		return Command{}, false
+	}
+	name, input := text, ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		name, input = text[:i], strings.TrimSpace(text[i:])
+	}
+	if name == "" {
+		return Command{}, false
+	}
+	return Command{Name: name, Input: input}, true
+}
+
+// CommandRegistry advertises slash commands to clients and dispatches
+// prompts that invoke them.
+//
+// Commands are advertised in session/new responses whose handler did not set
+// AvailableCommands, and are sent to sessions loaded with session/load. After
+// changing the commands mid-session, call Publish to update the clients.
+// Prompts are dispatched by the PromptTurnHandler returned by Wrap.
+//
+// The registry tracks the connection's sessions for Publish until the
+// connection closes, or until they are removed from a SessionManager bound
+// with BindSessionManager.
+type CommandRegistry struct {
+	conn     *AgentConnection
+	sessions *util.SyncMap[api.SessionId, struct{}]
+
+	mu       sync.RWMutex
+	commands []registeredCommand
+}
+
+// registeredCommand is a command and its handler.
+type registeredCommand struct {
+	command api.AvailableCommand
+	handler CommandHandler
+}
+
+// NewCommandRegistry creates a command registry bound to the connection. It
+// should be created before the connection starts serving requests.
+func NewCommandRegistry(conn *AgentConnection) *CommandRegistry {
+	r := &CommandRegistry{
+		conn:     conn,
+		sessions: util.NewSyncMap[api.SessionId, struct{}](),
+	}
+	conn.core.intercept(r.intercept)
+	conn.core.onClose(r.sessions.Clear)
+	return r
+}
+
+// BindSessionManager stops publishing to sessions once they are removed from
+// the manager, whether they were deleted, reaped or detached because their
+// connection closed.
+func (r *CommandRegistry) BindSessionManager(manager *SessionManager) {
+	manager.onDelete(func(session *SessionState, _ SessionDeleteReason) {
+		r.sessions.Delete(session.ID)
+	})
+}
+
+// Add adds a command that takes no input, replacing any command with the same
+// name. It panics if name is empty or contains a slash or whitespace.
+func (r *CommandRegistry) Add(name, description string, handler CommandHandler) {
+	r.add(api.AvailableCommand{Name: name, Description: description}, handler)
+}
+
+// AddWithInput adds a command whose input is described by hint, replacing any
+// command with the same name. It panics if name is empty or contains a slash
+// or whitespace.
+func (r *CommandRegistry) AddWithInput(name, description, hint string, handler CommandHandler) {
+	r.add(api.AvailableCommand{
+		Name:        name,
+		Description: description,
+		Input:       api.AvailableCommandInput{Hint: hint},
+	}, handler)
+}
+
+// add adds or replaces a command, keeping the position of a replaced one.
+func (r *CommandRegistry) add(command api.AvailableCommand, handler CommandHandler) {
+	if command.Name == "" || strings.ContainsFunc(command.Name, func(c rune) bool {
+		return c == '/' || unicode.IsSpace(c)
+	}) {
+		panic(fmt.Sprintf("acp: invalid command name %q", command.Name))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.commands {
+		if r.commands[i].command.Name == command.Name {
+			r.commands[i] = registeredCommand{command: command, handler: handler}
+			return
+		}
+	}
+	r.commands = append(r.commands, registeredCommand{command: command, handler: handler})
+}
+
+// Remove removes a command and reports whether it existed.
+func (r *CommandRegistry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.commands {
+		if r.commands[i].command.Name == name {
+			r.commands = append(r.commands[:i], r.commands[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AvailableCommands returns the commands in the order they were added.
+func (r *CommandRegistry) AvailableCommands() []api.AvailableCommand {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	commands := make([]api.AvailableCommand, len(r.commands))
+	for i, registered := range r.commands {
+		commands[i] = registered.command
+	}
+	return commands
+}
+
+// Lookup parses a prompt and returns the command it invokes, if the command
+// exists.
+func (r *CommandRegistry) Lookup(params *api.PromptRequest) (Command, CommandHandler, bool) {
+	command, ok := ParseCommand(params)
+	if !ok {
+		return Command{}, nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, registered := range r.commands {
+		if registered.command.Name == command.Name {
+			return command, registered.handler, true
+		}
+	}
+	return Command{}, nil, false
+}
+
+// Wrap returns a PromptTurnHandler that runs prompts invoking a command with
+// the command's handler and passes every other prompt, including unknown
+// commands, to next.
+func (r *CommandRegistry) Wrap(next PromptTurnHandler) PromptTurnHandler {
+	return func(turn *TurnContext, params *api.PromptRequest) (api.StopReason, error) {
+		if command, handler, ok := r.Lookup(params); ok {
+			return handler(turn, command, params)
+		}
+		return next(turn, params)
+	}
+}
+
+// Publish sends the current commands to the given sessions, or to every
+// session created or loaded on the connection if none are given.
+func (r *CommandRegistry) Publish(ctx context.Context, sessionIDs ...api.SessionId) error {
+	if len(sessionIDs) == 0 {
+		for id := range r.sessions.GetAll() {
+			sessionIDs = append(sessionIDs, id)
+		}
+	}
+	var errs []error
+	for _, id := range sessionIDs {
+		errs = append(errs, r.publish(ctx, id))
+	}
+	return errors.Join(errs...)
+}
+
+// publish sends the current commands to one session.
+func (r *CommandRegistry) publish(ctx context.Context, sessionID api.SessionId) error {
+	return r.conn.SendSessionUpdate(ctx, &api.SessionNotification{
+		SessionId: sessionID,
+		Update: availableCommandsUpdate{
+			Type:              SessionUpdateTypeAvailableCommandsUpdate,
+			AvailableCommands: r.AvailableCommands(),
+		},
+	})
+}
+
+// intercept advertises the commands to sessions after session/new or
+// session/load succeeds.
+func (r *CommandRegistry) intercept(
+	ctx context.Context,
+	req *jsonrpc2.Request,
+	next dispatchFunc,
+) (interface{}, error) {
+	if req.Method != api.MethodSessionNew && req.Method != api.MethodSessionLoad {
+		return next(ctx, req)
+	}
+
+	result, err := next(ctx, req)
+	if err != nil {
+		return result, err
+	}
+
+	if req.Method == api.MethodSessionLoad {
+		var params api.LoadSessionRequest
+		if decodeErr := json.Unmarshal(req.Params, &params); decodeErr == nil && params.SessionId != "" {
+			r.sessions.Store(params.SessionId, struct{}{})
+			_ = r.publish(ctx, params.SessionId)
+		}
+		return result, nil
+	}
+
+	var response api.NewSessionResponse
+	if decodeErr := remarshal(result, &response); decodeErr != nil || response.SessionId == "" {
+		return result, nil
+	}
+	r.sessions.Store(response.SessionId, struct{}{})
+	commands := r.AvailableCommands()
+	if len(response.AvailableCommands) > 0 || len(commands) == 0 {
+		return result, nil
+	}
+	return withAvailableCommands(result, commands), nil
+}
+
+// withAvailableCommands returns a session/new result with availableCommands
+// set. Only that field is changed, so fields the api package does not model,
+// such as _meta, are kept.
+func withAvailableCommands(result interface{}, commands []api.AvailableCommand) interface{} {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return result
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return result
+	}
+	if fields["availableCommands"], err = json.Marshal(commands); err != nil {
+		return result
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return result
+	}
+	return json.RawMessage(data)
+}
+
+// Client-side command helpers.
+
+// CompleteCommands returns the commands whose name starts with the command
+// name being typed in text, in their advertised order. The leading slash is
+// optional. Once the name is followed by whitespace, text is no longer a
+// prefix and nothing is returned.
+func CompleteCommands(commands []api.AvailableCommand, text string) []api.AvailableCommand {
+	prefix := strings.TrimPrefix(strings.TrimLeftFunc(text, unicode.IsSpace), "/")
+	if strings.ContainsFunc(prefix, unicode.IsSpace) {
+		return nil
+	}
+	var matches []api.AvailableCommand
+	for _, command := range commands {
+		if strings.HasPrefix(command.Name, prefix) {
+			matches = append(matches, command)
+		}
+	}
+	return matches
+}
+
+// AvailableCommands returns the commands the agent advertised for a session,
+// from its session/new response and later available_commands_update
+// session updates.
+func (c *ClientConnection) AvailableCommands(sessionID api.SessionId) []api.AvailableCommand {
+	commands, _ := c.sessionCommands.Load(sessionID)
+	return append([]api.AvailableCommand(nil), commands...)
+}
+
+// CompleteCommand returns the session's commands that complete text. See
+// CompleteCommands.
+func (c *ClientConnection) CompleteCommand(sessionID api.SessionId, text string) []api.AvailableCommand {
+	commands, _ := c.sessionCommands.Load(sessionID)
+	return CompleteCommands(commands, text)
+}
+
+// trackCommandsUpdate is a dispatch interceptor that records the commands of
+// available_commands_update session updates. The update is still passed to
+// the session/update handler.
+func (c *ClientConnection) trackCommandsUpdate(
+	ctx context.Context,
+	req *jsonrpc2.Request,
+	next dispatchFunc,
+) (interface{}, error) {
+	if req.IsCall() || req.Method != api.MethodSessionUpdate {
+		return next(ctx, req)
+	}
+
+	var notification struct {
+		SessionId api.SessionId           `json:"sessionId"`
+		Update    availableCommandsUpdate `json:"update"`
+	}
+	if err := json.Unmarshal(req.Params, &notification); err == nil &&
+		notification.Update.Type == SessionUpdateTypeAvailableCommandsUpdate {
+		c.sessionCommands.Store(notification.SessionId, notification.Update.AvailableCommands)
+	}
+	return next(ctx, req)
+}
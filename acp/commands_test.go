@@ -0,0 +1,258 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// textPrompt returns a prompt request with a single text block.
+func textPrompt(sessionID api.SessionId, text string) *api.PromptRequest {
+	return &api.PromptRequest{
+		SessionId: sessionID,
+		Prompt:    []api.PromptRequestPromptElem{NewTextContent(text)},
+	}
+}
+
+// newCommandPair creates a connection pair whose agent dispatches prompts
+// through a CommandRegistry and answers other prompts with "plain".
+func newCommandPair(t *testing.T) (*AgentConnection, *ClientConnection, *CommandRegistry) {
+	t.Helper()
+
+	var registry *CommandRegistry
+	agentHandler := NewAgentHandlerRegistry()
+	agentHandler.RegisterSessionNewHandler(
+		func(_ context.Context, _ *api.NewSessionRequest) (*api.NewSessionResponse, error) {
+			return &api.NewSessionResponse{SessionId: "s1"}, nil
+		},
+	)
+	agentHandler.RegisterSessionLoadHandler(func(_ context.Context, _ *api.LoadSessionRequest) error {
+		return nil
+	})
+	agentHandler.RegisterPromptTurnHandler(func(turn *TurnContext, params *api.PromptRequest) (api.StopReason, error) {
+		return registry.Wrap(func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			return api.StopReasonEndTurn, turn.SendText("plain")
+		})(turn, params)
+	})
+	agentConn, clientConn := NewRolePair(t, agentHandler, NewClientHandlerRegistry())
+	registry = NewCommandRegistry(agentConn)
+	return agentConn, clientConn, registry
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		prompt *api.PromptRequest
+		want   Command
+		wantOK bool
+	}{
+		{"NameOnly", textPrompt("s1", "/plan"), Command{Name: "plan"}, true},
+		{
+			"WithInput",
+			textPrompt("s1", "  /research  the  codebase \n"),
+			Command{Name: "research", Input: "the  codebase"},
+			true,
+		},
+		{"NewlineAfterName", textPrompt("s1", "/fix\nthe bug"), Command{Name: "fix", Input: "the bug"}, true},
+		{"NoSlash", textPrompt("s1", "plan this"), Command{}, false},
+		{"SlashOnly", textPrompt("s1", "/ plan"), Command{}, false},
+		{"Empty", &api.PromptRequest{SessionId: "s1"}, Command{}, false},
+		{"NotText", &api.PromptRequest{
+			SessionId: "s1",
+			Prompt:    []api.PromptRequestPromptElem{NewResourceLink("file:///plan", "plan")},
+		}, Command{}, false},
+		{"DecodedMap", &api.PromptRequest{
+			SessionId: "s1",
+			Prompt:    []api.PromptRequestPromptElem{map[string]interface{}{"type": "text", "text": "/plan now"}},
+		}, Command{Name: "plan", Input: "now"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseCommand(tt.prompt)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCommandRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("AdvertisesCommandsInSessionResponse", func(t *testing.T) {
+		_, clientConn, registry := newCommandPair(t)
+		registry.Add("plan", "Create a plan", nil)
+		registry.AddWithInput("research", "Research the codebase", "topic to research", nil)
+
+		response, err := clientConn.SessionNew(ctx, &api.NewSessionRequest{Cwd: "/tmp", McpServers: []api.McpServer{}})
+		require.NoError(t, err)
+		require.Len(t, response.AvailableCommands, 2)
+		assert.Equal(t, "plan", response.AvailableCommands[0].Name)
+		assert.Nil(t, response.AvailableCommands[0].Input)
+		assert.Equal(t, "research", response.AvailableCommands[1].Name)
+		assert.Equal(t, map[string]interface{}{"hint": "topic to research"}, response.AvailableCommands[1].Input)
+
+		assert.Equal(t, response.AvailableCommands, clientConn.AvailableCommands("s1"))
+		completions := clientConn.CompleteCommand("s1", "/re")
+		require.Len(t, completions, 1)
+		assert.Equal(t, "research", completions[0].Name)
+	})
+
+	t.Run("DispatchesCommands", func(t *testing.T) {
+		_, clientConn, registry := newCommandPair(t)
+		commands := make(chan Command, 1)
+		registry.AddWithInput("research", "Research the codebase", "topic",
+			func(turn *TurnContext, command Command, _ *api.PromptRequest) (api.StopReason, error) {
+				commands <- command
+				return api.StopReasonEndTurn, turn.SendText("researching")
+			},
+		)
+
+		response, err := clientConn.SessionPrompt(ctx, textPrompt("s1", "/research error handling"))
+		require.NoError(t, err)
+		assert.Equal(t, string(api.StopReasonEndTurn), response.StopReason)
+		assert.Equal(t, Command{Name: "research", Input: "error handling"}, <-commands)
+
+		// Unknown commands and plain text go to the wrapped handler.
+		var events []PromptEvent
+		for event := range clientConn.PromptStream(ctx, textPrompt("s1", "/unknown command")) {
+			events = append(events, event)
+		}
+		require.Len(t, events, 2)
+		assert.Equal(t, "plain", events[0].Update.AgentMessageChunk.Content.Text.Text)
+	})
+
+	t.Run("ReplacesAndRemovesCommands", func(t *testing.T) {
+		_, _, registry := newCommandPair(t)
+		registry.Add("plan", "Create a plan", nil)
+		registry.Add("test", "Run the tests", nil)
+		registry.Add("plan", "Create a detailed plan", nil)
+
+		commands := registry.AvailableCommands()
+		require.Len(t, commands, 2)
+		assert.Equal(t, "Create a detailed plan", commands[0].Description)
+
+		assert.True(t, registry.Remove("plan"))
+		assert.False(t, registry.Remove("plan"))
+		assert.Len(t, registry.AvailableCommands(), 1)
+
+		assert.Panics(t, func() { registry.Add("", "Empty", nil) })
+		assert.Panics(t, func() { registry.Add("/plan", "Slash", nil) })
+		assert.Panics(t, func() { registry.Add("make plan", "Space", nil) })
+	})
+
+	t.Run("PublishesUpdatesMidSession", func(t *testing.T) {
+		_, clientConn, registry := newCommandPair(t)
+		registry.Add("plan", "Create a plan", nil)
+
+		_, err := clientConn.SessionNew(ctx, &api.NewSessionRequest{Cwd: "/tmp", McpServers: []api.McpServer{}})
+		require.NoError(t, err)
+
+		registry.Add("test", "Run the tests", nil)
+		require.NoError(t, registry.Publish(ctx))
+		WaitWithTimeout(t, 5*time.Second, func() bool {
+			return len(clientConn.AvailableCommands("s1")) == 2
+		}, "command update not received")
+
+		// Loaded sessions receive the commands as an update.
+		err = clientConn.SessionLoad(ctx, &api.LoadSessionRequest{
+			SessionId: "s2", Cwd: "/tmp", McpServers: []api.McpServer{},
+		})
+		require.NoError(t, err)
+		WaitWithTimeout(t, 5*time.Second, func() bool {
+			return len(clientConn.AvailableCommands("s2")) == 2
+		}, "command update not received")
+	})
+
+	t.Run("KeepsUnmodeledResponseFields", func(t *testing.T) {
+		_, _, registry := newCommandPair(t)
+		req, err := jsonrpc2.NewCall(jsonrpc2.Int64ID(1), api.MethodSessionNew, map[string]string{"cwd": "/tmp"})
+		require.NoError(t, err)
+		respond := func(result interface{}) dispatchFunc {
+			return func(context.Context, *jsonrpc2.Request) (interface{}, error) {
+				return result, nil
+			}
+		}
+
+		// Without commands, or with commands set by the handler, the result
+		// is returned as is.
+		handled := map[string]interface{}{"sessionId": "s1", "_meta": map[string]interface{}{"trace": "abc"}}
+		result, err := registry.intercept(ctx, req, respond(handled))
+		require.NoError(t, err)
+		assert.Equal(t, handled, result)
+
+		registry.Add("plan", "Create a plan", nil)
+		result, err = registry.intercept(ctx, req, respond(handled))
+		require.NoError(t, err)
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"sessionId": "s1",
+			"_meta": {"trace": "abc"},
+			"availableCommands": [{"name": "plan", "description": "Create a plan"}]
+		}`, string(data))
+
+		own := &api.NewSessionResponse{SessionId: "s1", AvailableCommands: []api.AvailableCommand{{Name: "own"}}}
+		result, err = registry.intercept(ctx, req, respond(own))
+		require.NoError(t, err)
+		assert.Same(t, own, result)
+	})
+
+	t.Run("ForgetsEndedSessions", func(t *testing.T) {
+		agentConn, clientConn, registry := newCommandPair(t)
+		manager := NewSessionManager()
+		agentConn.BindSessionManager(manager)
+		registry.BindSessionManager(manager)
+		registry.Add("plan", "Create a plan", nil)
+
+		_, err := clientConn.SessionNew(ctx, &api.NewSessionRequest{Cwd: "/tmp", McpServers: []api.McpServer{}})
+		require.NoError(t, err)
+		_, tracked := registry.sessions.Load("s1")
+		require.True(t, tracked)
+		require.Len(t, clientConn.AvailableCommands("s1"), 1)
+
+		require.NoError(t, manager.DeleteSession("s1"))
+		require.Eventually(t, func() bool {
+			_, tracked = registry.sessions.Load("s1")
+			return !tracked
+		}, 5*time.Second, 10*time.Millisecond)
+
+		clientConn.ForgetSession("s1")
+		assert.Empty(t, clientConn.AvailableCommands("s1"))
+	})
+
+	t.Run("UpdateIsUnsupportedByDecodeSessionUpdate", func(t *testing.T) {
+		_, err := DecodeSessionUpdate(&api.SessionNotification{
+			SessionId: "s1",
+			Update:    availableCommandsUpdate{Type: SessionUpdateTypeAvailableCommandsUpdate},
+		})
+		require.True(t, errors.Is(err, ErrUnsupportedSessionUpdate))
+	})
+}
+
+func TestCompleteCommands(t *testing.T) {
+	commands := []api.AvailableCommand{
+		{Name: "plan", Description: "Create a plan"},
+		{Name: "pr", Description: "Open a pull request"},
+		{Name: "test", Description: "Run the tests"},
+	}
+	names := func(matches []api.AvailableCommand) []string {
+		var result []string
+		for _, command := range matches {
+			result = append(result, command.Name)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"plan", "pr"}, names(CompleteCommands(commands, "/p")))
+	assert.Equal(t, []string{"plan"}, names(CompleteCommands(commands, "pl")))
+	assert.Equal(t, []string{"plan", "pr", "test"}, names(CompleteCommands(commands, "/")))
+	assert.Empty(t, CompleteCommands(commands, "/x"))
+	assert.Empty(t, CompleteCommands(commands, "/plan now"))
+}
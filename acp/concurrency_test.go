@@ -44,7 +44,7 @@ func (s *ConcurrencyTestSuite) TestConcurrentInitialization() {
 			defer wg.Done()
 
 			request := SampleInitializeRequest()
-			result, err := s.pair.AgentConn.Initialize(ctx, request)
+			result, err := s.pair.ClientConn.Initialize(ctx, request)
 			if err != nil {
 				errors <- err
 			} else {
@@ -97,7 +97,7 @@ func (s *ConcurrencyTestSuite) TestConcurrentSessionOperations() {
 			// Make each session unique by modifying the cwd.
 			request.Cwd = request.Cwd + "/" + string(rune('0'+sessionNum))
 
-			result, err := s.pair.AgentConn.SessionNew(ctx, request)
+			result, err := s.pair.ClientConn.SessionNew(ctx, request)
 			if err != nil {
 				errors <- err
 			} else {
@@ -177,7 +177,7 @@ func (s *ConcurrencyTestSuite) TestConcurrentFileOperations() {
 			}
 
 			request := SampleReadTextFileRequest("session-1", filePath)
-			result, err := s.pair.ClientConn.FsReadTextFile(ctx, request)
+			result, err := s.pair.AgentConn.FsReadTextFile(ctx, request)
 			if err != nil {
 				readErrors <- err
 			} else {
@@ -221,7 +221,7 @@ func (s *ConcurrencyTestSuite) TestConcurrentFileOperations() {
 			content := "Concurrent write content " + string(rune('0'+writeNum))
 
 			request := SampleWriteTextFileRequest("session-1", filePath, content)
-			err := s.pair.ClientConn.FsWriteTextFile(ctx, request)
+			err := s.pair.AgentConn.FsWriteTextFile(ctx, request)
 			if err != nil {
 				writeErrors <- err
 			}
@@ -307,7 +307,7 @@ func (s *ConcurrencyTestSuite) TestConcurrentNotifications() {
 			cancelRequest := &api.CancelNotification{
 				SessionId: sessionResponse.SessionId,
 			}
-			err := s.pair.AgentConn.SessionCancel(ctx, cancelRequest)
+			err := s.pair.ClientConn.SessionCancel(ctx, cancelRequest)
 			if err != nil {
 				notificationErrors <- err
 			}
@@ -357,7 +357,7 @@ func (s *ConcurrencyTestSuite) TestConcurrentErrorHandling() {
 			defer wg.Done()
 
 			request := SampleReadTextFileRequest("session-1", "/error/file_"+string(rune('0'+reqNum))+".txt")
-			_, err := s.pair.ClientConn.FsReadTextFile(ctx, request)
+			_, err := s.pair.AgentConn.FsReadTextFile(ctx, request)
 			errorResults <- err
 		}(i)
 	}
@@ -397,7 +397,7 @@ func (s *ConcurrencyTestSuite) TestConcurrentConnectionManagement() {
 
 			// Test basic operation on each connection.
 			request := SampleInitializeRequest()
-			result, err := pair.AgentConn.Initialize(ctx, request)
+			result, err := pair.ClientConn.Initialize(ctx, request)
 			if err != nil {
 				connectionErrors <- err
 			} else {
@@ -432,7 +432,7 @@ func (s *ConcurrencyTestSuite) TestConcurrentConnectionManagement() {
 
 func (s *ConcurrencyTestSuite) initializeConnection(ctx context.Context) *api.InitializeResponse {
 	request := SampleInitializeRequest()
-	response, err := s.pair.AgentConn.Initialize(ctx, request)
+	response, err := s.pair.ClientConn.Initialize(ctx, request)
 	s.Require().NoError(err)
 	s.Require().NotNil(response)
 	return response
@@ -440,7 +440,7 @@ func (s *ConcurrencyTestSuite) initializeConnection(ctx context.Context) *api.In
 
 func (s *ConcurrencyTestSuite) createSession(ctx context.Context) *api.NewSessionResponse {
 	request := SampleNewSessionRequest()
-	response, err := s.pair.AgentConn.SessionNew(ctx, request)
+	response, err := s.pair.ClientConn.SessionNew(ctx, request)
 	s.Require().NoError(err)
 	s.Require().NotNil(response)
 	return response
@@ -457,7 +457,7 @@ func (s *ConcurrencyTestSuite) executeMixedOperation(
 		// Session operation.
 		request := SampleNewSessionRequest()
 		request.Cwd = "/mixed/" + string(rune('0'+opNum))
-		result, err := s.pair.AgentConn.SessionNew(ctx, request)
+		result, err := s.pair.ClientConn.SessionNew(ctx, request)
 		if err != nil {
 			operationErrors <- err
 		} else {
@@ -468,7 +468,7 @@ func (s *ConcurrencyTestSuite) executeMixedOperation(
 		// File read operation.
 		s.pair.TestClient.AddFileContent("/mixed/file_"+string(rune('0'+opNum))+".txt", "mixed content")
 		request := SampleReadTextFileRequest("session-1", "/mixed/file_"+string(rune('0'+opNum))+".txt")
-		result, err := s.pair.ClientConn.FsReadTextFile(ctx, request)
+		result, err := s.pair.AgentConn.FsReadTextFile(ctx, request)
 		if err != nil {
 			operationErrors <- err
 		} else {
@@ -482,7 +482,7 @@ func (s *ConcurrencyTestSuite) executeMixedOperation(
 			"/mixed/output_"+string(rune('0'+opNum))+".txt",
 			"mixed output",
 		)
-		err := s.pair.ClientConn.FsWriteTextFile(ctx, request)
+		err := s.pair.AgentConn.FsWriteTextFile(ctx, request)
 		if err != nil {
 			operationErrors <- err
 		} else {
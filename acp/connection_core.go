@@ -53,14 +53,56 @@ type ConnectionCore struct {
 	callQueue chan *queuedCall
 	closeOnce sync.Once
 	closed    chan struct{}
+
+	// Dispatch interceptors and close hooks used by opt-in integrations
+	interceptors  *util.CallbackRegistry[dispatchInterceptor]
+	closeHooks    *util.CallbackRegistry[func()]
+	closeHookOnce sync.Once
+
+	// Ordering of incoming messages relative to responses
+	incoming *deliveryBarrier
 }
 
-// NewConnectionCore creates a new connection core.
+// dispatchFunc handles a single incoming request or notification.
+type dispatchFunc func(ctx context.Context, req *jsonrpc2.Request) (interface{}, error)
+
+// serveFunc serves an incoming request or notification for the role of the
+// connection, ending with handle.
+type serveFunc func(
+	ctx context.Context,
+	conn *jsonrpc2.Connection,
+	req *jsonrpc2.Request,
+	handle dispatchFunc,
+) (interface{}, error)
+
+// dispatchInterceptor wraps the dispatch of an incoming request. It must call
+// next to continue the chain.
+type dispatchInterceptor func(ctx context.Context, req *jsonrpc2.Request, next dispatchFunc) (interface{}, error)
+
+// NewConnectionCore creates a new connection core that passes incoming
+// requests and notifications to handler.
 func NewConnectionCore(
 	ctx context.Context,
 	rwc io.ReadWriteCloser,
 	handler Handler,
 	timeout time.Duration,
+) (*ConnectionCore, error) {
+	return newConnectionCore(ctx, rwc, handler, timeout, func(core *ConnectionCore) serveFunc {
+		return func(ctx context.Context, _ *jsonrpc2.Connection, req *jsonrpc2.Request, handle dispatchFunc) (interface{}, error) {
+			return core.dispatch(ctx, req, handle)
+		}
+	})
+}
+
+// newConnectionCore creates a connection core for a connection role. bind is
+// called with the core before the connection starts reading and returns the
+// function that serves incoming requests and notifications.
+func newConnectionCore(
+	ctx context.Context,
+	rwc io.ReadWriteCloser,
+	handler Handler,
+	timeout time.Duration,
+	bind func(core *ConnectionCore) serveFunc,
 ) (*ConnectionCore, error) {
 	core := &ConnectionCore{
 		state:          util.NewAtomicValue(StateUninitialized),
@@ -68,11 +110,15 @@ func NewConnectionCore(
 		requestTimeout: timeout,
 		callQueue:      make(chan *queuedCall, defaultCallQueueSize),
 		closed:         make(chan struct{}),
+		interceptors:   util.NewCallbackRegistry[dispatchInterceptor](),
+		closeHooks:     util.NewCallbackRegistry[func()](),
+		incoming:       newDeliveryBarrier(ctx),
 	}
 
 	b := &binder{
 		handler: handler,
 		core:    core,
+		serve:   bind(core),
 	}
 
 	// Create the connection using our custom dialer.
@@ -86,9 +132,73 @@ func NewConnectionCore(
 	// Start the call queue processor
 	go core.processCallQueue(ctx)
 
+	// Run close hooks when the peer goes away, not only on an explicit Close
+	go func() {
+		_ = conn.Wait()
+		core.closeOnce.Do(func() {
+			close(core.closed)
+		})
+		core.runCloseHooks()
+	}()
+
 	return core, nil
 }
 
+// dispatch runs an incoming request through the registered interceptors,
+// ending with final.
+func (c *ConnectionCore) dispatch(ctx context.Context, req *jsonrpc2.Request, final dispatchFunc) (interface{}, error) {
+	interceptors := c.interceptors.GetAll()
+	next := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func(ctx context.Context, req *jsonrpc2.Request) (interface{}, error) {
+			return interceptor(ctx, req, inner)
+		}
+	}
+	return next(ctx, req)
+}
+
+// dispatchAsync dispatches a request in the background and responds when it
+// completes, so a long-running handler does not hold up other messages.
+func (c *ConnectionCore) dispatchAsync(
+	ctx context.Context,
+	conn *jsonrpc2.Connection,
+	req *jsonrpc2.Request,
+	final dispatchFunc,
+) (interface{}, error) {
+	go func() {
+		result, err := c.dispatch(ctx, req, final)
+		_ = conn.Respond(req.ID, result, err)
+	}()
+	return nil, jsonrpc2.ErrAsyncResponse
+}
+
+// intercept registers an interceptor for incoming requests and notifications.
+func (c *ConnectionCore) intercept(interceptor dispatchInterceptor) {
+	c.interceptors.Register(interceptor)
+}
+
+// onClose registers a hook that runs once when the connection closes.
+func (c *ConnectionCore) onClose(hook func()) {
+	c.closeHooks.Register(hook)
+}
+
+// runCloseHooks runs the registered close hooks exactly once.
+func (c *ConnectionCore) runCloseHooks() {
+	c.closeHookOnce.Do(func() {
+		for _, hook := range c.closeHooks.GetAll() {
+			hook()
+		}
+	})
+}
+
+// waitIncoming blocks until every request and notification read so far has
+// been handled. Calling it after a response arrives guarantees that the
+// messages the peer sent before that response were delivered first.
+func (c *ConnectionCore) waitIncoming(ctx context.Context) error {
+	return c.incoming.wait(ctx, c.incoming.readCount(), c.closed)
+}
+
 // processCallQueue processes queued calls sequentially to avoid writer contention.
 func (c *ConnectionCore) processCallQueue(ctx context.Context) {
 	for {
@@ -129,6 +239,32 @@ func (c *ConnectionCore) callDirect(ctx context.Context, method string, params i
 	return result, nil
 }
 
+// callUntilDone makes a JSON-RPC call that may legitimately stay pending for
+// a long time, such as terminal/wait_for_exit. It bypasses the call queue, so
+// it never holds up other calls, and is bounded by ctx and the connection
+// closing rather than the request timeout.
+func (c *ConnectionCore) callUntilDone(ctx context.Context, method string, params, result any) error {
+	if c.conn == nil {
+		return ErrConnectionClosed
+	}
+
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closed:
+			cancel()
+		case <-callCtx.Done():
+		}
+	}()
+
+	err := c.conn.Call(callCtx, method, params).Await(callCtx, result)
+	if err != nil && ctx.Err() == nil && callCtx.Err() != nil {
+		return ErrConnectionClosed
+	}
+	return err
+}
+
 // Call makes a JSON-RPC call via the queue to prevent writer contention.
 func (c *ConnectionCore) Call(ctx context.Context, method string, params, result any) error {
 	if c.conn == nil {
@@ -198,7 +334,9 @@ func (c *ConnectionCore) Close() error {
 		close(c.closed)
 	})
 
-	return c.conn.Close()
+	err := c.conn.Close()
+	c.runCloseHooks()
+	return err
 }
 
 // Wait waits for the connection to close.
@@ -0,0 +1,97 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/internal/atomicfile"
+)
+
+const (
+	newFilePerm = 0o600
+	newDirPerm  = 0o750
+)
+
+var (
+	// ErrConflict is returned by Apply when the file on disk no longer
+	// matches the diff's old text.
+	ErrConflict = errors.New("file does not match the diff's old text")
+	// ErrOutsideRoot is returned by Apply when the diff's path is not inside
+	// the root it is applied to.
+	ErrOutsideRoot = errors.New("path is outside the root")
+)
+
+// Apply writes the diff's new text to disk. The diff's path must be absolute
+// and inside root, or an error wrapping ErrOutsideRoot is returned. The file
+// is accessed through os.Root, so symbolic links leading out of root fail too.
+//
+// The file must still contain the diff's old text, or not exist if the diff
+// creates a file; otherwise an error wrapping ErrConflict is returned and the
+// file is left unchanged. Applying a diff whose new text is already on disk
+// succeeds without writing. The new text is written to a temporary file that
+// is renamed over the target, so readers never see a partial write. Existing
+// files keep their permissions.
+func (d Diff) Apply(root string) error {
+	name, err := d.rootRelative(root)
+	if err != nil {
+		return err
+	}
+	dir, err := os.OpenRoot(root)
+	if err != nil {
+		return fmt.Errorf("failed to open root %s: %w", root, err)
+	}
+	defer dir.Close()
+
+	current, err := dir.ReadFile(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", d.Path, err)
+	}
+
+	switch {
+	case exists && string(current) == d.NewText:
+		return nil
+	case d.OldText == nil && exists:
+		return fmt.Errorf("%s already exists: %w", d.Path, ErrConflict)
+	case d.OldText != nil && !exists:
+		return fmt.Errorf("%s does not exist: %w", d.Path, ErrConflict)
+	case d.OldText != nil && string(current) != *d.OldText:
+		return fmt.Errorf("%s was modified: %w", d.Path, ErrConflict)
+	}
+
+	perm := fs.FileMode(newFilePerm)
+	if exists {
+		info, statErr := dir.Stat(name)
+		if statErr != nil {
+			return fmt.Errorf("failed to stat %s: %w", d.Path, statErr)
+		}
+		perm = info.Mode().Perm()
+	} else if err = dir.MkdirAll(filepath.Dir(name), newDirPerm); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", d.Path, err)
+	}
+
+	if err = atomicfile.WriteFileIn(dir, name, []byte(d.NewText), perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", d.Path, err)
+	}
+	return nil
+}
+
+// rootRelative returns the diff's path relative to root.
+func (d Diff) rootRelative(root string) (string, error) {
+	if !filepath.IsAbs(d.Path) {
+		return "", fmt.Errorf("%s is not absolute: %w", d.Path, ErrOutsideRoot)
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %s: %w", root, err)
+	}
+	name, err := filepath.Rel(abs, filepath.Clean(d.Path))
+	if err != nil || name == "." || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not inside %s: %w", d.Path, root, ErrOutsideRoot)
+	}
+	return name, nil
+}
@@ -0,0 +1,122 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+)
+
+// Diff is a whole-file change to a text file, as carried by diff tool call
+// content.
+type Diff struct {
+	// Path is the absolute path of the file.
+	Path string
+	// OldText is the original content, or nil if the file is new.
+	OldText *string
+	// NewText is the content after the change.
+	NewText string
+}
+
+// New creates a diff that changes an existing file from oldText to newText.
+func New(path, oldText, newText string) Diff {
+	return Diff{Path: path, OldText: &oldText, NewText: newText}
+}
+
+// NewFile creates a diff that creates a file with the given content.
+func NewFile(path, newText string) Diff {
+	return Diff{Path: path, NewText: newText}
+}
+
+// FileReader reads text files through the client. AgentConnection implements
+// it.
+type FileReader interface {
+	FsReadTextFile(ctx context.Context, params *api.ReadTextFileRequest) (*api.ReadTextFileResponse, error)
+}
+
+// Read creates a diff that changes the file at path to newText, reading the
+// current content through the client with fs/read_text_file. If the file does
+// not exist yet, the diff creates it.
+func Read(ctx context.Context, reader FileReader, sessionID api.SessionId, path, newText string) (Diff, error) {
+	resp, err := reader.FsReadTextFile(ctx, &api.ReadTextFileRequest{SessionId: sessionID, Path: path})
+	if isNotFound(err) {
+		return NewFile(path, newText), nil
+	}
+	if err != nil {
+		return Diff{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return New(path, resp.Content, newText), nil
+}
+
+// isNotFound reports whether err says the file does not exist. Errors
+// returned by the client arrive as JSON-RPC errors that keep only the
+// message of the ACP error, so the message is checked as well.
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	var acpErr *api.ACPError
+	if errors.As(err, &acpErr) {
+		return acpErr.Code == api.ErrorCodeNotFound
+	}
+	return strings.HasPrefix(err.Error(), fmt.Sprintf("ACP Error %d:", api.ErrorCodeNotFound))
+}
+
+// IsNewFile reports whether the diff creates a file.
+func (d Diff) IsNewFile() bool {
+	return d.OldText == nil
+}
+
+// Content returns the diff as tool call content.
+func (d Diff) Content() *api.ToolCallContent {
+	var oldText interface{}
+	if d.OldText != nil {
+		oldText = *d.OldText
+	}
+	return api.NewToolCallContentDiff(d.NewText, oldText, d.Path)
+}
+
+// FromContent extracts the diff from tool call content. Content decoded from
+// the wire, such as the elements of a tool call update, is accepted as well.
+func FromContent(content interface{}) (Diff, error) {
+	var toolCallContent *api.ToolCallContent
+	switch v := content.(type) {
+	case *api.ToolCallContent:
+		toolCallContent = v
+	case api.ToolCallContent:
+		toolCallContent = &v
+	default:
+		data, err := json.Marshal(content)
+		if err != nil {
+			return Diff{}, fmt.Errorf("failed to encode tool call content: %w", err)
+		}
+		toolCallContent = &api.ToolCallContent{}
+		if err = json.Unmarshal(data, toolCallContent); err != nil {
+			return Diff{}, fmt.Errorf("failed to decode tool call content: %w", err)
+		}
+	}
+
+	diff := toolCallContent.GetDiff()
+	if diff == nil {
+		return Diff{}, fmt.Errorf("tool call content of type %s is not a diff", toolCallContent.Type)
+	}
+
+	result := Diff{Path: diff.Path, NewText: diff.Newtext}
+	switch oldText := diff.Oldtext.(type) {
+	case nil:
+	case string:
+		result.OldText = &oldText
+	case *string:
+		result.OldText = oldText
+	default:
+		return Diff{}, fmt.Errorf("unsupported old text type %T", diff.Oldtext)
+	}
+	return result, nil
+}
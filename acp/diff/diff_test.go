@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReader serves fs/read_text_file requests from a map.
+type fakeReader map[string]string
+
+func (f fakeReader) FsReadTextFile(
+	_ context.Context,
+	params *api.ReadTextFileRequest,
+) (*api.ReadTextFileResponse, error) {
+	switch params.Path {
+	case "/src/locked.go":
+		return nil, errors.New("permission denied")
+	case "/src/remote.go":
+		// Errors from a real client arrive with only the ACP error's message.
+		return nil, errors.New("ACP Error -32004: file with ID '/src/remote.go' not found")
+	}
+	content, ok := f[params.Path]
+	if !ok {
+		return nil, api.NewACPError(api.ErrorCodeNotFound, "file not found", nil)
+	}
+	return &api.ReadTextFileResponse{Content: content}, nil
+}
+
+func TestRead(t *testing.T) {
+	ctx := context.Background()
+	reader := fakeReader{"/src/main.go": "package main\n"}
+
+	d, err := Read(ctx, reader, "s1", "/src/main.go", "package app\n")
+	require.NoError(t, err)
+	assert.False(t, d.IsNewFile())
+	assert.Equal(t, "package main\n", *d.OldText)
+	assert.Equal(t, "package app\n", d.NewText)
+
+	d, err = Read(ctx, reader, "s1", "/src/missing.go", "package app\n")
+	require.NoError(t, err)
+	assert.True(t, d.IsNewFile())
+	assert.Equal(t, NewFile("/src/missing.go", "package app\n"), d)
+
+	d, err = Read(ctx, reader, "s1", "/src/remote.go", "package app\n")
+	require.NoError(t, err)
+	assert.True(t, d.IsNewFile())
+
+	_, err = Read(ctx, reader, "s1", "/src/locked.go", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/src/locked.go")
+}
+
+func TestContentRoundTrip(t *testing.T) {
+	for _, d := range []Diff{New("/a.txt", "old\n", "new\n"), NewFile("/b.txt", "new\n")} {
+		content := d.Content()
+		assert.Equal(t, api.ToolCallContentTypeDiff, content.Type)
+
+		decoded, err := FromContent(content)
+		require.NoError(t, err)
+		assert.Equal(t, d, decoded)
+
+		// Content received over the wire arrives as generic JSON values.
+		data, err := json.Marshal(content)
+		require.NoError(t, err)
+		var wire map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &wire))
+
+		decoded, err = FromContent(wire)
+		require.NoError(t, err)
+		assert.Equal(t, d, decoded)
+	}
+
+	_, err := FromContent(api.NewToolCallContentTerminal("term-1"))
+	require.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.txt")
+
+	t.Run("NewFile", func(t *testing.T) {
+		require.NoError(t, NewFile(path, "a\n").Apply(dir))
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "a\n", string(content))
+	})
+
+	t.Run("Change", func(t *testing.T) {
+		require.NoError(t, os.Chmod(path, 0o640))
+		require.NoError(t, New(path, "a\n", "b\n").Apply(dir))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "b\n", string(content))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	})
+
+	t.Run("AlreadyApplied", func(t *testing.T) {
+		require.NoError(t, New(path, "a\n", "b\n").Apply(dir))
+	})
+
+	t.Run("Conflicts", func(t *testing.T) {
+		assert.ErrorIs(t, New(path, "a\n", "c\n").Apply(dir), ErrConflict)
+		assert.ErrorIs(t, NewFile(path, "c\n").Apply(dir), ErrConflict)
+		assert.ErrorIs(t, New(filepath.Join(dir, "missing.txt"), "a\n", "c\n").Apply(dir), ErrConflict)
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "b\n", string(content))
+	})
+
+	t.Run("CreatesDirectories", func(t *testing.T) {
+		nested := filepath.Join(dir, "nested", "dir", "file.txt")
+		require.NoError(t, NewFile(nested, "x").Apply(dir))
+		assert.FileExists(t, nested)
+	})
+	t.Run("RejectsPathsOutsideRoot", func(t *testing.T) {
+		outside := t.TempDir()
+		escape := dir + string(filepath.Separator) + filepath.Join("..", "escape.txt")
+		assert.ErrorIs(t, NewFile(escape, "x").Apply(dir), ErrOutsideRoot)
+		assert.NoFileExists(t, filepath.Join(filepath.Dir(dir), "escape.txt"))
+		assert.ErrorIs(t, NewFile("relative.txt", "x").Apply(dir), ErrOutsideRoot)
+		assert.ErrorIs(t, NewFile(dir, "x").Apply(dir), ErrOutsideRoot)
+
+		// Symbolic links may not lead out of the root either.
+		require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+		require.Error(t, NewFile(filepath.Join(dir, "link", "file.txt"), "x").Apply(dir))
+		assert.NoFileExists(t, filepath.Join(outside, "file.txt"))
+	})
+
+	t.Run("LeavesNoTemporaryFiles", func(t *testing.T) {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			assert.NotContains(t, entry.Name(), ".tmp")
+		}
+	})
+}
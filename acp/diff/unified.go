@@ -0,0 +1,260 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContextLines is the number of unchanged lines shown around each
+// change, as in diff -u.
+const DefaultContextLines = 3
+
+// opKind is the kind of a line edit.
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// lineOp is a single line of an edit script. oldLine and newLine are 0-based
+// indexes into the old and new lines; only the one matching the kind is used
+// for deletions and insertions.
+type lineOp struct {
+	kind    opKind
+	oldLine int
+	newLine int
+}
+
+// Unified renders the diff in unified format with contextLines unchanged
+// lines around each change; a negative value uses DefaultContextLines. File
+// names use the a/ and b/ prefixes of git. It returns an empty string if the
+// old and new text are equal.
+func (d Diff) Unified(contextLines int) string {
+	if contextLines < 0 {
+		contextLines = DefaultContextLines
+	}
+
+	var oldText string
+	name := strings.TrimPrefix(d.Path, "/")
+	oldName, newName := "a/"+name, "b/"+name
+	if d.OldText == nil {
+		oldName = "/dev/null"
+	} else {
+		oldText = *d.OldText
+	}
+
+	oldLines, newLines := splitLines(oldText), splitLines(d.NewText)
+	ops := diffLines(oldLines, newLines)
+
+	var b strings.Builder
+	for i, hunk := range hunks(ops, contextLines) {
+		if i == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		writeHunk(&b, ops[hunk.start:hunk.end], oldLines, newLines)
+	}
+	return b.String()
+}
+
+// span is a range of an edit script.
+type span struct {
+	start, end int
+}
+
+// hunks groups the changes of an edit script with their context. Changes
+// separated by at most twice the context are shown in one hunk.
+func hunks(ops []lineOp, contextLines int) []span {
+	var result []span
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == opEqual {
+			continue
+		}
+
+		start := max(i-contextLines, 0)
+		if len(result) > 0 && start <= result[len(result)-1].end {
+			start = result[len(result)-1].start
+			result = result[:len(result)-1]
+		}
+
+		// Extend over the change and any changes within twice the context.
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == opEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*contextLines {
+				break
+			}
+			end = next
+		}
+
+		result = append(result, span{start: start, end: min(end+contextLines, len(ops))})
+		i = end
+	}
+	return result
+}
+
+// writeHunk writes one hunk with its header.
+func writeHunk(b *strings.Builder, ops []lineOp, oldLines, newLines []string) {
+	oldStart, newStart := -1, -1
+	var oldCount, newCount int
+	for _, op := range ops {
+		if op.kind != opInsert {
+			if oldStart < 0 {
+				oldStart = op.oldLine
+			}
+			oldCount++
+		}
+		if op.kind != opDelete {
+			if newStart < 0 {
+				newStart = op.newLine
+			}
+			newCount++
+		}
+	}
+
+	fmt.Fprintf(b, "@@ -%s +%s @@\n",
+		hunkRange(oldStart, oldCount, ops[0].oldLine), hunkRange(newStart, newCount, ops[0].newLine))
+	for _, op := range ops {
+		switch op.kind {
+		case opEqual:
+			writeLine(b, ' ', oldLines[op.oldLine])
+		case opDelete:
+			writeLine(b, '-', oldLines[op.oldLine])
+		case opInsert:
+			writeLine(b, '+', newLines[op.newLine])
+		}
+	}
+}
+
+// hunkRange formats the line range of one side of a hunk. An empty range is
+// reported as starting at the line before it.
+func hunkRange(start, count, position int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", position)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// writeLine writes a prefixed diff line, marking a missing final newline.
+func writeLine(b *strings.Builder, prefix byte, line string) {
+	b.WriteByte(prefix)
+	b.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		b.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// splitLines splits text into lines that keep their line endings, so a
+// missing final newline counts as a change.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// maxEditDistance bounds the edit distance diffLines searches for. Memory
+// grows with its square; larger rewrites are shown as a single replacement.
+const maxEditDistance = 1000
+
+// diffLines computes a shortest edit script from a to b with Myers'
+// algorithm. If the script needs more than maxEditDistance edits, every old
+// line is deleted and every new line inserted instead.
+func diffLines(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEditDistance)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace[d] holds v[-d-1..d+1] before step d, the diagonals step d reads.
+	var trace [][]int
+
+	found := false
+search:
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break search
+			}
+		}
+	}
+	if !found {
+		return replaceLines(n, m)
+	}
+
+	// Walk the trace back from the end to recover the edits.
+	var ops []lineOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+d+1] < v[k+1+d+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d+1]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, lineOp{kind: opEqual, oldLine: x, newLine: y})
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, lineOp{kind: opInsert, oldLine: x, newLine: prevY})
+			} else {
+				ops = append(ops, lineOp{kind: opDelete, oldLine: prevX, newLine: y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// replaceLines returns an edit script that deletes all n old lines and then
+// inserts all m new lines.
+func replaceLines(n, m int) []lineOp {
+	ops := make([]lineOp, 0, n+m)
+	for i := range n {
+		ops = append(ops, lineOp{kind: opDelete, oldLine: i})
+	}
+	for j := range m {
+		ops = append(ops, lineOp{kind: opInsert, oldLine: n, newLine: j})
+	}
+	return ops
+}
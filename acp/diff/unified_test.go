@@ -0,0 +1,141 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// numberedLines returns "1\n2\n...n\n" with the given lines replaced.
+func numberedLines(n int, replace map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := replace[i]; ok {
+			b.WriteString(line + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	return b.String()
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		diff     Diff
+		context  int
+		expected string
+	}{
+		{
+			name:     "Unchanged",
+			diff:     New("/a.txt", "same\n", "same\n"),
+			context:  3,
+			expected: "",
+		},
+		{
+			name:    "ChangedLine",
+			diff:    New("/a.txt", "one\ntwo\nthree\n", "one\nTWO\nthree\n"),
+			context: 3,
+			expected: "--- a/a.txt\n+++ b/a.txt\n" +
+				"@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n",
+		},
+		{
+			name:    "NewFile",
+			diff:    NewFile("/new.txt", "hello\nworld\n"),
+			context: 3,
+			expected: "--- /dev/null\n+++ b/new.txt\n" +
+				"@@ -0,0 +1,2 @@\n+hello\n+world\n",
+		},
+		{
+			name:    "DeletedContent",
+			diff:    New("/a.txt", "gone\n", ""),
+			context: 3,
+			expected: "--- a/a.txt\n+++ b/a.txt\n" +
+				"@@ -1 +0,0 @@\n-gone\n",
+		},
+		{
+			name:    "MissingFinalNewline",
+			diff:    New("/a.txt", "a\nb", "a\nb\n"),
+			context: 3,
+			expected: "--- a/a.txt\n+++ b/a.txt\n" +
+				"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name:    "SeparateHunks",
+			diff:    New("/n.txt", numberedLines(20, nil), numberedLines(20, map[int]string{2: "two", 19: "nineteen"})),
+			context: 1,
+			expected: "--- a/n.txt\n+++ b/n.txt\n" +
+				"@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n" +
+				"@@ -18,3 +18,3 @@\n 18\n-19\n+nineteen\n 20\n",
+		},
+		{
+			name:    "NearbyChangesShareHunk",
+			diff:    New("/n.txt", numberedLines(10, nil), numberedLines(10, map[int]string{3: "x", 6: "y"})),
+			context: 2,
+			expected: "--- a/n.txt\n+++ b/n.txt\n" +
+				"@@ -1,8 +1,8 @@\n 1\n 2\n-3\n+x\n 4\n 5\n-6\n+y\n 7\n 8\n",
+		},
+		{
+			name:    "Insertion",
+			diff:    New("/n.txt", numberedLines(5, nil), "1\n2\n3\nnew\n4\n5\n"),
+			context: 0,
+			expected: "--- a/n.txt\n+++ b/n.txt\n" +
+				"@@ -3,0 +4 @@\n+new\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.diff.Unified(tt.context))
+		})
+	}
+}
+
+func TestDiffLinesIsMinimal(t *testing.T) {
+	a := splitLines("a\nb\nc\na\nb\nb\na\n")
+	b := splitLines("c\nb\na\nb\na\nc\n")
+
+	var edits int
+	for _, op := range diffLines(a, b) {
+		if op.kind != opEqual {
+			edits++
+		}
+	}
+	// The classic example from Myers' paper has an edit distance of 5.
+	assert.Equal(t, 5, edits)
+}
+
+func TestUnifiedLargeRewrite(t *testing.T) {
+	const n = 4000
+	replace := make(map[int]string, n)
+	for i := 1; i <= n; i++ {
+		replace[i] = fmt.Sprintf("rewritten %d", i)
+	}
+	oldText := numberedLines(n, nil)
+	d := Diff{Path: "big.txt", OldText: &oldText, NewText: numberedLines(n, replace)}
+
+	unified := d.Unified(-1)
+	lines := strings.Split(strings.TrimSuffix(unified, "\n"), "\n")
+	assert.Len(t, lines, 3+2*n)
+	assert.Equal(t, "@@ -1,4000 +1,4000 @@", lines[2])
+	assert.Equal(t, "-1", lines[3])
+	assert.Equal(t, "-4000", lines[2+n])
+	assert.Equal(t, "+rewritten 1", lines[3+n])
+	assert.Equal(t, "+rewritten 4000", lines[2+2*n])
+
+	// Scattered changes within the edit limit still get a minimal diff.
+	sparse := map[int]string{}
+	for i := 10; i <= n; i += 100 {
+		sparse[i] = "changed"
+	}
+	d.NewText = numberedLines(n, sparse)
+	var edits int
+	for _, op := range diffLines(splitLines(oldText), splitLines(d.NewText)) {
+		if op.kind != opEqual {
+			edits++
+		}
+	}
+	assert.Equal(t, 2*len(sparse), edits)
+}
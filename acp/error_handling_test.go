@@ -34,7 +34,7 @@ func (s *ErrorHandlingTestSuite) TestInitializationErrors() {
 	s.pair.TestAgent.SetShouldError("initialize", true)
 
 	request := SampleInitializeRequest()
-	result, err := s.pair.AgentConn.Initialize(ctx, request)
+	result, err := s.pair.ClientConn.Initialize(ctx, request)
 
 	s.Require().Error(err)
 	s.Nil(result)
@@ -52,7 +52,7 @@ func (s *ErrorHandlingTestSuite) TestAuthenticationErrors() {
 	authRequest := &api.AuthenticateRequest{
 		MethodId: api.AuthMethodId("invalid-method"),
 	}
-	err := s.pair.AgentConn.Authenticate(ctx, authRequest)
+	err := s.pair.ClientConn.Authenticate(ctx, authRequest)
 
 	s.Require().Error(err)
 	AssertACPError(s.T(), err, api.ErrorCodeUnauthorized)
@@ -67,14 +67,14 @@ func (s *ErrorHandlingTestSuite) TestSessionErrors() {
 	s.pair.TestAgent.SetShouldError("session/new", true)
 
 	request := SampleNewSessionRequest()
-	result, err := s.pair.AgentConn.SessionNew(ctx, request)
+	result, err := s.pair.ClientConn.SessionNew(ctx, request)
 
 	s.Require().Error(err)
 	s.Nil(result)
 	AssertACPError(s.T(), err, api.ErrorCodeInternalServerError)
 
 	s.pair.TestAgent.SetShouldError("session/new", false)
-	sessionResponse, err := s.pair.AgentConn.SessionNew(ctx, request)
+	sessionResponse, err := s.pair.ClientConn.SessionNew(ctx, request)
 	s.Require().NoError(err)
 
 	s.pair.TestAgent.SetShouldError("session/load", true)
@@ -82,14 +82,14 @@ func (s *ErrorHandlingTestSuite) TestSessionErrors() {
 	loadRequest := &api.LoadSessionRequest{
 		SessionId: api.SessionId("nonexistent-session"),
 	}
-	err = s.pair.AgentConn.SessionLoad(ctx, loadRequest)
+	err = s.pair.ClientConn.SessionLoad(ctx, loadRequest)
 
 	s.Require().Error(err)
 	AssertACPError(s.T(), err, api.ErrorCodeNotFound)
 
 	s.pair.TestAgent.SetShouldError("session/load", false)
 	loadRequest.SessionId = sessionResponse.SessionId
-	err = s.pair.AgentConn.SessionLoad(ctx, loadRequest)
+	err = s.pair.ClientConn.SessionLoad(ctx, loadRequest)
 	s.Require().NoError(err)
 }
 
@@ -102,7 +102,7 @@ func (s *ErrorHandlingTestSuite) TestFileSystemErrors() {
 	s.pair.TestClient.SetShouldError("fs/read_text_file", true)
 
 	readRequest := SampleReadTextFileRequest("session-1", "/nonexistent/file.txt")
-	result, err := s.pair.ClientConn.FsReadTextFile(ctx, readRequest)
+	result, err := s.pair.AgentConn.FsReadTextFile(ctx, readRequest)
 
 	s.Require().Error(err)
 	s.Nil(result)
@@ -111,7 +111,7 @@ func (s *ErrorHandlingTestSuite) TestFileSystemErrors() {
 	s.pair.TestClient.SetShouldError("fs/write_text_file", true)
 
 	writeRequest := SampleWriteTextFileRequest("session-1", "/forbidden/file.txt", "content")
-	err = s.pair.ClientConn.FsWriteTextFile(ctx, writeRequest)
+	err = s.pair.AgentConn.FsWriteTextFile(ctx, writeRequest)
 
 	s.Require().Error(err)
 	AssertACPError(s.T(), err, api.ErrorCodeForbidden)
@@ -126,7 +126,7 @@ func (s *ErrorHandlingTestSuite) TestPromptErrors() {
 	s.pair.TestAgent.SetShouldError("session/prompt", true)
 
 	promptRequest := SamplePromptRequest("session-1")
-	result, err := s.pair.AgentConn.SessionPrompt(ctx, promptRequest)
+	result, err := s.pair.ClientConn.SessionPrompt(ctx, promptRequest)
 
 	s.Require().Error(err)
 	s.Nil(result)
@@ -175,14 +175,14 @@ func (s *ErrorHandlingTestSuite) TestErrorRecovery() {
 	s.pair.TestClient.SetShouldError("fs/read_text_file", true)
 
 	readRequest := SampleReadTextFileRequest("session-1", "/test/file.txt")
-	_, err := s.pair.ClientConn.FsReadTextFile(ctx, readRequest)
+	_, err := s.pair.AgentConn.FsReadTextFile(ctx, readRequest)
 	s.Require().Error(err)
 	AssertACPError(s.T(), err, api.ErrorCodeNotFound)
 
 	s.pair.TestClient.SetShouldError("fs/read_text_file", false)
 	s.pair.TestClient.AddFileContent("/test/file.txt", "recovered content")
 
-	result, err := s.pair.ClientConn.FsReadTextFile(ctx, readRequest)
+	result, err := s.pair.AgentConn.FsReadTextFile(ctx, readRequest)
 	s.Require().NoError(err)
 	s.NotNil(result)
 	s.Equal("recovered content", result.Content)
@@ -219,7 +219,7 @@ func (s *ErrorHandlingTestSuite) TestMixedSuccessAndFailure() {
 			}
 
 			request := SampleReadTextFileRequest("session-1", tc.path)
-			result, err := s.pair.ClientConn.FsReadTextFile(ctx, request)
+			result, err := s.pair.AgentConn.FsReadTextFile(ctx, request)
 
 			if tc.shouldSucceed {
 				s.Require().NoError(err)
@@ -239,7 +239,7 @@ func (s *ErrorHandlingTestSuite) TestMixedSuccessAndFailure() {
 
 func (s *ErrorHandlingTestSuite) initializeConnection(ctx context.Context) *api.InitializeResponse {
 	request := SampleInitializeRequest()
-	response, err := s.pair.AgentConn.Initialize(ctx, request)
+	response, err := s.pair.ClientConn.Initialize(ctx, request)
 	s.Require().NoError(err)
 	s.Require().NotNil(response)
 	return response
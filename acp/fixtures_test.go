@@ -34,8 +34,8 @@ func NewConnectionPair(t *testing.T) *ConnectionPair {
 	testClient := NewTestClient()
 
 	// Create handler registries.
-	agentHandler := NewHandlerRegistry()
-	clientHandler := NewHandlerRegistry()
+	agentHandler := NewAgentHandlerRegistry()
+	clientHandler := NewClientHandlerRegistry()
 
 	// Register agent handlers (these handle requests FROM client TO agent).
 	agentHandler.RegisterInitializeHandler(testAgent.HandleInitialize)
@@ -51,21 +51,21 @@ func NewConnectionPair(t *testing.T) *ConnectionPair {
 
 	ctx := context.Background()
 
-	// The "agent side" connection - receives calls to agent methods, can send calls to client methods.
-	agentSideConn, err := NewClientConnectionStdio(ctx, transport.Agent(), agentHandler, testRequestTimeout)
+	// The agent side - serves agent methods and calls client methods.
+	agentConn, err := NewAgentConnectionStdio(ctx, transport.Agent(), agentHandler, testRequestTimeout)
 	if err != nil {
 		t.Fatalf("Failed to create agent side connection: %v", err)
 	}
 
-	// The "client side" connection - receives calls to client methods, can send calls to agent methods.
-	clientSideConn, err := NewAgentConnectionStdio(ctx, transport.Client(), clientHandler, testRequestTimeout)
+	// The client side - serves client methods and calls agent methods.
+	clientConn, err := NewClientConnectionStdio(ctx, transport.Client(), clientHandler, testRequestTimeout)
 	if err != nil {
 		t.Fatalf("Failed to create client side connection: %v", err)
 	}
 
 	return &ConnectionPair{
-		AgentConn:     clientSideConn, // Connection that can call agent methods
-		ClientConn:    agentSideConn,  // Connection that can call client methods
+		AgentConn:     agentConn,
+		ClientConn:    clientConn,
 		Transport:     transport,
 		AgentHandler:  agentHandler,
 		ClientHandler: clientHandler,
@@ -81,6 +81,30 @@ func (cp *ConnectionPair) Close() error {
 	return cp.Transport.Close()
 }
 
+// NewRolePair creates an AgentConnection on the agent side of a transport and
+// a ClientConnection on the client side, each serving the given handler.
+// Both connections are closed when the test finishes.
+func NewRolePair(t *testing.T, agentHandler, clientHandler Handler) (*AgentConnection, *ClientConnection) {
+	t.Helper()
+
+	transport := NewMockTransport()
+	ctx := context.Background()
+
+	agentConn, err := NewAgentConnectionStdio(ctx, transport.Agent(), agentHandler, testRequestTimeout)
+	require.NoError(t, err)
+
+	clientConn, err := NewClientConnectionStdio(ctx, transport.Client(), clientHandler, testRequestTimeout)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		agentConn.Close()
+		clientConn.Close()
+		transport.Close()
+	})
+
+	return agentConn, clientConn
+}
+
 // WaitWithTimeout waits for a condition with a timeout.
 func WaitWithTimeout(t *testing.T, timeout time.Duration, condition func() bool, message string) {
 	t.Helper()
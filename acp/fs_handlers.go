@@ -0,0 +1,294 @@
+package acp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+)
+
+const (
+	// DefaultMaxReadBytes is the default limit on the content returned by a
+	// single fs/read_text_file request.
+	DefaultMaxReadBytes = 10 << 20
+	// DefaultMaxWriteBytes is the default limit on the content of a single
+	// fs/write_text_file request.
+	DefaultMaxWriteBytes = 10 << 20
+)
+
+// FSHandlerOptions configures FSHandlers.
+type FSHandlerOptions struct {
+	// Roots are the directories requests may read and write in. When empty,
+	// each session is confined to the Cwd it was created or loaded with.
+	Roots []string
+	// MaxReadBytes limits the content returned by one read. Zero uses
+	// DefaultMaxReadBytes.
+	MaxReadBytes int
+	// MaxWriteBytes limits the content of one write. Zero uses
+	// DefaultMaxWriteBytes.
+	MaxWriteBytes int
+	// FS is the file system requests are served from. Nil uses DiskFS.
+	FS WorkspaceFS
+}
+
+// FSHandlers implements the fs/read_text_file and fs/write_text_file methods
+// for clients, confined to a set of allowed roots.
+//
+// Paths must be absolute. A path is allowed only if it lies inside a root
+// after ".." elements and symbolic links are resolved, so neither can be used
+// to reach files outside the roots. Files are read and written through the
+// configured WorkspaceFS; use an OverlayFS to serve unsaved editor buffers.
+// DiskFS opens files through os.Root at the matching root, so a symbolic link
+// swapped in after the check cannot lead out of it either.
+//
+// Register the handlers with Register, or individually with
+// HandlerRegistry.RegisterFsReadTextFileHandler and
+// HandlerRegistry.RegisterFsWriteTextFileHandler.
+type FSHandlers struct {
+	fs            WorkspaceFS
+	roots         []string
+	maxReadBytes  int
+	maxWriteBytes int
+}
+
+// NewFSHandlers creates file system handlers. Each root must be an existing
+// directory.
+func NewFSHandlers(options FSHandlerOptions) (*FSHandlers, error) {
+	h := &FSHandlers{
+		fs:            options.FS,
+		maxReadBytes:  options.MaxReadBytes,
+		maxWriteBytes: options.MaxWriteBytes,
+	}
+	if h.maxReadBytes <= 0 {
+		h.maxReadBytes = DefaultMaxReadBytes
+	}
+	if h.maxWriteBytes <= 0 {
+		h.maxWriteBytes = DefaultMaxWriteBytes
+	}
+	if h.fs == nil {
+		h.fs = DiskFS{}
+	}
+
+	for _, root := range options.Roots {
+		resolved, err := resolveRoot(root)
+		if err != nil {
+			return nil, err
+		}
+		h.roots = append(h.roots, resolved)
+	}
+	return h, nil
+}
+
+// Register registers the read and write handlers on a registry.
+func (h *FSHandlers) Register(registry *HandlerRegistry) {
+	registry.RegisterFsReadTextFileHandler(h.HandleReadTextFile)
+	registry.RegisterFsWriteTextFileHandler(h.HandleWriteTextFile)
+}
+
+// HandleReadTextFile answers a fs/read_text_file request, returning the lines
+// selected by the request's line and limit.
+func (h *FSHandlers) HandleReadTextFile(
+	ctx context.Context,
+	params *api.ReadTextFileRequest,
+) (*api.ReadTextFileResponse, error) {
+	if params.Line != nil && *params.Line < 1 {
+		return nil, NewValidationError("line", "must be at least 1")
+	}
+	if params.Limit != nil && *params.Limit < 0 {
+		return nil, NewValidationError("limit", "must not be negative")
+	}
+
+	path, root, err := h.resolve(ctx, params.SessionId, params.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := h.fs.OpenTextFile(withWorkspaceRoot(ctx, root), path)
+	if err != nil {
+		return nil, fileError(params.Path, err)
+	}
+	defer file.Close()
+
+	content, err := h.readLines(file, params.Line, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ReadTextFileResponse{Content: content}, nil
+}
+
+// readLines reads the selected lines of a file, failing once the content
+// exceeds the read limit.
+func (h *FSHandlers) readLines(r io.Reader, line, limit *int) (string, error) {
+	first := 1
+	if line != nil {
+		first = *line
+	}
+	last := -1
+	if limit != nil {
+		last = first + *limit - 1
+	}
+
+	var b strings.Builder
+	reader := bufio.NewReader(r)
+	for number := 1; last < 0 || number <= last; number++ {
+		// Read the line in buffer-sized fragments, so skipped lines are never
+		// held in memory and selected ones only up to the read limit.
+		var err error
+		for {
+			var fragment []byte
+			fragment, err = reader.ReadSlice('\n')
+			if number >= first {
+				b.Write(fragment)
+				if b.Len() > h.maxReadBytes {
+					return "", NewValidationError("limit",
+						fmt.Sprintf("content exceeds the %d byte read limit; read fewer lines", h.maxReadBytes))
+				}
+			}
+			if !errors.Is(err, bufio.ErrBufferFull) {
+				break
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", WrapError(err, api.ErrorCodeInternalServerError, "failed to read file")
+		}
+	}
+	return b.String(), nil
+}
+
+// HandleWriteTextFile answers a fs/write_text_file request.
+func (h *FSHandlers) HandleWriteTextFile(ctx context.Context, params *api.WriteTextFileRequest) error {
+	if len(params.Content) > h.maxWriteBytes {
+		return NewValidationError("content", fmt.Sprintf("exceeds the %d byte write limit", h.maxWriteBytes))
+	}
+
+	path, root, err := h.resolve(ctx, params.SessionId, params.Path)
+	if err != nil {
+		return err
+	}
+
+	if err = h.fs.WriteTextFile(withWorkspaceRoot(ctx, root), path, params.Content); err != nil {
+		return fileError(params.Path, err)
+	}
+	return nil
+}
+
+// resolve returns the real path for a request path and the allowed root it is
+// in, or an error if it is not inside one of the session's allowed roots.
+func (h *FSHandlers) resolve(ctx context.Context, sessionID api.SessionId, path string) (string, string, error) {
+	if !filepath.IsAbs(path) {
+		return "", "", NewValidationError("path", "must be absolute")
+	}
+
+	roots := h.roots
+	if len(roots) == 0 {
+		root, err := sessionRoot(ctx, sessionID)
+		if err != nil {
+			return "", "", err
+		}
+		roots = []string{root}
+	}
+
+	resolved, err := resolvePath(filepath.Clean(path))
+	if err != nil {
+		return "", "", fileError(path, err)
+	}
+	for _, root := range roots {
+		if pathWithin(root, resolved) {
+			return resolved, root, nil
+		}
+	}
+	return "", "", api.NewACPError(api.ErrorCodeForbidden,
+		fmt.Sprintf("path %q is outside the allowed roots", path),
+		map[string]interface{}{"path": path})
+}
+
+// sessionRoot returns the resolved Cwd of a session created or loaded on the
+// connection serving the request.
+func sessionRoot(ctx context.Context, sessionID api.SessionId) (string, error) {
+	var cwd string
+	if conn := ClientConnectionFromContext(ctx); conn != nil {
+		cwd, _ = conn.sessionCwds.Load(sessionID)
+	}
+	if cwd == "" {
+		return "", api.NewACPError(api.ErrorCodeForbidden,
+			fmt.Sprintf("no allowed roots for session %q", sessionID),
+			map[string]interface{}{"sessionId": sessionID})
+	}
+	return resolveRoot(cwd)
+}
+
+// resolveRoot returns the absolute path of a root directory with symbolic
+// links resolved.
+func resolveRoot(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %q: %w", root, err)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %q: %w", root, err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %q: %w", root, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("invalid root %q: not a directory", root)
+	}
+	return resolved, nil
+}
+
+// resolvePath resolves the symbolic links of a clean absolute path. For a
+// path that does not exist yet, the links of its nearest existing ancestor
+// are resolved and the missing elements appended.
+func resolvePath(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// pathWithin reports whether path is root or inside it.
+func pathWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// fileError converts a file system error to an ACP error.
+func fileError(path string, err error) *api.ACPError {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return NewNotFoundError("file", path)
+	case errors.Is(err, fs.ErrPermission):
+		return WrapError(err, api.ErrorCodeForbidden, "permission denied")
+	case errors.Is(err, ErrNotRegularFile):
+		return NewValidationError("path", "not a regular file")
+	default:
+		return WrapError(err, api.ErrorCodeInternalServerError, "file system error")
+	}
+}
@@ -0,0 +1,220 @@
+package acp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFSHandlers creates handlers confined to a new temporary root.
+func newTestFSHandlers(t *testing.T, options FSHandlerOptions) (*FSHandlers, string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	options.Roots = []string{root}
+	handlers, err := NewFSHandlers(options)
+	require.NoError(t, err)
+	return handlers, root
+}
+
+func TestFSHandlersRead(t *testing.T) {
+	ctx := context.Background()
+	handlers, root := newTestFSHandlers(t, FSHandlerOptions{})
+	path := filepath.Join(root, "lines.txt")
+	require.NoError(t, os.WriteFile(path, []byte("one\ntwo\nthree\nfour"), 0o600))
+
+	tests := []struct {
+		name     string
+		line     *int
+		limit    *int
+		expected string
+	}{
+		{name: "Whole", expected: "one\ntwo\nthree\nfour"},
+		{name: "FromLine", line: IntPtr(3), expected: "three\nfour"},
+		{name: "Limit", limit: IntPtr(2), expected: "one\ntwo\n"},
+		{name: "LineAndLimit", line: IntPtr(2), limit: IntPtr(1), expected: "two\n"},
+		{name: "PastEnd", line: IntPtr(10), expected: ""},
+		{name: "ZeroLimit", limit: IntPtr(0), expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{
+				Path: path, Line: tt.line, Limit: tt.limit,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, resp.Content)
+		})
+	}
+
+	t.Run("InvalidSlice", func(t *testing.T) {
+		_, err := handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: path, Line: IntPtr(0)})
+		AssertACPError(t, err, api.CodeInvalidParams)
+		_, err = handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: path, Limit: IntPtr(-1)})
+		AssertACPError(t, err, api.CodeInvalidParams)
+	})
+
+	t.Run("SizeLimit", func(t *testing.T) {
+		handlers, root := newTestFSHandlers(t, FSHandlerOptions{MaxReadBytes: 16})
+		big := filepath.Join(root, "big.txt")
+		require.NoError(t, os.WriteFile(big, []byte(strings.Repeat("x", 10)+"\n"+strings.Repeat("y", 10)), 0o600))
+
+		_, err := handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: big})
+		AssertACPError(t, err, api.CodeInvalidParams)
+
+		resp, err := handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: big, Line: IntPtr(2)})
+		require.NoError(t, err)
+		assert.Equal(t, strings.Repeat("y", 10), resp.Content)
+
+		// Lines longer than the read buffer are skipped or cut off at the limit.
+		long := filepath.Join(root, "long.txt")
+		require.NoError(t, os.WriteFile(long, []byte(strings.Repeat("z", 1<<20)+"\nshort\n"), 0o600))
+		resp, err = handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: long, Line: IntPtr(2)})
+		require.NoError(t, err)
+		assert.Equal(t, "short\n", resp.Content)
+		_, err = handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: long, Limit: IntPtr(1)})
+		AssertACPError(t, err, api.CodeInvalidParams)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: filepath.Join(root, "missing.txt")})
+		AssertACPError(t, err, api.ErrorCodeNotFound)
+		_, err = handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: root})
+		AssertACPError(t, err, api.CodeInvalidParams)
+		_, err = handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: "lines.txt"})
+		AssertACPError(t, err, api.CodeInvalidParams)
+	})
+}
+
+func TestFSHandlersWrite(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("CreatesFileAndDirectories", func(t *testing.T) {
+		handlers, root := newTestFSHandlers(t, FSHandlerOptions{})
+		path := filepath.Join(root, "a", "b", "new.txt")
+
+		require.NoError(t, handlers.HandleWriteTextFile(ctx, &api.WriteTextFileRequest{Path: path, Content: "hello"}))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "temporary file left behind")
+	})
+
+	t.Run("PreservesMode", func(t *testing.T) {
+		handlers, root := newTestFSHandlers(t, FSHandlerOptions{})
+		path := filepath.Join(root, "script.sh")
+		require.NoError(t, os.WriteFile(path, []byte("old"), 0o600))
+		require.NoError(t, os.Chmod(path, 0o750))
+
+		require.NoError(t, handlers.HandleWriteTextFile(ctx, &api.WriteTextFileRequest{Path: path, Content: "new"}))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+	})
+
+	t.Run("SizeLimit", func(t *testing.T) {
+		handlers, root := newTestFSHandlers(t, FSHandlerOptions{MaxWriteBytes: 4})
+		path := filepath.Join(root, "big.txt")
+
+		err := handlers.HandleWriteTextFile(ctx, &api.WriteTextFileRequest{Path: path, Content: "too long"})
+		AssertACPError(t, err, api.CodeInvalidParams)
+		assert.NoFileExists(t, path)
+	})
+}
+
+func TestFSHandlersConfinement(t *testing.T) {
+	ctx := context.Background()
+	handlers, root := newTestFSHandlers(t, FSHandlerOptions{})
+	outside, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	secret := filepath.Join(outside, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0o600))
+
+	require.NoError(t, os.Symlink(secret, filepath.Join(root, "file-link")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "dir-link")))
+
+	paths := map[string]string{
+		"Outside":       secret,
+		"DotDot":        filepath.Join(root, "..", filepath.Base(outside), "secret.txt"),
+		"FileSymlink":   filepath.Join(root, "file-link"),
+		"DirSymlink":    filepath.Join(root, "dir-link", "secret.txt"),
+		"NewInSymlink":  filepath.Join(root, "dir-link", "new.txt"),
+		"DeepInSymlink": filepath.Join(root, "dir-link", "x", "y.txt"),
+	}
+	for name, path := range paths {
+		t.Run(name, func(t *testing.T) {
+			_, err := handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: path})
+			AssertACPError(t, err, api.ErrorCodeForbidden)
+			err = handlers.HandleWriteTextFile(ctx, &api.WriteTextFileRequest{Path: path, Content: "owned"})
+			AssertACPError(t, err, api.ErrorCodeForbidden)
+		})
+	}
+
+	data, err := os.ReadFile(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(data))
+	assert.NoFileExists(t, filepath.Join(outside, "new.txt"))
+	assert.NoDirExists(t, filepath.Join(outside, "x"))
+}
+
+func TestFSHandlersSessionCwd(t *testing.T) {
+	ctx := context.Background()
+	cwd := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(cwd, "a.txt"), []byte("inside"), 0o600))
+
+	handlers, err := NewFSHandlers(FSHandlerOptions{})
+	require.NoError(t, err)
+	clientHandler := NewClientHandlerRegistry()
+	handlers.Register(clientHandler)
+	agentHandler := NewAgentHandlerRegistry()
+	agentHandler.RegisterSessionNewHandler(
+		func(_ context.Context, _ *api.NewSessionRequest) (*api.NewSessionResponse, error) {
+			return &api.NewSessionResponse{SessionId: "s1"}, nil
+		},
+	)
+	agentHandler.RegisterSessionLoadHandler(func(_ context.Context, _ *api.LoadSessionRequest) error {
+		return nil
+	})
+	agentConn, clientConn := NewRolePair(t, agentHandler, clientHandler)
+
+	read := &api.ReadTextFileRequest{SessionId: "s1", Path: filepath.Join(cwd, "a.txt")}
+
+	// Unknown sessions have no allowed roots.
+	_, err = agentConn.FsReadTextFile(ctx, read)
+	AssertACPError(t, err, api.ErrorCodeForbidden)
+
+	_, err = clientConn.SessionNew(ctx, &api.NewSessionRequest{Cwd: cwd, McpServers: []api.McpServer{}})
+	require.NoError(t, err)
+
+	resp, err := agentConn.FsReadTextFile(ctx, read)
+	require.NoError(t, err)
+	assert.Equal(t, "inside", resp.Content)
+
+	err = agentConn.FsWriteTextFile(ctx, &api.WriteTextFileRequest{SessionId: "s1", Path: filepath.Join(cwd, "b.txt")})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(cwd, "b.txt"))
+
+	err = agentConn.FsWriteTextFile(ctx, &api.WriteTextFileRequest{
+		SessionId: "s1",
+		Path:      filepath.Join(filepath.Dir(cwd), "escape.txt"),
+	})
+	AssertACPError(t, err, api.ErrorCodeForbidden)
+
+	// Loaded sessions are confined to the Cwd they were loaded with.
+	loaded := &api.ReadTextFileRequest{SessionId: "s2", Path: filepath.Join(cwd, "a.txt")}
+	_, err = agentConn.FsReadTextFile(ctx, loaded)
+	AssertACPError(t, err, api.ErrorCodeForbidden)
+	err = clientConn.SessionLoad(ctx, &api.LoadSessionRequest{SessionId: "s2", Cwd: cwd, McpServers: []api.McpServer{}})
+	require.NoError(t, err)
+	resp, err = agentConn.FsReadTextFile(ctx, loaded)
+	require.NoError(t, err)
+	assert.Equal(t, "inside", resp.Content)
+}
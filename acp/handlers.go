@@ -3,6 +3,7 @@ package acp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
@@ -10,9 +11,10 @@ import (
 )
 
 // Handler is the interface that wraps the Handle method.
-// It's implemented by HandlerRegistry and used by AgentConnection to dispatch requests.
+// It's implemented by HandlerRegistry and used by AgentConnection and
+// ClientConnection to dispatch requests.
 type Handler interface {
-	Handle(ctx context.Context, conn *AgentConnection, req *jsonrpc2.Request) (interface{}, error)
+	Handle(ctx context.Context, req *jsonrpc2.Request) (interface{}, error)
 }
 
 // HandlerFunc represents a handler function for ACP methods.
@@ -21,33 +23,177 @@ type HandlerFunc func(_ context.Context, params json.RawMessage) (any, error)
 // NotificationHandlerFunc represents a handler function for ACP notifications.
 type NotificationHandlerFunc func(_ context.Context, params json.RawMessage) error
 
-// HandlerRegistry manages method and notification handlers.
+// ErrWrongRole is returned when a handler belongs to the other side of the
+// connection.
+var ErrWrongRole = errors.New("method is implemented by the other side of the connection")
+
+// Role identifies which side of an ACP connection a HandlerRegistry serves.
+type Role int
+
+const (
+	// RoleAgent serves the methods clients call on agents.
+	RoleAgent Role = iota
+	// RoleClient serves the methods agents call on clients.
+	RoleClient
+
+	// roleAny serves every method, for registries created with
+	// NewHandlerRegistry.
+	roleAny Role = -1
+)
+
+// String returns the name of the role.
+func (r Role) String() string {
+	switch r {
+	case RoleAgent:
+		return "agent"
+	case RoleClient:
+		return "client"
+	case roleAny:
+		return "any"
+	default:
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+}
+
+// agentMethods are the methods and notifications the schema has agents
+// implement and clients call.
+var agentMethods = map[string]struct{}{
+	api.MethodAuthenticate:  {},
+	api.MethodInitialize:    {},
+	api.MethodSessionCancel: {},
+	api.MethodSessionLoad:   {},
+	api.MethodSessionNew:    {},
+	api.MethodSessionPrompt: {},
+}
+
+// clientMethods are the methods and notifications the schema has clients
+// implement and agents call.
+var clientMethods = map[string]struct{}{
+	api.MethodFsReadTextFile:           {},
+	api.MethodFsWriteTextFile:          {},
+	api.MethodSessionRequestPermission: {},
+	api.MethodSessionUpdate:            {},
+	api.MethodTerminalCreate:           {},
+	api.MethodTerminalKill:             {},
+	api.MethodTerminalOutput:           {},
+	api.MethodTerminalRelease:          {},
+	api.MethodTerminalWaitForExit:      {},
+}
+
+// Implements reports whether the schema has this role implement method.
+// Extension methods that are in neither side's set are allowed on both.
+func (r Role) Implements(method string) bool {
+	switch r {
+	case RoleAgent:
+		_, peer := clientMethods[method]
+		return !peer
+	case RoleClient:
+		_, peer := agentMethods[method]
+		return !peer
+	case roleAny:
+		return true
+	default:
+		return false
+	}
+}
+
+// HandlerRegistry manages method and notification handlers for one side of
+// a connection.
 type HandlerRegistry struct {
+	role          Role
 	methods       map[string]HandlerFunc
 	notifications map[string]NotificationHandlerFunc
+
+	// First registration rejected because the peer implements the method
+	err error
 }
 
-// NewHandlerRegistry creates a new handler registry.
+// NewHandlerRegistry creates a new handler registry that accepts handlers for
+// every method and can be used on either side of a connection.
+//
+// Deprecated: Use NewAgentHandlerRegistry or NewClientHandlerRegistry, which
+// reject handlers for the methods the peer implements.
 func NewHandlerRegistry() *HandlerRegistry {
+	return newHandlerRegistry(roleAny)
+}
+
+// NewAgentHandlerRegistry creates a handler registry for an agent. It only
+// accepts handlers for methods clients call on agents.
+func NewAgentHandlerRegistry() *HandlerRegistry {
+	return newHandlerRegistry(RoleAgent)
+}
+
+// NewClientHandlerRegistry creates a handler registry for a client. It only
+// accepts handlers for methods agents call on clients.
+func NewClientHandlerRegistry() *HandlerRegistry {
+	return newHandlerRegistry(RoleClient)
+}
+
+// newHandlerRegistry creates an empty handler registry for role.
+func newHandlerRegistry(role Role) *HandlerRegistry {
 	return &HandlerRegistry{
+		role:          role,
 		methods:       make(map[string]HandlerFunc),
 		notifications: make(map[string]NotificationHandlerFunc),
 	}
 }
 
-// RegisterMethod registers a handler for a method (request/response).
+// Role returns the side of the connection the registry serves.
+func (h *HandlerRegistry) Role() Role {
+	return h.role
+}
+
+// RegisterMethod registers a handler for a method (request/response). A
+// handler for a method the peer implements is not registered; see Err.
 func (h *HandlerRegistry) RegisterMethod(method string, handler HandlerFunc) {
-	h.methods[method] = handler
+	if h.checkRole(method) {
+		h.methods[method] = handler
+	}
 }
 
-// RegisterNotification registers a handler for a notification.
+// RegisterNotification registers a handler for a notification. A handler for
+// a notification the peer handles is not registered; see Err.
 func (h *HandlerRegistry) RegisterNotification(method string, handler NotificationHandlerFunc) {
-	h.notifications[method] = handler
+	if h.checkRole(method) {
+		h.notifications[method] = handler
+	}
+}
+
+// Err returns an error wrapping ErrWrongRole if a handler was registered for
+// a method the peer implements, or nil. Connections refuse to serve a
+// registry with such an error.
+func (h *HandlerRegistry) Err() error {
+	return h.err
+}
+
+// checkRole reports whether the registry's role implements method, and
+// records an error if it does not.
+func (h *HandlerRegistry) checkRole(method string) bool {
+	if h.role.Implements(method) {
+		return true
+	}
+	if h.err == nil {
+		h.err = fmt.Errorf("%w: %s cannot handle %s", ErrWrongRole, h.role, method)
+	}
+	return false
+}
+
+// checkHandlerRole returns ErrWrongRole if handler is a HandlerRegistry
+// created for a role other than role, or one that rejected a registration.
+func checkHandlerRole(handler Handler, role Role) error {
+	registry, ok := handler.(*HandlerRegistry)
+	if !ok {
+		return nil
+	}
+	if registry.role != role && registry.role != roleAny {
+		return fmt.Errorf("%w: %s handler registry used for %s connection", ErrWrongRole, registry.role, role)
+	}
+	return registry.err
 }
 
 // Handle dispatches incoming requests to the appropriate registered handler.
 // It implements the Handler interface.
-func (h *HandlerRegistry) Handle(ctx context.Context, _ *AgentConnection, req *jsonrpc2.Request) (any, error) {
+func (h *HandlerRegistry) Handle(ctx context.Context, req *jsonrpc2.Request) (any, error) {
 	// Handle notifications.
 	if !req.IsCall() {
 		handler, exists := h.notifications[req.Method]
@@ -142,6 +288,19 @@ func (h *HandlerRegistry) RegisterSessionPromptHandler(
 	})
 }
 
+// RegisterPromptTurnHandler registers a handler for the session/prompt method
+// that receives a TurnContext bound to the prompt's session. It replaces any
+// handler registered with RegisterSessionPromptHandler.
+func (h *HandlerRegistry) RegisterPromptTurnHandler(handler PromptTurnHandler) {
+	h.RegisterMethod(api.MethodSessionPrompt, func(ctx context.Context, rawParams json.RawMessage) (any, error) {
+		var params api.PromptRequest
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, fmt.Errorf("%w: %w", jsonrpc2.ErrInvalidParams, err)
+		}
+		return runPromptTurnHandler(ctx, handler, &params)
+	})
+}
+
 // Client-side method helpers.
 
 // RegisterFsReadTextFileHandler registers a typed handler for the fs/read_text_file method.
@@ -190,6 +349,79 @@ func (h *HandlerRegistry) RegisterSessionRequestPermissionHandler(
 	)
 }
 
+// RegisterTerminalCreateHandler registers a typed handler for the terminal/create method.
+func (h *HandlerRegistry) RegisterTerminalCreateHandler(
+	handler func(_ context.Context, params *api.CreateTerminalRequest) (*api.CreateTerminalResponse, error),
+) {
+	h.RegisterMethod(api.MethodTerminalCreate, func(ctx context.Context, rawParams json.RawMessage) (any, error) {
+		var params api.CreateTerminalRequest
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, fmt.Errorf("%w: %w", jsonrpc2.ErrInvalidParams, err)
+		}
+		return handler(ctx, &params)
+	})
+}
+
+// RegisterTerminalOutputHandler registers a typed handler for the terminal/output method.
+func (h *HandlerRegistry) RegisterTerminalOutputHandler(
+	handler func(_ context.Context, params *api.TerminalOutputRequest) (*api.TerminalOutputResponse, error),
+) {
+	h.RegisterMethod(api.MethodTerminalOutput, func(ctx context.Context, rawParams json.RawMessage) (any, error) {
+		var params api.TerminalOutputRequest
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, fmt.Errorf("%w: %w", jsonrpc2.ErrInvalidParams, err)
+		}
+		return handler(ctx, &params)
+	})
+}
+
+// RegisterTerminalWaitForExitHandler registers a typed handler for the terminal/wait_for_exit method.
+func (h *HandlerRegistry) RegisterTerminalWaitForExitHandler(
+	handler func(_ context.Context, params *api.WaitForTerminalExitRequest) (*api.WaitForTerminalExitResponse, error),
+) {
+	h.RegisterMethod(api.MethodTerminalWaitForExit, func(ctx context.Context, rawParams json.RawMessage) (any, error) {
+		var params api.WaitForTerminalExitRequest
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, fmt.Errorf("%w: %w", jsonrpc2.ErrInvalidParams, err)
+		}
+		return handler(ctx, &params)
+	})
+}
+
+// RegisterTerminalKillHandler registers a typed handler for the terminal/kill method.
+func (h *HandlerRegistry) RegisterTerminalKillHandler(
+	handler func(_ context.Context, params *api.KillTerminalRequest) error,
+) {
+	h.RegisterMethod(api.MethodTerminalKill, func(ctx context.Context, rawParams json.RawMessage) (any, error) {
+		var params api.KillTerminalRequest
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, fmt.Errorf("%w: %w", jsonrpc2.ErrInvalidParams, err)
+		}
+		err := handler(ctx, &params)
+		if err != nil {
+			return nil, err
+		}
+		return struct{}{}, nil
+	})
+}
+
+// RegisterTerminalReleaseHandler registers a typed handler for the terminal/release method.
+func (h *HandlerRegistry) RegisterTerminalReleaseHandler(
+	handler func(_ context.Context, params *api.ReleaseTerminalRequest) error,
+) {
+	h.RegisterMethod(api.MethodTerminalRelease, func(ctx context.Context, rawParams json.RawMessage) (any, error) {
+		var params api.ReleaseTerminalRequest
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, fmt.Errorf("%w: %w", jsonrpc2.ErrInvalidParams, err)
+		}
+		err := handler(ctx, &params)
+		if err != nil {
+			return nil, err
+		}
+		return struct{}{}, nil
+	})
+}
+
 // Notification handlers.
 
 // RegisterSessionUpdateHandler registers a typed handler for the session/update notification.
@@ -16,11 +16,13 @@ import (
 type HandlerRegistryTestSuite struct {
 	suite.Suite
 
-	registry *HandlerRegistry
+	registry       *HandlerRegistry
+	clientRegistry *HandlerRegistry
 }
 
 func (s *HandlerRegistryTestSuite) SetupTest() {
-	s.registry = NewHandlerRegistry()
+	s.registry = NewAgentHandlerRegistry()
+	s.clientRegistry = NewClientHandlerRegistry()
 }
 
 func (s *HandlerRegistryTestSuite) TestRegisterMethod() {
@@ -86,7 +88,7 @@ func (s *HandlerRegistryTestSuite) TestRegisterSessionNewHandler() {
 func (s *HandlerRegistryTestSuite) TestRegisterFsReadTextFileHandler() {
 	called := false
 
-	s.registry.RegisterFsReadTextFileHandler(
+	s.clientRegistry.RegisterFsReadTextFileHandler(
 		func(_ context.Context, _ *api.ReadTextFileRequest) (*api.ReadTextFileResponse, error) {
 			called = true
 			return &api.ReadTextFileResponse{}, nil
@@ -94,19 +96,63 @@ func (s *HandlerRegistryTestSuite) TestRegisterFsReadTextFileHandler() {
 	)
 
 	s.False(called)
-	s.NotNil(s.registry.methods[api.MethodFsReadTextFile])
+	s.NotNil(s.clientRegistry.methods[api.MethodFsReadTextFile])
 }
 
 func (s *HandlerRegistryTestSuite) TestRegisterFsWriteTextFileHandler() {
 	called := false
 
-	s.registry.RegisterFsWriteTextFileHandler(func(_ context.Context, _ *api.WriteTextFileRequest) error {
+	s.clientRegistry.RegisterFsWriteTextFileHandler(func(_ context.Context, _ *api.WriteTextFileRequest) error {
 		called = true
 		return nil
 	})
 
 	s.False(called)
-	s.NotNil(s.registry.methods[api.MethodFsWriteTextFile])
+	s.NotNil(s.clientRegistry.methods[api.MethodFsWriteTextFile])
+}
+
+func (s *HandlerRegistryTestSuite) TestRegisterPeerMethodFails() {
+	s.registry.RegisterFsReadTextFileHandler(
+		func(_ context.Context, _ *api.ReadTextFileRequest) (*api.ReadTextFileResponse, error) {
+			return &api.ReadTextFileResponse{}, nil
+		},
+	)
+	s.registry.RegisterSessionUpdateHandler(func(_ context.Context, _ *api.SessionNotification) error {
+		return nil
+	})
+	s.clientRegistry.RegisterInitializeHandler(
+		func(_ context.Context, _ *api.InitializeRequest) (*api.InitializeResponse, error) {
+			return &api.InitializeResponse{}, nil
+		},
+	)
+	s.clientRegistry.RegisterSessionCancelHandler(func(_ context.Context, _ *api.CancelNotification) error {
+		return nil
+	})
+
+	s.Require().ErrorIs(s.registry.Err(), ErrWrongRole)
+	s.EqualError(
+		s.registry.Err(),
+		"method is implemented by the other side of the connection: agent cannot handle fs/read_text_file",
+	)
+	s.Require().ErrorIs(s.clientRegistry.Err(), ErrWrongRole)
+	s.Contains(s.clientRegistry.Err().Error(), "client cannot handle initialize")
+	s.Empty(s.registry.methods)
+	s.Empty(s.registry.notifications)
+	s.Empty(s.clientRegistry.methods)
+	s.Empty(s.clientRegistry.notifications)
+}
+
+func (s *HandlerRegistryTestSuite) TestRegisterExtensionMethodOnBothRoles() {
+	handler := func(_ context.Context, _ json.RawMessage) (any, error) {
+		return struct{}{}, nil
+	}
+
+	s.NotPanics(func() {
+		s.registry.RegisterMethod("_vendor/ping", handler)
+		s.clientRegistry.RegisterMethod("_vendor/ping", handler)
+	})
+	s.Equal(RoleAgent, s.registry.Role())
+	s.Equal(RoleClient, s.clientRegistry.Role())
 }
 
 func TestHandlerRegistryTestSuite(t *testing.T) {
@@ -123,9 +169,9 @@ func TestHandlerRegistry_IntegrationInitialize(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Test initialize - CLIENT calls initialize on AGENT (using AgentConn which represents agent methods).
+	// Test initialize - CLIENT calls initialize on AGENT.
 	request := SampleInitializeRequest()
-	result, err := pair.AgentConn.Initialize(ctx, request)
+	result, err := pair.ClientConn.Initialize(ctx, request)
 
 	require.NoError(t, err)
 	require.NotNil(t, result)
@@ -140,9 +186,9 @@ func TestHandlerRegistry_IntegrationSessionNew(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Test session creation - CLIENT calls session/new on AGENT (using AgentConn which represents agent methods)
+	// Test session creation - CLIENT calls session/new on AGENT.
 	request := SampleNewSessionRequest()
-	result, err := pair.AgentConn.SessionNew(ctx, request)
+	result, err := pair.ClientConn.SessionNew(ctx, request)
 
 	require.NoError(t, err)
 	require.NotNil(t, result)
@@ -163,17 +209,17 @@ func TestHandlerRegistry_IntegrationFileOperations(t *testing.T) {
 	// Add file content to test client.
 	pair.TestClient.AddFileContent("/test/file.txt", "Hello, World!")
 
-	// Test file read - AGENT calls fs/read_text_file on CLIENT (using ClientConn which represents client methods)
+	// Test file read - AGENT calls fs/read_text_file on CLIENT.
 	readRequest := SampleReadTextFileRequest("session-1", "/test/file.txt")
-	readResult, err := pair.ClientConn.FsReadTextFile(ctx, readRequest)
+	readResult, err := pair.AgentConn.FsReadTextFile(ctx, readRequest)
 
 	require.NoError(t, err)
 	require.NotNil(t, readResult)
 	assert.Equal(t, "Hello, World!", readResult.Content)
 
-	// Test file write - AGENT calls fs/write_text_file on CLIENT (using ClientConn which represents client methods)
+	// Test file write - AGENT calls fs/write_text_file on CLIENT.
 	writeRequest := SampleWriteTextFileRequest("session-1", "/test/output.txt", "Written content")
-	err = pair.ClientConn.FsWriteTextFile(ctx, writeRequest)
+	err = pair.AgentConn.FsWriteTextFile(ctx, writeRequest)
 
 	require.NoError(t, err)
 
@@ -194,9 +240,9 @@ func TestHandlerRegistry_IntegrationErrorHandling(t *testing.T) {
 	// Configure test client to return error.
 	pair.TestClient.SetShouldError("fs/read_text_file", true)
 
-	// Test error propagation - AGENT calls fs/read_text_file on CLIENT (using ClientConn which represents client methods)
+	// Test error propagation - AGENT calls fs/read_text_file on CLIENT.
 	readRequest := SampleReadTextFileRequest("session-1", "/test/file.txt")
-	result, err := pair.ClientConn.FsReadTextFile(ctx, readRequest)
+	result, err := pair.AgentConn.FsReadTextFile(ctx, readRequest)
 
 	require.Error(t, err)
 	assert.Nil(t, result)
@@ -204,3 +250,77 @@ func TestHandlerRegistry_IntegrationErrorHandling(t *testing.T) {
 	// Check it's the expected ACP error.
 	AssertACPError(t, err, api.ErrorCodeNotFound)
 }
+
+func TestHandlerRegistry_ConnectionRejectsWrongRole(t *testing.T) {
+	transport := NewMockTransport()
+	defer transport.Close()
+	ctx := context.Background()
+
+	_, err := NewAgentConnectionStdio(ctx, transport.Agent(), NewClientHandlerRegistry(), testRequestTimeout)
+	require.ErrorIs(t, err, ErrWrongRole)
+
+	_, err = NewClientConnectionStdio(ctx, transport.Client(), NewAgentHandlerRegistry(), testRequestTimeout)
+	require.ErrorIs(t, err, ErrWrongRole)
+
+	registry := NewAgentHandlerRegistry()
+	registry.RegisterSessionUpdateHandler(func(_ context.Context, _ *api.SessionNotification) error {
+		return nil
+	})
+	_, err = NewAgentConnectionStdio(ctx, transport.Agent(), registry, testRequestTimeout)
+	require.ErrorIs(t, err, ErrWrongRole)
+}
+
+func TestHandlerRegistry_DeprecatedServesEitherRole(t *testing.T) {
+	ctx := context.Background()
+
+	agentHandler := NewHandlerRegistry()
+	agentHandler.RegisterInitializeHandler(func(_ context.Context, _ *api.InitializeRequest) (*api.InitializeResponse, error) {
+		return &api.InitializeResponse{ProtocolVersion: 1}, nil
+	})
+	clientHandler := NewHandlerRegistry()
+	clientHandler.RegisterFsReadTextFileHandler(func(_ context.Context, _ *api.ReadTextFileRequest) (*api.ReadTextFileResponse, error) {
+		return &api.ReadTextFileResponse{Content: "content"}, nil
+	})
+	require.NoError(t, agentHandler.Err())
+	require.NoError(t, clientHandler.Err())
+	agentConn, clientConn := NewRolePair(t, agentHandler, clientHandler)
+
+	initResp, err := clientConn.Initialize(ctx, &api.InitializeRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, api.ProtocolVersion(1), initResp.ProtocolVersion)
+
+	readResp, err := agentConn.FsReadTextFile(ctx, SampleReadTextFileRequest("s1", "/tmp/file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "content", readResp.Content)
+}
+
+func TestHandlerRegistry_HandlersSeeTheirOwnRole(t *testing.T) {
+	ctx := context.Background()
+
+	type roles struct {
+		agent  *AgentConnection
+		client *ClientConnection
+	}
+	agentSeen := make(chan roles, 1)
+	clientSeen := make(chan roles, 1)
+
+	agentHandler := NewAgentHandlerRegistry()
+	agentHandler.RegisterInitializeHandler(func(ctx context.Context, _ *api.InitializeRequest) (*api.InitializeResponse, error) {
+		agentSeen <- roles{agent: AgentConnectionFromContext(ctx), client: ClientConnectionFromContext(ctx)}
+		return &api.InitializeResponse{}, nil
+	})
+	clientHandler := NewClientHandlerRegistry()
+	clientHandler.RegisterFsReadTextFileHandler(func(ctx context.Context, _ *api.ReadTextFileRequest) (*api.ReadTextFileResponse, error) {
+		clientSeen <- roles{agent: AgentConnectionFromContext(ctx), client: ClientConnectionFromContext(ctx)}
+		return &api.ReadTextFileResponse{}, nil
+	})
+	agentConn, clientConn := NewRolePair(t, agentHandler, clientHandler)
+
+	_, err := clientConn.Initialize(ctx, &api.InitializeRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, roles{agent: agentConn}, <-agentSeen)
+
+	_, err = agentConn.FsReadTextFile(ctx, SampleReadTextFileRequest("s1", "/tmp/file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, roles{client: clientConn}, <-clientSeen)
+}
@@ -0,0 +1,94 @@
+// Package atomicfile replaces files atomically: data is written and synced to
+// a temporary file next to the target, which is then renamed over it, so
+// readers never see a partial write and a crash leaves either the old or the
+// new contents.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// tempFilePerm is the permission temporary files are created with, before
+// they are given their final permission.
+const tempFilePerm = 0o600
+
+// WriteFile atomically replaces the file at path with data and gives it perm.
+// The parent directory must exist.
+func WriteFile(path string, data []byte, perm fs.FileMode) error {
+	dir, err := os.OpenRoot(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return WriteFileIn(dir, filepath.Base(path), data, perm)
+}
+
+// WriteFileIn atomically replaces the file name inside dir with data and
+// gives it perm. The file's parent directory must exist.
+func WriteFileIn(dir *os.Root, name string, data []byte, perm fs.FileMode) error {
+	tmp, tmpName, err := createTemp(dir, name)
+	if err != nil {
+		return err
+	}
+
+	if _, writeErr := tmp.Write(data); writeErr != nil {
+		_ = tmp.Close()
+		_ = dir.Remove(tmpName)
+		return writeErr
+	}
+	if syncErr := tmp.Sync(); syncErr != nil {
+		_ = tmp.Close()
+		_ = dir.Remove(tmpName)
+		return syncErr
+	}
+	if closeErr := tmp.Close(); closeErr != nil {
+		_ = dir.Remove(tmpName)
+		return closeErr
+	}
+	if chmodErr := dir.Chmod(tmpName, perm); chmodErr != nil {
+		_ = dir.Remove(tmpName)
+		return chmodErr
+	}
+	if renameErr := dir.Rename(tmpName, name); renameErr != nil {
+		_ = dir.Remove(tmpName)
+		return renameErr
+	}
+	return syncDir(dir, filepath.Dir(name))
+}
+
+// syncDir flushes the directory holding a renamed file, so the rename itself
+// survives a crash. Windows cannot sync directories, and does not need to.
+func syncDir(dir *os.Root, name string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := dir.Open(name)
+	if err != nil {
+		return err
+	}
+	syncErr := d.Sync()
+	closeErr := d.Close()
+	return errors.Join(syncErr, closeErr)
+}
+
+// createTemp creates a new temporary file next to name, as os.CreateTemp
+// does, which os.Root has no equivalent of.
+func createTemp(dir *os.Root, name string) (*os.File, string, error) {
+	prefix := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".")
+	for range 10000 {
+		tmpName := prefix + strconv.FormatUint(uint64(rand.Uint32()), 10) + ".tmp"
+		file, err := dir.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_EXCL, tempFilePerm)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return file, tmpName, err
+	}
+	return nil, "", fmt.Errorf("failed to create a temporary file for %s: %w", name, fs.ErrExist)
+}
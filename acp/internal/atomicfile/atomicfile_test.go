@@ -0,0 +1,51 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	t.Run("CreatesAndReplaces", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "data.json")
+
+		require.NoError(t, WriteFile(path, []byte("one"), 0o600))
+		require.NoError(t, WriteFile(path, []byte("two"), 0o640))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "two", string(data))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("MissingDirectory", func(t *testing.T) {
+		err := WriteFile(filepath.Join(t.TempDir(), "missing", "data.json"), []byte("one"), 0o600)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("InRoot", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o750))
+		root, err := os.OpenRoot(dir)
+		require.NoError(t, err)
+		defer root.Close()
+
+		require.NoError(t, WriteFileIn(root, filepath.Join("sub", "data.json"), []byte("one"), 0o600))
+		data, err := os.ReadFile(filepath.Join(dir, "sub", "data.json"))
+		require.NoError(t, err)
+		assert.Equal(t, "one", string(data))
+
+		require.Error(t, WriteFileIn(root, filepath.Join("..", "escaped.json"), []byte("one"), 0o600))
+	})
+}
@@ -0,0 +1,155 @@
+// Package mcptest provides a fake stdio MCP server for tests. The server runs
+// inside the test binary itself, which TestMain re-executes.
+package mcptest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	// envMode selects the fake server's behavior when the test binary is
+	// launched as one.
+	envMode = "ACP_MCPTEST_FAKE_SERVER"
+	// modeServe serves requests.
+	modeServe = "serve"
+	// modeExit exits before the handshake.
+	modeExit = "exit"
+)
+
+// Main runs the fake server and exits if the test binary was launched as
+// one. Call it first in TestMain.
+func Main() {
+	switch os.Getenv(envMode) {
+	case modeServe:
+		serve()
+		os.Exit(0)
+	case modeExit:
+		os.Exit(2)
+	}
+}
+
+// Command returns the executable and environment that launch the fake
+// server.
+func Command() (string, []string) {
+	return os.Args[0], []string{envMode + "=" + modeServe}
+}
+
+// BrokenCommand returns the executable and environment that launch a fake
+// server that exits before completing the handshake.
+func BrokenCommand() (string, []string) {
+	return os.Args[0], []string{envMode + "=" + modeExit}
+}
+
+// Tools offered by the fake server:
+//
+//   - echo returns its "text" argument.
+//   - env returns the value of the environment variable named by "name".
+//   - cwd returns the working directory.
+//   - fail returns a tool error.
+//   - media returns an image and an embedded resource.
+//   - crash exits the process without answering.
+var tools = []map[string]any{
+	{"name": "echo", "description": "Echo text", "inputSchema": map[string]any{"type": "object"}},
+	{"name": "env", "inputSchema": map[string]any{"type": "object"}},
+	{"name": "cwd", "inputSchema": map[string]any{"type": "object"}},
+	{"name": "fail", "inputSchema": map[string]any{"type": "object"}},
+	{"name": "media", "inputSchema": map[string]any{"type": "object"}},
+	{"name": "crash", "inputSchema": map[string]any{"type": "object"}},
+}
+
+// message is a JSON-RPC request or notification.
+type message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// serve answers newline-delimited JSON-RPC requests on stdin until it closes.
+func serve() {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.ID == nil {
+			continue
+		}
+		result, code, text := handle(msg)
+		response := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+		if code != 0 {
+			response["error"] = map[string]any{"code": code, "message": text}
+		} else {
+			response["result"] = result
+		}
+		data, _ := json.Marshal(response)
+		fmt.Fprintf(os.Stdout, "%s\n", data)
+	}
+}
+
+// handle answers a request, returning a result or an error code and message.
+func handle(msg message) (any, int, string) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": "2025-06-18",
+			"capabilities":    map[string]any{"tools": map[string]any{"listChanged": true}},
+			"serverInfo":      map[string]any{"name": "fake", "version": "1.0.0"},
+		}, 0, ""
+	case "ping":
+		return map[string]any{}, 0, ""
+	case "tools/list":
+		// Two pages, to exercise pagination.
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+		if params.Cursor == "" {
+			return map[string]any{"tools": tools[:2], "nextCursor": "2"}, 0, ""
+		}
+		return map[string]any{"tools": tools[2:]}, 0, ""
+	case "tools/call":
+		return callTool(msg.Params)
+	default:
+		return nil, -32601, "method not found"
+	}
+}
+
+// callTool runs one of the fake tools.
+func callTool(raw json.RawMessage) (any, int, string) {
+	var params struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, -32602, err.Error()
+	}
+
+	text := func(s string) map[string]any {
+		return map[string]any{"content": []any{map[string]any{"type": "text", "text": s}}}
+	}
+	switch params.Name {
+	case "echo":
+		return text(params.Arguments["text"]), 0, ""
+	case "env":
+		return text(os.Getenv(params.Arguments["name"])), 0, ""
+	case "cwd":
+		dir, _ := os.Getwd()
+		return text(dir), 0, ""
+	case "fail":
+		result := text("tool failed")
+		result["isError"] = true
+		return result, 0, ""
+	case "media":
+		return map[string]any{"content": []any{
+			map[string]any{"type": "image", "data": "aW1n", "mimeType": "image/png"},
+			map[string]any{"type": "resource", "resource": map[string]any{
+				"uri": "file:///notes.txt", "mimeType": "text/plain", "text": "notes",
+			}},
+		}}, 0, ""
+	case "crash":
+		os.Exit(3)
+	}
+	return nil, -32602, "unknown tool " + params.Name
+}
@@ -0,0 +1,218 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// defaultClientInfo identifies the client when ClientOptions sets none.
+var defaultClientInfo = Implementation{Name: "agent-client-protocol-go", Version: "0.1.0"}
+
+// ErrConnectionClosed is returned by calls that were pending or made after the
+// connection to the server ended.
+var ErrConnectionClosed = errors.New("MCP connection is closed")
+
+// ClientOptions configures a Client.
+type ClientOptions struct {
+	// ClientInfo identifies the client to the server.
+	ClientInfo Implementation
+	// OnToolsChanged is called, on its own goroutine, when the server reports
+	// that its tool list changed.
+	OnToolsChanged func()
+}
+
+// Client is an initialized connection to an MCP server.
+//
+// Requests the server sends to the client are answered with method not
+// found, except ping.
+type Client struct {
+	conn           *jsonrpc2.Connection
+	info           InitializeResult
+	onToolsChanged func()
+	done           chan struct{}
+}
+
+// Connect performs the MCP initialize handshake over rwc, which carries
+// newline-delimited JSON-RPC messages as the stdio transport does. ctx bounds
+// the handshake only; the connection lasts until Close or the end of the
+// stream. The connection is closed if the handshake fails.
+func Connect(ctx context.Context, rwc io.ReadWriteCloser, opts ClientOptions) (*Client, error) {
+	c := &Client{
+		onToolsChanged: opts.OnToolsChanged,
+		done:           make(chan struct{}),
+	}
+	conn, err := jsonrpc2.Dial(context.WithoutCancel(ctx), dialer{rwc: rwc}, jsonrpc2.ConnectionOptions{
+		Framer:  lineFramer{},
+		Handler: jsonrpc2.HandlerFunc(c.handle),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial MCP server: %w", err)
+	}
+	c.conn = conn
+	go func() {
+		_ = conn.Wait()
+		close(c.done)
+	}()
+
+	clientInfo := opts.ClientInfo
+	if clientInfo.Name == "" {
+		clientInfo = defaultClientInfo
+	}
+	params := initializeParams{ProtocolVersion: ProtocolVersion, ClientInfo: clientInfo}
+	if err := c.call(ctx, MethodInitialize, params, &c.info); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("MCP initialize failed: %w", err)
+	}
+	if err := conn.Notify(ctx, NotificationInitialized, struct{}{}); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("MCP initialize failed: %w", err)
+	}
+	return c, nil
+}
+
+// ServerInfo returns the server's answer to the initialize handshake.
+func (c *Client) ServerInfo() InitializeResult {
+	return c.info
+}
+
+// ListTools returns all tools the server offers, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	params := listToolsParams{}
+	for {
+		var page listToolsResult
+		if err := c.call(ctx, MethodToolsList, params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = page.NextCursor
+	}
+}
+
+// CallTool calls a tool with the given arguments. A tool that fails returns
+// a result with IsError set rather than an error; errors are reserved for
+// protocol and transport failures.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]any) (*CallToolResult, error) {
+	var result CallToolResult
+	if err := c.call(ctx, MethodToolsCall, callToolParams{Name: name, Arguments: arguments}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Done returns a channel that is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// call sends a request and decodes its result. jsonrpc2 leaves calls pending
+// when the stream ends, so the wait is also cut short by the end of the
+// connection.
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-callCtx.Done():
+		}
+	}()
+
+	err := c.conn.Call(callCtx, method, params).Await(callCtx, result)
+	if err != nil && ctx.Err() == nil && callCtx.Err() != nil {
+		return ErrConnectionClosed
+	}
+	return err
+}
+
+// handle answers requests and notifications from the server.
+func (c *Client) handle(_ context.Context, req *jsonrpc2.Request) (interface{}, error) {
+	switch req.Method {
+	case MethodPing:
+		return struct{}{}, nil
+	case NotificationToolsListChanged:
+		if c.onToolsChanged != nil {
+			go c.onToolsChanged()
+		}
+		return nil, nil
+	}
+	if req.IsCall() {
+		return nil, jsonrpc2.ErrMethodNotFound
+	}
+	return nil, nil
+}
+
+// dialer returns an existing stream as the connection.
+type dialer struct {
+	rwc io.ReadWriteCloser
+}
+
+// Dial returns the stream.
+func (d dialer) Dial(_ context.Context) (io.ReadWriteCloser, error) {
+	return d.rwc, nil
+}
+
+// lineFramer frames messages as single lines of JSON, as required by the MCP
+// stdio transport.
+type lineFramer struct{}
+
+// Reader decodes one JSON message after another.
+func (lineFramer) Reader(r io.Reader) jsonrpc2.Reader {
+	return &lineReader{in: json.NewDecoder(r)}
+}
+
+// Writer writes each message followed by a newline.
+func (lineFramer) Writer(w io.Writer) jsonrpc2.Writer {
+	return &lineWriter{out: w}
+}
+
+// lineReader reads messages from a JSON stream.
+type lineReader struct {
+	in *json.Decoder
+}
+
+// Read reads the next message.
+func (r *lineReader) Read(ctx context.Context) (jsonrpc2.Message, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	var raw json.RawMessage
+	if err := r.in.Decode(&raw); err != nil {
+		return nil, 0, err
+	}
+	msg, err := jsonrpc2.DecodeMessage(raw)
+	return msg, int64(len(raw)), err
+}
+
+// lineWriter writes newline-terminated messages.
+type lineWriter struct {
+	out io.Writer
+}
+
+// Write writes a message. encoding/json never emits raw newlines, so a
+// message always fits on one line.
+func (w *lineWriter) Write(ctx context.Context, msg jsonrpc2.Message) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	data, err := jsonrpc2.EncodeMessage(msg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode message: %w", err)
+	}
+	n, err := w.out.Write(append(data, '\n'))
+	return int64(n), err
+}
@@ -0,0 +1,481 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultStartTimeout bounds launching a server, the handshake and listing tools.
+	defaultStartTimeout = 10 * time.Second
+	// defaultMaxRestarts is the number of consecutive restarts before giving up.
+	defaultMaxRestarts = 5
+	// defaultRestartDelay is the delay before the first restart.
+	defaultRestartDelay = 200 * time.Millisecond
+	// maxRestartDelay caps the doubling restart delay.
+	maxRestartDelay = 30 * time.Second
+	// stableRunTime is how long a server must run for its restart count and
+	// delay to be reset.
+	stableRunTime = time.Minute
+	// shutdownGrace is how long a server may take to exit after its input is
+	// closed before it is killed.
+	shutdownGrace = 2 * time.Second
+)
+
+// ErrServerStopped is returned by calls to a Server that has been closed.
+var ErrServerStopped = errors.New("MCP server is stopped")
+
+// ServerState is the lifecycle state of a Server.
+type ServerState int
+
+const (
+	// ServerStarting means the process is being launched for the first time.
+	ServerStarting ServerState = iota
+	// ServerRunning means the server completed the handshake and serves calls.
+	ServerRunning
+	// ServerRestarting means the server exited or failed to start and will be
+	// launched again.
+	ServerRestarting
+	// ServerFailed means the server exceeded its restarts and was given up.
+	ServerFailed
+	// ServerStopped means the server was closed.
+	ServerStopped
+)
+
+// String returns the name of the state.
+func (s ServerState) String() string {
+	switch s {
+	case ServerStarting:
+		return "starting"
+	case ServerRunning:
+		return "running"
+	case ServerRestarting:
+		return "restarting"
+	case ServerFailed:
+		return "failed"
+	case ServerStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("ServerState(%d)", int(s))
+	}
+}
+
+// Config describes a stdio MCP server.
+type Config struct {
+	// Name identifies the server.
+	Name string
+	// Command is the executable to launch.
+	Command string
+	// Args are the command-line arguments.
+	Args []string
+	// Env holds KEY=VALUE pairs added to the current process environment.
+	Env []string
+	// Dir is the working directory, or the current one if empty.
+	Dir string
+}
+
+// Options configures how a Server is run.
+type Options struct {
+	// ClientInfo identifies the client during the handshake.
+	ClientInfo Implementation
+	// StartTimeout bounds launching the process, the initialize handshake and
+	// listing tools. Defaults to 10 seconds.
+	StartTimeout time.Duration
+	// MaxRestarts is the number of consecutive restarts after which the
+	// server is given up. The count is reset once the server has run for a
+	// minute. Defaults to 5; a negative value disables restarts.
+	MaxRestarts int
+	// RestartDelay is the delay before the first restart. It doubles with
+	// each consecutive restart, up to 30 seconds. Defaults to 200ms.
+	RestartDelay time.Duration
+	// Stderr receives the server's standard error. It is discarded if nil.
+	Stderr io.Writer
+}
+
+// Server runs a stdio MCP server process and keeps an initialized Client
+// connected to it.
+//
+// The process is launched again if it exits, its connection breaks or its
+// handshake fails, after a delay that doubles with each consecutive restart.
+// Calls made while the server restarts wait for it to be running again. A
+// call in progress when the process exits fails and is not retried, since
+// tools may have side effects.
+type Server struct {
+	config Config
+	opts   Options
+
+	mu       sync.Mutex
+	state    ServerState
+	client   *Client
+	tools    []Tool
+	err      error
+	restarts int
+	changed  chan struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Start launches the server in the background. Use WaitReady to wait for
+// the first handshake.
+func Start(config Config, opts Options) (*Server, error) {
+	if config.Command == "" {
+		return nil, fmt.Errorf("MCP server %q has no command", config.Name)
+	}
+	if opts.StartTimeout <= 0 {
+		opts.StartTimeout = defaultStartTimeout
+	}
+	if opts.MaxRestarts == 0 {
+		opts.MaxRestarts = defaultMaxRestarts
+	}
+	if opts.RestartDelay <= 0 {
+		opts.RestartDelay = defaultRestartDelay
+	}
+
+	s := &Server{
+		config:  config,
+		opts:    opts,
+		changed: make(chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Name returns the server's name.
+func (s *Server) Name() string {
+	return s.config.Name
+}
+
+// State returns the server's lifecycle state.
+func (s *Server) State() ServerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Err returns the error that caused the last restart or the failure, or nil.
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Restarts returns how many times the server has been restarted.
+func (s *Server) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// Tools returns the tools listed by the running server. The list is
+// refreshed when the server reports that it changed.
+func (s *Server) Tools() []Tool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.tools)
+}
+
+// WaitReady waits until the server is running. It fails if the server is
+// given up or closed first.
+func (s *Server) WaitReady(ctx context.Context) error {
+	_, err := s.Client(ctx)
+	return err
+}
+
+// Client returns the client connected to the running server, waiting while
+// the server starts or restarts.
+func (s *Server) Client(ctx context.Context) (*Client, error) {
+	for {
+		s.mu.Lock()
+		state, client, err, changed := s.state, s.client, s.err, s.changed
+		s.mu.Unlock()
+
+		switch state {
+		case ServerRunning:
+			// A client whose connection ended is about to be replaced.
+			select {
+			case <-client.Done():
+			default:
+				return client, nil
+			}
+		case ServerFailed:
+			return nil, err
+		case ServerStopped:
+			return nil, ErrServerStopped
+		case ServerStarting, ServerRestarting:
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ListTools lists the tools of the running server.
+func (s *Server) ListTools(ctx context.Context) ([]Tool, error) {
+	client, err := s.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListTools(ctx)
+}
+
+// CallTool calls a tool on the running server.
+func (s *Server) CallTool(ctx context.Context, name string, arguments map[string]any) (*CallToolResult, error) {
+	client, err := s.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.CallTool(ctx, name, arguments)
+}
+
+// Close shuts the server down and waits for its process to exit. The
+// process's input is closed first, and it is killed if it does not exit
+// shortly after.
+func (s *Server) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return nil
+}
+
+// run launches the server and relaunches it until it is closed or given up.
+func (s *Server) run() {
+	defer close(s.done)
+
+	delay := s.opts.RestartDelay
+	consecutive := 0
+	for {
+		started := time.Now()
+		err := s.runOnce()
+		if s.stopping() {
+			s.setState(ServerStopped, nil, nil)
+			return
+		}
+
+		if time.Since(started) >= stableRunTime {
+			consecutive = 0
+			delay = s.opts.RestartDelay
+		}
+		if s.opts.MaxRestarts < 0 || consecutive >= s.opts.MaxRestarts {
+			s.setState(ServerFailed, nil, fmt.Errorf("MCP server %q failed: %w", s.config.Name, err))
+			return
+		}
+		consecutive++
+		s.mu.Lock()
+		s.restarts++
+		s.mu.Unlock()
+		s.setState(ServerRestarting, nil, err)
+
+		select {
+		case <-time.After(delay):
+		case <-s.stop:
+			s.setState(ServerStopped, nil, nil)
+			return
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+// runOnce launches the process, connects to it and waits for it to exit or
+// for the server to be closed. It returns why the process ended.
+func (s *Server) runOnce() error {
+	cmd := exec.Command(s.config.Command, s.config.Args...)
+	cmd.Env = append(os.Environ(), s.config.Env...)
+	cmd.Dir = s.config.Dir
+	cmd.Stderr = s.opts.Stderr
+
+	stream, err := startProcess(cmd)
+	if err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	var exitErr error
+	go func() {
+		exitErr = cmd.Wait()
+		close(exited)
+	}()
+
+	// The handshake is abandoned if the server is closed or the process exits.
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.StartTimeout)
+	go func() {
+		select {
+		case <-s.stop:
+		case <-exited:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	client, tools, err := s.connect(ctx, stream)
+	cancel()
+	if err != nil {
+		_ = stream.Close()
+		_ = cmd.Process.Kill()
+		<-exited
+		return err
+	}
+	s.mu.Lock()
+	s.tools = tools
+	s.mu.Unlock()
+	s.setState(ServerRunning, client, nil)
+
+	select {
+	case <-exited:
+		_ = client.Close()
+		return exitError(exitErr)
+	case <-client.Done():
+		// The stream usually ends because the process exited.
+		select {
+		case <-exited:
+			return exitError(exitErr)
+		case <-time.After(shutdownGrace):
+			_ = cmd.Process.Kill()
+			<-exited
+			return errors.New("connection closed")
+		}
+	case <-s.stop:
+		_ = client.Close()
+		select {
+		case <-exited:
+		case <-time.After(shutdownGrace):
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+		return nil
+	}
+}
+
+// exitError describes a process exit with the error returned by Wait.
+func exitError(err error) error {
+	if err != nil {
+		return fmt.Errorf("process exited: %w", err)
+	}
+	return errors.New("process exited")
+}
+
+// connect performs the handshake and lists the server's tools.
+func (s *Server) connect(ctx context.Context, stream io.ReadWriteCloser) (*Client, []Tool, error) {
+	client, err := Connect(ctx, stream, ClientOptions{
+		ClientInfo:     s.opts.ClientInfo,
+		OnToolsChanged: s.refreshTools,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		_ = client.Close()
+		return nil, nil, fmt.Errorf("failed to list MCP tools: %w", err)
+	}
+	return client, tools, nil
+}
+
+// refreshTools lists the tools again after the server reported a change.
+// Changes reported during the handshake are covered by the initial listing.
+func (s *Server) refreshTools() {
+	s.mu.Lock()
+	client := s.client
+	s.mu.Unlock()
+	if client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.StartTimeout)
+	defer cancel()
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == client {
+		s.tools = tools
+	}
+}
+
+// setState records a state change and wakes the callers waiting for one.
+func (s *Server) setState(state ServerState, client *Client, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	s.client = client
+	if err != nil {
+		s.err = err
+	}
+	if client == nil {
+		s.tools = nil
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// stopping reports whether Close has been called.
+func (s *Server) stopping() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// startProcess starts cmd with its standard input and output connected to
+// the returned stream.
+func startProcess(cmd *exec.Cmd) (io.ReadWriteCloser, error) {
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		_ = stdinReader.Close()
+		_ = stdinWriter.Close()
+		return nil, err
+	}
+
+	cmd.Stdin = stdinReader
+	cmd.Stdout = stdoutWriter
+	err = cmd.Start()
+	// The child holds its own copies of these ends.
+	_ = stdinReader.Close()
+	_ = stdoutWriter.Close()
+	if err != nil {
+		_ = stdinWriter.Close()
+		_ = stdoutReader.Close()
+		return nil, fmt.Errorf("failed to start MCP server: %w", err)
+	}
+	return processStream{stdout: stdoutReader, stdin: stdinWriter}, nil
+}
+
+// processStream reads a process's standard output and writes its standard
+// input.
+type processStream struct {
+	stdout *os.File
+	stdin  *os.File
+}
+
+// Read reads from the process's standard output.
+func (p processStream) Read(b []byte) (int, error) {
+	return p.stdout.Read(b)
+}
+
+// Write writes to the process's standard input.
+func (p processStream) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+// Close closes both pipes.
+func (p processStream) Close() error {
+	return errors.Join(p.stdin.Close(), p.stdout.Close())
+}
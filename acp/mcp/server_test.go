@@ -0,0 +1,168 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/internal/mcptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	mcptest.Main()
+	os.Exit(m.Run())
+}
+
+// startFake starts the fake MCP server and waits for its handshake.
+func startFake(t *testing.T, config Config, opts Options) *Server {
+	t.Helper()
+	command, env := mcptest.Command()
+	config.Command = command
+	config.Env = append(config.Env, env...)
+	if opts.RestartDelay == 0 {
+		opts.RestartDelay = 10 * time.Millisecond
+	}
+
+	server, err := Start(config, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.WaitReady(ctx))
+	return server
+}
+
+// text returns the text of a single-item text result.
+func text(t *testing.T, result *CallToolResult) string {
+	t.Helper()
+	require.Len(t, result.Content, 1)
+	require.Equal(t, ContentTypeText, result.Content[0].Type)
+	return result.Content[0].Text
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("HandshakeAndTools", func(t *testing.T) {
+		server := startFake(t, Config{Name: "fake"}, Options{})
+		assert.Equal(t, ServerRunning, server.State())
+		assert.Equal(t, "fake", server.Name())
+
+		client, err := server.Client(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "fake", client.ServerInfo().ServerInfo.Name)
+		assert.Equal(t, ProtocolVersion, client.ServerInfo().ProtocolVersion)
+
+		// The fake server lists its tools on two pages.
+		var names []string
+		for _, tool := range server.Tools() {
+			names = append(names, tool.Name)
+		}
+		assert.Equal(t, []string{"echo", "env", "cwd", "fail", "media", "crash"}, names)
+		assert.Equal(t, "Echo text", server.Tools()[0].Description)
+	})
+
+	t.Run("CallTool", func(t *testing.T) {
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		require.NoError(t, err)
+		server := startFake(t, Config{Name: "fake", Env: []string{"GREETING=hello"}, Dir: dir}, Options{})
+
+		result, err := server.CallTool(ctx, "echo", map[string]any{"text": "hi"})
+		require.NoError(t, err)
+		assert.False(t, result.IsError)
+		assert.Equal(t, "hi", text(t, result))
+
+		result, err = server.CallTool(ctx, "env", map[string]any{"name": "GREETING"})
+		require.NoError(t, err)
+		assert.Equal(t, "hello", text(t, result))
+
+		result, err = server.CallTool(ctx, "cwd", nil)
+		require.NoError(t, err)
+		assert.Equal(t, dir, text(t, result))
+	})
+
+	t.Run("ToolErrorAndContent", func(t *testing.T) {
+		server := startFake(t, Config{Name: "fake"}, Options{})
+
+		result, err := server.CallTool(ctx, "fail", nil)
+		require.NoError(t, err)
+		assert.True(t, result.IsError)
+		assert.Equal(t, "tool failed", text(t, result))
+
+		result, err = server.CallTool(ctx, "media", nil)
+		require.NoError(t, err)
+		require.Len(t, result.Content, 2)
+		assert.Equal(t, Content{Type: ContentTypeImage, Data: "aW1n", MimeType: "image/png"}, result.Content[0])
+		require.NotNil(t, result.Content[1].Resource)
+		assert.Equal(t, "file:///notes.txt", result.Content[1].Resource.URI)
+		assert.Equal(t, "notes", *result.Content[1].Resource.Text)
+
+		_, err = server.CallTool(ctx, "missing", nil)
+		require.Error(t, err)
+	})
+
+	t.Run("RestartsAfterCrash", func(t *testing.T) {
+		server := startFake(t, Config{Name: "fake"}, Options{})
+
+		_, err := server.CallTool(ctx, "crash", nil)
+		require.Error(t, err)
+
+		callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		result, err := server.CallTool(callCtx, "echo", map[string]any{"text": "back"})
+		require.NoError(t, err)
+		assert.Equal(t, "back", text(t, result))
+		assert.Equal(t, 1, server.Restarts())
+		assert.ErrorContains(t, server.Err(), "process exited")
+		assert.Len(t, server.Tools(), 6)
+	})
+
+	t.Run("GivesUpAfterMaxRestarts", func(t *testing.T) {
+		command, env := mcptest.BrokenCommand()
+		server, err := Start(
+			Config{Name: "broken", Command: command, Env: env},
+			Options{MaxRestarts: 2, RestartDelay: time.Millisecond},
+		)
+		require.NoError(t, err)
+		defer server.Close()
+
+		waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = server.WaitReady(waitCtx)
+		require.ErrorContains(t, err, `MCP server "broken" failed`)
+		assert.Equal(t, ServerFailed, server.State())
+		assert.Equal(t, 2, server.Restarts())
+	})
+
+	t.Run("NoRestarts", func(t *testing.T) {
+		server := startFake(t, Config{Name: "fake"}, Options{MaxRestarts: -1})
+
+		_, err := server.CallTool(ctx, "crash", nil)
+		require.Error(t, err)
+		waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		require.Error(t, server.WaitReady(waitCtx))
+		assert.Equal(t, ServerFailed, server.State())
+		assert.Zero(t, server.Restarts())
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		server := startFake(t, Config{Name: "fake"}, Options{})
+
+		require.NoError(t, server.Close())
+		assert.Equal(t, ServerStopped, server.State())
+		_, err := server.CallTool(ctx, "echo", nil)
+		require.ErrorIs(t, err, ErrServerStopped)
+		require.NoError(t, server.Close())
+	})
+
+	t.Run("MissingCommand", func(t *testing.T) {
+		_, err := Start(Config{Name: "empty"}, Options{})
+		require.Error(t, err)
+	})
+}
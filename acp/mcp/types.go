@@ -0,0 +1,113 @@
+package mcp
+
+import "encoding/json"
+
+// ProtocolVersion is the MCP protocol version requested during initialize.
+const ProtocolVersion = "2025-06-18"
+
+// MCP method and notification names used by the client.
+const (
+	MethodInitialize             = "initialize"
+	MethodPing                   = "ping"
+	MethodToolsList              = "tools/list"
+	MethodToolsCall              = "tools/call"
+	NotificationInitialized      = "notifications/initialized"
+	NotificationToolsListChanged = "notifications/tools/list_changed"
+)
+
+// Content types of tool result content.
+const (
+	ContentTypeText         = "text"
+	ContentTypeImage        = "image"
+	ContentTypeAudio        = "audio"
+	ContentTypeResource     = "resource"
+	ContentTypeResourceLink = "resource_link"
+)
+
+// Implementation names and versions an MCP client or server.
+type Implementation struct {
+	Name    string `json:"name"`
+	Title   string `json:"title,omitempty"`
+	Version string `json:"version"`
+}
+
+// InitializeResult is the server's answer to the initialize handshake.
+type InitializeResult struct {
+	ProtocolVersion string          `json:"protocolVersion"`
+	Capabilities    json.RawMessage `json:"capabilities,omitempty"`
+	ServerInfo      Implementation  `json:"serverInfo"`
+	Instructions    string          `json:"instructions,omitempty"`
+}
+
+// Tool describes a tool offered by an MCP server.
+type Tool struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// Content is one item of tool result content. Type selects which of the
+// other fields are set.
+type Content struct {
+	Type string `json:"type"`
+
+	// Text is set for text content.
+	Text string `json:"text,omitempty"`
+
+	// Data and MimeType are set for image and audio content. Data is base64
+	// encoded.
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+
+	// Resource is set for embedded resource content.
+	Resource *ResourceContents `json:"resource,omitempty"`
+
+	// URI, Name and Description are set for resource links, along with
+	// MimeType and Size.
+	URI         string `json:"uri,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Size        *int64 `json:"size,omitempty"`
+}
+
+// ResourceContents is the content of an embedded resource. Text is set for
+// text resources and Blob, base64 encoded, for binary ones.
+type ResourceContents struct {
+	URI      string  `json:"uri"`
+	MimeType string  `json:"mimeType,omitempty"`
+	Text     *string `json:"text,omitempty"`
+	Blob     *string `json:"blob,omitempty"`
+}
+
+// CallToolResult is the result of a tools/call request. IsError reports a
+// tool failure; the content then describes the error.
+type CallToolResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// initializeParams are the parameters of the initialize request.
+type initializeParams struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    struct{}       `json:"capabilities"`
+	ClientInfo      Implementation `json:"clientInfo"`
+}
+
+// listToolsParams are the parameters of the tools/list request.
+type listToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// listToolsResult is one page of the tools/list response.
+type listToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// callToolParams are the parameters of the tools/call request.
+type callToolParams struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
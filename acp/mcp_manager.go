@@ -0,0 +1,233 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/acp/mcp"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// MCPManager runs the stdio MCP servers that clients list in session/new and
+// session/load, one set per session.
+//
+// Servers are launched in the session's working directory, with the
+// requested environment variables added to the agent's environment, once the
+// handler has answered the request. The response does not wait for the
+// servers; use MCPSession.WaitReady, or call tools, which wait for their
+// server. Servers are restarted if they crash, as described by mcp.Server.
+//
+// A session's servers are stopped when the session is loaded again, when it
+// is removed from a SessionManager bound with BindSessionManager, and when
+// the connection closes.
+type MCPManager struct {
+	opts     mcp.Options
+	sessions *util.SyncMap[api.SessionId, *MCPSession]
+	closed   atomic.Bool
+}
+
+// NewMCPManager creates an MCP manager bound to the connection's lifecycle.
+// It should be created before the connection starts serving requests.
+func NewMCPManager(conn *AgentConnection, opts mcp.Options) *MCPManager {
+	m := &MCPManager{
+		opts:     opts,
+		sessions: util.NewSyncMap[api.SessionId, *MCPSession](),
+	}
+	conn.core.intercept(m.intercept)
+	conn.core.onClose(func() { _ = m.CloseAll() })
+	return m
+}
+
+// BindSessionManager stops a session's servers when the session is removed
+// from the manager, whether it was deleted, reaped or detached because its
+// connection closed.
+func (m *MCPManager) BindSessionManager(manager *SessionManager) {
+	manager.onDelete(func(session *SessionState, _ SessionDeleteReason) {
+		_ = m.StopSession(session.ID)
+	})
+}
+
+// StartSession launches the servers of a session, replacing any it already
+// has; the replaced servers are stopped in the background. Invalid server
+// configurations are skipped and reported in the error, which is also kept
+// as the session's Err; the other servers still start.
+func (m *MCPManager) StartSession(id api.SessionId, cwd string, servers []api.McpServer) (*MCPSession, error) {
+	session := &MCPSession{id: id}
+	var errs []error
+	for _, server := range servers {
+		env := make([]string, 0, len(server.Env))
+		for _, variable := range server.Env {
+			env = append(env, variable.Name+"="+variable.Value)
+		}
+		started, err := mcp.Start(mcp.Config{
+			Name:    server.Name,
+			Command: server.Command,
+			Args:    server.Args,
+			Env:     env,
+			Dir:     cwd,
+		}, m.opts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		session.servers = append(session.servers, started)
+	}
+	session.err = errors.Join(errs...)
+
+	if previous, exists := m.sessions.Swap(id, session); exists {
+		// Stopping can take a while and must not hold up the caller.
+		go func() { _ = previous.Close() }()
+	}
+	// Servers started while the connection closed would outlive it.
+	if m.closed.Load() {
+		_ = m.StopSession(id)
+		return session, errors.Join(session.err, ErrConnectionClosed)
+	}
+	return session, session.err
+}
+
+// Session returns the MCP servers of a session.
+func (m *MCPManager) Session(id api.SessionId) (*MCPSession, bool) {
+	return m.sessions.Load(id)
+}
+
+// StopSession stops the servers of a session.
+func (m *MCPManager) StopSession(id api.SessionId) error {
+	if session, exists := m.sessions.LoadAndDelete(id); exists {
+		return session.Close()
+	}
+	return nil
+}
+
+// CloseAll stops the servers of every session. Sessions started afterwards
+// are stopped right away.
+func (m *MCPManager) CloseAll() error {
+	m.closed.Store(true)
+	var wg sync.WaitGroup
+	for id := range m.sessions.GetAll() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = m.StopSession(id)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// intercept starts a session's servers after session/new or session/load
+// succeeds. Servers that fail to start are reported by the session's Err, as
+// the response cannot carry them.
+func (m *MCPManager) intercept(ctx context.Context, req *jsonrpc2.Request, next dispatchFunc) (interface{}, error) {
+	if req.Method != api.MethodSessionNew && req.Method != api.MethodSessionLoad {
+		return next(ctx, req)
+	}
+
+	result, err := next(ctx, req)
+	if err != nil {
+		return result, err
+	}
+
+	var params struct {
+		Cwd        string          `json:"cwd"`
+		McpServers []api.McpServer `json:"mcpServers"`
+		SessionId  api.SessionId   `json:"sessionId"`
+	}
+	if decodeErr := json.Unmarshal(req.Params, &params); decodeErr != nil {
+		return result, nil
+	}
+	if req.Method == api.MethodSessionNew {
+		var response api.NewSessionResponse
+		if decodeErr := remarshal(result, &response); decodeErr != nil {
+			return result, nil
+		}
+		params.SessionId = response.SessionId
+	}
+	if params.SessionId == "" || len(params.McpServers) == 0 {
+		return result, nil
+	}
+
+	_, _ = m.StartSession(params.SessionId, params.Cwd, params.McpServers)
+	return result, nil
+}
+
+// MCPSession holds the MCP servers of one session.
+type MCPSession struct {
+	id      api.SessionId
+	servers []*mcp.Server
+	err     error
+}
+
+// ID returns the session ID.
+func (s *MCPSession) ID() api.SessionId {
+	return s.id
+}
+
+// Err returns the errors of the servers that could not be started, which are
+// missing from Servers, or nil if every server was started.
+func (s *MCPSession) Err() error {
+	return s.err
+}
+
+// Servers returns the session's servers in the order the client listed them.
+func (s *MCPSession) Servers() []*mcp.Server {
+	return append([]*mcp.Server(nil), s.servers...)
+}
+
+// Server returns the first server with the given name.
+func (s *MCPSession) Server(name string) (*mcp.Server, bool) {
+	for _, server := range s.servers {
+		if server.Name() == name {
+			return server, true
+		}
+	}
+	return nil, false
+}
+
+// WaitReady waits until every server is running. It returns the errors of
+// the servers that were given up.
+func (s *MCPSession) WaitReady(ctx context.Context) error {
+	var errs []error
+	for _, server := range s.servers {
+		if err := server.WaitReady(ctx); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CallTool calls a tool on the named server.
+func (s *MCPSession) CallTool(
+	ctx context.Context,
+	server, tool string,
+	arguments map[string]any,
+) (*mcp.CallToolResult, error) {
+	target, exists := s.Server(server)
+	if !exists {
+		return nil, fmt.Errorf("session %s has no MCP server %q", s.id, server)
+	}
+	return target.CallTool(ctx, tool, arguments)
+}
+
+// Close stops the session's servers.
+func (s *MCPSession) Close() error {
+	var wg sync.WaitGroup
+	for _, server := range s.servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = server.Close()
+		}()
+	}
+	wg.Wait()
+	return nil
+}
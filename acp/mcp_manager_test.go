@@ -0,0 +1,209 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/acp/internal/mcptest"
+	"github.com/joshgarnett/agent-client-protocol-go/acp/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	mcptest.Main()
+	os.Exit(m.Run())
+}
+
+// fakeMcpServer returns a session/new entry for the fake MCP server.
+func fakeMcpServer(name string, env ...api.EnvVariable) api.McpServer {
+	command, fakeEnv := mcptest.Command()
+	for _, variable := range fakeEnv {
+		name, value, _ := strings.Cut(variable, "=")
+		env = append(env, api.EnvVariable{Name: name, Value: value})
+	}
+	return api.McpServer{Name: name, Command: command, Args: []string{}, Env: env}
+}
+
+// newMCPPair creates a connection pair whose agent runs the MCP servers of
+// its sessions, and whose session/new handler fails when failNew is set.
+func newMCPPair(t *testing.T, failNew bool) (*AgentConnection, *ClientConnection, *MCPManager) {
+	t.Helper()
+
+	agentHandler := NewAgentHandlerRegistry()
+	agentHandler.RegisterSessionNewHandler(
+		func(_ context.Context, _ *api.NewSessionRequest) (*api.NewSessionResponse, error) {
+			if failNew {
+				return nil, errors.New("no sessions today")
+			}
+			return &api.NewSessionResponse{SessionId: "s1"}, nil
+		},
+	)
+	agentHandler.RegisterSessionLoadHandler(func(_ context.Context, _ *api.LoadSessionRequest) error {
+		return nil
+	})
+	agentConn, clientConn := NewRolePair(t, agentHandler, NewClientHandlerRegistry())
+	manager := NewMCPManager(agentConn, mcp.Options{RestartDelay: 10 * time.Millisecond})
+	return agentConn, clientConn, manager
+}
+
+// readySession waits for the servers of a session to be running.
+func readySession(t *testing.T, manager *MCPManager, id api.SessionId) *MCPSession {
+	t.Helper()
+	session, exists := manager.Session(id)
+	require.True(t, exists)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, session.WaitReady(ctx))
+	return session
+}
+
+func TestMCPManager(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("StartsServersOnSessionNew", func(t *testing.T) {
+		_, clientConn, manager := newMCPPair(t, false)
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		require.NoError(t, err)
+
+		_, err = clientConn.SessionNew(ctx, &api.NewSessionRequest{
+			Cwd: dir,
+			McpServers: []api.McpServer{
+				fakeMcpServer("tools", api.EnvVariable{Name: "GREETING", Value: "hello"}),
+				fakeMcpServer("more"),
+			},
+		})
+		require.NoError(t, err)
+
+		session := readySession(t, manager, "s1")
+		assert.Equal(t, api.SessionId("s1"), session.ID())
+		require.NoError(t, session.Err())
+		require.Len(t, session.Servers(), 2)
+		server, exists := session.Server("tools")
+		require.True(t, exists)
+		assert.Len(t, server.Tools(), 6)
+
+		result, err := session.CallTool(ctx, "tools", "env", map[string]any{"name": "GREETING"})
+		require.NoError(t, err)
+		assert.Equal(t, "hello", result.Content[0].Text)
+
+		result, err = session.CallTool(ctx, "more", "cwd", nil)
+		require.NoError(t, err)
+		assert.Equal(t, dir, result.Content[0].Text)
+
+		_, err = session.CallTool(ctx, "missing", "echo", nil)
+		require.Error(t, err)
+	})
+
+	t.Run("NoServersOnFailedSessionNew", func(t *testing.T) {
+		_, clientConn, manager := newMCPPair(t, true)
+
+		_, err := clientConn.SessionNew(ctx, &api.NewSessionRequest{
+			Cwd:        "/tmp",
+			McpServers: []api.McpServer{fakeMcpServer("tools")},
+		})
+		require.Error(t, err)
+		_, exists := manager.Session("s1")
+		assert.False(t, exists)
+	})
+
+	t.Run("SessionLoadReplacesServers", func(t *testing.T) {
+		_, clientConn, manager := newMCPPair(t, false)
+
+		_, err := clientConn.SessionNew(ctx, &api.NewSessionRequest{
+			Cwd:        "/tmp",
+			McpServers: []api.McpServer{fakeMcpServer("old")},
+		})
+		require.NoError(t, err)
+		old := readySession(t, manager, "s1").Servers()[0]
+
+		err = clientConn.SessionLoad(ctx, &api.LoadSessionRequest{
+			SessionId:  "s1",
+			Cwd:        "/tmp",
+			McpServers: []api.McpServer{fakeMcpServer("new")},
+		})
+		require.NoError(t, err)
+
+		session := readySession(t, manager, "s1")
+		_, exists := session.Server("new")
+		assert.True(t, exists)
+		require.Eventually(t, func() bool {
+			return old.State() == mcp.ServerStopped
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("StopsServersWhenSessionDeleted", func(t *testing.T) {
+		agentConn, clientConn, manager := newMCPPair(t, false)
+		sessions := NewSessionManager()
+		agentConn.BindSessionManager(sessions)
+		manager.BindSessionManager(sessions)
+
+		_, err := clientConn.SessionNew(ctx, &api.NewSessionRequest{
+			Cwd:        "/tmp",
+			McpServers: []api.McpServer{fakeMcpServer("tools")},
+		})
+		require.NoError(t, err)
+		server := readySession(t, manager, "s1").Servers()[0]
+
+		require.NoError(t, sessions.DeleteSession("s1"))
+		require.Eventually(t, func() bool {
+			return server.State() == mcp.ServerStopped
+		}, 5*time.Second, 10*time.Millisecond)
+		_, exists := manager.Session("s1")
+		assert.False(t, exists)
+	})
+
+	t.Run("StopsServersWhenConnectionCloses", func(t *testing.T) {
+		agentConn, clientConn, manager := newMCPPair(t, false)
+
+		_, err := clientConn.SessionNew(ctx, &api.NewSessionRequest{
+			Cwd:        "/tmp",
+			McpServers: []api.McpServer{fakeMcpServer("tools")},
+		})
+		require.NoError(t, err)
+		server := readySession(t, manager, "s1").Servers()[0]
+
+		require.NoError(t, agentConn.Close())
+		assert.Equal(t, mcp.ServerStopped, server.State())
+		_, exists := manager.Session("s1")
+		assert.False(t, exists)
+
+		_, err = manager.StartSession("s2", "/tmp", []api.McpServer{fakeMcpServer("late")})
+		require.ErrorIs(t, err, ErrConnectionClosed)
+		_, exists = manager.Session("s2")
+		assert.False(t, exists)
+	})
+
+	t.Run("InvalidServerIsSkipped", func(t *testing.T) {
+		_, _, manager := newMCPPair(t, false)
+
+		session, err := manager.StartSession("s1", "/tmp", []api.McpServer{
+			{Name: "empty"},
+			fakeMcpServer("tools"),
+		})
+		require.Error(t, err)
+		assert.Equal(t, err, session.Err())
+		require.Len(t, session.Servers(), 1)
+		readySession(t, manager, "s1")
+	})
+
+	t.Run("ReportsStartErrorsOfSessionNew", func(t *testing.T) {
+		_, clientConn, manager := newMCPPair(t, false)
+
+		_, err := clientConn.SessionNew(ctx, &api.NewSessionRequest{
+			Cwd:        "/tmp",
+			McpServers: []api.McpServer{{Name: "empty"}, fakeMcpServer("tools")},
+		})
+		require.NoError(t, err)
+		session := readySession(t, manager, "s1")
+		require.Error(t, session.Err())
+		assert.Len(t, session.Servers(), 1)
+	})
+}
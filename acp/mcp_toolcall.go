@@ -0,0 +1,195 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/acp/mcp"
+)
+
+// MCPToolCaller calls MCP tools. It is implemented by mcp.Server and
+// mcp.Client.
+type MCPToolCaller interface {
+	CallTool(ctx context.Context, name string, arguments map[string]any) (*mcp.CallToolResult, error)
+}
+
+// MCPContentBlock converts MCP content to an ACP content block. ACP content
+// blocks are modelled on MCP's, so every MCP content type has an equivalent.
+func MCPContentBlock(content mcp.Content) (api.ContentBlock, error) {
+	switch content.Type {
+	case mcp.ContentTypeText:
+		return NewTextContent(content.Text), nil
+	case mcp.ContentTypeImage:
+		return api.ContentBlock{
+			Type:  api.ContentBlockTypeImage,
+			Image: &api.ContentBlockImage{Data: content.Data, Mimetype: content.MimeType},
+		}, nil
+	case mcp.ContentTypeAudio:
+		return api.ContentBlock{
+			Type:  api.ContentBlockTypeAudio,
+			Audio: &api.ContentBlockAudio{Data: content.Data, Mimetype: content.MimeType},
+		}, nil
+	case mcp.ContentTypeResource:
+		resource, err := mcpEmbeddedResource(content.Resource)
+		if err != nil {
+			return api.ContentBlock{}, err
+		}
+		return api.ContentBlock{
+			Type:     api.ContentBlockTypeResource,
+			Resource: &api.ContentBlockResource{Resource: &resource},
+		}, nil
+	case mcp.ContentTypeResourceLink:
+		block := NewResourceLink(content.URI, content.Name)
+		if content.Description != "" {
+			block.ResourceLink.Description = content.Description
+		}
+		if content.MimeType != "" {
+			block.ResourceLink.Mimetype = content.MimeType
+		}
+		if content.Size != nil {
+			block.ResourceLink.Size = *content.Size
+		}
+		return block, nil
+	}
+	return api.ContentBlock{}, fmt.Errorf("unsupported MCP content type %q", content.Type)
+}
+
+// mcpEmbeddedResource converts the contents of an MCP embedded resource.
+func mcpEmbeddedResource(resource *mcp.ResourceContents) (api.EmbeddedResourceResource, error) {
+	if resource == nil {
+		return nil, NewValidationError("resource", "embedded resource has no contents")
+	}
+	var mimeType *string
+	if resource.MimeType != "" {
+		mimeType = &resource.MimeType
+	}
+	switch {
+	case resource.Text != nil:
+		return api.TextResourceContents{Uri: resource.URI, MimeType: mimeType, Text: *resource.Text}, nil
+	case resource.Blob != nil:
+		return api.BlobResourceContents{Uri: resource.URI, MimeType: mimeType, Blob: *resource.Blob}, nil
+	}
+	return nil, NewValidationError("resource", fmt.Sprintf("resource %s has neither text nor blob", resource.URI))
+}
+
+// MCPToolCallContent converts the content of an MCP tool result to tool call
+// content.
+func MCPToolCallContent(content []mcp.Content) ([]api.ToolCallUpdateContentElem, error) {
+	elems := make([]api.ToolCallUpdateContentElem, 0, len(content))
+	for i, item := range content {
+		block, err := MCPContentBlock(item)
+		if err != nil {
+			return nil, fmt.Errorf("content %d: %w", i, err)
+		}
+		elems = append(elems, *api.NewToolCallContentContent(&block))
+	}
+	return elems, nil
+}
+
+// NewMCPToolCall creates a tool call builder for an invocation of an MCP tool.
+// The tool name is used as the title and the arguments as the raw input.
+func NewMCPToolCall(id api.ToolCallId, tool string, arguments map[string]any) *ToolCallBuilder {
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+	return NewToolCall(id, tool).
+		WithKind(string(api.ToolKindOther)).
+		WithRawInput(arguments)
+}
+
+// MCPToolCallUpdate builds the final update of an MCP tool call from the
+// outcome of the call.
+//
+// A successful result completes the tool call with the result's content, and
+// the result itself as raw output. A result with IsError set fails the tool
+// call with its content. A call error, a missing result, or content that
+// cannot be converted fails the tool call with the error message as text
+// content.
+func MCPToolCallUpdate(id api.ToolCallId, result *mcp.CallToolResult, err error) api.ToolCallUpdate {
+	if err == nil && result == nil {
+		err = errors.New("MCP tool call returned no result")
+	}
+	var content []api.ToolCallUpdateContentElem
+	if err == nil {
+		content, err = MCPToolCallContent(result.Content)
+	}
+	if err != nil {
+		block := NewTextContent(err.Error())
+		return NewToolCallUpdate(id).
+			WithStatus(api.ToolCallStatusFailed).
+			WithContent([]api.ToolCallUpdateContentElem{*api.NewToolCallContentContent(&block)}).
+			Build()
+	}
+
+	status := api.ToolCallStatusCompleted
+	if result.IsError {
+		status = api.ToolCallStatusFailed
+	}
+	return NewToolCallUpdate(id).
+		WithStatus(status).
+		WithContent(content).
+		WithRawOutput(result).
+		Build()
+}
+
+// CallMCPTool calls an MCP tool and reports the call to the client as a tool
+// call, so the agent can forward MCP tools to the client's UI.
+//
+// The tool call is reported in progress before the call and is completed or
+// failed as described by MCPToolCallUpdate. Like the tool calls of
+// RunCommand, it is tracked by the session's running prompt turn, if any. The
+// result and error are those of the MCP call; an error reporting the tool call
+// is returned only if the MCP call succeeded.
+func (a *AgentConnection) CallMCPTool(
+	ctx context.Context,
+	sessionID api.SessionId,
+	caller MCPToolCaller,
+	tool string,
+	arguments map[string]any,
+) (*mcp.CallToolResult, error) {
+	toolCall := NewMCPToolCall(a.newToolCallID(), tool, arguments).
+		WithStatus(api.ToolCallStatusInProgress).
+		Build()
+	handle, err := a.startToolCall(ctx, sessionID, toolCall)
+	if err != nil {
+		return nil, err
+	}
+	return callMCPTool(ctx, handle, caller, tool, arguments)
+}
+
+// CallMCPTool calls an MCP tool and reports the call as a tool call of the
+// turn. See AgentConnection.CallMCPTool.
+func (t *TurnContext) CallMCPTool(
+	caller MCPToolCaller,
+	tool string,
+	arguments map[string]any,
+) (*mcp.CallToolResult, error) {
+	toolCall := NewMCPToolCall(api.ToolCallId(t.NewID("call")), tool, arguments).Build()
+	handle, err := t.startToolCall(toolCall)
+	if err != nil {
+		return nil, err
+	}
+	if err = handle.Start(); err != nil {
+		return nil, err
+	}
+	return callMCPTool(t.ctx, handle, caller, tool, arguments)
+}
+
+// callMCPTool calls an MCP tool and reports its outcome through the handle of
+// its tool call.
+func callMCPTool(
+	ctx context.Context,
+	handle *ToolCallHandle,
+	caller MCPToolCaller,
+	tool string,
+	arguments map[string]any,
+) (*mcp.CallToolResult, error) {
+	result, err := caller.CallTool(ctx, tool, arguments)
+	updateErr := handle.Update(MCPToolCallUpdate(handle.ID(), result, err))
+	if err != nil {
+		return nil, err
+	}
+	return result, updateErr
+}
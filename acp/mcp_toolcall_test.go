@@ -0,0 +1,233 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/acp/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mcpToolFunc is an MCPToolCaller backed by a function.
+type mcpToolFunc func(name string, arguments map[string]any) (*mcp.CallToolResult, error)
+
+// CallTool calls the function.
+func (f mcpToolFunc) CallTool(_ context.Context, name string, arguments map[string]any) (*mcp.CallToolResult, error) {
+	return f(name, arguments)
+}
+
+// toolCallBlock decodes the content block of a tool call content element.
+func toolCallBlock(t *testing.T, elem interface{}) api.ContentBlock {
+	t.Helper()
+	var content api.ToolCallContent
+	require.NoError(t, remarshal(elem, &content))
+	require.NotNil(t, content.GetContent())
+	require.NotNil(t, content.GetContent().Content)
+	return *content.GetContent().Content
+}
+
+func TestMCPContentBlock(t *testing.T) {
+	t.Run("TextAndMedia", func(t *testing.T) {
+		block, err := MCPContentBlock(mcp.Content{Type: mcp.ContentTypeText, Text: "hi"})
+		require.NoError(t, err)
+		assert.Equal(t, NewTextContent("hi"), block)
+
+		block, err = MCPContentBlock(mcp.Content{Type: mcp.ContentTypeImage, Data: "aW1n", MimeType: "image/png"})
+		require.NoError(t, err)
+		require.NotNil(t, block.Image)
+		assert.Equal(t, "aW1n", block.Image.Data)
+		assert.Equal(t, "image/png", block.Image.Mimetype)
+
+		block, err = MCPContentBlock(mcp.Content{Type: mcp.ContentTypeAudio, Data: "c25k", MimeType: "audio/wav"})
+		require.NoError(t, err)
+		require.NotNil(t, block.Audio)
+		assert.Equal(t, "c25k", block.Audio.Data)
+	})
+
+	t.Run("Resources", func(t *testing.T) {
+		text, blob := "notes", "YmxvYg=="
+		block, err := MCPContentBlock(mcp.Content{
+			Type:     mcp.ContentTypeResource,
+			Resource: &mcp.ResourceContents{URI: "file:///notes.txt", MimeType: "text/plain", Text: &text},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, block.Resource)
+		resource, ok := (*block.Resource.Resource).(api.TextResourceContents)
+		require.True(t, ok)
+		assert.Equal(t, "file:///notes.txt", resource.Uri)
+		assert.Equal(t, "notes", resource.Text)
+		assert.Equal(t, "text/plain", *resource.MimeType)
+
+		block, err = MCPContentBlock(mcp.Content{
+			Type:     mcp.ContentTypeResource,
+			Resource: &mcp.ResourceContents{URI: "file:///data.bin", Blob: &blob},
+		})
+		require.NoError(t, err)
+		blobResource, ok := (*block.Resource.Resource).(api.BlobResourceContents)
+		require.True(t, ok)
+		assert.Equal(t, blob, blobResource.Blob)
+		assert.Nil(t, blobResource.MimeType)
+
+		_, err = MCPContentBlock(mcp.Content{Type: mcp.ContentTypeResource})
+		require.Error(t, err)
+
+		size := int64(42)
+		block, err = MCPContentBlock(mcp.Content{
+			Type: mcp.ContentTypeResourceLink, URI: "file:///a.go", Name: "a.go", MimeType: "text/x-go", Size: &size,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, block.ResourceLink)
+		assert.Equal(t, "file:///a.go", block.ResourceLink.Uri)
+		assert.Equal(t, "a.go", block.ResourceLink.Name)
+		assert.Equal(t, "text/x-go", block.ResourceLink.Mimetype)
+		assert.Equal(t, size, block.ResourceLink.Size)
+		assert.Nil(t, block.ResourceLink.Description)
+	})
+
+	t.Run("UnsupportedType", func(t *testing.T) {
+		_, err := MCPContentBlock(mcp.Content{Type: "video"})
+		require.ErrorContains(t, err, `unsupported MCP content type "video"`)
+	})
+}
+
+func TestMCPToolCallUpdate(t *testing.T) {
+	t.Run("Completed", func(t *testing.T) {
+		result := &mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: "ok"}}}
+		update := MCPToolCallUpdate("call_1", result, nil)
+		assert.Equal(t, api.ToolCallId("call_1"), update.ToolCallId)
+		assert.Equal(t, api.ToolCallStatusCompleted, update.Status)
+		assert.Equal(t, result, update.RawOutput)
+		require.Len(t, update.Content, 1)
+		assert.Equal(t, "ok", toolCallBlock(t, update.Content[0]).Text.Text)
+	})
+
+	t.Run("ToolError", func(t *testing.T) {
+		result := &mcp.CallToolResult{
+			Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: "no such file"}},
+			IsError: true,
+		}
+		update := MCPToolCallUpdate("call_1", result, nil)
+		assert.Equal(t, api.ToolCallStatusFailed, update.Status)
+		require.Len(t, update.Content, 1)
+		assert.Equal(t, "no such file", toolCallBlock(t, update.Content[0]).Text.Text)
+	})
+
+	t.Run("CallError", func(t *testing.T) {
+		update := MCPToolCallUpdate("call_1", nil, errors.New("server crashed"))
+		assert.Equal(t, api.ToolCallStatusFailed, update.Status)
+		assert.Nil(t, update.RawOutput)
+		require.Len(t, update.Content, 1)
+		assert.Equal(t, "server crashed", toolCallBlock(t, update.Content[0]).Text.Text)
+	})
+
+	t.Run("NoResult", func(t *testing.T) {
+		update := MCPToolCallUpdate("call_1", nil, nil)
+		assert.Equal(t, api.ToolCallStatusFailed, update.Status)
+		assert.Nil(t, update.RawOutput)
+		require.Len(t, update.Content, 1)
+		assert.Equal(t, "MCP tool call returned no result", toolCallBlock(t, update.Content[0]).Text.Text)
+	})
+
+	t.Run("UnconvertibleContent", func(t *testing.T) {
+		result := &mcp.CallToolResult{Content: []mcp.Content{{Type: "video"}}}
+		update := MCPToolCallUpdate("call_1", result, nil)
+		assert.Equal(t, api.ToolCallStatusFailed, update.Status)
+		require.Len(t, update.Content, 1)
+		assert.Contains(t, toolCallBlock(t, update.Content[0]).Text.Text, "content 0")
+	})
+}
+
+func TestCallMCPTool(t *testing.T) {
+	ctx := context.Background()
+	echo := mcpToolFunc(func(name string, arguments map[string]any) (*mcp.CallToolResult, error) {
+		if name == "fail" {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: "tool failed"}},
+				IsError: true,
+			}, nil
+		}
+		if name == "broken" {
+			return nil, mcp.ErrConnectionClosed
+		}
+		text, _ := arguments["text"].(string)
+		return &mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: text}}}, nil
+	})
+
+	t.Run("ReportsToolCall", func(t *testing.T) {
+		agentConn, _, recorder := newRunCommandPair(t)
+
+		result, err := agentConn.CallMCPTool(ctx, "s1", echo, "echo", map[string]any{"text": "hi"})
+		require.NoError(t, err)
+		assert.Equal(t, "hi", result.Content[0].Text)
+
+		updates := recorder.waitFor(t, 2)
+		require.Len(t, updates, 2)
+		toolCall := updates[0].ToolCall
+		require.NotNil(t, toolCall)
+		assert.Equal(t, "echo", toolCall.Title)
+		assert.Equal(t, map[string]interface{}{"text": "hi"}, toolCall.Rawinput)
+		assert.Equal(t, api.ToolCallStatusInProgress, *toolCall.Status)
+
+		final := updates[1].ToolCallUpdate
+		require.NotNil(t, final)
+		assert.Equal(t, *toolCall.Toolcallid, *final.Toolcallid)
+		assert.Equal(t, string(api.ToolCallStatusCompleted), final.Status)
+		assert.NotNil(t, final.Rawoutput)
+	})
+
+	t.Run("ReportsFailures", func(t *testing.T) {
+		agentConn, _, recorder := newRunCommandPair(t)
+
+		result, err := agentConn.CallMCPTool(ctx, "s1", echo, "fail", nil)
+		require.NoError(t, err)
+		assert.True(t, result.IsError)
+
+		_, err = agentConn.CallMCPTool(ctx, "s1", echo, "broken", nil)
+		require.ErrorIs(t, err, mcp.ErrConnectionClosed)
+
+		updates := recorder.waitFor(t, 4)
+		require.Len(t, updates, 4)
+		assert.Equal(t, map[string]interface{}{}, updates[0].ToolCall.Rawinput)
+		assert.Equal(t, string(api.ToolCallStatusFailed), updates[1].ToolCallUpdate.Status)
+		assert.Equal(t, string(api.ToolCallStatusFailed), updates[3].ToolCallUpdate.Status)
+	})
+
+	t.Run("TrackedByRunningTurn", func(t *testing.T) {
+		var during, after int
+		clientConn := newTurnPair(t, func(turn *TurnContext, params *api.PromptRequest) (api.StopReason, error) {
+			tracked := mcpToolFunc(func(name string, arguments map[string]any) (*mcp.CallToolResult, error) {
+				during = len(turn.OpenToolCalls())
+				return echo.CallTool(turn.Context(), name, arguments)
+			})
+			_, err := turn.Connection().CallMCPTool(turn.Context(), params.SessionId, tracked, "echo", nil)
+			require.NoError(t, err)
+			after = len(turn.OpenToolCalls())
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		events := streamEvents(ctx, clientConn, "s1")
+		require.Len(t, events, 3)
+		assert.Equal(t, 1, during)
+		assert.Zero(t, after)
+	})
+
+	t.Run("TurnContext", func(t *testing.T) {
+		var open int
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			_, err := turn.CallMCPTool(echo, "echo", map[string]any{"text": "hi"})
+			require.NoError(t, err)
+			open = len(turn.OpenToolCalls())
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		events := streamEvents(ctx, clientConn, "s1")
+		require.Len(t, events, 4)
+		assert.Zero(t, open)
+		assert.Equal(t, "echo", events[0].Update.ToolCall.Title)
+		assert.Equal(t, string(api.ToolCallStatusInProgress), events[1].Update.ToolCallUpdate.Status)
+		assert.Equal(t, string(api.ToolCallStatusCompleted), events[2].Update.ToolCallUpdate.Status)
+	})
+}
@@ -0,0 +1,144 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// pendingPermission is a session/request_permission request whose handler has
+// not been answered yet.
+type pendingPermission struct {
+	cancel    context.CancelFunc
+	once      sync.Once
+	cancelled chan struct{}
+}
+
+// cancelRequest cancels the handler's context and marks the request cancelled.
+func (p *pendingPermission) cancelRequest() {
+	p.once.Do(func() {
+		close(p.cancelled)
+		p.cancel()
+	})
+}
+
+// permissionTracker tracks pending permission requests by session.
+type permissionTracker struct {
+	mu       sync.Mutex
+	sessions map[api.SessionId]map[*pendingPermission]struct{}
+}
+
+// newPermissionTracker creates an empty tracker.
+func newPermissionTracker() *permissionTracker {
+	return &permissionTracker{sessions: make(map[api.SessionId]map[*pendingPermission]struct{})}
+}
+
+// add tracks a pending request for a session.
+func (t *permissionTracker) add(sessionID api.SessionId, pending *pendingPermission) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	requests, exists := t.sessions[sessionID]
+	if !exists {
+		requests = make(map[*pendingPermission]struct{})
+		t.sessions[sessionID] = requests
+	}
+	requests[pending] = struct{}{}
+}
+
+// remove stops tracking a request once it is answered.
+func (t *permissionTracker) remove(sessionID api.SessionId, pending *pendingPermission) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	requests := t.sessions[sessionID]
+	delete(requests, pending)
+	if len(requests) == 0 {
+		delete(t.sessions, sessionID)
+	}
+}
+
+// count returns the number of pending requests for a session.
+func (t *permissionTracker) count(sessionID api.SessionId) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.sessions[sessionID])
+}
+
+// cancel cancels every pending request for a session.
+func (t *permissionTracker) cancel(sessionID api.SessionId) {
+	t.mu.Lock()
+	requests := make([]*pendingPermission, 0, len(t.sessions[sessionID]))
+	for pending := range t.sessions[sessionID] {
+		requests = append(requests, pending)
+	}
+	t.mu.Unlock()
+
+	for _, pending := range requests {
+		pending.cancelRequest()
+	}
+}
+
+// dispatchPermission runs a session/request_permission handler asynchronously
+// so that the request can be answered with the cancelled outcome as soon as
+// its session is cancelled, even if the handler is still waiting for the user.
+// A result the handler returns after the cancellation is discarded.
+func (c *ClientConnection) dispatchPermission(
+	ctx context.Context,
+	conn *jsonrpc2.Connection,
+	req *jsonrpc2.Request,
+	final dispatchFunc,
+) (interface{}, error) {
+	var params struct {
+		SessionID api.SessionId `json:"sessionId"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.SessionID == "" {
+		// Let the handler report the invalid params.
+		return c.core.dispatch(ctx, req, final)
+	}
+
+	handlerCtx, cancel := context.WithCancel(ctx)
+	pending := &pendingPermission{cancel: cancel, cancelled: make(chan struct{})}
+	c.permissionRequests.add(params.SessionID, pending)
+
+	go func() {
+		defer cancel()
+
+		done := make(chan callResult, 1)
+		go func() {
+			result, err := c.core.dispatch(handlerCtx, req, final)
+			done <- callResult{result: result, err: err}
+		}()
+
+		var answer callResult
+		select {
+		case answer = <-done:
+		case <-pending.cancelled:
+		}
+		// A handler that failed because its context was cancelled still
+		// counts as cancelled.
+		select {
+		case <-pending.cancelled:
+			answer = callResult{result: &api.RequestPermissionResponse{Outcome: NewPermissionCancelledOutcome()}}
+		default:
+		}
+
+		c.permissionRequests.remove(params.SessionID, pending)
+		_ = conn.Respond(req.ID, answer.result, answer.err)
+	}()
+
+	return nil, jsonrpc2.ErrAsyncResponse
+}
+
+// cancelPermissions answers the pending permission requests of a session with
+// the cancelled outcome.
+func (c *ClientConnection) cancelPermissions(sessionID api.SessionId) {
+	c.permissionRequests.cancel(sessionID)
+}
+
+// PendingPermissionRequests returns the number of session/request_permission
+// requests for a session that have not been answered yet.
+func (c *ClientConnection) PendingPermissionRequests(sessionID api.SessionId) int {
+	return c.permissionRequests.count(sessionID)
+}
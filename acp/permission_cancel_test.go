@@ -0,0 +1,119 @@
+package acp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// askInBackground sends a permission request for a session and returns a
+// channel with its decision.
+func askInBackground(agentConn *AgentConnection, sessionID api.SessionId) <-chan PermissionDecision {
+	decisions := make(chan PermissionDecision, 1)
+	go func() {
+		decision, err := agentConn.AskPermission(context.Background(), sessionID, editToolCall(api.ToolKindEdit))
+		if err != nil {
+			close(decisions)
+			return
+		}
+		decisions <- decision
+	}()
+	return decisions
+}
+
+func TestCancelPendingPermissions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("AnswersCancelledAndCancelsHandler", func(t *testing.T) {
+		handlerDone := make(chan error, 1)
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionRequestPermissionHandler(
+			func(ctx context.Context, _ *api.RequestPermissionRequest) (*api.RequestPermissionResponse, error) {
+				<-ctx.Done()
+				handlerDone <- ctx.Err()
+				return &api.RequestPermissionResponse{Outcome: NewPermissionSelectedOutcome("allow_once")}, nil
+			},
+		)
+		agentConn, clientConn := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+
+		decisions := askInBackground(agentConn, "s1")
+		require.Eventually(t, func() bool {
+			return clientConn.PendingPermissionRequests("s1") == 1
+		}, time.Second, 5*time.Millisecond)
+
+		require.NoError(t, clientConn.SessionCancel(ctx, &api.CancelNotification{SessionId: "s1"}))
+
+		select {
+		case decision, ok := <-decisions:
+			require.True(t, ok, "permission request failed")
+			assert.Equal(t, PermissionOutcomeCancelled, decision.Outcome)
+		case <-time.After(time.Second):
+			t.Fatal("permission request was not answered")
+		}
+		assert.ErrorIs(t, <-handlerDone, context.Canceled)
+		assert.Eventually(t, func() bool {
+			return clientConn.PendingPermissionRequests("s1") == 0
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("HandlerIgnoringContext", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionRequestPermissionHandler(
+			func(_ context.Context, _ *api.RequestPermissionRequest) (*api.RequestPermissionResponse, error) {
+				<-release
+				return &api.RequestPermissionResponse{Outcome: NewPermissionSelectedOutcome("allow_once")}, nil
+			},
+		)
+		agentConn, clientConn := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+
+		decisions := askInBackground(agentConn, "s1")
+		require.Eventually(t, func() bool {
+			return clientConn.PendingPermissionRequests("s1") == 1
+		}, time.Second, 5*time.Millisecond)
+
+		require.NoError(t, clientConn.SessionCancel(ctx, &api.CancelNotification{SessionId: "s1"}))
+
+		select {
+		case decision, ok := <-decisions:
+			require.True(t, ok, "permission request failed")
+			assert.Equal(t, PermissionOutcomeCancelled, decision.Outcome)
+		case <-time.After(time.Second):
+			t.Fatal("permission request was not answered")
+		}
+	})
+
+	t.Run("OtherSessionsUnaffected", func(t *testing.T) {
+		release := make(chan struct{})
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionRequestPermissionHandler(
+			func(ctx context.Context, _ *api.RequestPermissionRequest) (*api.RequestPermissionResponse, error) {
+				select {
+				case <-release:
+					return &api.RequestPermissionResponse{Outcome: NewPermissionSelectedOutcome("allow_once")}, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		)
+		agentConn, clientConn := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+
+		decisions := askInBackground(agentConn, "s1")
+		require.Eventually(t, func() bool {
+			return clientConn.PendingPermissionRequests("s1") == 1
+		}, time.Second, 5*time.Millisecond)
+
+		require.NoError(t, clientConn.SessionCancel(ctx, &api.CancelNotification{SessionId: "s2"}))
+		assert.Equal(t, 1, clientConn.PendingPermissionRequests("s1"))
+
+		close(release)
+		decision, ok := <-decisions
+		require.True(t, ok, "permission request failed")
+		assert.True(t, decision.Allowed())
+	})
+}
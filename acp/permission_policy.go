@@ -0,0 +1,526 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/acp/internal/atomicfile"
+)
+
+const (
+	// permissionFilePerm is the permission used for permission store files.
+	permissionFilePerm = 0o600
+	// permissionDirPerm is the permission used when creating the store directory.
+	permissionDirPerm = 0o750
+)
+
+// NewPermissionSelectedOutcome returns the outcome of a permission request for
+// which the user selected optionID.
+func NewPermissionSelectedOutcome(optionID string) api.RequestPermissionResponseOutcome {
+	return map[string]interface{}{
+		"outcome":  "selected",
+		"optionId": optionID,
+	}
+}
+
+// NewPermissionCancelledOutcome returns the outcome of a permission request
+// that was cancelled.
+func NewPermissionCancelledOutcome() api.RequestPermissionResponseOutcome {
+	return map[string]interface{}{
+		"outcome": "cancelled",
+	}
+}
+
+// PermissionAction is what a PermissionPolicy does with a permission request.
+type PermissionAction int
+
+const (
+	// PermissionActionAsk asks the policy's Prompter.
+	PermissionActionAsk PermissionAction = iota
+	// PermissionActionAllow selects an allow option without asking.
+	PermissionActionAllow
+	// PermissionActionReject selects a reject option without asking.
+	PermissionActionReject
+)
+
+// String returns the string representation of the action.
+func (a PermissionAction) String() string {
+	switch a {
+	case PermissionActionAsk:
+		return "ask"
+	case PermissionActionAllow:
+		return "allow"
+	case PermissionActionReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler so actions persist by name.
+func (a PermissionAction) MarshalText() ([]byte, error) {
+	name := a.String()
+	if name == "unknown" {
+		return nil, fmt.Errorf("invalid permission action: %d", int(a))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *PermissionAction) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "ask":
+		*a = PermissionActionAsk
+	case "allow":
+		*a = PermissionActionAllow
+	case "reject":
+		*a = PermissionActionReject
+	default:
+		return fmt.Errorf("unknown permission action: %q", string(text))
+	}
+	return nil
+}
+
+// PermissionScope is where a PermissionPolicy remembers "always" decisions.
+type PermissionScope int
+
+const (
+	// PermissionScopeSession remembers decisions for the session they were made in.
+	PermissionScopeSession PermissionScope = iota
+	// PermissionScopeWorkspace remembers decisions for every session, and
+	// persists them if the policy has a PermissionStore.
+	PermissionScopeWorkspace
+)
+
+// String returns the string representation of the scope.
+func (s PermissionScope) String() string {
+	switch s {
+	case PermissionScopeSession:
+		return "session"
+	case PermissionScopeWorkspace:
+		return "workspace"
+	default:
+		return "unknown"
+	}
+}
+
+// PermissionRule decides permission requests that match it. Empty fields
+// match anything.
+//
+// Title and Path are glob patterns. In Path, "*" and "?" do not match "/"
+// while "**" matches any sequence; in Title, "*" matches any sequence.
+type PermissionRule struct {
+	// Kind is the tool kind to match.
+	Kind api.ToolKind
+	// Title is a glob matched against the tool call's title.
+	Title string
+	// Path is a glob matched against the tool call's location paths, after
+	// cleaning them so ".." elements cannot escape the pattern. Allow rules
+	// require every location to match; reject rules match if any does.
+	// Relative paths never match, and a tool call without locations never
+	// matches a rule with a Path.
+	Path string
+	// Action is applied to matching requests.
+	Action PermissionAction
+}
+
+// Matches reports whether the rule applies to a tool call.
+func (r PermissionRule) Matches(toolCall *api.ToolCallUpdate) bool {
+	if r.Kind != "" && toolKindValue(toolCall.Kind) != r.Kind {
+		return false
+	}
+	if r.Title != "" {
+		title := ""
+		if toolCall.Title != nil {
+			title = *toolCall.Title
+		}
+		if !matchGlob(r.Title, title, false) {
+			return false
+		}
+	}
+	if r.Path == "" {
+		return true
+	}
+	if len(toolCall.Locations) == 0 {
+		return false
+	}
+
+	for _, location := range toolCall.Locations {
+		matched := filepath.IsAbs(location.Path) &&
+			matchGlob(r.Path, filepath.ToSlash(filepath.Clean(location.Path)), true)
+		if r.Action == PermissionActionReject && matched {
+			return true
+		}
+		if r.Action != PermissionActionReject && !matched {
+			return false
+		}
+	}
+	return r.Action != PermissionActionReject
+}
+
+// Prompter asks the user to choose one of the options of a permission request.
+type Prompter interface {
+	// PromptPermission returns the selected option, or nil if the user made
+	// no choice. It should return promptly once ctx is cancelled.
+	PromptPermission(ctx context.Context, request *api.RequestPermissionRequest) (*api.PermissionOption, error)
+}
+
+// PermissionStore persists workspace-wide "always" decisions of a
+// PermissionPolicy. Keys identify the tool calls a decision applies to.
+type PermissionStore interface {
+	// Load returns the stored decisions.
+	Load() (map[string]PermissionAction, error)
+	// Save replaces the stored decisions.
+	Save(decisions map[string]PermissionAction) error
+}
+
+// PermissionPolicy answers session/request_permission requests on the client.
+//
+// Requests are decided by the first matching rule, then by remembered
+// "always" decisions, and otherwise by the Prompter. When the user selects an
+// allow_always or reject_always option, later requests for a tool call with
+// the same kind, title and location paths are answered without asking.
+// Requests that cannot be decided are answered with the cancelled
+// outcome.
+//
+// Register HandleRequestPermission with
+// HandlerRegistry.RegisterSessionRequestPermissionHandler.
+type PermissionPolicy struct {
+	prompter Prompter
+	rules    []PermissionRule
+	store    PermissionStore
+
+	mu        sync.Mutex
+	scope     PermissionScope
+	sessions  map[api.SessionId]map[string]PermissionAction
+	workspace map[string]PermissionAction
+}
+
+// NewPermissionPolicy creates a policy that applies rules in order and asks
+// prompter for everything else. The prompter may be nil, in which case
+// undecided requests are cancelled.
+func NewPermissionPolicy(prompter Prompter, rules ...PermissionRule) *PermissionPolicy {
+	return &PermissionPolicy{
+		prompter:  prompter,
+		rules:     rules,
+		sessions:  make(map[api.SessionId]map[string]PermissionAction),
+		workspace: make(map[string]PermissionAction),
+	}
+}
+
+// NewPermissionPolicyWithStore creates a policy that remembers decisions for
+// the whole workspace and persists them in store. Decisions already in the
+// store are loaded.
+func NewPermissionPolicyWithStore(
+	store PermissionStore,
+	prompter Prompter,
+	rules ...PermissionRule,
+) (*PermissionPolicy, error) {
+	decisions, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permission decisions: %w", err)
+	}
+
+	policy := NewPermissionPolicy(prompter, rules...)
+	policy.store = store
+	policy.scope = PermissionScopeWorkspace
+	for key, action := range decisions {
+		policy.workspace[key] = action
+	}
+	return policy, nil
+}
+
+// SetRememberScope sets where "always" decisions are remembered. The default
+// is PermissionScopeSession, or PermissionScopeWorkspace for a policy with a
+// store.
+func (p *PermissionPolicy) SetRememberScope(scope PermissionScope) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scope = scope
+}
+
+// Remembered returns the remembered decision for a tool call in a session.
+func (p *PermissionPolicy) Remembered(sessionID api.SessionId, toolCall *api.ToolCallUpdate) PermissionAction {
+	key := permissionKey(toolCall)
+	if key == "" {
+		return PermissionActionAsk
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if action, exists := p.sessions[sessionID][key]; exists {
+		return action
+	}
+	return p.workspace[key]
+}
+
+// ForgetSession drops the decisions remembered for a session.
+func (p *PermissionPolicy) ForgetSession(sessionID api.SessionId) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, sessionID)
+}
+
+// HandleRequestPermission answers a session/request_permission request.
+func (p *PermissionPolicy) HandleRequestPermission(
+	ctx context.Context,
+	params *api.RequestPermissionRequest,
+) (*api.RequestPermissionResponse, error) {
+	toolCall := &params.ToolCall
+
+	action := PermissionActionAsk
+	for _, rule := range p.rules {
+		if rule.Matches(toolCall) {
+			action = rule.Action
+			break
+		}
+	}
+	if action == PermissionActionAsk {
+		action = p.Remembered(params.SessionId, toolCall)
+	}
+	if option := selectPermissionOption(params.Options, action); option != nil {
+		return &api.RequestPermissionResponse{Outcome: NewPermissionSelectedOutcome(string(option.OptionId))}, nil
+	}
+
+	if p.prompter == nil || len(params.Options) == 0 {
+		return &api.RequestPermissionResponse{Outcome: NewPermissionCancelledOutcome()}, nil
+	}
+
+	option, err := p.prompter.PromptPermission(ctx, params)
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, io.EOF) {
+			return &api.RequestPermissionResponse{Outcome: NewPermissionCancelledOutcome()}, nil
+		}
+		return nil, err
+	}
+	if option == nil || ctx.Err() != nil {
+		return &api.RequestPermissionResponse{Outcome: NewPermissionCancelledOutcome()}, nil
+	}
+
+	switch option.Kind {
+	case api.PermissionOptionKindAllowAlways:
+		err = p.remember(params.SessionId, toolCall, PermissionActionAllow)
+	case api.PermissionOptionKindRejectAlways:
+		err = p.remember(params.SessionId, toolCall, PermissionActionReject)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.RequestPermissionResponse{Outcome: NewPermissionSelectedOutcome(string(option.OptionId))}, nil
+}
+
+// remember records an "always" decision in the policy's scope.
+func (p *PermissionPolicy) remember(
+	sessionID api.SessionId,
+	toolCall *api.ToolCallUpdate,
+	action PermissionAction,
+) error {
+	key := permissionKey(toolCall)
+	if key == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.scope == PermissionScopeSession {
+		if p.sessions[sessionID] == nil {
+			p.sessions[sessionID] = make(map[string]PermissionAction)
+		}
+		p.sessions[sessionID][key] = action
+		return nil
+	}
+
+	p.workspace[key] = action
+	if p.store == nil {
+		return nil
+	}
+	decisions := make(map[string]PermissionAction, len(p.workspace))
+	for k, v := range p.workspace {
+		decisions[k] = v
+	}
+	if err := p.store.Save(decisions); err != nil {
+		return fmt.Errorf("failed to save permission decisions: %w", err)
+	}
+	return nil
+}
+
+// selectPermissionOption returns the option that carries out an action,
+// preferring the one-time option over the "always" one. It returns nil for
+// PermissionActionAsk or if no option matches.
+func selectPermissionOption(options []api.PermissionOption, action PermissionAction) *api.PermissionOption {
+	var kinds []api.PermissionOptionKind
+	switch action {
+	case PermissionActionAllow:
+		kinds = []api.PermissionOptionKind{api.PermissionOptionKindAllowOnce, api.PermissionOptionKindAllowAlways}
+	case PermissionActionReject:
+		kinds = []api.PermissionOptionKind{api.PermissionOptionKindRejectOnce, api.PermissionOptionKindRejectAlways}
+	default:
+		return nil
+	}
+
+	for _, kind := range kinds {
+		for i := range options {
+			if options[i].Kind == kind {
+				return &options[i]
+			}
+		}
+	}
+	return nil
+}
+
+// permissionKey identifies the tool calls a remembered decision applies to:
+// those with the same kind, title and location paths. It returns "" for tool
+// calls with none of these, whose decisions are not remembered.
+func permissionKey(toolCall *api.ToolCallUpdate) string {
+	kind := toolKindValue(toolCall.Kind)
+	title := ""
+	if toolCall.Title != nil {
+		title = *toolCall.Title
+	}
+	paths := make([]string, 0, len(toolCall.Locations))
+	for _, location := range toolCall.Locations {
+		paths = append(paths, filepath.Clean(location.Path))
+	}
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+	if kind == "" && title == "" && len(paths) == 0 {
+		return ""
+	}
+
+	key, err := json.Marshal(struct {
+		Kind  api.ToolKind `json:"kind,omitempty"`
+		Title string       `json:"title,omitempty"`
+		Paths []string     `json:"paths,omitempty"`
+	}{kind, title, paths})
+	if err != nil {
+		return ""
+	}
+	return string(key)
+}
+
+// toolKindValue converts the untyped kind of a tool call update.
+func toolKindValue(kind interface{}) api.ToolKind {
+	switch k := kind.(type) {
+	case api.ToolKind:
+		return k
+	case *api.ToolKind:
+		if k != nil {
+			return *k
+		}
+	case string:
+		return api.ToolKind(k)
+	}
+	return ""
+}
+
+// matchGlob matches name against a glob pattern. With paths set, "*" and "?"
+// do not match "/" and "**" matches anything. No wildcard matches a newline.
+//
+// The pattern is run directly against name, one pattern character at a time,
+// tracking every position in name the pattern so far can end at. No regexp
+// is compiled, since policies match many names against the same patterns.
+func matchGlob(pattern, name string, paths bool) bool {
+	runes := []rune(name)
+	cur := make([]bool, len(runes)+1)
+	next := make([]bool, len(runes)+1)
+	cur[0] = true
+
+	for i := 0; i < len(pattern); {
+		c, size := utf8.DecodeRuneInString(pattern[i:])
+		i += size
+		anyDepth := c == '*' && strings.HasPrefix(pattern[i:], "*")
+		if anyDepth {
+			i++
+		}
+
+		switch {
+		case c == '*':
+			next[0] = cur[0]
+			for j := 1; j <= len(runes); j++ {
+				next[j] = cur[j] || next[j-1] && wildcardMatches(runes[j-1], anyDepth || !paths)
+			}
+		default:
+			next[0] = false
+			for j := 1; j <= len(runes); j++ {
+				r := runes[j-1]
+				matches := r == c || c == '?' && wildcardMatches(r, !paths)
+				next[j] = cur[j-1] && matches
+			}
+		}
+		cur, next = next, cur
+	}
+	return cur[len(runes)]
+}
+
+// wildcardMatches reports whether a wildcard may match r, where slashes
+// reports whether it may cross path separators.
+func wildcardMatches(r rune, slashes bool) bool {
+	return r != '\n' && (slashes || r != '/')
+}
+
+// FilePermissionStore is a PermissionStore that keeps decisions in a JSON file.
+type FilePermissionStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFilePermissionStore creates a store that keeps decisions in the file at
+// path. The file is created on the first save.
+func NewFilePermissionStore(path string) *FilePermissionStore {
+	return &FilePermissionStore{path: path}
+}
+
+// Path returns the file the store writes to.
+func (fs *FilePermissionStore) Path() string {
+	return fs.path
+}
+
+// Load reads the decisions from disk. A missing file holds no decisions.
+func (fs *FilePermissionStore) Load() (map[string]PermissionAction, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	decisions := make(map[string]PermissionAction)
+	data, err := os.ReadFile(fs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return decisions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read permission decisions: %w", err)
+	}
+	if err = json.Unmarshal(data, &decisions); err != nil {
+		return nil, fmt.Errorf("failed to decode permission decisions: %w", err)
+	}
+	return decisions, nil
+}
+
+// Save writes the decisions to disk.
+func (fs *FilePermissionStore) Save(decisions map[string]PermissionAction) error {
+	data, err := json.MarshalIndent(decisions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode permission decisions: %w", err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	dir := filepath.Dir(fs.path)
+	if err = os.MkdirAll(dir, permissionDirPerm); err != nil {
+		return fmt.Errorf("failed to create permission directory: %w", err)
+	}
+	if err = atomicfile.WriteFile(fs.path, data, permissionFilePerm); err != nil {
+		return fmt.Errorf("failed to write permission decisions: %w", err)
+	}
+	return nil
+}
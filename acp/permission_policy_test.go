@@ -0,0 +1,301 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedPrompter answers permission prompts with fixed option IDs.
+type scriptedPrompter struct {
+	answers []api.PermissionOptionId
+	asked   int
+	err     error
+}
+
+func (s *scriptedPrompter) PromptPermission(
+	_ context.Context,
+	request *api.RequestPermissionRequest,
+) (*api.PermissionOption, error) {
+	s.asked++
+	if s.err != nil {
+		return nil, s.err
+	}
+	if len(s.answers) == 0 {
+		return nil, nil
+	}
+	answer := s.answers[0]
+	s.answers = s.answers[1:]
+	for i := range request.Options {
+		if request.Options[i].OptionId == answer {
+			return &request.Options[i], nil
+		}
+	}
+	return nil, errors.New("unknown option")
+}
+
+// standardOptions returns one option of each kind.
+func standardOptions() []api.PermissionOption {
+	return []api.PermissionOption{
+		{Kind: api.PermissionOptionKindAllowOnce, Name: "Allow", OptionId: "allow"},
+		{Kind: api.PermissionOptionKindAllowAlways, Name: "Always allow", OptionId: "allow-always"},
+		{Kind: api.PermissionOptionKindRejectOnce, Name: "Reject", OptionId: "reject"},
+		{Kind: api.PermissionOptionKindRejectAlways, Name: "Always reject", OptionId: "reject-always"},
+	}
+}
+
+// permissionRequest builds a request for a tool call with the given kind and paths.
+func permissionRequest(sessionID api.SessionId, kind api.ToolKind, paths ...string) *api.RequestPermissionRequest {
+	builder := NewToolCallUpdate("call-1").WithTitle("Edit files").WithKind(string(kind))
+	var locations []api.ToolCallLocation
+	for _, path := range paths {
+		locations = append(locations, CreateLocationSimple(path))
+	}
+	builder.WithLocations(locations)
+	return &api.RequestPermissionRequest{SessionId: sessionID, ToolCall: builder.Build(), Options: standardOptions()}
+}
+
+// decide runs a request through the policy and returns the selected option ID,
+// or "cancelled".
+func decide(t *testing.T, policy *PermissionPolicy, request *api.RequestPermissionRequest) string {
+	t.Helper()
+
+	resp, err := policy.HandleRequestPermission(context.Background(), request)
+	require.NoError(t, err)
+	outcome, ok := resp.Outcome.(map[string]interface{})
+	require.True(t, ok)
+	if outcome["outcome"] == "cancelled" {
+		return "cancelled"
+	}
+	return outcome["optionId"].(string)
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		paths   bool
+		want    bool
+	}{
+		{"", "", false, true},
+		{"", "a", false, false},
+		{"go", "go", false, true},
+		{"go", "got", false, false},
+		{"g?", "go", false, true},
+		{"*", "", false, true},
+		{"*", "a/b", false, true},
+		{"*.go", "main.go", false, true},
+		{"*.go", "main.go.txt", false, false},
+		{"a*b*c", "axxbyyc", false, true},
+		{"a*b*c", "axxbyy", false, false},
+		{"/src/*.go", "/src/main.go", true, true},
+		{"/src/*.go", "/src/sub/main.go", true, false},
+		{"/src/?", "/src//", true, false},
+		{"/src/**", "/src/sub/main.go", true, true},
+		{"/src/**.go", "/src/sub/main.go", true, true},
+		{"(a|b)+", "(a|b)+", false, true},
+		{"(a|b)+", "a", false, false},
+		{"héllo?", "héllo✓", false, true},
+		{"rm *", "rm -rf\n/", false, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchGlob(tt.pattern, tt.name, tt.paths), "%q against %q", tt.pattern, tt.name)
+	}
+}
+
+func TestPermissionRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     PermissionRule
+		request  *api.RequestPermissionRequest
+		expected bool
+	}{
+		{"EmptyRuleMatchesAll", PermissionRule{}, permissionRequest("s1", api.ToolKindRead), true},
+		{"Kind", PermissionRule{Kind: api.ToolKindRead}, permissionRequest("s1", api.ToolKindRead), true},
+		{"OtherKind", PermissionRule{Kind: api.ToolKindEdit}, permissionRequest("s1", api.ToolKindRead), false},
+		{"Title", PermissionRule{Title: "Edit *"}, permissionRequest("s1", api.ToolKindEdit), true},
+		{"OtherTitle", PermissionRule{Title: "Read *"}, permissionRequest("s1", api.ToolKindEdit), false},
+		{
+			"PathStarStopsAtSlash",
+			PermissionRule{Path: "/src/*"},
+			permissionRequest("s1", api.ToolKindEdit, "/src/pkg/a.go"),
+			false,
+		},
+		{
+			"PathDoubleStar",
+			PermissionRule{Path: "/src/**"},
+			permissionRequest("s1", api.ToolKindEdit, "/src/pkg/a.go", "/src/b.go"),
+			true,
+		},
+		{
+			"AllowNeedsAllPaths",
+			PermissionRule{Path: "/src/**", Action: PermissionActionAllow},
+			permissionRequest("s1", api.ToolKindEdit, "/src/a.go", "/etc/passwd"),
+			false,
+		},
+		{
+			"RejectNeedsAnyPath",
+			PermissionRule{Path: "/etc/**", Action: PermissionActionReject},
+			permissionRequest("s1", api.ToolKindEdit, "/src/a.go", "/etc/passwd"),
+			true,
+		},
+		{"PathWithoutLocations", PermissionRule{Path: "**"}, permissionRequest("s1", api.ToolKindEdit), false},
+		{
+			"PathTraversal",
+			PermissionRule{Path: "/src/**", Action: PermissionActionAllow},
+			permissionRequest("s1", api.ToolKindEdit, "/src/../etc/passwd"),
+			false,
+		},
+		{
+			"RejectCleansPath",
+			PermissionRule{Path: "/etc/**", Action: PermissionActionReject},
+			permissionRequest("s1", api.ToolKindEdit, "/src/../etc/passwd"),
+			true,
+		},
+		{
+			"RelativePath",
+			PermissionRule{Path: "**", Action: PermissionActionAllow},
+			permissionRequest("s1", api.ToolKindEdit, "src/a.go"),
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.rule.Matches(&tt.request.ToolCall))
+		})
+	}
+}
+
+func TestPermissionPolicy(t *testing.T) {
+	t.Run("RulesDecideWithoutPrompting", func(t *testing.T) {
+		prompter := &scriptedPrompter{}
+		policy := NewPermissionPolicy(prompter,
+			PermissionRule{Kind: api.ToolKindRead, Action: PermissionActionAllow},
+			PermissionRule{Path: "/etc/**", Action: PermissionActionReject},
+		)
+
+		assert.Equal(t, "allow", decide(t, policy, permissionRequest("s1", api.ToolKindRead)))
+		assert.Equal(t, "reject", decide(t, policy, permissionRequest("s1", api.ToolKindEdit, "/etc/hosts")))
+		assert.Equal(t, 0, prompter.asked)
+	})
+
+	t.Run("FallsBackToPrompter", func(t *testing.T) {
+		prompter := &scriptedPrompter{answers: []api.PermissionOptionId{"reject"}}
+		policy := NewPermissionPolicy(prompter, PermissionRule{Kind: api.ToolKindRead, Action: PermissionActionAllow})
+
+		assert.Equal(t, "reject", decide(t, policy, permissionRequest("s1", api.ToolKindEdit)))
+		assert.Equal(t, 1, prompter.asked)
+	})
+
+	t.Run("RemembersPerSession", func(t *testing.T) {
+		prompter := &scriptedPrompter{answers: []api.PermissionOptionId{"allow-always", "reject"}}
+		policy := NewPermissionPolicy(prompter)
+
+		assert.Equal(t, "allow-always", decide(t, policy, permissionRequest("s1", api.ToolKindEdit)))
+		assert.Equal(t, "allow", decide(t, policy, permissionRequest("s1", api.ToolKindEdit)))
+		assert.Equal(t, 1, prompter.asked)
+
+		// Other sessions, tool kinds, titles and paths are asked again.
+		assert.Equal(t, "reject", decide(t, policy, permissionRequest("s2", api.ToolKindEdit)))
+		assert.Equal(t, 2, prompter.asked)
+		assert.Equal(t, PermissionActionAsk, policy.Remembered("s1", &permissionRequest("s1", api.ToolKindRead).ToolCall))
+		assert.Equal(t, PermissionActionAsk,
+			policy.Remembered("s1", &permissionRequest("s1", api.ToolKindEdit, "/work/main.go").ToolCall))
+		renamed := NewToolCallUpdate("call-2").WithTitle("Edit other files").WithKind(string(api.ToolKindEdit)).Build()
+		assert.Equal(t, PermissionActionAsk, policy.Remembered("s1", &renamed))
+
+		policy.ForgetSession("s1")
+		assert.Equal(t, PermissionActionAsk, policy.Remembered("s1", &permissionRequest("s1", api.ToolKindEdit).ToolCall))
+	})
+
+	t.Run("RemembersByPaths", func(t *testing.T) {
+		prompter := &scriptedPrompter{answers: []api.PermissionOptionId{"allow-always"}}
+		policy := NewPermissionPolicy(prompter)
+
+		request := permissionRequest("s1", api.ToolKindEdit, "/work/a.go", "/work/b.go")
+		assert.Equal(t, "allow-always", decide(t, policy, request))
+
+		// The same paths in another order or spelling match; other paths do not.
+		reordered := permissionRequest("s1", api.ToolKindEdit, "/work/b.go", "/work/../work/a.go")
+		assert.Equal(t, PermissionActionAllow, policy.Remembered("s1", &reordered.ToolCall))
+		subset := permissionRequest("s1", api.ToolKindEdit, "/work/a.go")
+		assert.Equal(t, PermissionActionAsk, policy.Remembered("s1", &subset.ToolCall))
+	})
+
+	t.Run("DoesNotRememberUnidentifiedToolCalls", func(t *testing.T) {
+		prompter := &scriptedPrompter{answers: []api.PermissionOptionId{"allow-always", "reject"}}
+		policy := NewPermissionPolicy(prompter)
+
+		request := &api.RequestPermissionRequest{
+			SessionId: "s1",
+			ToolCall:  NewToolCallUpdate("call-1").Build(),
+			Options:   standardOptions(),
+		}
+		assert.Equal(t, "allow-always", decide(t, policy, request))
+		assert.Equal(t, "reject", decide(t, policy, request))
+		assert.Equal(t, 2, prompter.asked)
+	})
+
+	t.Run("RemembersPerWorkspace", func(t *testing.T) {
+		prompter := &scriptedPrompter{answers: []api.PermissionOptionId{"reject-always"}}
+		policy := NewPermissionPolicy(prompter)
+		policy.SetRememberScope(PermissionScopeWorkspace)
+
+		assert.Equal(t, "reject-always", decide(t, policy, permissionRequest("s1", api.ToolKindExecute)))
+		assert.Equal(t, "reject", decide(t, policy, permissionRequest("s2", api.ToolKindExecute)))
+		assert.Equal(t, 1, prompter.asked)
+	})
+
+	t.Run("Persistence", func(t *testing.T) {
+		store := NewFilePermissionStore(filepath.Join(t.TempDir(), "acp", "permissions.json"))
+
+		policy, err := NewPermissionPolicyWithStore(store, &scriptedPrompter{
+			answers: []api.PermissionOptionId{"allow-always"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "allow-always", decide(t, policy, permissionRequest("s1", api.ToolKindFetch)))
+
+		prompter := &scriptedPrompter{}
+		reloaded, err := NewPermissionPolicyWithStore(store, prompter)
+		require.NoError(t, err)
+		assert.Equal(t, "allow", decide(t, reloaded, permissionRequest("s2", api.ToolKindFetch)))
+		assert.Equal(t, 0, prompter.asked)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		// No prompter, no choice, or a cancelled prompt all cancel the request.
+		assert.Equal(t, "cancelled", decide(t, NewPermissionPolicy(nil), permissionRequest("s1", api.ToolKindEdit)))
+		assert.Equal(t, "cancelled",
+			decide(t, NewPermissionPolicy(&scriptedPrompter{}), permissionRequest("s1", api.ToolKindEdit)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		policy := NewPermissionPolicy(&scriptedPrompter{err: context.Canceled})
+		resp, err := policy.HandleRequestPermission(ctx, permissionRequest("s1", api.ToolKindEdit))
+		require.NoError(t, err)
+		assert.Equal(t, NewPermissionCancelledOutcome(), resp.Outcome)
+	})
+
+	t.Run("PrompterError", func(t *testing.T) {
+		policy := NewPermissionPolicy(&scriptedPrompter{err: errors.New("terminal gone")})
+		_, err := policy.HandleRequestPermission(context.Background(), permissionRequest("s1", api.ToolKindEdit))
+		require.Error(t, err)
+	})
+
+	t.Run("OverConnection", func(t *testing.T) {
+		policy := NewPermissionPolicy(nil, PermissionRule{Kind: api.ToolKindRead, Action: PermissionActionAllow})
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionRequestPermissionHandler(policy.HandleRequestPermission)
+
+		agentConn, _ := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+		resp, err := agentConn.SessionRequestPermission(context.Background(), permissionRequest("s1", api.ToolKindRead))
+		require.NoError(t, err)
+		assert.Equal(t, NewPermissionSelectedOutcome("allow"), resp.Outcome)
+	})
+}
@@ -0,0 +1,171 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"sync"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// PromptEvent is a single event of a prompt turn streamed by
+// ClientConnection.PromptStream.
+//
+// Every event but the last carries an Update. The last event carries either
+// the Response and its StopReason, or an Err.
+type PromptEvent struct {
+	// Update is a session update sent by the agent during the turn.
+	Update *api.SessionUpdate
+	// Response is the final response of the turn.
+	Response *api.PromptResponse
+	// StopReason is the stop reason of the final response.
+	StopReason api.StopReason
+	// Err is set if the prompt failed.
+	Err error
+}
+
+// Final reports whether this is the last event of the turn.
+func (e PromptEvent) Final() bool {
+	return e.Update == nil
+}
+
+// promptStream buffers the session updates of one streamed prompt turn.
+//
+// Updates are queued without blocking so a slow consumer never stalls the
+// connection's message delivery.
+type promptStream struct {
+	mu      sync.Mutex
+	pending []*api.SessionUpdate
+	signal  chan struct{}
+}
+
+// newPromptStream creates an empty prompt stream.
+func newPromptStream() *promptStream {
+	return &promptStream{signal: make(chan struct{}, 1)}
+}
+
+// push queues an update and wakes the consumer.
+func (s *promptStream) push(update *api.SessionUpdate) {
+	s.mu.Lock()
+	s.pending = append(s.pending, update)
+	s.mu.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// drain returns and clears the queued updates.
+func (s *promptStream) drain() []*api.SessionUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.pending
+	s.pending = nil
+	return pending
+}
+
+// routeStreamUpdate is a dispatch interceptor that copies session/update
+// notifications to the active prompt stream of their session. The regular
+// session/update handler still runs.
+func (c *ClientConnection) routeStreamUpdate(
+	ctx context.Context,
+	req *jsonrpc2.Request,
+	next dispatchFunc,
+) (interface{}, error) {
+	if req.IsCall() || req.Method != api.MethodSessionUpdate || c.streams.Count() == 0 {
+		return next(ctx, req)
+	}
+
+	var notification api.SessionNotification
+	if err := json.Unmarshal(req.Params, &notification); err == nil {
+		if stream, exists := c.streams.Load(notification.SessionId); exists {
+			// Unsupported update types are left to the regular handler.
+			if update, decodeErr := DecodeSessionUpdate(&notification); decodeErr == nil {
+				stream.push(update)
+			}
+		}
+	}
+	return next(ctx, req)
+}
+
+// PromptStream sends a session/prompt request and returns an iterator over the
+// turn's session updates, followed by a final event with the stop reason.
+//
+// The turn is not bounded by the connection's request timeout. Updates the
+// agent sends before its response are always yielded before the final event. Cancelling ctx sends session/cancel and keeps streaming until
+// the agent ends the turn. Stopping the iteration early also sends
+// session/cancel; the rest of the turn is then only seen by the regular
+// session/update handler.
+//
+// Only one stream may be active per session.
+func (c *ClientConnection) PromptStream(ctx context.Context, params *api.PromptRequest) iter.Seq[PromptEvent] {
+	return func(yield func(PromptEvent) bool) {
+		sessionID := params.SessionId
+		stream := newPromptStream()
+		if _, loaded := c.streams.LoadOrStore(sessionID, stream); loaded {
+			yield(PromptEvent{Err: NewConflictError(
+				fmt.Sprintf("session %v", sessionID),
+				"a prompt stream is already active",
+			)})
+			return
+		}
+		defer c.streams.CompareAndDelete(sessionID, stream)
+
+		done := make(chan PromptEvent, 1)
+		go func() {
+			// The turn is ended by the agent; ctx cancellation sends
+			// session/cancel instead. A turn may run for much longer than the
+			// request timeout, so only the connection closing ends the call.
+			callCtx := context.WithoutCancel(ctx)
+			resp := &api.PromptResponse{}
+			err := c.core.callUntilDone(callCtx, api.MethodSessionPrompt, params, resp)
+			// Updates sent before an error response are delivered first too.
+			if waitErr := c.core.waitIncoming(callCtx); err == nil {
+				err = waitErr
+			}
+			if err != nil {
+				done <- PromptEvent{Err: err}
+				return
+			}
+			stopReason, _ := resp.StopReason.(string)
+			done <- PromptEvent{Response: resp, StopReason: api.StopReason(stopReason)}
+		}()
+
+		yieldUpdates := func() bool {
+			for _, update := range stream.drain() {
+				if !yield(PromptEvent{Update: update}) {
+					return false
+				}
+			}
+			return true
+		}
+
+		cancel := func() {
+			_ = c.SessionCancel(context.WithoutCancel(ctx), &api.CancelNotification{SessionId: sessionID})
+		}
+
+		ctxDone := ctx.Done()
+		for {
+			select {
+			case <-stream.signal:
+				if !yieldUpdates() {
+					cancel()
+					return
+				}
+			case <-ctxDone:
+				ctxDone = nil
+				cancel()
+			case final := <-done:
+				if !yieldUpdates() {
+					return
+				}
+				yield(final)
+				return
+			}
+		}
+	}
+}
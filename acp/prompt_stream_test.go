@@ -0,0 +1,228 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamingAgent sends a fixed number of message chunks for each prompt, then
+// optionally waits for session/cancel before ending the turn.
+type streamingAgent struct {
+	conn        *AgentConnection
+	chunks      int
+	waitCancel  bool
+	promptErr   error
+	cancelled   chan api.SessionId
+	stop        chan struct{}
+	otherUpdate bool
+}
+
+func (s *streamingAgent) handler() *HandlerRegistry {
+	handler := NewAgentHandlerRegistry()
+	handler.RegisterSessionPromptHandler(s.HandleSessionPrompt)
+	handler.RegisterSessionCancelHandler(func(_ context.Context, params *api.CancelNotification) error {
+		s.cancelled <- params.SessionId
+		s.stop <- struct{}{}
+		return nil
+	})
+	return handler
+}
+
+func (s *streamingAgent) HandleSessionPrompt(
+	ctx context.Context,
+	params *api.PromptRequest,
+) (*api.PromptResponse, error) {
+	if s.promptErr != nil {
+		return nil, s.promptErr
+	}
+
+	for i := range s.chunks {
+		if s.otherUpdate {
+			_ = s.conn.SendSessionUpdate(ctx, &api.SessionNotification{
+				SessionId: "other",
+				Update:    api.NewSessionUpdateAgentMessageChunk(textChunk("ignored")),
+			})
+		}
+		err := s.conn.SendSessionUpdate(ctx, &api.SessionNotification{
+			SessionId: params.SessionId,
+			Update:    api.NewSessionUpdateAgentMessageChunk(textChunk(fmt.Sprintf("%d,", i))),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.waitCancel {
+		<-s.stop
+		return &api.PromptResponse{StopReason: api.StopReasonCancelled}, nil
+	}
+	return &api.PromptResponse{StopReason: api.StopReasonEndTurn}, nil
+}
+
+func newStreamingPair(t *testing.T, agent *streamingAgent, clientHandler Handler) *ClientConnection {
+	t.Helper()
+
+	agent.cancelled = make(chan api.SessionId, 10)
+	agent.stop = make(chan struct{}, 10)
+	agentConn, clientConn := NewRolePair(t, agent.handler(), clientHandler)
+	agent.conn = agentConn
+	return clientConn
+}
+
+// collectText concatenates the text of the message chunk updates of a stream.
+func collectText(events []PromptEvent) string {
+	var text string
+	for _, event := range events {
+		if event.Update != nil && event.Update.AgentMessageChunk != nil {
+			text += event.Update.AgentMessageChunk.Content.Text.Text
+		}
+	}
+	return text
+}
+
+func TestPromptStream(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("UpdatesPrecedeStopReason", func(t *testing.T) {
+		agent := &streamingAgent{chunks: 50}
+		clientConn := newStreamingPair(t, agent, NewClientHandlerRegistry())
+
+		var expected string
+		for i := range agent.chunks {
+			expected += fmt.Sprintf("%d,", i)
+		}
+
+		// Repeat to exercise the race between the response and queued updates.
+		for range 10 {
+			var events []PromptEvent
+			for event := range clientConn.PromptStream(ctx, SamplePromptRequest("s1")) {
+				events = append(events, event)
+			}
+
+			require.Len(t, events, agent.chunks+1)
+			final := events[len(events)-1]
+			assert.True(t, final.Final())
+			require.NoError(t, final.Err)
+			assert.Equal(t, api.StopReasonEndTurn, final.StopReason)
+			assert.Equal(t, expected, collectText(events))
+		}
+	})
+
+	t.Run("OtherSessionsAndGlobalHandler", func(t *testing.T) {
+		var seen atomic.Int32
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionUpdateHandler(func(_ context.Context, _ *api.SessionNotification) error {
+			seen.Add(1)
+			return nil
+		})
+
+		agent := &streamingAgent{chunks: 3, otherUpdate: true}
+		clientConn := newStreamingPair(t, agent, clientHandler)
+
+		var events []PromptEvent
+		for event := range clientConn.PromptStream(ctx, SamplePromptRequest("s1")) {
+			events = append(events, event)
+		}
+
+		assert.Len(t, events, 4)
+		assert.Equal(t, "0,1,2,", collectText(events))
+		assert.Equal(t, int32(6), seen.Load())
+	})
+
+	t.Run("ContextCancelSendsSessionCancel", func(t *testing.T) {
+		agent := &streamingAgent{chunks: 1, waitCancel: true}
+		clientConn := newStreamingPair(t, agent, NewClientHandlerRegistry())
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var events []PromptEvent
+		for event := range clientConn.PromptStream(streamCtx, SamplePromptRequest("s1")) {
+			events = append(events, event)
+			if !event.Final() {
+				cancel()
+			}
+		}
+
+		require.Len(t, events, 2)
+		final := events[1]
+		require.NoError(t, final.Err)
+		assert.Equal(t, api.StopReasonCancelled, final.StopReason)
+		assert.Equal(t, api.SessionId("s1"), <-agent.cancelled)
+	})
+
+	t.Run("OutlivesRequestTimeout", func(t *testing.T) {
+		agent := &streamingAgent{chunks: 1, waitCancel: true}
+		clientConn := newStreamingPair(t, agent, NewClientHandlerRegistry())
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		time.AfterFunc(testRequestTimeout+500*time.Millisecond, cancel)
+
+		var events []PromptEvent
+		for event := range clientConn.PromptStream(streamCtx, SamplePromptRequest("s1")) {
+			events = append(events, event)
+		}
+
+		require.Len(t, events, 2)
+		require.NoError(t, events[1].Err)
+		assert.Equal(t, api.StopReasonCancelled, events[1].StopReason)
+	})
+
+	t.Run("BreakSendsSessionCancel", func(t *testing.T) {
+		agent := &streamingAgent{chunks: 1, waitCancel: true}
+		clientConn := newStreamingPair(t, agent, NewClientHandlerRegistry())
+
+		for event := range clientConn.PromptStream(ctx, SamplePromptRequest("s1")) {
+			require.NotNil(t, event.Update)
+			break
+		}
+
+		select {
+		case id := <-agent.cancelled:
+			assert.Equal(t, api.SessionId("s1"), id)
+		case <-time.After(time.Second):
+			t.Fatal("session/cancel was not sent")
+		}
+	})
+
+	t.Run("PromptError", func(t *testing.T) {
+		agent := &streamingAgent{promptErr: errors.New("model unavailable")}
+		clientConn := newStreamingPair(t, agent, NewClientHandlerRegistry())
+
+		var events []PromptEvent
+		for event := range clientConn.PromptStream(ctx, SamplePromptRequest("s1")) {
+			events = append(events, event)
+		}
+
+		require.Len(t, events, 1)
+		require.Error(t, events[0].Err)
+		assert.Contains(t, events[0].Err.Error(), "model unavailable")
+	})
+
+	t.Run("OneStreamPerSession", func(t *testing.T) {
+		agent := &streamingAgent{chunks: 1, waitCancel: true}
+		clientConn := newStreamingPair(t, agent, NewClientHandlerRegistry())
+
+		next, stop := iter.Pull(clientConn.PromptStream(ctx, SamplePromptRequest("s1")))
+		defer stop()
+		event, ok := next()
+		require.True(t, ok)
+		require.NotNil(t, event.Update)
+
+		var events []PromptEvent
+		for event := range clientConn.PromptStream(ctx, SamplePromptRequest("s1")) {
+			events = append(events, event)
+		}
+		require.Len(t, events, 1)
+		AssertACPError(t, events[0].Err, api.ErrorCodeConflict)
+	})
+}
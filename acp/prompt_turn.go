@@ -0,0 +1,298 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// PromptTurnPolicy controls what happens when a session/prompt request arrives
+// for a session that already has a prompt turn in progress.
+//
+// ACP allows only one active prompt turn per session. Prompts for different
+// sessions always run concurrently.
+type PromptTurnPolicy int
+
+const (
+	// PromptTurnPolicyQueue runs overlapping prompts one after another in arrival order.
+	PromptTurnPolicyQueue PromptTurnPolicy = iota
+	// PromptTurnPolicyReject fails overlapping prompts with a conflict error.
+	PromptTurnPolicyReject
+	// PromptTurnPolicyCancelReplace cancels the running turn and any queued
+	// prompts, then runs the new prompt. Replaced prompts that never started
+	// complete with StopReasonCancelled.
+	PromptTurnPolicyCancelReplace
+)
+
+// String returns the string representation of the policy.
+func (p PromptTurnPolicy) String() string {
+	switch p {
+	case PromptTurnPolicyQueue:
+		return "queue"
+	case PromptTurnPolicyReject:
+		return "reject"
+	case PromptTurnPolicyCancelReplace:
+		return "cancel-replace"
+	default:
+		return "unknown"
+	}
+}
+
+// PromptTurnState describes the prompt turns for one session on a connection.
+type PromptTurnState struct {
+	// Active is true while a prompt turn is running.
+	Active bool
+	// Queued is the number of prompts waiting for the running turn to finish.
+	Queued int
+}
+
+// PromptTurnCallback is called when the prompt turn state of a session changes.
+type PromptTurnCallback func(sessionID api.SessionId, state PromptTurnState)
+
+// promptTurn is a single session/prompt request tracked by a promptTurnTracker.
+type promptTurn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	ready  chan struct{}
+}
+
+// sessionTurns holds the running and waiting turns for one session.
+type sessionTurns struct {
+	active *promptTurn
+	queued []*promptTurn
+}
+
+// promptTurnTracker enforces a PromptTurnPolicy per session.
+type promptTurnTracker struct {
+	mu        sync.Mutex
+	policy    PromptTurnPolicy
+	sessions  map[api.SessionId]*sessionTurns
+	callbacks *util.CallbackRegistry[PromptTurnCallback]
+}
+
+// newPromptTurnTracker creates a tracker using PromptTurnPolicyQueue.
+func newPromptTurnTracker() *promptTurnTracker {
+	return &promptTurnTracker{
+		policy:    PromptTurnPolicyQueue,
+		sessions:  make(map[api.SessionId]*sessionTurns),
+		callbacks: util.NewCallbackRegistry[PromptTurnCallback](),
+	}
+}
+
+// setPolicy sets the policy applied to prompts that arrive after the call.
+func (pt *promptTurnTracker) setPolicy(policy PromptTurnPolicy) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.policy = policy
+}
+
+// getPolicy returns the current policy.
+func (pt *promptTurnTracker) getPolicy() PromptTurnPolicy {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return pt.policy
+}
+
+// state returns the prompt turn state of a session.
+func (pt *promptTurnTracker) state(id api.SessionId) PromptTurnState {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return pt.stateLocked(id)
+}
+
+func (pt *promptTurnTracker) stateLocked(id api.SessionId) PromptTurnState {
+	st, exists := pt.sessions[id]
+	if !exists {
+		return PromptTurnState{}
+	}
+	return PromptTurnState{Active: st.active != nil, Queued: len(st.queued)}
+}
+
+// begin registers a new prompt for a session according to the policy.
+//
+// It must be called in arrival order. The returned turn is ready to run once
+// wait returns without error.
+func (pt *promptTurnTracker) begin(ctx context.Context, id api.SessionId) (*promptTurn, error) {
+	turnCtx, cancel := context.WithCancel(ctx)
+	turn := &promptTurn{ctx: turnCtx, cancel: cancel, ready: make(chan struct{})}
+
+	pt.mu.Lock()
+	st, exists := pt.sessions[id]
+	if !exists {
+		st = &sessionTurns{}
+		pt.sessions[id] = st
+	}
+
+	switch {
+	case st.active == nil:
+		st.active = turn
+		close(turn.ready)
+	case pt.policy == PromptTurnPolicyReject:
+		pt.mu.Unlock()
+		cancel()
+		return nil, NewConflictError(
+			fmt.Sprintf("session %v", id),
+			"a prompt turn is already in progress",
+		)
+	case pt.policy == PromptTurnPolicyCancelReplace:
+		st.active.cancel()
+		for _, queued := range st.queued {
+			queued.cancel()
+		}
+		st.queued = []*promptTurn{turn}
+	default:
+		st.queued = append(st.queued, turn)
+	}
+	state := pt.stateLocked(id)
+	pt.mu.Unlock()
+
+	pt.notify(id, state)
+	return turn, nil
+}
+
+// wait blocks until the turn may run. It returns an error if the turn was
+// cancelled or replaced before it started.
+func (pt *promptTurnTracker) wait(id api.SessionId, turn *promptTurn) error {
+	select {
+	case <-turn.ready:
+		return nil
+	case <-turn.ctx.Done():
+	}
+
+	// The turn may have been promoted concurrently with its cancellation.
+	select {
+	case <-turn.ready:
+		pt.end(id, turn)
+	default:
+		pt.remove(id, turn)
+	}
+	return turn.ctx.Err()
+}
+
+// end finishes a running turn and starts the next queued turn, if any.
+func (pt *promptTurnTracker) end(id api.SessionId, turn *promptTurn) {
+	turn.cancel()
+
+	pt.mu.Lock()
+	st, exists := pt.sessions[id]
+	if !exists || st.active != turn {
+		pt.mu.Unlock()
+		return
+	}
+
+	st.active = nil
+	if len(st.queued) > 0 {
+		st.active = st.queued[0]
+		st.queued = st.queued[1:]
+		close(st.active.ready)
+	} else {
+		delete(pt.sessions, id)
+	}
+	state := pt.stateLocked(id)
+	pt.mu.Unlock()
+
+	pt.notify(id, state)
+}
+
+// remove drops a turn that never started from the queue.
+func (pt *promptTurnTracker) remove(id api.SessionId, turn *promptTurn) {
+	pt.mu.Lock()
+	st, exists := pt.sessions[id]
+	if !exists {
+		pt.mu.Unlock()
+		return
+	}
+
+	for i, queued := range st.queued {
+		if queued == turn {
+			st.queued = append(st.queued[:i:i], st.queued[i+1:]...)
+			break
+		}
+	}
+	state := pt.stateLocked(id)
+	pt.mu.Unlock()
+
+	pt.notify(id, state)
+}
+
+// notify invokes the registered state callbacks.
+func (pt *promptTurnTracker) notify(id api.SessionId, state PromptTurnState) {
+	for _, callback := range pt.callbacks.GetAll() {
+		callback(id, state)
+	}
+}
+
+// dispatchPrompt runs a session/prompt request as its own goroutine so that
+// other messages, including session/cancel, are handled while the turn runs.
+// The turn is serialized against other prompts for the same session according
+// to the connection's PromptTurnPolicy.
+func (a *AgentConnection) dispatchPrompt(
+	ctx context.Context,
+	conn *jsonrpc2.Connection,
+	req *jsonrpc2.Request,
+	final dispatchFunc,
+) (interface{}, error) {
+	var params struct {
+		SessionID api.SessionId `json:"sessionId"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.SessionID == "" {
+		// Let the handler report the invalid params.
+		return a.core.dispatch(ctx, req, final)
+	}
+
+	turn, err := a.turns.begin(ctx, params.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		result, runErr := a.runPromptTurn(params.SessionID, turn, req, final)
+		_ = a.flushSessionUpdates(params.SessionID)
+		_ = conn.Respond(req.ID, result, runErr)
+	}()
+
+	return nil, jsonrpc2.ErrAsyncResponse
+}
+
+// runPromptTurn waits for the turn to become active and dispatches it.
+func (a *AgentConnection) runPromptTurn(
+	id api.SessionId,
+	turn *promptTurn,
+	req *jsonrpc2.Request,
+	final dispatchFunc,
+) (interface{}, error) {
+	if err := a.turns.wait(id, turn); err != nil {
+		return &api.PromptResponse{StopReason: api.StopReasonCancelled}, nil
+	}
+	defer a.turns.end(id, turn)
+
+	return a.core.dispatch(turn.ctx, req, final)
+}
+
+// Integration with AgentConnection
+
+// SetPromptTurnPolicy sets how overlapping session/prompt requests for the same
+// session are handled. The default is PromptTurnPolicyQueue.
+func (a *AgentConnection) SetPromptTurnPolicy(policy PromptTurnPolicy) {
+	a.turns.setPolicy(policy)
+}
+
+// PromptTurnPolicy returns the connection's prompt turn policy.
+func (a *AgentConnection) PromptTurnPolicy() PromptTurnPolicy {
+	return a.turns.getPolicy()
+}
+
+// PromptTurnState returns the prompt turn state of a session on this connection.
+func (a *AgentConnection) PromptTurnState(sessionID api.SessionId) PromptTurnState {
+	return a.turns.state(sessionID)
+}
+
+// OnPromptTurnChange registers a callback for prompt turn state changes.
+func (a *AgentConnection) OnPromptTurnChange(callback PromptTurnCallback) {
+	a.turns.callbacks.Register(callback)
+}
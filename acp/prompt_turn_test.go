@@ -0,0 +1,273 @@
+package acp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// blockingPromptAgent is a prompt handler that blocks each turn until released
+// or cancelled.
+type blockingPromptAgent struct {
+	started  chan api.SessionId
+	release  chan struct{}
+	canceled chan api.SessionId
+}
+
+func newBlockingPromptAgent() *blockingPromptAgent {
+	return &blockingPromptAgent{
+		started:  make(chan api.SessionId, 10),
+		release:  make(chan struct{}, 10),
+		canceled: make(chan api.SessionId, 10),
+	}
+}
+
+func (b *blockingPromptAgent) HandleSessionPrompt(
+	ctx context.Context,
+	params *api.PromptRequest,
+) (*api.PromptResponse, error) {
+	b.started <- params.SessionId
+	select {
+	case <-b.release:
+		return &api.PromptResponse{StopReason: api.StopReasonEndTurn}, nil
+	case <-ctx.Done():
+		return &api.PromptResponse{StopReason: api.StopReasonCancelled}, nil
+	}
+}
+
+func (b *blockingPromptAgent) HandleSessionCancel(_ context.Context, params *api.CancelNotification) error {
+	b.canceled <- params.SessionId
+	return nil
+}
+
+// newPromptTurnPair creates an agent connection running a blockingPromptAgent
+// and a raw JSON-RPC peer for the client side. ClientConnection serializes its
+// own calls, so a raw peer is used to issue overlapping prompts the way a
+// misbehaving client could.
+func newPromptTurnPair(t *testing.T) (*AgentConnection, *jsonrpc2.Connection, *blockingPromptAgent) {
+	t.Helper()
+
+	agent := newBlockingPromptAgent()
+	handler := NewAgentHandlerRegistry()
+	handler.RegisterSessionPromptHandler(agent.HandleSessionPrompt)
+	handler.RegisterSessionCancelHandler(agent.HandleSessionCancel)
+
+	transport := NewMockTransport()
+	ctx := context.Background()
+
+	agentConn, err := NewAgentConnectionStdio(ctx, transport.Agent(), handler, testRequestTimeout)
+	require.NoError(t, err)
+
+	clientConn, err := jsonrpc2.Dial(ctx, stdioDialer{rwc: transport.Client()}, jsonrpc2.ConnectionOptions{})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		agentConn.Close()
+		clientConn.Close()
+		transport.Close()
+	})
+
+	return agentConn, clientConn, agent
+}
+
+type promptResult struct {
+	resp *api.PromptResponse
+	err  error
+}
+
+// sendPrompt issues a session/prompt in the background.
+func sendPrompt(clientConn *jsonrpc2.Connection, sessionID string) <-chan promptResult {
+	done := make(chan promptResult, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testRequestTimeout)
+		defer cancel()
+
+		var resp api.PromptResponse
+		err := clientConn.Call(ctx, api.MethodSessionPrompt, SamplePromptRequest(sessionID)).Await(ctx, &resp)
+		done <- promptResult{resp: &resp, err: err}
+	}()
+	return done
+}
+
+func waitStarted(t *testing.T, agent *blockingPromptAgent) api.SessionId {
+	t.Helper()
+	select {
+	case id := <-agent.started:
+		return id
+	case <-time.After(time.Second):
+		t.Fatal("prompt turn did not start")
+		return ""
+	}
+}
+
+func waitResult(t *testing.T, done <-chan promptResult) promptResult {
+	t.Helper()
+	select {
+	case result := <-done:
+		return result
+	case <-time.After(time.Second):
+		t.Fatal("prompt did not complete")
+		return promptResult{}
+	}
+}
+
+func TestPromptTurnPolicy(t *testing.T) {
+	t.Run("DefaultIsQueue", func(t *testing.T) {
+		agentConn, _, _ := newPromptTurnPair(t)
+		assert.Equal(t, PromptTurnPolicyQueue, agentConn.PromptTurnPolicy())
+	})
+
+	t.Run("Queue", func(t *testing.T) {
+		agentConn, clientConn, agent := newPromptTurnPair(t)
+
+		first := sendPrompt(clientConn, "s1")
+		waitStarted(t, agent)
+
+		second := sendPrompt(clientConn, "s1")
+		WaitWithTimeout(t, time.Second, func() bool {
+			return agentConn.PromptTurnState("s1") == PromptTurnState{Active: true, Queued: 1}
+		}, "second prompt queued")
+
+		select {
+		case <-agent.started:
+			t.Fatal("queued prompt started while a turn was active")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		agent.release <- struct{}{}
+		result := waitResult(t, first)
+		require.NoError(t, result.err)
+
+		waitStarted(t, agent)
+		agent.release <- struct{}{}
+		result = waitResult(t, second)
+		require.NoError(t, result.err)
+		assert.Equal(t, string(api.StopReasonEndTurn), result.resp.StopReason)
+
+		WaitWithTimeout(t, time.Second, func() bool {
+			return agentConn.PromptTurnState("s1") == PromptTurnState{}
+		}, "turn state cleared")
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		agentConn, clientConn, agent := newPromptTurnPair(t)
+		agentConn.SetPromptTurnPolicy(PromptTurnPolicyReject)
+
+		first := sendPrompt(clientConn, "s1")
+		waitStarted(t, agent)
+
+		result := waitResult(t, sendPrompt(clientConn, "s1"))
+		AssertACPError(t, result.err, api.ErrorCodeConflict)
+		assert.Equal(t, PromptTurnState{Active: true}, agentConn.PromptTurnState("s1"))
+
+		agent.release <- struct{}{}
+		require.NoError(t, waitResult(t, first).err)
+	})
+
+	t.Run("CancelReplace", func(t *testing.T) {
+		agentConn, clientConn, agent := newPromptTurnPair(t)
+		agentConn.SetPromptTurnPolicy(PromptTurnPolicyQueue)
+
+		first := sendPrompt(clientConn, "s1")
+		waitStarted(t, agent)
+
+		// Queue a prompt, then replace everything with a third one.
+		second := sendPrompt(clientConn, "s1")
+		WaitWithTimeout(t, time.Second, func() bool {
+			return agentConn.PromptTurnState("s1").Queued == 1
+		}, "second prompt queued")
+
+		agentConn.SetPromptTurnPolicy(PromptTurnPolicyCancelReplace)
+		third := sendPrompt(clientConn, "s1")
+
+		result := waitResult(t, first)
+		require.NoError(t, result.err)
+		assert.Equal(t, string(api.StopReasonCancelled), result.resp.StopReason)
+
+		// The queued prompt never ran.
+		result = waitResult(t, second)
+		require.NoError(t, result.err)
+		assert.Equal(t, string(api.StopReasonCancelled), result.resp.StopReason)
+
+		waitStarted(t, agent)
+		agent.release <- struct{}{}
+		result = waitResult(t, third)
+		require.NoError(t, result.err)
+		assert.Equal(t, string(api.StopReasonEndTurn), result.resp.StopReason)
+	})
+
+	t.Run("SessionsRunConcurrently", func(t *testing.T) {
+		agentConn, clientConn, agent := newPromptTurnPair(t)
+		agentConn.SetPromptTurnPolicy(PromptTurnPolicyReject)
+
+		first := sendPrompt(clientConn, "s1")
+		second := sendPrompt(clientConn, "s2")
+
+		started := []api.SessionId{waitStarted(t, agent), waitStarted(t, agent)}
+		assert.ElementsMatch(t, []api.SessionId{"s1", "s2"}, started)
+
+		agent.release <- struct{}{}
+		agent.release <- struct{}{}
+		require.NoError(t, waitResult(t, first).err)
+		require.NoError(t, waitResult(t, second).err)
+	})
+
+	t.Run("CancelDeliveredDuringTurn", func(t *testing.T) {
+		_, clientConn, agent := newPromptTurnPair(t)
+
+		first := sendPrompt(clientConn, "s1")
+		waitStarted(t, agent)
+
+		cancel := &api.CancelNotification{SessionId: "s1"}
+		require.NoError(t, clientConn.Notify(context.Background(), api.MethodSessionCancel, cancel))
+		select {
+		case id := <-agent.canceled:
+			assert.Equal(t, api.SessionId("s1"), id)
+		case <-time.After(time.Second):
+			t.Fatal("session/cancel was not delivered while the turn was running")
+		}
+
+		agent.release <- struct{}{}
+		require.NoError(t, waitResult(t, first).err)
+	})
+
+	t.Run("ObservableThroughSessionState", func(t *testing.T) {
+		agentConn, clientConn, agent := newPromptTurnPair(t)
+		manager := NewSessionManager()
+		agentConn.BindSessionManager(manager)
+		_, err := manager.CreateSession("s1")
+		require.NoError(t, err)
+
+		first := sendPrompt(clientConn, "s1")
+		waitStarted(t, agent)
+		second := sendPrompt(clientConn, "s1")
+
+		session, exists := manager.GetSession("s1")
+		require.True(t, exists)
+		WaitWithTimeout(t, time.Second, func() bool {
+			return session.PromptTurns() == PromptTurnState{Active: true, Queued: 1}
+		}, "session reports queued prompt")
+
+		agent.release <- struct{}{}
+		require.NoError(t, waitResult(t, first).err)
+		waitStarted(t, agent)
+		agent.release <- struct{}{}
+		require.NoError(t, waitResult(t, second).err)
+
+		WaitWithTimeout(t, time.Second, func() bool {
+			return session.PromptTurns() == PromptTurnState{}
+		}, "session reports idle")
+	})
+}
+
+func TestPromptTurnPolicyString(t *testing.T) {
+	assert.Equal(t, "queue", PromptTurnPolicyQueue.String())
+	assert.Equal(t, "reject", PromptTurnPolicyReject.String())
+	assert.Equal(t, "cancel-replace", PromptTurnPolicyCancelReplace.String())
+	assert.Equal(t, "unknown", PromptTurnPolicy(99).String())
+}
@@ -0,0 +1,176 @@
+package acp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+)
+
+// TTYPrompter is a Prompter that asks on a terminal. It also reads free-form
+// input lines, so a client can share one terminal between its own prompts and
+// permission requests.
+//
+// Prompts are serialized: a prompt waits until the previous one is answered.
+// A prompt abandoned because its context was cancelled leaves the next line
+// typed for the following prompt.
+type TTYPrompter struct {
+	in  io.Reader
+	out io.Writer
+
+	once  sync.Once
+	lines chan string
+	turn  chan struct{}
+}
+
+// NewTTYPrompter creates a prompter that reads lines from in and writes
+// prompts to out.
+func NewTTYPrompter(in io.Reader, out io.Writer) *TTYPrompter {
+	return &TTYPrompter{
+		in:    in,
+		out:   out,
+		lines: make(chan string),
+		turn:  make(chan struct{}, 1),
+	}
+}
+
+// readLines starts reading input lines in the background. The channel is
+// closed at end of input.
+func (p *TTYPrompter) readLines() {
+	p.once.Do(func() {
+		go func() {
+			defer close(p.lines)
+			scanner := bufio.NewScanner(p.in)
+			for scanner.Scan() {
+				p.lines <- scanner.Text()
+			}
+		}()
+	})
+}
+
+// acquire waits for the prompter to be free.
+func (p *TTYPrompter) acquire(ctx context.Context) error {
+	select {
+	case p.turn <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the prompter for the next prompt.
+func (p *TTYPrompter) release() {
+	<-p.turn
+}
+
+// nextLine returns the next input line, or io.EOF at end of input.
+func (p *TTYPrompter) nextLine(ctx context.Context) (string, error) {
+	p.readLines()
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			return "", io.EOF
+		}
+		return strings.TrimSpace(line), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// ReadLine writes prompt and returns the next input line with surrounding
+// whitespace removed. It returns io.EOF at end of input.
+func (p *TTYPrompter) ReadLine(ctx context.Context, prompt string) (string, error) {
+	if err := p.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer p.release()
+
+	fmt.Fprint(p.out, prompt)
+	return p.nextLine(ctx)
+}
+
+// Choose lists options and asks until a valid one is chosen. It returns the
+// index of the chosen option, or io.EOF at end of input.
+func (p *TTYPrompter) Choose(ctx context.Context, prompt string, options []string) (int, error) {
+	if err := p.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer p.release()
+
+	return p.choose(ctx, prompt, options)
+}
+
+// choose implements Choose for a caller that holds the prompter.
+func (p *TTYPrompter) choose(ctx context.Context, prompt string, options []string) (int, error) {
+	if prompt != "" {
+		fmt.Fprint(p.out, prompt)
+	}
+	fmt.Fprintln(p.out)
+	for i, option := range options {
+		fmt.Fprintf(p.out, "  %d. %s\n", i+1, option)
+	}
+
+	ask := "Choose an option (1-" + strconv.Itoa(len(options)) + "): "
+	for {
+		fmt.Fprint(p.out, ask)
+		choice, err := p.nextLine(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if choice == "" {
+			continue
+		}
+
+		choiceNum, err := strconv.Atoi(choice)
+		if err != nil || choiceNum < 1 || choiceNum > len(options) {
+			fmt.Fprintln(p.out, "Invalid choice. Please try again.")
+			continue
+		}
+		return choiceNum - 1, nil
+	}
+}
+
+// PromptPermission describes the tool call of a permission request and asks
+// the user to choose one of its options.
+func (p *TTYPrompter) PromptPermission(
+	ctx context.Context,
+	request *api.RequestPermissionRequest,
+) (*api.PermissionOption, error) {
+	if len(request.Options) == 0 {
+		return nil, nil //nolint:nilnil // No options means no choice was made.
+	}
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer p.release()
+
+	title := ""
+	if request.ToolCall.Title != nil {
+		title = *request.ToolCall.Title
+	}
+	fmt.Fprintf(p.out, "\n[PERMISSION] Agent requested permission for: %s\n", title)
+	if kind := toolKindValue(request.ToolCall.Kind); kind != "" {
+		fmt.Fprintf(p.out, "    Tool kind: %s\n", kind)
+	}
+	if len(request.ToolCall.Locations) > 0 {
+		fmt.Fprintln(p.out, "    Affected locations:")
+		for _, location := range request.ToolCall.Locations {
+			fmt.Fprintf(p.out, "      - %s\n", location.Path)
+		}
+	}
+
+	names := make([]string, len(request.Options))
+	for i, option := range request.Options {
+		names[i] = option.Name
+	}
+	index, err := p.choose(ctx, "", names)
+	if err != nil {
+		return nil, err
+	}
+	return &request.Options[index], nil
+}
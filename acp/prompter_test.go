@@ -0,0 +1,81 @@
+package acp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTYPrompter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ReadLine", func(t *testing.T) {
+		var out bytes.Buffer
+		prompter := NewTTYPrompter(strings.NewReader("  hello  \n"), &out)
+
+		line, err := prompter.ReadLine(ctx, "You: ")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", line)
+		assert.Equal(t, "You: ", out.String())
+
+		_, err = prompter.ReadLine(ctx, "You: ")
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("ChooseRetriesInvalidInput", func(t *testing.T) {
+		var out bytes.Buffer
+		prompter := NewTTYPrompter(strings.NewReader("\nabc\n9\n2\n"), &out)
+
+		index, err := prompter.Choose(ctx, "Pick one:", []string{"red", "green"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, index)
+		assert.Contains(t, out.String(), "  1. red\n  2. green\n")
+		assert.Equal(t, 2, strings.Count(out.String(), "Invalid choice"))
+	})
+
+	t.Run("PromptPermission", func(t *testing.T) {
+		var out bytes.Buffer
+		prompter := NewTTYPrompter(strings.NewReader("3\n"), &out)
+
+		request := permissionRequest("s1", api.ToolKindEdit, "/src/main.go")
+		option, err := prompter.PromptPermission(ctx, request)
+		require.NoError(t, err)
+		assert.Equal(t, api.PermissionOptionId("reject"), option.OptionId)
+		assert.Contains(t, out.String(), "permission for: Edit files")
+		assert.Contains(t, out.String(), "Tool kind: edit")
+		assert.Contains(t, out.String(), "- /src/main.go")
+	})
+
+	t.Run("PromptPermissionAtEOF", func(t *testing.T) {
+		prompter := NewTTYPrompter(strings.NewReader(""), io.Discard)
+		_, err := prompter.PromptPermission(ctx, permissionRequest("s1", api.ToolKindEdit))
+		assert.ErrorIs(t, err, io.EOF)
+
+		// The policy treats the end of input as a cancelled request.
+		policy := NewPermissionPolicy(prompter)
+		assert.Equal(t, "cancelled", decide(t, policy, permissionRequest("s1", api.ToolKindEdit)))
+	})
+
+	t.Run("CancelledPromptKeepsLineForNextPrompt", func(t *testing.T) {
+		in, writer := io.Pipe()
+		defer writer.Close()
+		prompter := NewTTYPrompter(in, io.Discard)
+
+		cancelCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err := prompter.ReadLine(cancelCtx, "first: ")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		go func() { _, _ = writer.Write([]byte("typed later\n")) }()
+		line, err := prompter.ReadLine(ctx, "second: ")
+		require.NoError(t, err)
+		assert.Equal(t, "typed later", line)
+	})
+}
@@ -33,7 +33,7 @@ func (s *ProtocolFlowTestSuite) TestCompleteInitializationFlow() {
 
 	// 1. Initialize - client calls initialize on agent.
 	request := SampleInitializeRequest()
-	response, err := s.pair.AgentConn.Initialize(ctx, request)
+	response, err := s.pair.ClientConn.Initialize(ctx, request)
 
 	s.Require().NoError(err)
 	s.Require().NotNil(response)
@@ -46,7 +46,7 @@ func (s *ProtocolFlowTestSuite) TestCompleteInitializationFlow() {
 	authRequest := &api.AuthenticateRequest{
 		MethodId: response.AuthMethods[0].Id,
 	}
-	err = s.pair.AgentConn.Authenticate(ctx, authRequest)
+	err = s.pair.ClientConn.Authenticate(ctx, authRequest)
 	s.Require().NoError(err)
 
 	// Verify agent is authenticated.
@@ -62,7 +62,7 @@ func (s *ProtocolFlowTestSuite) TestCompleteSessionFlow() {
 
 	// 1. Create new session.
 	sessionRequest := SampleNewSessionRequest()
-	sessionResponse, err := s.pair.AgentConn.SessionNew(ctx, sessionRequest)
+	sessionResponse, err := s.pair.ClientConn.SessionNew(ctx, sessionRequest)
 
 	s.Require().NoError(err)
 	s.Require().NotNil(sessionResponse)
@@ -81,7 +81,7 @@ func (s *ProtocolFlowTestSuite) TestCompleteSessionFlow() {
 	loadRequest := &api.LoadSessionRequest{
 		SessionId: sessionResponse.SessionId,
 	}
-	err = s.pair.AgentConn.SessionLoad(ctx, loadRequest)
+	err = s.pair.ClientConn.SessionLoad(ctx, loadRequest)
 	s.Require().NoError(err)
 }
 
@@ -107,7 +107,7 @@ func main() {
 
 	for _, filePath := range files {
 		readRequest := SampleReadTextFileRequest("session-1", filePath)
-		result, err := s.pair.ClientConn.FsReadTextFile(ctx, readRequest)
+		result, err := s.pair.AgentConn.FsReadTextFile(ctx, readRequest)
 
 		if filePath == "/project/nonexistent.txt" {
 			// This should return default content since file doesn't exist.
@@ -128,7 +128,7 @@ func main() {
 
 	for filePath, content := range writeFiles {
 		writeRequest := SampleWriteTextFileRequest("session-1", filePath, content)
-		err := s.pair.ClientConn.FsWriteTextFile(ctx, writeRequest)
+		err := s.pair.AgentConn.FsWriteTextFile(ctx, writeRequest)
 		s.Require().NoError(err)
 	}
 
@@ -153,7 +153,7 @@ func (s *ProtocolFlowTestSuite) TestPromptFlow() {
 
 	// Send prompt request.
 	promptRequest := SamplePromptRequest(string(sessionResponse.SessionId))
-	promptResponse, err := s.pair.AgentConn.SessionPrompt(ctx, promptRequest)
+	promptResponse, err := s.pair.ClientConn.SessionPrompt(ctx, promptRequest)
 
 	s.Require().NoError(err)
 	s.NotNil(promptResponse)
@@ -175,7 +175,7 @@ func (s *ProtocolFlowTestSuite) TestErrorRecoveryFlow() {
 	s.pair.TestClient.SetShouldError("fs/read_text_file", true)
 
 	readRequest := SampleReadTextFileRequest("session-1", "/test/file.txt")
-	result, err := s.pair.ClientConn.FsReadTextFile(ctx, readRequest)
+	result, err := s.pair.AgentConn.FsReadTextFile(ctx, readRequest)
 
 	s.Require().Error(err)
 	s.Nil(result)
@@ -185,7 +185,7 @@ func (s *ProtocolFlowTestSuite) TestErrorRecoveryFlow() {
 	s.pair.TestClient.SetShouldError("fs/read_text_file", false)
 	s.pair.TestClient.AddFileContent("/test/file.txt", "Recovered content")
 
-	result, err = s.pair.ClientConn.FsReadTextFile(ctx, readRequest)
+	result, err = s.pair.AgentConn.FsReadTextFile(ctx, readRequest)
 	s.Require().NoError(err)
 	s.NotNil(result)
 	s.Equal("Recovered content", result.Content)
@@ -194,7 +194,7 @@ func (s *ProtocolFlowTestSuite) TestErrorRecoveryFlow() {
 	s.pair.TestAgent.SetShouldError("session/new", true)
 
 	sessionRequest := SampleNewSessionRequest()
-	sessionResponse, err := s.pair.AgentConn.SessionNew(ctx, sessionRequest)
+	sessionResponse, err := s.pair.ClientConn.SessionNew(ctx, sessionRequest)
 
 	s.Require().Error(err)
 	s.Nil(sessionResponse)
@@ -202,7 +202,7 @@ func (s *ProtocolFlowTestSuite) TestErrorRecoveryFlow() {
 	// Recover agent.
 	s.pair.TestAgent.SetShouldError("session/new", false)
 
-	sessionResponse, err = s.pair.AgentConn.SessionNew(ctx, sessionRequest)
+	sessionResponse, err = s.pair.ClientConn.SessionNew(ctx, sessionRequest)
 	s.Require().NoError(err)
 	s.NotNil(sessionResponse)
 }
@@ -219,7 +219,7 @@ func (s *ProtocolFlowTestSuite) TestCancellationFlow() {
 	cancelRequest := &api.CancelNotification{
 		SessionId: sessionResponse.SessionId,
 	}
-	err := s.pair.AgentConn.SessionCancel(ctx, cancelRequest)
+	err := s.pair.ClientConn.SessionCancel(ctx, cancelRequest)
 	s.Require().NoError(err)
 
 	// Give notification time to be processed.
@@ -239,7 +239,7 @@ func (s *ProtocolFlowTestSuite) TestCancellationFlow() {
 
 func (s *ProtocolFlowTestSuite) initializeConnection(ctx context.Context) *api.InitializeResponse {
 	request := SampleInitializeRequest()
-	response, err := s.pair.AgentConn.Initialize(ctx, request)
+	response, err := s.pair.ClientConn.Initialize(ctx, request)
 	s.Require().NoError(err)
 	s.Require().NotNil(response)
 	return response
@@ -247,7 +247,7 @@ func (s *ProtocolFlowTestSuite) initializeConnection(ctx context.Context) *api.I
 
 func (s *ProtocolFlowTestSuite) createSession(ctx context.Context) *api.NewSessionResponse {
 	request := SampleNewSessionRequest()
-	response, err := s.pair.AgentConn.SessionNew(ctx, request)
+	response, err := s.pair.ClientConn.SessionNew(ctx, request)
 	s.Require().NoError(err)
 	s.Require().NotNil(response)
 	return response
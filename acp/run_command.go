@@ -0,0 +1,246 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+)
+
+// RunCommandOptions configures AgentConnection.RunCommand.
+type RunCommandOptions struct {
+	// Args are the command's arguments.
+	Args []string
+	// Env holds additional environment variables for the command.
+	Env []api.EnvVariable
+	// Cwd is the absolute working directory. Empty uses the client's default,
+	// usually the session's Cwd.
+	Cwd string
+	// OutputByteLimit limits the output the client keeps. Zero uses the
+	// client's default.
+	OutputByteLimit int
+	// Timeout kills the command if it runs longer. Zero means no limit.
+	Timeout time.Duration
+	// OnOutput, if set, receives the command's output as it is written,
+	// polled with TerminalHandle.Follow. Chunks carry only Output and Gap; the
+	// exit status is in the result. Without OnOutput, RunCommand waits for the
+	// command with terminal/wait_for_exit and reads the output once.
+	OnOutput func(chunk TerminalChunk)
+	// PollInterval is the interval at which the output is polled for
+	// OnOutput. Zero uses DefaultTerminalFollowInterval.
+	PollInterval time.Duration
+
+	// ToolCall, if set, attaches the terminal to an open tool call instead of
+	// reporting a new one. The terminal is appended to its content, and its
+	// final status is set through the handle.
+	ToolCall *ToolCallHandle
+	// Title is the title of a new tool call. Empty uses the command line.
+	Title string
+}
+
+// CommandResult is the result of a command run with AgentConnection.RunCommand.
+type CommandResult struct {
+	// TerminalID is the ID of the terminal the command ran in. The terminal
+	// is released when RunCommand returns.
+	TerminalID string
+	// ToolCallID is the ID of the tool call showing the terminal.
+	ToolCallID api.ToolCallId
+	// Output is the output kept by the client.
+	Output string
+	// Truncated reports whether the client dropped output because of its
+	// output limit.
+	Truncated bool
+	// ExitStatus is the command's exit status.
+	ExitStatus api.TerminalExitStatus
+	// TimedOut reports whether the command was killed because it exceeded
+	// its Timeout.
+	TimedOut bool
+}
+
+// Success reports whether the command exited with exit code 0.
+func (r *CommandResult) Success() bool {
+	return r.ExitStatus.ExitCode != nil && *r.ExitStatus.ExitCode == 0
+}
+
+// RunCommand runs a command in a client terminal and waits for it to exit.
+//
+// The terminal is attached to a tool call as terminal content so the client
+// can display the output live. Unless opts.ToolCall is set, a new execute tool
+// call is reported; it is tracked by the session's running prompt turn, if
+// any. The tool call is completed when the command exits with exit code 0 and
+// failed otherwise.
+//
+// A command that exceeds opts.Timeout is killed and its result is returned
+// with TimedOut set. If ctx is cancelled, the command is killed and ctx's
+// error is returned. The terminal is always released before RunCommand
+// returns.
+func (a *AgentConnection) RunCommand(
+	ctx context.Context,
+	sessionID api.SessionId,
+	command string,
+	opts RunCommandOptions,
+) (*CommandResult, error) {
+	params := &api.CreateTerminalRequest{
+		SessionId: sessionID,
+		Command:   command,
+		Args:      opts.Args,
+		Env:       opts.Env,
+	}
+	if opts.Cwd != "" {
+		params.Cwd = &opts.Cwd
+	}
+	if opts.OutputByteLimit > 0 {
+		params.OutputByteLimit = &opts.OutputByteLimit
+	}
+
+	handle, err := a.CreateTerminalWithHandle(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	// Cleanup must happen even if ctx was cancelled.
+	cleanupCtx := context.WithoutCancel(ctx)
+	defer func() { _ = handle.Release(cleanupCtx) }()
+
+	result := &CommandResult{TerminalID: handle.ID}
+	toolCall, err := a.attachCommandToolCall(cleanupCtx, params, opts, result)
+	if err != nil {
+		return nil, err
+	}
+
+	waitCtx, cancel := ctx, context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		waitCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	defer cancel()
+
+	status, err := waitForCommand(waitCtx, handle, opts)
+	if err != nil && waitCtx.Err() != nil && ctx.Err() == nil {
+		result.TimedOut = true
+		status, err = killCommand(cleanupCtx, handle)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			_ = handle.Kill(cleanupCtx)
+		}
+		_ = finishCommandToolCall(toolCall, result, api.ToolCallStatusFailed)
+		return nil, err
+	}
+	result.ExitStatus = *status
+
+	output, err := handle.CurrentOutput(cleanupCtx)
+	if err != nil {
+		_ = finishCommandToolCall(toolCall, result, api.ToolCallStatusFailed)
+		return nil, err
+	}
+	result.Output = output.Output
+	result.Truncated = output.Truncated
+
+	toolStatus := api.ToolCallStatusCompleted
+	if !result.Success() {
+		toolStatus = api.ToolCallStatusFailed
+	}
+	if err = finishCommandToolCall(toolCall, result, toolStatus); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RunCommand runs a command in the turn's session. See
+// AgentConnection.RunCommand.
+func (t *TurnContext) RunCommand(command string, opts RunCommandOptions) (*CommandResult, error) {
+	return t.conn.RunCommand(t.ctx, t.sessionID, command, opts)
+}
+
+// attachCommandToolCall reports a new tool call showing the terminal, or
+// appends the terminal to the content of opts.ToolCall, and returns the tool
+// call's handle.
+func (a *AgentConnection) attachCommandToolCall(
+	ctx context.Context,
+	params *api.CreateTerminalRequest,
+	opts RunCommandOptions,
+	result *CommandResult,
+) (*ToolCallHandle, error) {
+	content := api.NewToolCallContentTerminal(result.TerminalID)
+	if handle := opts.ToolCall; handle != nil {
+		result.ToolCallID = handle.ID()
+		update := NewToolCallUpdate(handle.ID()).
+			WithStatus(api.ToolCallStatusInProgress).
+			WithContent(append(handle.Content(), content)).
+			Build()
+		return handle, handle.Update(update)
+	}
+
+	title := opts.Title
+	if title == "" {
+		title = commandLine(params)
+	}
+	result.ToolCallID = a.newToolCallID()
+	toolCall := NewToolCall(result.ToolCallID, title).
+		WithKind(string(api.ToolKindExecute)).
+		WithStatus(api.ToolCallStatusInProgress).
+		WithRawInput(params).
+		AddContent(content).
+		Build()
+	return a.startToolCall(ctx, params.SessionId, toolCall)
+}
+
+// finishCommandToolCall reports the final status of a command's tool call.
+func finishCommandToolCall(handle *ToolCallHandle, result *CommandResult, status api.ToolCallStatus) error {
+	update := NewToolCallUpdate(handle.ID()).
+		WithStatus(status).
+		WithRawOutput(map[string]interface{}{
+			"exitStatus": result.ExitStatus,
+			"timedOut":   result.TimedOut,
+			"truncated":  result.Truncated,
+		}).
+		Build()
+	return handle.Update(update)
+}
+
+// waitForCommand waits for a command's terminal to exit, following its
+// output if the caller asked for it.
+func waitForCommand(
+	ctx context.Context,
+	handle *TerminalHandle,
+	opts RunCommandOptions,
+) (*api.TerminalExitStatus, error) {
+	if opts.OnOutput == nil {
+		var response api.WaitForTerminalExitResponse
+		// Updates held back for coalescing must reach the client first.
+		handle.conn.flushUpdates()
+		err := handle.conn.core.callUntilDone(ctx, api.MethodTerminalWaitForExit, &api.WaitForTerminalExitRequest{
+			SessionId:  handle.sessionID,
+			TerminalId: handle.ID,
+		}, &response)
+		if err != nil {
+			return nil, err
+		}
+		return &api.TerminalExitStatus{ExitCode: response.ExitCode, Signal: response.Signal}, nil
+	}
+
+	for chunk := range handle.Follow(ctx, opts.PollInterval) {
+		if chunk.Err != nil {
+			return nil, chunk.Err
+		}
+		if chunk.Output != "" || chunk.Gap {
+			opts.OnOutput(TerminalChunk{Output: chunk.Output, Gap: chunk.Gap})
+		}
+		if chunk.ExitStatus != nil {
+			return chunk.ExitStatus, nil
+		}
+	}
+	return nil, errors.New("terminal handle has been released")
+}
+
+// killCommand kills a command and waits for its exit status.
+func killCommand(ctx context.Context, handle *TerminalHandle) (*api.TerminalExitStatus, error) {
+	if err := handle.Kill(ctx); err != nil {
+		return nil, err
+	}
+	response, err := handle.WaitForExit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &api.TerminalExitStatus{ExitCode: response.ExitCode, Signal: response.Signal}, nil
+}
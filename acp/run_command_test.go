@@ -0,0 +1,258 @@
+package acp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// updateRecorder records the session updates received by a client.
+type updateRecorder struct {
+	mu      sync.Mutex
+	updates []*api.SessionUpdate
+}
+
+// handle is a session/update handler.
+func (r *updateRecorder) handle(_ context.Context, params *api.SessionNotification) error {
+	update, err := DecodeSessionUpdate(params)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, update)
+	return nil
+}
+
+// waitFor waits until n updates were received and returns them.
+func (r *updateRecorder) waitFor(t *testing.T, n int) []*api.SessionUpdate {
+	t.Helper()
+	WaitWithTimeout(t, 5*time.Second, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.updates) >= n
+	}, "session updates not received")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*api.SessionUpdate(nil), r.updates...)
+}
+
+// newRunCommandPair creates a connection pair whose client runs terminals with
+// a TerminalHost and records session updates.
+func newRunCommandPair(t *testing.T) (*AgentConnection, *TerminalHost, *updateRecorder) {
+	t.Helper()
+	host := NewTerminalHost()
+	t.Cleanup(func() { _ = host.Close() })
+	recorder := &updateRecorder{}
+
+	clientHandler := NewClientHandlerRegistry()
+	host.Register(clientHandler)
+	clientHandler.RegisterSessionUpdateHandler(recorder.handle)
+	agentConn, _ := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+	return agentConn, host, recorder
+}
+
+func TestRunCommand(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ReportsToolCallWithTerminal", func(t *testing.T) {
+		agentConn, host, recorder := newRunCommandPair(t)
+
+		result, err := agentConn.RunCommand(ctx, "s1", "sh", RunCommandOptions{
+			Args: []string{"-c", "echo building; sleep 0.1; echo done"},
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Success())
+		assert.False(t, result.TimedOut)
+		assert.False(t, result.Truncated)
+		assert.Equal(t, "building\ndone\n", result.Output)
+		assert.Equal(t, 0, host.Count())
+
+		updates := recorder.waitFor(t, 2)
+		require.Len(t, updates, 2)
+		toolCall := updates[0].ToolCall
+		require.NotNil(t, toolCall)
+		assert.Equal(t, result.ToolCallID, *toolCall.Toolcallid)
+		assert.Equal(t, "sh -c echo building; sleep 0.1; echo done", toolCall.Title)
+		assert.Equal(t, api.ToolKindExecute, *toolCall.Kind)
+		require.Len(t, toolCall.Content, 1)
+		var content api.ToolCallContent
+		require.NoError(t, remarshal(toolCall.Content[0], &content))
+		require.NotNil(t, content.GetTerminal())
+		assert.Equal(t, result.TerminalID, content.GetTerminal().Terminalid)
+
+		final := updates[1].ToolCallUpdate
+		require.NotNil(t, final)
+		assert.Equal(t, string(api.ToolCallStatusCompleted), final.Status)
+	})
+
+	t.Run("WaitsWithoutPolling", func(t *testing.T) {
+		host := NewTerminalHost()
+		defer host.Close()
+		var outputRequests atomic.Int32
+		clientHandler := NewClientHandlerRegistry()
+		host.Register(clientHandler)
+		clientHandler.RegisterTerminalOutputHandler(func(
+			ctx context.Context,
+			params *api.TerminalOutputRequest,
+		) (*api.TerminalOutputResponse, error) {
+			outputRequests.Add(1)
+			return host.HandleOutput(ctx, params)
+		})
+		agentConn, _ := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+
+		// The command outlives the request timeout and is not cut short by it.
+		result, err := agentConn.RunCommand(ctx, "s1", "sh", RunCommandOptions{
+			Args: []string{"-c", "echo started; sleep 1.5; echo done"},
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Success())
+		assert.Equal(t, "started\ndone\n", result.Output)
+		assert.Equal(t, int32(1), outputRequests.Load())
+	})
+
+	t.Run("StreamsOutput", func(t *testing.T) {
+		agentConn, _, _ := newRunCommandPair(t)
+
+		var streamed strings.Builder
+		result, err := agentConn.RunCommand(ctx, "s1", "sh", RunCommandOptions{
+			Args:         []string{"-c", "echo building; sleep 0.1; echo done"},
+			PollInterval: 10 * time.Millisecond,
+			OnOutput: func(chunk TerminalChunk) {
+				assert.Nil(t, chunk.ExitStatus)
+				streamed.WriteString(chunk.Output)
+			},
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Success())
+		assert.Equal(t, "building\ndone\n", streamed.String())
+		assert.Equal(t, result.Output, streamed.String())
+	})
+
+	t.Run("FailedExitCode", func(t *testing.T) {
+		agentConn, _, recorder := newRunCommandPair(t)
+
+		result, err := agentConn.RunCommand(ctx, "s1", "sh", RunCommandOptions{
+			Args: []string{"-c", "echo oops >&2; exit 4"},
+		})
+		require.NoError(t, err)
+		assert.False(t, result.Success())
+		require.NotNil(t, result.ExitStatus.ExitCode)
+		assert.Equal(t, 4, *result.ExitStatus.ExitCode)
+		assert.Equal(t, "oops\n", result.Output)
+
+		updates := recorder.waitFor(t, 2)
+		require.Len(t, updates, 2)
+		assert.Equal(t, string(api.ToolCallStatusFailed), updates[1].ToolCallUpdate.Status)
+	})
+
+	t.Run("AttachesToOpenToolCall", func(t *testing.T) {
+		host := NewTerminalHost()
+		t.Cleanup(func() { _ = host.Close() })
+		clientHandler := NewClientHandlerRegistry()
+		host.Register(clientHandler)
+
+		var result *CommandResult
+		var status api.ToolCallStatus
+		var content []api.ToolCallUpdateContentElem
+		var open int
+		var completeErr error
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			call, err := turn.StartToolCall("Build", api.ToolKindExecute)
+			require.NoError(t, err)
+			block := NewTextContent("building")
+			require.NoError(t, call.SetContent(*api.NewToolCallContentContent(&block)))
+
+			result, err = turn.RunCommand("sh", RunCommandOptions{Args: []string{"-c", "exit 4"}, ToolCall: call})
+			require.NoError(t, err)
+			status, content, open = call.Status(), call.Content(), len(turn.OpenToolCalls())
+			completeErr = call.Complete()
+			return api.StopReasonEndTurn, nil
+		}, clientHandler)
+
+		events := streamEvents(ctx, clientConn, "s1")
+		require.NotNil(t, result)
+		assert.False(t, result.Success())
+		assert.Equal(t, api.ToolCallStatusFailed, status)
+		assert.Zero(t, open)
+		require.ErrorIs(t, completeErr, ErrToolCallClosed)
+
+		// The terminal is appended to the content the tool call already had.
+		require.Len(t, content, 2)
+		terminal, ok := content[1].(*api.ToolCallContent)
+		require.True(t, ok)
+		require.NotNil(t, terminal.Terminal)
+		assert.Equal(t, result.TerminalID, terminal.Terminal.Terminalid)
+
+		var updates []*api.SessionUpdate
+		for _, event := range events {
+			if event.Update != nil && event.Update.ToolCallUpdate != nil {
+				updates = append(updates, event.Update)
+			}
+		}
+		require.Len(t, updates, 3)
+		assert.Len(t, updates[1].ToolCallUpdate.Content, 2)
+		assert.Equal(t, string(api.ToolCallStatusFailed), updates[2].ToolCallUpdate.Status)
+	})
+
+	t.Run("TruncatedOutput", func(t *testing.T) {
+		agentConn, _, _ := newRunCommandPair(t)
+
+		result, err := agentConn.RunCommand(ctx, "s1", "sh", RunCommandOptions{
+			Args:            []string{"-c", "echo 0123456789; echo tail"},
+			OutputByteLimit: 8,
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Success())
+		assert.True(t, result.Truncated)
+		assert.Equal(t, "89\ntail\n", result.Output)
+	})
+
+	t.Run("KillsOnTimeout", func(t *testing.T) {
+		agentConn, host, recorder := newRunCommandPair(t)
+
+		start := time.Now()
+		result, err := agentConn.RunCommand(ctx, "s1", "sh", RunCommandOptions{
+			Args:    []string{"-c", "echo started; sleep 30"},
+			Timeout: 200 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), 10*time.Second)
+		assert.True(t, result.TimedOut)
+		assert.False(t, result.Success())
+		require.NotNil(t, result.ExitStatus.Signal)
+		assert.Equal(t, "SIGKILL", *result.ExitStatus.Signal)
+		assert.Equal(t, "started\n", result.Output)
+		assert.Equal(t, 0, host.Count())
+
+		updates := recorder.waitFor(t, 2)
+		assert.Equal(t, string(api.ToolCallStatusFailed), updates[1].ToolCallUpdate.Status)
+	})
+
+	t.Run("ReleasesOnCancel", func(t *testing.T) {
+		agentConn, host, recorder := newRunCommandPair(t)
+
+		runCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		_, err := agentConn.RunCommand(runCtx, "s1", "sleep", RunCommandOptions{Args: []string{"30"}})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 0, host.Count())
+
+		updates := recorder.waitFor(t, 2)
+		assert.Equal(t, string(api.ToolCallStatusFailed), updates[1].ToolCallUpdate.Status)
+	})
+
+	t.Run("CreateFails", func(t *testing.T) {
+		agentConn, _, _ := newRunCommandPair(t)
+
+		_, err := agentConn.RunCommand(ctx, "s1", "/nonexistent/cmd", RunCommandOptions{})
+		AssertACPError(t, err, api.ErrorCodeInternalServerError)
+	})
+}
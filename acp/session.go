@@ -1,6 +1,8 @@
 package acp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -42,6 +44,43 @@ func (s SessionStatus) String() string {
 	}
 }
 
+// MarshalText implements encoding.TextMarshaler so statuses persist by name.
+func (s SessionStatus) MarshalText() ([]byte, error) {
+	name := s.String()
+	if name == "unknown" {
+		return nil, fmt.Errorf("invalid session status: %d", int(s))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *SessionStatus) UnmarshalText(text []byte) error {
+	status, err := ParseSessionStatus(string(text))
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// ParseSessionStatus parses the string representation of a session status.
+func ParseSessionStatus(name string) (SessionStatus, error) {
+	switch name {
+	case "active":
+		return SessionStatusActive, nil
+	case "pending":
+		return SessionStatusPending, nil
+	case "cancelled":
+		return SessionStatusCancelled, nil
+	case "completed":
+		return SessionStatusCompleted, nil
+	case "error":
+		return SessionStatusError, nil
+	default:
+		return 0, fmt.Errorf("invalid session status: %q", name)
+	}
+}
+
 // SessionState represents the state of a single session.
 type SessionState struct {
 	ID         api.SessionId
@@ -49,21 +88,63 @@ type SessionState struct {
 	LastActive *util.AtomicValue[time.Time]
 	Status     *util.AtomicValue[SessionStatus]
 	Metadata   *util.SyncMap[string, interface{}]
+
+	turnCancel  *util.AtomicValue[context.CancelFunc]
+	promptTurns *util.AtomicValue[PromptTurnState]
 }
 
 // NewSessionState creates a new session state.
 func NewSessionState(id api.SessionId) *SessionState {
 	now := time.Now()
 	ss := &SessionState{
-		ID:         id,
-		CreatedAt:  now,
-		LastActive: util.NewAtomicValue(now),
-		Status:     util.NewAtomicValue(SessionStatusPending),
-		Metadata:   util.NewSyncMap[string, interface{}](),
+		ID:          id,
+		CreatedAt:   now,
+		LastActive:  util.NewAtomicValue(now),
+		Status:      util.NewAtomicValue(SessionStatusPending),
+		Metadata:    util.NewSyncMap[string, interface{}](),
+		turnCancel:  util.NewAtomicValue[context.CancelFunc](nil),
+		promptTurns: util.NewAtomicValue(PromptTurnState{}),
+	}
+	return ss
+}
+
+// newSessionStateFromRecord restores a session state from a persisted record.
+//
+// A record saved while a prompt turn was running is restored as cancelled,
+// since no turn survives the process that ran it.
+func newSessionStateFromRecord(record *SessionRecord) *SessionState {
+	status := record.Status
+	if status == SessionStatusActive {
+		status = SessionStatusCancelled
+	}
+	ss := &SessionState{
+		ID:          record.ID,
+		CreatedAt:   record.CreatedAt,
+		LastActive:  util.NewAtomicValue(record.LastActive),
+		Status:      util.NewAtomicValue(status),
+		Metadata:    util.NewSyncMap[string, interface{}](),
+		turnCancel:  util.NewAtomicValue[context.CancelFunc](nil),
+		promptTurns: util.NewAtomicValue(PromptTurnState{}),
 	}
+	ss.Metadata.Replace(record.Metadata)
 	return ss
 }
 
+// Record returns a snapshot of the session suitable for persistence.
+func (ss *SessionState) Record() *SessionRecord {
+	metadata := ss.Metadata.GetAll()
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	return &SessionRecord{
+		ID:         ss.ID,
+		CreatedAt:  ss.CreatedAt,
+		LastActive: ss.LastActive.Load(),
+		Status:     ss.Status.Load(),
+		Metadata:   metadata,
+	}
+}
+
 // UpdateActivity updates the last active timestamp.
 func (ss *SessionState) UpdateActivity() {
 	ss.LastActive.Store(time.Now())
@@ -90,6 +171,34 @@ func (ss *SessionState) GetMetadata(key string) (interface{}, bool) {
 	return ss.Metadata.Load(key)
 }
 
+// SetTurnCancel records the cancel function for the session's running prompt turn.
+// Pass nil when the turn ends.
+func (ss *SessionState) SetTurnCancel(cancel context.CancelFunc) {
+	ss.turnCancel.Store(cancel)
+}
+
+// CancelTurn cancels the session's running prompt turn, if any.
+// It returns true if a turn was cancelled.
+func (ss *SessionState) CancelTurn() bool {
+	cancel := ss.turnCancel.Swap(nil)
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	return true
+}
+
+// turnRunning reports whether the session is in a prompt turn.
+func (ss *SessionState) turnRunning() bool {
+	return ss.IsActive() || ss.turnCancel.Load() != nil
+}
+
+// PromptTurns returns the session's prompt turn state as last reported by a
+// connection bound with BindSessionManager.
+func (ss *SessionState) PromptTurns() PromptTurnState {
+	return ss.promptTurns.Load()
+}
+
 // IsActive returns true if the session is currently active.
 func (ss *SessionState) IsActive() bool {
 	return ss.Status.Load() == SessionStatusActive
@@ -100,30 +209,130 @@ func (ss *SessionState) Duration() time.Duration {
 	return time.Since(ss.CreatedAt)
 }
 
+// SessionDeleteReason describes why a session was removed from a SessionManager.
+type SessionDeleteReason int
+
+const (
+	// SessionDeleteReasonExplicit indicates the session was removed with DeleteSession.
+	SessionDeleteReasonExplicit SessionDeleteReason = iota
+	// SessionDeleteReasonIdle indicates the session was removed after being inactive.
+	SessionDeleteReasonIdle
+	// SessionDeleteReasonDisconnected indicates the connection owning the session closed.
+	SessionDeleteReasonDisconnected
+)
+
+// String returns the string representation of the delete reason.
+func (r SessionDeleteReason) String() string {
+	switch r {
+	case SessionDeleteReasonExplicit:
+		return "explicit"
+	case SessionDeleteReasonIdle:
+		return "idle"
+	case SessionDeleteReasonDisconnected:
+		return "disconnected"
+	default:
+		return "unknown"
+	}
+}
+
 // sessionCallbacks holds all session callback functions.
 type sessionCallbacks struct {
-	onCreate func(*SessionState)
-	onUpdate func(*SessionState)
-	onDelete func(*SessionState)
+	onCreate           func(*SessionState)
+	onUpdate           func(*SessionState)
+	onDelete           func(*SessionState)
+	onDeleteWithReason func(*SessionState, SessionDeleteReason)
 }
 
 // SessionManager manages multiple sessions.
+//
+// A SessionManager created with NewSessionManagerWithStore writes every
+// create, update and delete through to its SessionStore.
 type SessionManager struct {
 	sessions  *util.SyncMap[api.SessionId, *SessionState]
 	callbacks *util.AtomicValue[*sessionCallbacks]
+	store     SessionStore
+	clock     Clock
+
+	// Internal delete hooks, which unlike the callbacks do not replace each other
+	deleteHooks *util.CallbackRegistry[func(*SessionState, SessionDeleteReason)]
 }
 
-// NewSessionManager creates a new session manager.
+// NewSessionManager creates a new session manager that keeps sessions in memory only.
 func NewSessionManager() *SessionManager {
 	return &SessionManager{
-		sessions:  util.NewSyncMap[api.SessionId, *SessionState](),
-		callbacks: util.NewAtomicValue(&sessionCallbacks{}),
+		sessions:    util.NewSyncMap[api.SessionId, *SessionState](),
+		callbacks:   util.NewAtomicValue(&sessionCallbacks{}),
+		clock:       systemClock{},
+		deleteHooks: util.NewCallbackRegistry[func(*SessionState, SessionDeleteReason)](),
+	}
+}
+
+// NewSessionManagerWithStore creates a session manager backed by a persistent store.
+//
+// All sessions already present in the store are loaded before returning.
+func NewSessionManagerWithStore(store SessionStore) (*SessionManager, error) {
+	if store == nil {
+		return nil, errors.New("session store cannot be nil")
 	}
+
+	records, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sessions: %w", err)
+	}
+
+	sm := NewSessionManager()
+	sm.store = store
+	for _, record := range records {
+		sm.sessions.Store(record.ID, newSessionStateFromRecord(record))
+	}
+
+	return sm, nil
+}
+
+// WithClock sets the clock used to stamp session creation and activity times
+// and to measure idle time. It should be called before the manager is used.
+func (sm *SessionManager) WithClock(clock Clock) *SessionManager {
+	sm.clock = clock
+	return sm
+}
+
+// touch records activity on a session at the manager's current time.
+func (sm *SessionManager) touch(session *SessionState) {
+	session.LastActive.Store(sm.clock.Now())
+}
+
+// Store returns the persistent store backing this manager, or nil.
+func (sm *SessionManager) Store() SessionStore {
+	return sm.store
+}
+
+// persist writes the session through to the store, if one is configured.
+func (sm *SessionManager) persist(session *SessionState) error {
+	if sm.store == nil {
+		return nil
+	}
+	if err := sm.store.Save(session.Record()); err != nil {
+		return fmt.Errorf("failed to persist session %v: %w", session.ID, err)
+	}
+	return nil
+}
+
+// unpersist removes the session from the store, if one is configured.
+func (sm *SessionManager) unpersist(id api.SessionId) error {
+	if sm.store == nil {
+		return nil
+	}
+	if err := sm.store.Delete(id); err != nil {
+		return fmt.Errorf("failed to remove persisted session %v: %w", id, err)
+	}
+	return nil
 }
 
 // CreateSession creates a new session with the given ID.
 func (sm *SessionManager) CreateSession(id api.SessionId) (*SessionState, error) {
 	session := NewSessionState(id)
+	session.CreatedAt = sm.clock.Now()
+	session.LastActive.Store(session.CreatedAt)
 
 	// Try to add the session, will return the existing one if already present
 	actual, loaded := sm.sessions.LoadOrStore(id, session)
@@ -131,6 +340,11 @@ func (sm *SessionManager) CreateSession(id api.SessionId) (*SessionState, error)
 		return nil, fmt.Errorf("session %v already exists", id)
 	}
 
+	if err := sm.persist(session); err != nil {
+		sm.sessions.CompareAndDelete(id, session)
+		return nil, err
+	}
+
 	callbacks := sm.callbacks.Load()
 	if callbacks.onCreate != nil {
 		go callbacks.onCreate(actual)
@@ -151,7 +365,44 @@ func (sm *SessionManager) UpdateSession(id api.SessionId, status SessionStatus)
 		return fmt.Errorf("session %v not found", id)
 	}
 
-	session.SetStatus(status)
+	session.Status.Store(status)
+	sm.touch(session)
+
+	return sm.saveAndNotify(session)
+}
+
+// SetSessionMetadata sets a metadata value on a session and persists the change.
+//
+// Values must be JSON-serializable when the manager has a store.
+func (sm *SessionManager) SetSessionMetadata(id api.SessionId, key string, value interface{}) error {
+	session, exists := sm.sessions.Load(id)
+	if !exists {
+		return fmt.Errorf("session %v not found", id)
+	}
+
+	session.SetMetadata(key, value)
+
+	return sm.saveAndNotify(session)
+}
+
+// SaveSession persists the current state of a session.
+//
+// Use this after modifying a SessionState directly, for example through
+// SessionState.SetMetadata.
+func (sm *SessionManager) SaveSession(id api.SessionId) error {
+	session, exists := sm.sessions.Load(id)
+	if !exists {
+		return fmt.Errorf("session %v not found", id)
+	}
+
+	return sm.saveAndNotify(session)
+}
+
+// saveAndNotify persists a session and fires the update callback.
+func (sm *SessionManager) saveAndNotify(session *SessionState) error {
+	if err := sm.persist(session); err != nil {
+		return err
+	}
 
 	callbacks := sm.callbacks.Load()
 	if callbacks.onUpdate != nil {
@@ -168,12 +419,65 @@ func (sm *SessionManager) DeleteSession(id api.SessionId) error {
 		return fmt.Errorf("session %v not found", id)
 	}
 
-	callbacks := sm.callbacks.Load()
-	if callbacks.onDelete != nil {
-		go callbacks.onDelete(session)
+	err := sm.unpersist(id)
+	sm.notifyDelete(session, SessionDeleteReasonExplicit)
+
+	return err
+}
+
+// attachSession returns the session with the given ID, restoring it from the
+// store or creating it if the manager does not currently hold it.
+func (sm *SessionManager) attachSession(id api.SessionId) (*SessionState, error) {
+	session, err := sm.knownSession(id)
+	if err == nil || !errors.Is(err, ErrSessionNotFound) {
+		return session, err
 	}
 
-	return nil
+	session, err = sm.CreateSession(id)
+	if err != nil {
+		// Lost a race with another creator; use the winner.
+		if existing, exists := sm.sessions.Load(id); exists {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// knownSession returns the session with the given ID, restoring it from the
+// store if the manager does not currently hold it. It returns an error
+// wrapping ErrSessionNotFound if neither has the session.
+func (sm *SessionManager) knownSession(id api.SessionId) (*SessionState, error) {
+	if session, exists := sm.sessions.Load(id); exists {
+		return session, nil
+	}
+	if sm.store == nil {
+		return nil, fmt.Errorf("session %v: %w", id, ErrSessionNotFound)
+	}
+
+	record, err := sm.store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	session, loaded := sm.sessions.LoadOrStore(id, newSessionStateFromRecord(record))
+	if !loaded {
+		callbacks := sm.callbacks.Load()
+		if callbacks.onCreate != nil {
+			go callbacks.onCreate(session)
+		}
+	}
+	return session, nil
+}
+
+// detachSession removes a session from the manager without deleting its
+// persisted record, so it can be restored later with session/load.
+func (sm *SessionManager) detachSession(id api.SessionId) {
+	session, exists := sm.sessions.LoadAndDelete(id)
+	if !exists {
+		return
+	}
+
+	sm.notifyDelete(session, SessionDeleteReasonDisconnected)
 }
 
 // ListSessions returns all sessions.
@@ -230,66 +534,122 @@ func (sm *SessionManager) CountByStatus(status SessionStatus) int {
 // OnSessionCreate sets the callback for session creation.
 func (sm *SessionManager) OnSessionCreate(callback func(*SessionState)) {
 	sm.callbacks.Update(func(old *sessionCallbacks) *sessionCallbacks {
-		return &sessionCallbacks{
-			onCreate: callback,
-			onUpdate: old.onUpdate,
-			onDelete: old.onDelete,
-		}
+		updated := *old
+		updated.onCreate = callback
+		return &updated
 	})
 }
 
 // OnSessionUpdate sets the callback for session updates.
 func (sm *SessionManager) OnSessionUpdate(callback func(*SessionState)) {
 	sm.callbacks.Update(func(old *sessionCallbacks) *sessionCallbacks {
-		return &sessionCallbacks{
-			onCreate: old.onCreate,
-			onUpdate: callback,
-			onDelete: old.onDelete,
-		}
+		updated := *old
+		updated.onUpdate = callback
+		return &updated
 	})
 }
 
 // OnSessionDelete sets the callback for session deletion.
 func (sm *SessionManager) OnSessionDelete(callback func(*SessionState)) {
 	sm.callbacks.Update(func(old *sessionCallbacks) *sessionCallbacks {
-		return &sessionCallbacks{
-			onCreate: old.onCreate,
-			onUpdate: old.onUpdate,
-			onDelete: callback,
-		}
+		updated := *old
+		updated.onDelete = callback
+		return &updated
 	})
 }
 
+// OnSessionDeleteWithReason sets a callback for session deletion that also
+// receives the reason the session was removed.
+//
+// It fires alongside the OnSessionDelete callback.
+func (sm *SessionManager) OnSessionDeleteWithReason(callback func(*SessionState, SessionDeleteReason)) {
+	sm.callbacks.Update(func(old *sessionCallbacks) *sessionCallbacks {
+		updated := *old
+		updated.onDeleteWithReason = callback
+		return &updated
+	})
+}
+
+// notifyDelete fires the delete callbacks for a removed session.
+func (sm *SessionManager) notifyDelete(session *SessionState, reason SessionDeleteReason) {
+	callbacks := sm.callbacks.Load()
+	if callbacks.onDelete != nil {
+		go callbacks.onDelete(session)
+	}
+	if callbacks.onDeleteWithReason != nil {
+		go callbacks.onDeleteWithReason(session, reason)
+	}
+	for _, hook := range sm.deleteHooks.GetAll() {
+		go hook(session, reason)
+	}
+}
+
+// onDelete registers an internal hook that runs whenever a session is removed.
+func (sm *SessionManager) onDelete(hook func(*SessionState, SessionDeleteReason)) {
+	sm.deleteHooks.Register(hook)
+}
+
 // CleanupInactiveSessions removes sessions that have been inactive for the specified duration.
+//
+// Sessions with a running prompt turn are kept. Errors deleting the persisted
+// records of removed sessions are not reported; use RemoveInactiveSessions to
+// receive them.
 func (sm *SessionManager) CleanupInactiveSessions(inactiveDuration time.Duration) int {
-	now := time.Now()
-	cleaned := 0
+	removed, _ := sm.RemoveInactiveSessions(inactiveDuration)
+	return len(removed)
+}
 
-	// Get all sessions and identify inactive ones
-	sessionMap := sm.sessions.GetAll()
-	var toDelete []api.SessionId
-	var deletedSessions []*SessionState
+// RemoveInactiveSessions removes sessions that have been inactive for the
+// specified duration, like CleanupInactiveSessions, and returns their IDs.
+//
+// Sessions are removed even if deleting their persisted record fails; those
+// errors are joined in the returned error.
+func (sm *SessionManager) RemoveInactiveSessions(inactiveDuration time.Duration) ([]api.SessionId, error) {
+	return sm.removeIdle(sm.clock.Now(), inactiveDuration, 0, nil)
+}
 
-	for id, session := range sessionMap {
-		if now.Sub(session.LastActive.Load()) > inactiveDuration {
-			toDelete = append(toDelete, id)
-			deletedSessions = append(deletedSessions, session)
+// removeIdle removes the sessions that have been idle for longer than ttl at
+// now and fires the delete callbacks with SessionDeleteReasonIdle. Sessions
+// with a running prompt turn are only removed once they have been idle for
+// longer than a positive hardTTL.
+//
+// release, if not nil, frees the resources of each removed session before its
+// persisted record is deleted. Errors from release and from the store are
+// joined in the returned error.
+func (sm *SessionManager) removeIdle(
+	now time.Time,
+	ttl, hardTTL time.Duration,
+	release func(*SessionState) error,
+) ([]api.SessionId, error) {
+	var removed []api.SessionId
+	var errs []error
+	for _, session := range sm.ListSessions() {
+		limit := ttl
+		if session.turnRunning() {
+			if hardTTL <= 0 {
+				continue
+			}
+			limit = hardTTL
+		}
+		if now.Sub(session.LastActive.Load()) <= limit {
+			continue
+		}
+		// Skip sessions that were removed or replaced since the listing.
+		if !sm.sessions.CompareAndDelete(session.ID, session) {
+			continue
 		}
-	}
-
-	// Delete inactive sessions
-	for _, id := range toDelete {
-		sm.sessions.Delete(id)
-		cleaned++
-	}
 
-	// Call callbacks for deleted sessions
-	callbacks := sm.callbacks.Load()
-	if callbacks.onDelete != nil {
-		for _, session := range deletedSessions {
-			go callbacks.onDelete(session)
+		if release != nil {
+			if err := release(session); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := sm.unpersist(session.ID); err != nil {
+			errs = append(errs, err)
 		}
+		sm.notifyDelete(session, SessionDeleteReasonIdle)
+		removed = append(removed, session.ID)
 	}
 
-	return cleaned
+	return removed, errors.Join(errs...)
 }
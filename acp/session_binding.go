@@ -0,0 +1,203 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// sessionBinding keeps a SessionManager in sync with the requests handled on
+// a single connection.
+type sessionBinding struct {
+	conn    *AgentConnection
+	manager *SessionManager
+	owned   *util.SyncMap[api.SessionId, struct{}]
+}
+
+// BindSessionManager connects a SessionManager to this connection's lifecycle.
+//
+// Once bound, sessions returned by session/new and loaded by session/load are
+// added to the manager. Each session/prompt for a session the manager holds
+// or has persisted marks it Active, then Completed or Cancelled based on the
+// StopReason, or Error if the handler fails; prompts for other sessions are
+// not tracked. While a turn runs, SessionState.CancelTurn cancels the handler's
+// context, and SessionState.PromptTurns reports the running and queued
+// prompts. When the connection closes, the connection's sessions are removed
+// from the manager and OnSessionDelete fires for each of them. Persisted
+// records are kept so the sessions can be loaded again later. The "always"
+// answers AskPermission remembered for a session are dropped whenever the
+// session is removed from the manager.
+//
+// BindSessionManager should be called before the connection starts serving
+// requests.
+func (a *AgentConnection) BindSessionManager(manager *SessionManager) {
+	binding := &sessionBinding{
+		conn:    a,
+		manager: manager,
+		owned:   util.NewSyncMap[api.SessionId, struct{}](),
+	}
+	a.core.intercept(binding.intercept)
+	a.core.onClose(binding.detachAll)
+	a.OnPromptTurnChange(binding.promptTurnChanged)
+	manager.onDelete(func(session *SessionState, _ SessionDeleteReason) {
+		a.ForgetPermissions(session.ID)
+	})
+}
+
+// intercept observes session lifecycle requests as they are dispatched.
+func (sb *sessionBinding) intercept(
+	ctx context.Context,
+	req *jsonrpc2.Request,
+	next dispatchFunc,
+) (interface{}, error) {
+	switch req.Method {
+	case api.MethodSessionNew:
+		return sb.handleNew(ctx, req, next)
+	case api.MethodSessionLoad:
+		return sb.handleLoad(ctx, req, next)
+	case api.MethodSessionPrompt:
+		return sb.handlePrompt(ctx, req, next)
+	default:
+		return next(ctx, req)
+	}
+}
+
+// handleNew registers the session created by a successful session/new.
+func (sb *sessionBinding) handleNew(
+	ctx context.Context,
+	req *jsonrpc2.Request,
+	next dispatchFunc,
+) (interface{}, error) {
+	result, err := next(ctx, req)
+	if err != nil {
+		return result, err
+	}
+
+	var response api.NewSessionResponse
+	if decodeErr := remarshal(result, &response); decodeErr != nil || response.SessionId == "" {
+		return result, nil
+	}
+
+	sb.attach(response.SessionId)
+	return result, nil
+}
+
+// handleLoad registers the session restored by a successful session/load.
+func (sb *sessionBinding) handleLoad(
+	ctx context.Context,
+	req *jsonrpc2.Request,
+	next dispatchFunc,
+) (interface{}, error) {
+	result, err := next(ctx, req)
+	if err != nil {
+		return result, err
+	}
+
+	var params api.LoadSessionRequest
+	if decodeErr := json.Unmarshal(req.Params, &params); decodeErr != nil || params.SessionId == "" {
+		return result, nil
+	}
+
+	if session := sb.attach(params.SessionId); session != nil {
+		sb.manager.touch(session)
+	}
+	return result, nil
+}
+
+// handlePrompt tracks the session status across a prompt turn.
+func (sb *sessionBinding) handlePrompt(
+	ctx context.Context,
+	req *jsonrpc2.Request,
+	next dispatchFunc,
+) (interface{}, error) {
+	var params api.PromptRequest
+	if decodeErr := json.Unmarshal(req.Params, &params); decodeErr != nil || params.SessionId == "" {
+		return next(ctx, req)
+	}
+
+	// Only sessions created, loaded or persisted before are tracked; prompts
+	// for unknown sessions are left to the handler to reject.
+	session, err := sb.manager.knownSession(params.SessionId)
+	if err != nil {
+		return next(ctx, req)
+	}
+	sb.owned.Store(params.SessionId, struct{}{})
+	// The turn state may have changed before the session was attached.
+	session.promptTurns.Store(sb.conn.turns.state(params.SessionId))
+	_ = sb.manager.UpdateSession(params.SessionId, SessionStatusActive)
+
+	// Expose the turn's cancel function so the turn can be stopped from outside
+	// the handler, for example by a SessionReaper.
+	turnCtx, cancel := context.WithCancel(ctx)
+	session.SetTurnCancel(cancel)
+	defer func() {
+		session.SetTurnCancel(nil)
+		cancel()
+	}()
+
+	result, err := next(turnCtx, req)
+	_ = sb.manager.UpdateSession(params.SessionId, promptOutcomeStatus(result, err))
+	return result, err
+}
+
+// promptTurnChanged mirrors the connection's prompt turn state onto the session.
+//
+// The tracker is re-read rather than trusting the reported state, so that
+// concurrent notifications converge on the latest state.
+func (sb *sessionBinding) promptTurnChanged(id api.SessionId, _ PromptTurnState) {
+	if session, exists := sb.manager.GetSession(id); exists {
+		session.promptTurns.Store(sb.conn.turns.state(id))
+	}
+}
+
+// attach adds a session to the manager and records that this connection owns it.
+func (sb *sessionBinding) attach(id api.SessionId) *SessionState {
+	session, err := sb.manager.attachSession(id)
+	if err != nil {
+		return nil
+	}
+	sb.owned.Store(id, struct{}{})
+	return session
+}
+
+// detachAll removes this connection's sessions from the manager.
+func (sb *sessionBinding) detachAll() {
+	for id := range sb.owned.GetAll() {
+		sb.owned.Delete(id)
+		sb.manager.detachSession(id)
+	}
+}
+
+// promptOutcomeStatus maps the outcome of a session/prompt handler to a session status.
+func promptOutcomeStatus(result interface{}, err error) SessionStatus {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return SessionStatusCancelled
+		}
+		return SessionStatusError
+	}
+
+	var response struct {
+		StopReason api.StopReason `json:"stopReason"`
+	}
+	if decodeErr := remarshal(result, &response); decodeErr != nil {
+		return SessionStatusError
+	}
+	if response.StopReason == api.StopReasonCancelled {
+		return SessionStatusCancelled
+	}
+	return SessionStatusCompleted
+}
+
+// remarshal converts an arbitrary handler result into target via JSON.
+func remarshal(value interface{}, target interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
@@ -0,0 +1,253 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBoundAgent creates a correctly-roled connection pair whose agent side has
+// the test agent's handlers and a bound SessionManager.
+func newBoundAgent(
+	t *testing.T,
+	testAgent *TestAgent,
+	manager *SessionManager,
+) (*AgentConnection, *ClientConnection) {
+	t.Helper()
+
+	handler := NewAgentHandlerRegistry()
+	handler.RegisterSessionNewHandler(testAgent.HandleSessionNew)
+	handler.RegisterSessionLoadHandler(testAgent.HandleSessionLoad)
+	handler.RegisterSessionPromptHandler(testAgent.HandleSessionPrompt)
+
+	agentConn, clientConn := NewRolePair(t, handler, NewClientHandlerRegistry())
+	agentConn.BindSessionManager(manager)
+	return agentConn, clientConn
+}
+
+func TestBindSessionManager(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("SessionNewAndPrompt", func(t *testing.T) {
+		manager := NewSessionManager()
+		_, clientConn := newBoundAgent(t, NewTestAgent(), manager)
+
+		resp, err := clientConn.SessionNew(ctx, SampleNewSessionRequest())
+		require.NoError(t, err)
+
+		session, exists := manager.GetSession(resp.SessionId)
+		require.True(t, exists)
+		assert.Equal(t, SessionStatusPending, session.GetStatus())
+		before := session.LastActive.Load()
+
+		_, err = clientConn.SessionPrompt(ctx, SamplePromptRequest(string(resp.SessionId)))
+		require.NoError(t, err)
+
+		assert.Equal(t, SessionStatusCompleted, session.GetStatus())
+		assert.False(t, session.LastActive.Load().Before(before))
+	})
+
+	t.Run("PromptActiveDuringTurn", func(t *testing.T) {
+		manager := NewSessionManager()
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		handler := NewAgentHandlerRegistry()
+		handler.RegisterSessionPromptHandler(
+			func(_ context.Context, _ *api.PromptRequest) (*api.PromptResponse, error) {
+				close(started)
+				<-release
+				return &api.PromptResponse{StopReason: api.StopReasonCancelled}, nil
+			},
+		)
+		agentConn, clientConn := NewRolePair(t, handler, NewClientHandlerRegistry())
+		agentConn.BindSessionManager(manager)
+		_, err := manager.CreateSession("session-x")
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, promptErr := clientConn.SessionPrompt(ctx, SamplePromptRequest("session-x"))
+			assert.NoError(t, promptErr)
+		}()
+
+		<-started
+		session, exists := manager.GetSession("session-x")
+		require.True(t, exists)
+		assert.Equal(t, SessionStatusActive, session.GetStatus())
+
+		close(release)
+		wg.Wait()
+		assert.Equal(t, SessionStatusCancelled, session.GetStatus())
+	})
+
+	t.Run("CancelTurn", func(t *testing.T) {
+		manager := NewSessionManager()
+		started := make(chan struct{})
+
+		handler := NewAgentHandlerRegistry()
+		handler.RegisterSessionPromptHandler(
+			func(ctx context.Context, _ *api.PromptRequest) (*api.PromptResponse, error) {
+				close(started)
+				<-ctx.Done()
+				return &api.PromptResponse{StopReason: api.StopReasonCancelled}, nil
+			},
+		)
+		agentConn, clientConn := NewRolePair(t, handler, NewClientHandlerRegistry())
+		agentConn.BindSessionManager(manager)
+		_, err := manager.CreateSession("session-x")
+		require.NoError(t, err)
+
+		done := make(chan error, 1)
+		go func() {
+			_, promptErr := clientConn.SessionPrompt(ctx, SamplePromptRequest("session-x"))
+			done <- promptErr
+		}()
+
+		<-started
+		session, _ := manager.GetSession("session-x")
+		assert.True(t, session.CancelTurn())
+
+		require.NoError(t, <-done)
+		assert.Equal(t, SessionStatusCancelled, session.GetStatus())
+		assert.False(t, session.CancelTurn())
+	})
+
+	t.Run("PromptForUnknownSessionIsNotTracked", func(t *testing.T) {
+		manager := NewSessionManager()
+		_, clientConn := newBoundAgent(t, NewTestAgent(), manager)
+
+		_, err := clientConn.SessionPrompt(ctx, SamplePromptRequest("unknown"))
+		require.NoError(t, err)
+		_, exists := manager.GetSession("unknown")
+		assert.False(t, exists)
+		assert.Zero(t, manager.Count())
+	})
+
+	t.Run("PromptError", func(t *testing.T) {
+		manager := NewSessionManager()
+		testAgent := NewTestAgent()
+		_, clientConn := newBoundAgent(t, testAgent, manager)
+
+		resp, err := clientConn.SessionNew(ctx, SampleNewSessionRequest())
+		require.NoError(t, err)
+
+		testAgent.SetShouldError("session/prompt", true)
+		_, err = clientConn.SessionPrompt(ctx, SamplePromptRequest(string(resp.SessionId)))
+		require.Error(t, err)
+
+		session, _ := manager.GetSession(resp.SessionId)
+		assert.Equal(t, SessionStatusError, session.GetStatus())
+	})
+
+	t.Run("FailedSessionNewIsIgnored", func(t *testing.T) {
+		manager := NewSessionManager()
+		testAgent := NewTestAgent()
+		testAgent.SetShouldError("session/new", true)
+		_, clientConn := newBoundAgent(t, testAgent, manager)
+
+		_, err := clientConn.SessionNew(ctx, SampleNewSessionRequest())
+		require.Error(t, err)
+		assert.Equal(t, 0, manager.Count())
+	})
+
+	t.Run("SessionLoadRestoresFromStore", func(t *testing.T) {
+		store := NewMemorySessionStore()
+		manager, err := NewSessionManagerWithStore(store)
+		require.NoError(t, err)
+
+		testAgent := NewTestAgent()
+		agentConn, clientConn := newBoundAgent(t, testAgent, manager)
+
+		resp, err := clientConn.SessionNew(ctx, SampleNewSessionRequest())
+		require.NoError(t, err)
+		require.NoError(t, manager.SetSessionMetadata(resp.SessionId, "title", "Fix tests"))
+
+		require.NoError(t, agentConn.Close())
+		WaitWithTimeout(t, time.Second, func() bool { return manager.Count() == 0 }, "session detached on close")
+
+		// The record survives the connection, so a new connection can load it.
+		_, clientConn = newBoundAgent(t, testAgent, manager)
+		err = clientConn.core.Call(ctx, api.MethodSessionLoad, &api.LoadSessionRequest{
+			SessionId:  resp.SessionId,
+			Cwd:        "/test/project",
+			McpServers: []api.McpServer{},
+		}, nil)
+		require.NoError(t, err)
+
+		session, exists := manager.GetSession(resp.SessionId)
+		require.True(t, exists)
+		title, _ := session.GetMetadata("title")
+		assert.Equal(t, "Fix tests", title)
+	})
+
+	t.Run("CloseFiresOnSessionDelete", func(t *testing.T) {
+		manager := NewSessionManager()
+		deleted := make(chan api.SessionId, 2)
+		manager.OnSessionDelete(func(session *SessionState) {
+			deleted <- session.ID
+		})
+
+		// A session owned by another connection must survive.
+		_, err := manager.CreateSession("other")
+		require.NoError(t, err)
+
+		agentConn, clientConn := newBoundAgent(t, NewTestAgent(), manager)
+		resp, err := clientConn.SessionNew(ctx, SampleNewSessionRequest())
+		require.NoError(t, err)
+
+		require.NoError(t, agentConn.Close())
+
+		select {
+		case id := <-deleted:
+			assert.Equal(t, resp.SessionId, id)
+		case <-time.After(time.Second):
+			t.Fatal("OnSessionDelete was not called")
+		}
+
+		_, exists := manager.GetSession("other")
+		assert.True(t, exists)
+	})
+
+	t.Run("PeerDisconnectFiresOnSessionDelete", func(t *testing.T) {
+		manager := NewSessionManager()
+		_, clientConn := newBoundAgent(t, NewTestAgent(), manager)
+
+		_, err := clientConn.SessionNew(ctx, SampleNewSessionRequest())
+		require.NoError(t, err)
+		require.Equal(t, 1, manager.Count())
+
+		require.NoError(t, clientConn.Close())
+		WaitWithTimeout(t, time.Second, func() bool { return manager.Count() == 0 }, "session detached on disconnect")
+	})
+}
+
+func TestPromptOutcomeStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   interface{}
+		err      error
+		expected SessionStatus
+	}{
+		{"EndTurn", &api.PromptResponse{StopReason: api.StopReasonEndTurn}, nil, SessionStatusCompleted},
+		{"Refusal", &api.PromptResponse{StopReason: api.StopReasonRefusal}, nil, SessionStatusCompleted},
+		{"Cancelled", &api.PromptResponse{StopReason: api.StopReasonCancelled}, nil, SessionStatusCancelled},
+		{"ContextCancelled", nil, context.Canceled, SessionStatusCancelled},
+		{"HandlerError", nil, errors.New("boom"), SessionStatusError},
+		{"InvalidStopReason", map[string]string{"stopReason": "bogus"}, nil, SessionStatusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, promptOutcomeStatus(tt.result, tt.err))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+)
+
+const (
+	// defaultReapInterval is the interval used when a SessionReaper is created with a zero interval.
+	defaultReapInterval = time.Minute
+)
+
+// Clock abstracts the passage of time so scheduled work can be tested deterministically.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel that receives the current time after d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is a Clock backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SessionReaper periodically removes sessions that have been idle longer than a TTL.
+//
+// Sessions with a running prompt turn, that is sessions that are Active or
+// have a turn cancel function set, are not reaped by the TTL; their idle time
+// counts from the end of the turn. A turn that hangs is only cut short by a
+// hard TTL set with WithHardTTL.
+//
+// For every reaped session the reaper cancels its running prompt turn, if
+// any, releases the session's terminals, clears its
+// metadata, removes it from the manager and its store, and fires the delete
+// callbacks with SessionDeleteReasonIdle.
+type SessionReaper struct {
+	manager   *SessionManager
+	ttl       time.Duration
+	hardTTL   time.Duration
+	interval  time.Duration
+	clock     Clock
+	terminals *SessionTerminalManager
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSessionReaper creates a reaper that removes sessions idle for longer than ttl,
+// checking every interval.
+func NewSessionReaper(manager *SessionManager, ttl, interval time.Duration) *SessionReaper {
+	if interval <= 0 {
+		interval = defaultReapInterval
+	}
+	return &SessionReaper{
+		manager:  manager,
+		ttl:      ttl,
+		interval: interval,
+		clock:    manager.clock,
+	}
+}
+
+// WithClock sets the clock used to measure idle time and schedule reaping.
+// By default the reaper uses the manager's clock.
+func (r *SessionReaper) WithClock(clock Clock) *SessionReaper {
+	r.clock = clock
+	return r
+}
+
+// WithHardTTL sets how long a session with a running prompt turn may go
+// without activity before it is reaped anyway, cancelling its turn. For a
+// session bound with BindSessionManager, the turn's start is its last
+// activity. Zero, the default, never reaps sessions with a running turn.
+func (r *SessionReaper) WithHardTTL(ttl time.Duration) *SessionReaper {
+	r.hardTTL = ttl
+	return r
+}
+
+// WithTerminals sets the terminal manager whose terminals are released when a session is reaped.
+func (r *SessionReaper) WithTerminals(terminals *SessionTerminalManager) *SessionReaper {
+	r.terminals = terminals
+	return r
+}
+
+// Start begins reaping in the background. Calling Start on a running reaper has no effect.
+func (r *SessionReaper) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.run(ctx, r.done)
+}
+
+// Stop stops background reaping and waits for an in-progress pass to finish.
+func (r *SessionReaper) Stop() {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// run is the background reaping loop.
+func (r *SessionReaper) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.clock.After(r.interval):
+			_, _ = r.ReapNow(ctx)
+		}
+	}
+}
+
+// ReapNow reaps idle sessions immediately and returns the IDs of the removed sessions.
+//
+// Sessions are removed even if releasing their terminals or deleting their
+// persisted record fails; those errors are joined in the returned error.
+func (r *SessionReaper) ReapNow(ctx context.Context) ([]api.SessionId, error) {
+	return r.manager.removeIdle(r.clock.Now(), r.ttl, r.hardTTL, func(session *SessionState) error {
+		return r.release(ctx, session)
+	})
+}
+
+// release frees the resources held by a reaped session.
+func (r *SessionReaper) release(ctx context.Context, session *SessionState) error {
+	var errs []error
+
+	session.CancelTurn()
+
+	if r.terminals != nil {
+		if err := r.terminals.ReleaseSession(ctx, session.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release terminals for session %v: %w", session.ID, err))
+		}
+	}
+
+	session.Metadata.Clear()
+
+	return errors.Join(errs...)
+}
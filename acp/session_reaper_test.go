@@ -0,0 +1,340 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a manually advanced Clock.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeClockWaiter
+}
+
+type fakeClockWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeClockWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward and fires any timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(c.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		waiter.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns the number of timers that have not fired yet.
+func (c *fakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+func TestSessionReaper(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ReapNow", func(t *testing.T) {
+		clock := newFakeClock(time.Now())
+		manager := NewSessionManager().WithClock(clock)
+		reaper := NewSessionReaper(manager, time.Hour, time.Minute)
+
+		stale, err := manager.CreateSession("stale")
+		require.NoError(t, err)
+		stale.SetMetadata("key", "value")
+		_, err = manager.CreateSession("fresh")
+		require.NoError(t, err)
+
+		reaped, err := reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, reaped)
+
+		clock.Advance(2 * time.Hour)
+		require.NoError(t, manager.UpdateSession("fresh", SessionStatusCompleted))
+
+		reaped, err = reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []api.SessionId{"stale"}, reaped)
+		assert.Equal(t, 1, manager.Count())
+		assert.Equal(t, 0, stale.Metadata.Count())
+	})
+
+	t.Run("DeleteReason", func(t *testing.T) {
+		clock := newFakeClock(time.Now().Add(time.Hour))
+		manager := NewSessionManager()
+		reasons := make(chan SessionDeleteReason, 1)
+		deleted := make(chan api.SessionId, 1)
+		manager.OnSessionDeleteWithReason(func(_ *SessionState, reason SessionDeleteReason) {
+			reasons <- reason
+		})
+		manager.OnSessionDelete(func(session *SessionState) {
+			deleted <- session.ID
+		})
+
+		_, err := manager.CreateSession("stale")
+		require.NoError(t, err)
+
+		_, err = NewSessionReaper(manager, time.Minute, time.Minute).WithClock(clock).ReapNow(ctx)
+		require.NoError(t, err)
+
+		select {
+		case reason := <-reasons:
+			assert.Equal(t, SessionDeleteReasonIdle, reason)
+			assert.Equal(t, "idle", reason.String())
+		case <-time.After(time.Second):
+			t.Fatal("OnSessionDeleteWithReason was not called")
+		}
+		select {
+		case id := <-deleted:
+			assert.Equal(t, api.SessionId("stale"), id)
+		case <-time.After(time.Second):
+			t.Fatal("OnSessionDelete was not called")
+		}
+	})
+
+	t.Run("SkipsRunningTurn", func(t *testing.T) {
+		clock := newFakeClock(time.Now())
+		manager := NewSessionManager().WithClock(clock)
+		reaper := NewSessionReaper(manager, time.Minute, time.Minute)
+		session, err := manager.CreateSession("busy")
+		require.NoError(t, err)
+
+		turnCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		require.NoError(t, manager.UpdateSession("busy", SessionStatusActive))
+		session.SetTurnCancel(cancel)
+
+		// The turn outlives the TTL.
+		clock.Advance(time.Hour)
+		reaped, err := reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, reaped)
+		require.NoError(t, turnCtx.Err())
+
+		// A turn cancel alone also marks the turn as running.
+		session.Status.Store(SessionStatusPending)
+		reaped, err = reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, reaped)
+
+		// Once the turn ends, idle time counts from its end.
+		session.SetTurnCancel(nil)
+		require.NoError(t, manager.UpdateSession("busy", SessionStatusCompleted))
+		reaped, err = reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, reaped)
+
+		clock.Advance(2 * time.Minute)
+		reaped, err = reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []api.SessionId{"busy"}, reaped)
+	})
+
+	t.Run("CancelsTurnPastHardTTL", func(t *testing.T) {
+		clock := newFakeClock(time.Now())
+		manager := NewSessionManager().WithClock(clock)
+		reaper := NewSessionReaper(manager, time.Minute, time.Minute).WithHardTTL(time.Hour)
+		session, err := manager.CreateSession("hung")
+		require.NoError(t, err)
+
+		turnCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		require.NoError(t, manager.UpdateSession("hung", SessionStatusActive))
+		session.SetTurnCancel(cancel)
+
+		// The turn outlives the TTL but not the hard TTL.
+		clock.Advance(30 * time.Minute)
+		reaped, err := reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, reaped)
+		require.NoError(t, turnCtx.Err())
+
+		clock.Advance(time.Hour)
+		reaped, err = reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []api.SessionId{"hung"}, reaped)
+		require.ErrorIs(t, turnCtx.Err(), context.Canceled)
+		assert.Equal(t, 0, manager.Count())
+	})
+
+	t.Run("SkipsBoundPromptTurn", func(t *testing.T) {
+		clock := newFakeClock(time.Now())
+		manager := NewSessionManager().WithClock(clock)
+		reaper := NewSessionReaper(manager, time.Minute, time.Minute)
+
+		started := make(chan struct{})
+		finish := make(chan struct{})
+		agentHandler := NewAgentHandlerRegistry()
+		agentHandler.RegisterMethod(api.MethodSessionPrompt, func(ctx context.Context, _ json.RawMessage) (any, error) {
+			close(started)
+			select {
+			case <-finish:
+				return &api.PromptResponse{StopReason: api.StopReasonEndTurn}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		})
+		agentConn, clientConn := NewRolePair(t, agentHandler, NewClientHandlerRegistry())
+		agentConn.BindSessionManager(manager)
+		_, err := manager.CreateSession("busy")
+		require.NoError(t, err)
+
+		done := make(chan error, 1)
+		go func() {
+			_, promptErr := clientConn.SessionPrompt(ctx, &api.PromptRequest{SessionId: "busy"})
+			done <- promptErr
+		}()
+		<-started
+
+		// A turn streaming for longer than the TTL is not idle.
+		clock.Advance(time.Hour)
+		reaped, err := reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, reaped)
+
+		close(finish)
+		require.NoError(t, <-done)
+
+		// The end of the turn counts as activity.
+		reaped, err = reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, reaped)
+
+		clock.Advance(2 * time.Minute)
+		reaped, err = reaper.ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []api.SessionId{"busy"}, reaped)
+	})
+
+	t.Run("ReapsRestoredActiveSession", func(t *testing.T) {
+		clock := newFakeClock(time.Now().Add(time.Hour))
+		store := NewMemorySessionStore()
+		require.NoError(t, store.Save(&SessionRecord{
+			ID:         "crashed",
+			CreatedAt:  time.Now(),
+			LastActive: time.Now(),
+			Status:     SessionStatusActive,
+		}))
+		manager, err := NewSessionManagerWithStore(store)
+		require.NoError(t, err)
+
+		session, exists := manager.GetSession("crashed")
+		require.True(t, exists)
+		assert.Equal(t, SessionStatusCancelled, session.GetStatus())
+
+		reaped, err := NewSessionReaper(manager, time.Minute, time.Minute).WithClock(clock).ReapNow(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []api.SessionId{"crashed"}, reaped)
+	})
+
+	t.Run("RemovesPersistedRecord", func(t *testing.T) {
+		clock := newFakeClock(time.Now().Add(time.Hour))
+		store := NewMemorySessionStore()
+		manager, err := NewSessionManagerWithStore(store)
+		require.NoError(t, err)
+		_, err = manager.CreateSession("stale")
+		require.NoError(t, err)
+
+		_, err = NewSessionReaper(manager, time.Minute, time.Minute).WithClock(clock).ReapNow(ctx)
+		require.NoError(t, err)
+
+		_, err = store.Load("stale")
+		require.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	t.Run("ReleasesTerminals", func(t *testing.T) {
+		var released atomic.Int32
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterMethod(api.MethodTerminalCreate, func(_ context.Context, _ json.RawMessage) (any, error) {
+			return &api.CreateTerminalResponse{TerminalId: "term-1"}, nil
+		})
+		clientHandler.RegisterMethod(api.MethodTerminalRelease, func(_ context.Context, _ json.RawMessage) (any, error) {
+			released.Add(1)
+			return struct{}{}, nil
+		})
+		agentConn, _ := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+
+		terminals := NewSessionTerminalManager(agentConn)
+		_, err := terminals.GetManager("stale").CreateTerminal(ctx, &api.CreateTerminalRequest{
+			SessionId: "stale",
+			Command:   "sleep",
+		})
+		require.NoError(t, err)
+
+		clock := newFakeClock(time.Now().Add(time.Hour))
+		manager := NewSessionManager()
+		_, err = manager.CreateSession("stale")
+		require.NoError(t, err)
+
+		reaper := NewSessionReaper(manager, time.Minute, time.Minute).WithClock(clock).WithTerminals(terminals)
+		_, err = reaper.ReapNow(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(1), released.Load())
+		assert.Empty(t, terminals.ActiveSessions())
+	})
+
+	t.Run("StartStop", func(t *testing.T) {
+		clock := newFakeClock(time.Now())
+		manager := NewSessionManager()
+		_, err := manager.CreateSession("stale")
+		require.NoError(t, err)
+
+		reaper := NewSessionReaper(manager, time.Hour, 10*time.Minute).WithClock(clock)
+		reaper.Start()
+		reaper.Start() // no-op while running
+
+		// Not idle long enough yet.
+		WaitWithTimeout(t, time.Second, func() bool { return clock.Waiters() == 1 }, "reaper scheduled")
+		clock.Advance(10 * time.Minute)
+		WaitWithTimeout(t, time.Second, func() bool { return clock.Waiters() == 1 }, "reaper rescheduled")
+		assert.Equal(t, 1, manager.Count())
+
+		clock.Advance(2 * time.Hour)
+		WaitWithTimeout(t, time.Second, func() bool { return manager.Count() == 0 }, "session reaped")
+
+		reaper.Stop()
+		reaper.Stop() // no-op once stopped
+
+		// Nothing is reaped after Stop.
+		_, err = manager.CreateSession("late")
+		require.NoError(t, err)
+		clock.Advance(3 * time.Hour)
+		assert.Equal(t, 1, manager.Count())
+	})
+}
@@ -0,0 +1,231 @@
+package acp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/acp/internal/atomicfile"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+)
+
+const (
+	// sessionFileExtension is the file extension used by FileSessionStore.
+	sessionFileExtension = ".json"
+	// sessionDirPerm is the permission used when creating the session directory.
+	sessionDirPerm = 0o750
+	// sessionFilePerm is the permission used for session record files.
+	sessionFilePerm = 0o600
+)
+
+// Errors for session persistence.
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// SessionRecord is the persisted form of a SessionState.
+//
+// Metadata values must be JSON-serializable. Values loaded back from a
+// store are decoded with encoding/json, so numbers become float64 and
+// objects become map[string]interface{}.
+type SessionRecord struct {
+	ID         api.SessionId          `json:"id"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	LastActive time.Time              `json:"lastActive"`
+	Status     SessionStatus          `json:"status"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// SessionStore persists session records across process restarts.
+//
+// Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Save creates or replaces the record for record.ID.
+	Save(record *SessionRecord) error
+	// Load returns the record for id, or ErrSessionNotFound.
+	Load(id api.SessionId) (*SessionRecord, error)
+	// Delete removes the record for id. Deleting a missing record is not an error.
+	Delete(id api.SessionId) error
+	// List returns all stored records.
+	List() ([]*SessionRecord, error)
+}
+
+// MemorySessionStore is a SessionStore that keeps records in memory.
+//
+// It is primarily useful for tests and for agents that want the SessionManager
+// store semantics without touching disk.
+type MemorySessionStore struct {
+	records *util.SyncMap[api.SessionId, []byte]
+}
+
+// NewMemorySessionStore creates a new in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		records: util.NewSyncMap[api.SessionId, []byte](),
+	}
+}
+
+// Save stores a copy of the record.
+//
+// Records are kept in their JSON form so that loading returns the same
+// values a FileSessionStore would.
+func (ms *MemorySessionStore) Save(record *SessionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode session %v: %w", record.ID, err)
+	}
+	ms.records.Store(record.ID, data)
+	return nil
+}
+
+// Load returns the record for id.
+func (ms *MemorySessionStore) Load(id api.SessionId) (*SessionRecord, error) {
+	data, exists := ms.records.Load(id)
+	if !exists {
+		return nil, fmt.Errorf("%w: %v", ErrSessionNotFound, id)
+	}
+	return decodeSessionRecord(data)
+}
+
+// Delete removes the record for id.
+func (ms *MemorySessionStore) Delete(id api.SessionId) error {
+	ms.records.Delete(id)
+	return nil
+}
+
+// List returns all stored records.
+func (ms *MemorySessionStore) List() ([]*SessionRecord, error) {
+	recordMap := ms.records.GetAll()
+	records := make([]*SessionRecord, 0, len(recordMap))
+	for _, data := range recordMap {
+		record, err := decodeSessionRecord(data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// FileSessionStore is a SessionStore that keeps one JSON file per session in a
+// directory. Files are replaced atomically, so a crash never leaves a partial
+// record behind.
+type FileSessionStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileSessionStore creates a file-backed session store rooted at dir.
+//
+// The directory is created if it does not exist.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, sessionDirPerm); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+// Dir returns the directory the store writes to.
+func (fs *FileSessionStore) Dir() string {
+	return fs.dir
+}
+
+// Save writes the record to disk.
+func (fs *FileSessionStore) Save(record *SessionRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session %v: %w", record.ID, err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err = atomicfile.WriteFile(fs.path(record.ID), data, sessionFilePerm); err != nil {
+		return fmt.Errorf("failed to write session %v: %w", record.ID, err)
+	}
+	return nil
+}
+
+// Load reads the record for id from disk.
+func (fs *FileSessionStore) Load(id api.SessionId) (*SessionRecord, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, err := os.ReadFile(fs.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %v", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %v: %w", id, err)
+	}
+	return decodeSessionRecord(data)
+}
+
+// Delete removes the record file for id.
+func (fs *FileSessionStore) Delete(id api.SessionId) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	err := os.Remove(fs.path(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete session %v: %w", id, err)
+	}
+	return nil
+}
+
+// List reads every record in the store directory.
+func (fs *FileSessionStore) List() ([]*SessionRecord, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	records := make([]*SessionRecord, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != sessionFileExtension {
+			continue
+		}
+
+		data, readErr := os.ReadFile(filepath.Join(fs.dir, name))
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read session file %s: %w", name, readErr)
+		}
+		record, decodeErr := decodeSessionRecord(data)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("session file %s: %w", name, decodeErr)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// path returns the file path for a session ID.
+// IDs are path-escaped so that arbitrary strings map to a single file name,
+// and a leading dot is escaped so records are never hidden files.
+func (fs *FileSessionStore) path(id api.SessionId) string {
+	name := url.PathEscape(string(id))
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return filepath.Join(fs.dir, name+sessionFileExtension)
+}
+
+// decodeSessionRecord decodes a JSON session record.
+func decodeSessionRecord(data []byte) (*SessionRecord, error) {
+	var record SessionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode session record: %w", err)
+	}
+	return &record, nil
+}
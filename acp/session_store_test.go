@@ -0,0 +1,271 @@
+package acp
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingSessionStore is a SessionStore whose Save always fails.
+type failingSessionStore struct {
+	*MemorySessionStore
+}
+
+func (failingSessionStore) Save(*SessionRecord) error {
+	return errors.New("disk full")
+}
+
+// failingDeleteSessionStore is a SessionStore whose Delete always fails.
+type failingDeleteSessionStore struct {
+	*MemorySessionStore
+}
+
+func (failingDeleteSessionStore) Delete(api.SessionId) error {
+	return errors.New("read-only")
+}
+
+func TestSessionStatusText(t *testing.T) {
+	for _, status := range []SessionStatus{
+		SessionStatusActive,
+		SessionStatusPending,
+		SessionStatusCancelled,
+		SessionStatusCompleted,
+		SessionStatusError,
+	} {
+		t.Run(status.String(), func(t *testing.T) {
+			data, err := json.Marshal(status)
+			require.NoError(t, err)
+			assert.JSONEq(t, `"`+status.String()+`"`, string(data))
+
+			var decoded SessionStatus
+			require.NoError(t, json.Unmarshal(data, &decoded))
+			assert.Equal(t, status, decoded)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := json.Marshal(SessionStatus(99))
+		require.Error(t, err)
+
+		var decoded SessionStatus
+		require.Error(t, json.Unmarshal([]byte(`"bogus"`), &decoded))
+	})
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	t.Helper()
+
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	record := &SessionRecord{
+		ID:         "sess/with ..odd chars",
+		CreatedAt:  created,
+		LastActive: created.Add(time.Minute),
+		Status:     SessionStatusActive,
+		Metadata: map[string]interface{}{
+			"model": "test-model",
+			"turns": 3,
+		},
+	}
+
+	require.NoError(t, store.Save(record))
+
+	loaded, err := store.Load(record.ID)
+	require.NoError(t, err)
+	assert.Equal(t, record.ID, loaded.ID)
+	assert.True(t, created.Equal(loaded.CreatedAt))
+	assert.True(t, record.LastActive.Equal(loaded.LastActive))
+	assert.Equal(t, SessionStatusActive, loaded.Status)
+	assert.Equal(t, "test-model", loaded.Metadata["model"])
+	assert.InDelta(t, 3, loaded.Metadata["turns"], 0)
+
+	// Save replaces the existing record.
+	record.Status = SessionStatusCompleted
+	require.NoError(t, store.Save(record))
+	loaded, err = store.Load(record.ID)
+	require.NoError(t, err)
+	assert.Equal(t, SessionStatusCompleted, loaded.Status)
+
+	require.NoError(t, store.Save(&SessionRecord{ID: ".hidden", Status: SessionStatusPending}))
+
+	records, err := store.List()
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	require.NoError(t, store.Delete(record.ID))
+	_, err = store.Load(record.ID)
+	require.ErrorIs(t, err, ErrSessionNotFound)
+
+	// Deleting a missing record is not an error.
+	require.NoError(t, store.Delete(record.ID))
+
+	records, err = store.List()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, api.SessionId(".hidden"), records[0].ID)
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	testSessionStore(t, NewMemorySessionStore())
+}
+
+func TestFileSessionStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store, err := NewFileSessionStore(dir)
+	require.NoError(t, err)
+	assert.Equal(t, dir, store.Dir())
+
+	testSessionStore(t, store)
+
+	t.Run("IgnoresForeignFiles", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o600))
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "nested.json"), 0o750))
+
+		records, listErr := store.List()
+		require.NoError(t, listErr)
+		assert.Len(t, records, 1)
+	})
+
+	t.Run("CorruptRecord", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600))
+
+		_, listErr := store.List()
+		require.Error(t, listErr)
+		assert.Contains(t, listErr.Error(), "broken.json")
+	})
+}
+
+func TestSessionManagerWithStore(t *testing.T) {
+	t.Run("NilStore", func(t *testing.T) {
+		_, err := NewSessionManagerWithStore(nil)
+		require.Error(t, err)
+	})
+
+	t.Run("WriteThrough", func(t *testing.T) {
+		store := NewMemorySessionStore()
+		manager, err := NewSessionManagerWithStore(store)
+		require.NoError(t, err)
+		assert.Same(t, store, manager.Store())
+
+		_, err = manager.CreateSession("session-1")
+		require.NoError(t, err)
+
+		record, err := store.Load("session-1")
+		require.NoError(t, err)
+		assert.Equal(t, SessionStatusPending, record.Status)
+
+		require.NoError(t, manager.UpdateSession("session-1", SessionStatusActive))
+		record, err = store.Load("session-1")
+		require.NoError(t, err)
+		assert.Equal(t, SessionStatusActive, record.Status)
+
+		require.NoError(t, manager.SetSessionMetadata("session-1", "cwd", "/project"))
+		record, err = store.Load("session-1")
+		require.NoError(t, err)
+		assert.Equal(t, "/project", record.Metadata["cwd"])
+
+		session, _ := manager.GetSession("session-1")
+		session.SetMetadata("direct", true)
+		require.NoError(t, manager.SaveSession("session-1"))
+		record, err = store.Load("session-1")
+		require.NoError(t, err)
+		assert.Equal(t, true, record.Metadata["direct"])
+
+		require.NoError(t, manager.DeleteSession("session-1"))
+		_, err = store.Load("session-1")
+		require.ErrorIs(t, err, ErrSessionNotFound)
+
+		require.Error(t, manager.SetSessionMetadata("session-1", "k", "v"))
+		require.Error(t, manager.SaveSession("session-1"))
+	})
+
+	t.Run("LoadsOnStartup", func(t *testing.T) {
+		store, err := NewFileSessionStore(t.TempDir())
+		require.NoError(t, err)
+
+		first, err := NewSessionManagerWithStore(store)
+		require.NoError(t, err)
+
+		session, err := first.CreateSession("session-a")
+		require.NoError(t, err)
+		require.NoError(t, first.UpdateSession("session-a", SessionStatusCompleted))
+		require.NoError(t, first.SetSessionMetadata("session-a", "title", "Refactor"))
+		_, err = first.CreateSession("session-b")
+		require.NoError(t, err)
+
+		// Simulate a restarted agent daemon.
+		second, err := NewSessionManagerWithStore(store)
+		require.NoError(t, err)
+		assert.Equal(t, 2, second.Count())
+
+		restored, exists := second.GetSession("session-a")
+		require.True(t, exists)
+		assert.Equal(t, SessionStatusCompleted, restored.GetStatus())
+		assert.True(t, session.CreatedAt.Equal(restored.CreatedAt))
+		assert.True(t, session.LastActive.Load().Equal(restored.LastActive.Load()))
+		title, exists := restored.GetMetadata("title")
+		assert.True(t, exists)
+		assert.Equal(t, "Refactor", title)
+
+		// Duplicate IDs are still rejected after a restart.
+		_, err = second.CreateSession("session-b")
+		require.Error(t, err)
+	})
+
+	t.Run("NonSerializableMetadata", func(t *testing.T) {
+		manager, err := NewSessionManagerWithStore(NewMemorySessionStore())
+		require.NoError(t, err)
+
+		_, err = manager.CreateSession("session-1")
+		require.NoError(t, err)
+
+		err = manager.SetSessionMetadata("session-1", "callback", func() {})
+		require.Error(t, err)
+	})
+
+	t.Run("CreateFailureRollsBack", func(t *testing.T) {
+		manager, err := NewSessionManagerWithStore(failingSessionStore{NewMemorySessionStore()})
+		require.NoError(t, err)
+
+		_, err = manager.CreateSession("session-1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "disk full")
+		assert.Equal(t, 0, manager.Count())
+	})
+
+	t.Run("CleanupRemovesRecords", func(t *testing.T) {
+		store := NewMemorySessionStore()
+		manager, err := NewSessionManagerWithStore(store)
+		require.NoError(t, err)
+
+		session, err := manager.CreateSession("stale")
+		require.NoError(t, err)
+		session.LastActive.Store(time.Now().Add(-2 * time.Hour))
+
+		cleaned := manager.CleanupInactiveSessions(time.Hour)
+		assert.Equal(t, 1, cleaned)
+		_, err = store.Load("stale")
+		require.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	t.Run("CleanupReportsDeleteErrors", func(t *testing.T) {
+		manager, err := NewSessionManagerWithStore(failingDeleteSessionStore{NewMemorySessionStore()})
+		require.NoError(t, err)
+
+		session, err := manager.CreateSession("stale")
+		require.NoError(t, err)
+		session.LastActive.Store(time.Now().Add(-2 * time.Hour))
+
+		removed, err := manager.RemoveInactiveSessions(time.Hour)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "read-only")
+		assert.Equal(t, []api.SessionId{"stale"}, removed)
+		assert.Equal(t, 0, manager.Count())
+	})
+}
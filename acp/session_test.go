@@ -400,6 +400,17 @@ func TestSessionManager(t *testing.T) {
 		_, exists := manager.GetSession("session-0")
 		assert.False(t, exists)
 	})
+
+	t.Run("CleanupKeepsRunningTurns", func(t *testing.T) {
+		manager := NewSessionManager()
+		session, err := manager.CreateSession("busy")
+		require.NoError(t, err)
+		require.NoError(t, manager.UpdateSession("busy", SessionStatusActive))
+		session.LastActive.Store(time.Now().Add(-2 * time.Hour))
+
+		assert.Equal(t, 0, manager.CleanupInactiveSessions(time.Hour))
+		assert.Equal(t, 1, manager.Count())
+	})
 }
 
 func TestStateTransitions(t *testing.T) {
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
 	"github.com/joshgarnett/agent-client-protocol-go/util"
@@ -20,14 +22,22 @@ type TerminalHandle struct {
 	sessionID api.SessionId
 	conn      *AgentConnection
 	released  atomic.Bool
+
+	// Closed on release to stop Follow
+	releasedCh chan struct{}
+
+	// Set for handles created by CreateTerminalWithHandle, for leak reports
+	command   string
+	createdAt time.Time
 }
 
 // NewTerminalHandle creates a new terminal handle.
 func NewTerminalHandle(id string, sessionID api.SessionId, conn *AgentConnection) *TerminalHandle {
 	return &TerminalHandle{
-		ID:        id,
-		sessionID: sessionID,
-		conn:      conn,
+		ID:         id,
+		sessionID:  sessionID,
+		conn:       conn,
+		releasedCh: make(chan struct{}),
 	}
 }
 
@@ -67,6 +77,7 @@ func (th *TerminalHandle) Release(ctx context.Context) error {
 	if !th.released.CompareAndSwap(false, true) {
 		return nil // Already released
 	}
+	close(th.releasedCh)
 
 	err := th.conn.TerminalRelease(ctx, &api.ReleaseTerminalRequest{
 		SessionId:  th.sessionID,
@@ -111,6 +122,11 @@ type TerminalManager struct {
 	terminals *util.SyncMap[string, *TerminalHandle]
 	sessionID api.SessionId
 	conn      *AgentConnection
+
+	// Terminals created during the session's current prompt turn
+	mu            sync.Mutex
+	turnActive    bool
+	turnTerminals []*TerminalHandle
 }
 
 // NewTerminalManager creates a new terminal manager for the given session.
@@ -130,14 +146,15 @@ func (tm *TerminalManager) CreateTerminal(ctx context.Context,
 		return nil, fmt.Errorf("session ID mismatch: expected %v, got %v", tm.sessionID, params.SessionId)
 	}
 
-	response, err := tm.conn.TerminalCreate(ctx, params)
+	handle, err := tm.conn.CreateTerminalWithHandle(ctx, params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create terminal: %w", err)
 	}
 
-	handle := NewTerminalHandle(response.TerminalId, tm.sessionID, tm.conn)
-
-	tm.terminals.Store(response.TerminalId, handle)
+	tm.terminals.Store(handle.ID, handle)
+	if tm.conn.PromptTurnState(tm.sessionID).Active {
+		tm.addTurnTerminal(handle)
+	}
 
 	return handle, nil
 }
@@ -209,23 +226,33 @@ func (a *AgentConnection) CreateTerminalWithHandle(ctx context.Context,
 		return nil, err
 	}
 
-	return NewTerminalHandle(response.TerminalId, params.SessionId, a), nil
+	handle := NewTerminalHandle(response.TerminalId, params.SessionId, a)
+	handle.command = commandLine(params)
+	handle.createdAt = time.Now()
+	return handle, nil
 }
 
 // Session integration
 
 // SessionTerminalManager integrates terminal management with session lifecycle.
+//
+// Terminals are only tied to the lifecycle of the connection and its sessions
+// once BindConnection or BindSessionManager is called.
 type SessionTerminalManager struct {
-	managers *util.SyncMap[api.SessionId, *TerminalManager]
-	conn     *AgentConnection
+	managers     *util.SyncMap[api.SessionId, *TerminalManager]
+	conn         *AgentConnection
+	killOnCancel atomic.Bool
+	bound        atomic.Bool
 }
 
 // NewSessionTerminalManager creates a new session-level terminal manager.
 func NewSessionTerminalManager(conn *AgentConnection) *SessionTerminalManager {
-	return &SessionTerminalManager{
+	stm := &SessionTerminalManager{
 		managers: util.NewSyncMap[api.SessionId, *TerminalManager](),
 		conn:     conn,
 	}
+	stm.killOnCancel.Store(true)
+	return stm
 }
 
 // GetManager returns the terminal manager for a specific session.
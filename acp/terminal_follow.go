@@ -0,0 +1,154 @@
+package acp
+
+import (
+	"context"
+	"iter"
+	"strings"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+)
+
+// DefaultTerminalFollowInterval is the polling interval used by
+// TerminalHandle.Follow when none is given.
+const DefaultTerminalFollowInterval = 100 * time.Millisecond
+
+// TerminalChunk is a piece of terminal output streamed by
+// TerminalHandle.Follow.
+//
+// The last chunk of a terminal that exited carries its ExitStatus. If
+// following fails, the last chunk carries an Err instead.
+type TerminalChunk struct {
+	// Output is the output written since the previous chunk.
+	Output string
+	// Gap is set when output may have been dropped by the client's
+	// OutputByteLimit before it could be read, so Output does not directly
+	// follow the previous chunk.
+	Gap bool
+	// ExitStatus is set once the command has exited.
+	ExitStatus *api.TerminalExitStatus
+	// Err is set if reading the output failed.
+	Err error
+}
+
+// Final reports whether this is the last chunk.
+func (c TerminalChunk) Final() bool {
+	return c.ExitStatus != nil || c.Err != nil
+}
+
+// Follow polls the terminal's output every interval and returns an iterator
+// over the output written since the previous poll. Empty polls are skipped.
+// The iteration ends with a chunk carrying the exit status once the command
+// exits, and all output written before the exit is yielded first.
+//
+// When the client drops the oldest output because of the OutputByteLimit,
+// the new output is found by matching the end of the previously read output
+// with the start of the current output. If none of the previous output is
+// left, the chunk is marked as a Gap. Output that repeats exactly across a
+// truncation can make this matching ambiguous, in which case the repeated
+// text is treated as already read.
+//
+// Releasing the handle stops the iteration without a final chunk. Cancelling
+// ctx or failing to read the output ends it with a chunk carrying the error.
+// An interval of zero or less uses DefaultTerminalFollowInterval.
+func (th *TerminalHandle) Follow(ctx context.Context, interval time.Duration) iter.Seq[TerminalChunk] {
+	if interval <= 0 {
+		interval = DefaultTerminalFollowInterval
+	}
+
+	return func(yield func(TerminalChunk) bool) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var previous string
+		for {
+			if th.released.Load() {
+				return
+			}
+			response, err := th.CurrentOutput(ctx)
+			if err != nil {
+				// A release during the request makes the terminal unknown.
+				if th.released.Load() {
+					return
+				}
+				yield(TerminalChunk{Err: err})
+				return
+			}
+
+			delta, gap := outputDelta(previous, response.Output)
+			previous = response.Output
+
+			if response.ExitStatus != nil {
+				yield(TerminalChunk{
+					Output: delta,
+					Gap:    gap,
+					ExitStatus: &api.TerminalExitStatus{
+						ExitCode: response.ExitStatus.ExitCode,
+						Signal:   response.ExitStatus.Signal,
+					},
+				})
+				return
+			}
+			if (delta != "" || gap) && !yield(TerminalChunk{Output: delta, Gap: gap}) {
+				return
+			}
+
+			select {
+			case <-ticker.C:
+			case <-th.releasedCh:
+				return
+			case <-ctx.Done():
+				yield(TerminalChunk{Err: ctx.Err()})
+				return
+			}
+		}
+	}
+}
+
+// outputDelta returns the part of current that follows previous, for output
+// that is only ever appended to and truncated from the front. It reports a
+// gap if previous is not empty and none of it is left in current.
+func outputDelta(previous, current string) (string, bool) {
+	if strings.HasPrefix(current, previous) {
+		return current[len(previous):], false
+	}
+	if overlap := outputOverlap(previous, current); overlap > 0 {
+		return current[overlap:], false
+	}
+	return current, previous != ""
+}
+
+// outputOverlap returns the length of the longest end of previous that
+// current starts with. It runs the Knuth-Morris-Pratt matcher for the start of
+// current over previous, so it takes time linear in their lengths even for
+// repetitive output.
+func outputOverlap(previous, current string) int {
+	pattern := current[:min(len(current), len(previous))]
+	if pattern == "" {
+		return 0
+	}
+
+	// border[i] is the length of the longest proper prefix of pattern[:i+1]
+	// that is also its suffix.
+	border := make([]int32, len(pattern))
+	for i, k := 1, int32(0); i < len(pattern); i++ {
+		for k > 0 && pattern[i] != pattern[k] {
+			k = border[k-1]
+		}
+		if pattern[i] == pattern[k] {
+			k++
+		}
+		border[i] = k
+	}
+
+	matched := int32(0)
+	for i := range len(previous) {
+		for matched > 0 && (int(matched) == len(pattern) || previous[i] != pattern[matched]) {
+			matched = border[matched-1]
+		}
+		if previous[i] == pattern[matched] {
+			matched++
+		}
+	}
+	return int(matched)
+}
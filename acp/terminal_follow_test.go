@@ -0,0 +1,179 @@
+package acp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputDelta(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous string
+		current  string
+		delta    string
+		gap      bool
+	}{
+		{name: "First", previous: "", current: "abc", delta: "abc"},
+		{name: "Appended", previous: "abc", current: "abcdef", delta: "def"},
+		{name: "Unchanged", previous: "abc", current: "abc", delta: ""},
+		{name: "Truncated", previous: "abcdef", current: "defgh", delta: "gh"},
+		{name: "TruncatedWithoutNewOutput", previous: "abcdef", current: "ef", delta: ""},
+		{name: "AllDropped", previous: "abc", current: "xyz", delta: "xyz", gap: true},
+		{name: "RepeatedLines", previous: "a\nb\na\n", current: "a\na\nb\n", delta: "a\nb\n"},
+		{name: "RepeatedBytes", previous: "aaaa", current: "aaab", delta: "b"},
+		{name: "PartialBorder", previous: "xabab", current: "ababc", delta: "c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, gap := outputDelta(tt.previous, tt.current)
+			assert.Equal(t, tt.delta, delta)
+			assert.Equal(t, tt.gap, gap)
+		})
+	}
+
+	t.Run("RepetitiveTruncatedOutput", func(t *testing.T) {
+		// Quadratic matching would take far longer than the test timeout.
+		previous := strings.Repeat("a", DefaultMaxTerminalOutputLimit)
+		current := previous[1:] + "b"
+		delta, gap := outputDelta(previous, current)
+		assert.Equal(t, "b", delta)
+		assert.False(t, gap)
+	})
+}
+
+func TestTerminalFollow(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("StreamsDeltasAndExitStatus", func(t *testing.T) {
+		agentConn, _, _ := newTerminalHostPair(t)
+		handle, err := agentConn.CreateTerminalWithHandle(ctx,
+			shell("for i in 1 2 3; do echo line$i; sleep 0.1; done; exit 2"))
+		require.NoError(t, err)
+		defer handle.Close()
+
+		var chunks []TerminalChunk
+		for chunk := range handle.Follow(ctx, 10*time.Millisecond) {
+			chunks = append(chunks, chunk)
+		}
+
+		require.NotEmpty(t, chunks)
+		var output strings.Builder
+		for i, chunk := range chunks {
+			require.NoError(t, chunk.Err)
+			assert.False(t, chunk.Gap)
+			assert.Equal(t, i == len(chunks)-1, chunk.Final())
+			output.WriteString(chunk.Output)
+		}
+		assert.Equal(t, "line1\nline2\nline3\n", output.String())
+		assert.Greater(t, len(chunks), 1)
+
+		last := chunks[len(chunks)-1]
+		require.NotNil(t, last.ExitStatus)
+		require.NotNil(t, last.ExitStatus.ExitCode)
+		assert.Equal(t, 2, *last.ExitStatus.ExitCode)
+	})
+
+	t.Run("FollowsTruncatedOutput", func(t *testing.T) {
+		agentConn, _, _ := newTerminalHostPair(t)
+		params := shell("for i in 1 2 3 4 5 6; do echo line$i; sleep 0.1; done")
+		params.OutputByteLimit = IntPtr(12)
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, params)
+		require.NoError(t, err)
+		defer handle.Close()
+
+		var output strings.Builder
+		for chunk := range handle.Follow(ctx, 10*time.Millisecond) {
+			require.NoError(t, chunk.Err)
+			assert.False(t, chunk.Gap)
+			output.WriteString(chunk.Output)
+		}
+		assert.Equal(t, "line1\nline2\nline3\nline4\nline5\nline6\n", output.String())
+
+		current, err := handle.CurrentOutput(ctx)
+		require.NoError(t, err)
+		assert.True(t, current.Truncated)
+	})
+
+	t.Run("ReportsGap", func(t *testing.T) {
+		agentConn, _, _ := newTerminalHostPair(t)
+		params := shell("echo first; sleep 0.3; echo second; echo third")
+		params.OutputByteLimit = IntPtr(6)
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, params)
+		require.NoError(t, err)
+		defer handle.Close()
+
+		var chunks []TerminalChunk
+		for chunk := range handle.Follow(ctx, 100*time.Millisecond) {
+			chunks = append(chunks, chunk)
+		}
+		// The polls after the sleep may see the last output before the exit,
+		// and may see "second" before "third" is written.
+		require.GreaterOrEqual(t, len(chunks), 2)
+		assert.Equal(t, "first\n", chunks[0].Output)
+		assert.False(t, chunks[0].Gap)
+		assert.True(t, chunks[1].Gap)
+		var rest strings.Builder
+		for _, chunk := range chunks[1:] {
+			rest.WriteString(chunk.Output)
+		}
+		assert.True(t, strings.HasSuffix(rest.String(), "third\n"))
+		require.NotNil(t, chunks[len(chunks)-1].ExitStatus)
+	})
+
+	t.Run("StopsOnRelease", func(t *testing.T) {
+		agentConn, _, host := newTerminalHostPair(t)
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, shell("echo started; sleep 30"))
+		require.NoError(t, err)
+
+		done := make(chan []TerminalChunk)
+		go func() {
+			var chunks []TerminalChunk
+			for chunk := range handle.Follow(ctx, 10*time.Millisecond) {
+				chunks = append(chunks, chunk)
+				if chunk.Output != "" {
+					assert.NoError(t, handle.Release(ctx))
+				}
+			}
+			done <- chunks
+		}()
+
+		select {
+		case chunks := <-done:
+			require.Len(t, chunks, 1)
+			assert.Equal(t, "started\n", chunks[0].Output)
+			assert.False(t, chunks[0].Final())
+		case <-time.After(10 * time.Second):
+			t.Fatal("Follow did not stop after release")
+		}
+		assert.Equal(t, 0, host.Count())
+
+		var chunks []TerminalChunk
+		for chunk := range handle.Follow(ctx, 0) {
+			chunks = append(chunks, chunk)
+		}
+		assert.Empty(t, chunks)
+	})
+
+	t.Run("StopsOnContextCancel", func(t *testing.T) {
+		agentConn, _, _ := newTerminalHostPair(t)
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+		defer handle.Close()
+
+		followCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		var chunks []TerminalChunk
+		for chunk := range handle.Follow(followCtx, 10*time.Millisecond) {
+			chunks = append(chunks, chunk)
+		}
+		require.Len(t, chunks, 1)
+		assert.ErrorIs(t, chunks[0].Err, context.DeadlineExceeded)
+		assert.True(t, chunks[0].Final())
+	})
+}
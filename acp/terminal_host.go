@@ -0,0 +1,376 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+)
+
+const (
+	// DefaultTerminalOutputLimit is the output kept by a TerminalHost
+	// terminal when terminal/create does not set OutputByteLimit.
+	DefaultTerminalOutputLimit = 1 << 20
+	// DefaultMaxTerminalOutputLimit is the largest OutputByteLimit a
+	// TerminalHost accepts unless configured with WithMaxOutputLimit.
+	DefaultMaxTerminalOutputLimit = 16 << 20
+
+	// terminalWaitDelay bounds how long a terminal waits for its output to
+	// close after its process exits, in case processes it started keep
+	// standard output or standard error open.
+	terminalWaitDelay = 2 * time.Second
+)
+
+// TerminalHost implements the terminal methods for clients by running the
+// requested commands with os/exec.
+//
+// Each terminal runs one process with the request's Command, Args and Env.
+// The process runs in the request's Cwd, or in the session's Cwd if the
+// request has none. Standard output and standard error are captured
+// together. Once the output exceeds the OutputByteLimit, the oldest output is
+// dropped, always at a UTF-8 character boundary, and the output is reported
+// as truncated. Limits larger than the host's maximum are lowered to it.
+//
+// Releasing a terminal kills its process if it is still running. Terminals
+// are also released when the connection they were created on closes, or when
+// Close is called.
+type TerminalHost struct {
+	terminals *util.SyncMap[string, *hostTerminal]
+	ids       atomic.Uint64
+
+	// Connections whose close hook releases their terminals
+	bound *util.SyncMap[*ConnectionCore, struct{}]
+
+	// Optional restrictions on the commands run
+	policy *TerminalPolicy
+
+	// Largest output kept per terminal
+	maxOutputLimit int
+}
+
+// NewTerminalHost creates a terminal host with no terminals.
+func NewTerminalHost() *TerminalHost {
+	return &TerminalHost{
+		terminals:      util.NewSyncMap[string, *hostTerminal](),
+		bound:          util.NewSyncMap[*ConnectionCore, struct{}](),
+		maxOutputLimit: DefaultMaxTerminalOutputLimit,
+	}
+}
+
+// WithMaxOutputLimit sets the largest output a terminal keeps, whatever
+// OutputByteLimit the agent requests. It should be set before the host
+// handles requests.
+func (h *TerminalHost) WithMaxOutputLimit(limit int) *TerminalHost {
+	h.maxOutputLimit = limit
+	return h
+}
+
+// Register registers the terminal handlers on a registry. Clients that
+// register them should advertise the terminal capability.
+func (h *TerminalHost) Register(registry *HandlerRegistry) {
+	registry.RegisterTerminalCreateHandler(h.HandleCreate)
+	registry.RegisterTerminalOutputHandler(h.HandleOutput)
+	registry.RegisterTerminalWaitForExitHandler(h.HandleWaitForExit)
+	registry.RegisterTerminalKillHandler(h.HandleKill)
+	registry.RegisterTerminalReleaseHandler(h.HandleRelease)
+}
+
+// HandleCreate answers a terminal/create request by starting the command.
+func (h *TerminalHost) HandleCreate(
+	ctx context.Context,
+	params *api.CreateTerminalRequest,
+) (*api.CreateTerminalResponse, error) {
+	if params.Command == "" {
+		return nil, NewValidationError("command", "must not be empty")
+	}
+	limit := DefaultTerminalOutputLimit
+	if params.OutputByteLimit != nil {
+		if *params.OutputByteLimit < 0 {
+			return nil, NewValidationError("outputByteLimit", "must not be negative")
+		}
+		limit = *params.OutputByteLimit
+	}
+	limit = min(limit, h.maxOutputLimit)
+
+	var core *ConnectionCore
+	var sessionCwd string
+	if conn := ClientConnectionFromContext(ctx); conn != nil {
+		core = conn.core
+		sessionCwd, _ = conn.sessionCwds.Load(params.SessionId)
+	}
+
+	//nolint:gosec // Running the agent's command is the purpose of terminal/create.
+	cmd := exec.Command(params.Command, params.Args...)
+	cmd.Env = os.Environ()
+	for _, env := range params.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	cmd.Dir = sessionCwd
+	if params.Cwd != nil {
+		cmd.Dir = *params.Cwd
+	}
+	if h.policy != nil {
+		if err := h.policy.apply(ctx, params, sessionCwd, cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	terminal := &hostTerminal{
+		id:        "term-" + strconv.FormatUint(h.ids.Add(1), 10),
+		sessionID: params.SessionId,
+		core:      core,
+		cmd:       cmd,
+		output:    &terminalOutput{limit: limit},
+		done:      make(chan struct{}),
+	}
+	cmd.Stdout = terminal.output
+	cmd.Stderr = terminal.output
+	cmd.WaitDelay = terminalWaitDelay
+	configureTerminalProcess(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, WrapError(err, api.ErrorCodeInternalServerError, "failed to start command")
+	}
+	if h.policy != nil && h.policy.Timeout > 0 {
+		terminal.timer = time.AfterFunc(h.policy.Timeout, terminal.kill)
+	}
+	go terminal.wait()
+
+	h.terminals.Store(terminal.id, terminal)
+	if core != nil {
+		h.bind(core)
+	}
+	return &api.CreateTerminalResponse{TerminalId: terminal.id}, nil
+}
+
+// HandleOutput answers a terminal/output request with the captured output and
+// the exit status, if the process has exited.
+func (h *TerminalHost) HandleOutput(
+	_ context.Context,
+	params *api.TerminalOutputRequest,
+) (*api.TerminalOutputResponse, error) {
+	terminal, err := h.lookup(params.SessionId, params.TerminalId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the exit status first so that output written before the exit is
+	// always included.
+	status := terminal.exitStatus()
+	output, truncated := terminal.output.snapshot()
+	response := &api.TerminalOutputResponse{Output: output, Truncated: truncated}
+	if status != nil {
+		response.ExitStatus = &api.TerminalOutputResponseExitStatus{
+			ExitCode: status.ExitCode,
+			Signal:   status.Signal,
+		}
+	}
+	return response, nil
+}
+
+// HandleWaitForExit answers a terminal/wait_for_exit request once the process
+// exits.
+func (h *TerminalHost) HandleWaitForExit(
+	ctx context.Context,
+	params *api.WaitForTerminalExitRequest,
+) (*api.WaitForTerminalExitResponse, error) {
+	terminal, err := h.lookup(params.SessionId, params.TerminalId)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-terminal.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	status := terminal.exitStatus()
+	return &api.WaitForTerminalExitResponse{ExitCode: status.ExitCode, Signal: status.Signal}, nil
+}
+
+// HandleKill answers a terminal/kill request. The terminal stays available
+// for its output and exit status until it is released.
+func (h *TerminalHost) HandleKill(_ context.Context, params *api.KillTerminalRequest) error {
+	terminal, err := h.lookup(params.SessionId, params.TerminalId)
+	if err != nil {
+		return err
+	}
+	terminal.kill()
+	return nil
+}
+
+// HandleRelease answers a terminal/release request, killing the process if it
+// is still running.
+func (h *TerminalHost) HandleRelease(_ context.Context, params *api.ReleaseTerminalRequest) error {
+	terminal, err := h.lookup(params.SessionId, params.TerminalId)
+	if err != nil {
+		return err
+	}
+	h.release(terminal)
+	return nil
+}
+
+// Count returns the number of terminals that have not been released.
+func (h *TerminalHost) Count() int {
+	return h.terminals.Count()
+}
+
+// Close releases all terminals.
+func (h *TerminalHost) Close() error {
+	for _, terminal := range h.terminals.GetAll() {
+		h.release(terminal)
+	}
+	return nil
+}
+
+// bind releases the terminals created on a connection when it closes.
+func (h *TerminalHost) bind(core *ConnectionCore) {
+	if _, loaded := h.bound.LoadOrStore(core, struct{}{}); loaded {
+		return
+	}
+	core.onClose(func() {
+		h.bound.Delete(core)
+		for _, terminal := range h.terminals.GetAll() {
+			if terminal.core == core {
+				h.release(terminal)
+			}
+		}
+	})
+}
+
+// lookup returns a terminal of a session.
+func (h *TerminalHost) lookup(sessionID api.SessionId, terminalID string) (*hostTerminal, error) {
+	terminal, exists := h.terminals.Load(terminalID)
+	if !exists || terminal.sessionID != sessionID {
+		return nil, NewNotFoundError("terminal", terminalID)
+	}
+	return terminal, nil
+}
+
+// release kills a terminal's process, waits for it to exit and forgets the
+// terminal.
+func (h *TerminalHost) release(terminal *hostTerminal) {
+	if !h.terminals.CompareAndDelete(terminal.id, terminal) {
+		return
+	}
+	terminal.kill()
+	<-terminal.done
+}
+
+// hostTerminal is a process started by a TerminalHost.
+type hostTerminal struct {
+	id        string
+	sessionID api.SessionId
+	core      *ConnectionCore
+	cmd       *exec.Cmd
+	output    *terminalOutput
+
+	done   chan struct{}
+	timer  *time.Timer
+	mu     sync.Mutex
+	status *api.TerminalExitStatus
+}
+
+// wait waits for the process to exit and records its exit status.
+//
+// Processes the command started that still hold its output open once the
+// wait delay has passed are killed with the rest of its process group.
+func (t *hostTerminal) wait() {
+	if err := t.cmd.Wait(); errors.Is(err, exec.ErrWaitDelay) {
+		_ = killTerminalProcess(t.cmd)
+	}
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+
+	status := &api.TerminalExitStatus{}
+	if state := t.cmd.ProcessState; state != nil {
+		if signal := exitSignal(state); signal != "" {
+			status.Signal = &signal
+		} else {
+			code := state.ExitCode()
+			status.ExitCode = &code
+		}
+	}
+
+	t.mu.Lock()
+	t.status = status
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// exitStatus returns the exit status, or nil while the process is running.
+func (t *hostTerminal) exitStatus() *api.TerminalExitStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// kill kills the process if it is still running.
+func (t *hostTerminal) kill() {
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+	if err := killTerminalProcess(t.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		_ = t.cmd.Process.Kill()
+	}
+}
+
+// terminalOutput collects process output, keeping at most limit bytes.
+//
+// Dropped output stays in buf until it outgrows the kept output, so the
+// buffer is compacted once per limit bytes written rather than on every write.
+type terminalOutput struct {
+	mu        sync.Mutex
+	limit     int
+	buf       []byte
+	start     int // offset of the kept output in buf
+	truncated bool
+}
+
+// Write appends output, dropping the oldest output beyond the limit.
+func (o *terminalOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := len(p)
+	if len(p) > o.limit {
+		o.buf, o.start, o.truncated = o.buf[:0], 0, true
+		p = p[len(p)-o.limit:]
+		for len(p) > 0 && !utf8.RuneStart(p[0]) {
+			p = p[1:]
+		}
+	}
+
+	o.buf = append(o.buf, p...)
+	if len(o.buf)-o.start > o.limit {
+		cut := len(o.buf) - o.limit
+		for cut < len(o.buf) && !utf8.RuneStart(o.buf[cut]) {
+			cut++
+		}
+		o.start = cut
+		o.truncated = true
+	}
+	if o.start > o.limit {
+		o.buf = append(o.buf[:0], o.buf[o.start:]...)
+		o.start = 0
+	}
+	return n, nil
+}
+
+// snapshot returns the collected output and whether any was dropped.
+func (o *terminalOutput) snapshot() (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return string(o.buf[o.start:]), o.truncated
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package acp
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// configureTerminalProcess leaves the command unchanged on platforms without
+// process groups.
+func configureTerminalProcess(*exec.Cmd) {}
+
+// killTerminalProcess kills the command's process.
+func killTerminalProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// exitSignal reports no signal on platforms without signals.
+func exitSignal(*os.ProcessState) string {
+	return ""
+}
+
+// limitTerminalResources fails on platforms without resource limits.
+func limitTerminalResources(*exec.Cmd, time.Duration, uint64) error {
+	return errors.New("resource limits are not supported on this platform")
+}
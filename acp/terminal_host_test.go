@@ -0,0 +1,254 @@
+package acp
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTerminalHostPair creates a connection pair whose client runs terminals
+// with a TerminalHost.
+func newTerminalHostPair(t *testing.T) (*AgentConnection, *ClientConnection, *TerminalHost) {
+	t.Helper()
+	host := NewTerminalHost()
+	t.Cleanup(func() { _ = host.Close() })
+
+	clientHandler := NewClientHandlerRegistry()
+	host.Register(clientHandler)
+	agentHandler := NewAgentHandlerRegistry()
+	agentHandler.RegisterSessionNewHandler(
+		func(_ context.Context, _ *api.NewSessionRequest) (*api.NewSessionResponse, error) {
+			return &api.NewSessionResponse{SessionId: "s1"}, nil
+		},
+	)
+	agentConn, clientConn := NewRolePair(t, agentHandler, clientHandler)
+	return agentConn, clientConn, host
+}
+
+// shell returns a terminal/create request running a shell script.
+func shell(script string) *api.CreateTerminalRequest {
+	return &api.CreateTerminalRequest{SessionId: "s1", Command: "sh", Args: []string{"-c", script}}
+}
+
+func TestTerminalHost(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("OutputAndExitCode", func(t *testing.T) {
+		agentConn, _, _ := newTerminalHostPair(t)
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, shell("echo out; echo err >&2; exit 3"))
+		require.NoError(t, err)
+		defer handle.Close()
+
+		exit, err := handle.WaitForExit(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, exit.ExitCode)
+		assert.Equal(t, 3, *exit.ExitCode)
+		assert.Nil(t, exit.Signal)
+
+		output, err := handle.CurrentOutput(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "out\nerr\n", output.Output)
+		assert.False(t, output.Truncated)
+		require.NotNil(t, output.ExitStatus)
+		assert.Equal(t, 3, *output.ExitStatus.ExitCode)
+	})
+
+	t.Run("BackgroundProcessHoldingOutput", func(t *testing.T) {
+		// Called directly, as the wait outlasts the test connections' request timeout.
+		host := NewTerminalHost()
+		defer host.Close()
+		created, err := host.HandleCreate(ctx, shell("echo started; sleep 60 & exit 0"))
+		require.NoError(t, err)
+
+		// The shell exits at once while sleep keeps its output open.
+		waitCtx, cancel := context.WithTimeout(ctx, terminalWaitDelay+5*time.Second)
+		defer cancel()
+		exit, err := host.HandleWaitForExit(waitCtx, &api.WaitForTerminalExitRequest{
+			SessionId:  "s1",
+			TerminalId: created.TerminalId,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, exit.ExitCode)
+		assert.Equal(t, 0, *exit.ExitCode)
+
+		output, err := host.HandleOutput(ctx, &api.TerminalOutputRequest{SessionId: "s1", TerminalId: created.TerminalId})
+		require.NoError(t, err)
+		assert.Equal(t, "started\n", output.Output)
+	})
+
+	t.Run("EnvAndCwd", func(t *testing.T) {
+		agentConn, _, _ := newTerminalHostPair(t)
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		require.NoError(t, err)
+		params := shell("echo $GREETING; pwd")
+		params.Env = []api.EnvVariable{{Name: "GREETING", Value: "hello"}}
+		params.Cwd = &dir
+
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, params)
+		require.NoError(t, err)
+		defer handle.Close()
+		_, err = handle.WaitForExit(ctx)
+		require.NoError(t, err)
+		output, err := handle.CurrentOutput(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "hello\n"+dir+"\n", output.Output)
+	})
+
+	t.Run("DefaultsToSessionCwd", func(t *testing.T) {
+		agentConn, clientConn, _ := newTerminalHostPair(t)
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		require.NoError(t, err)
+		_, err = clientConn.SessionNew(ctx, &api.NewSessionRequest{Cwd: dir, McpServers: []api.McpServer{}})
+		require.NoError(t, err)
+
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, shell("pwd"))
+		require.NoError(t, err)
+		defer handle.Close()
+		_, err = handle.WaitForExit(ctx)
+		require.NoError(t, err)
+		output, err := handle.CurrentOutput(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, dir+"\n", output.Output)
+	})
+
+	t.Run("OutputByteLimit", func(t *testing.T) {
+		agentConn, _, host := newTerminalHostPair(t)
+		params := shell("printf 'first line\\nsecond line\\n'")
+		params.OutputByteLimit = IntPtr(12)
+
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, params)
+		require.NoError(t, err)
+		defer handle.Close()
+		_, err = handle.WaitForExit(ctx)
+		require.NoError(t, err)
+		output, err := handle.CurrentOutput(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "second line\n", output.Output)
+		assert.True(t, output.Truncated)
+
+		// Limits above the host's maximum are lowered to it.
+		host.WithMaxOutputLimit(6)
+		params.OutputByteLimit = IntPtr(1 << 30)
+		handle, err = agentConn.CreateTerminalWithHandle(ctx, params)
+		require.NoError(t, err)
+		defer handle.Close()
+		_, err = handle.WaitForExit(ctx)
+		require.NoError(t, err)
+		output, err = handle.CurrentOutput(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, " line\n", output.Output)
+	})
+
+	t.Run("Kill", func(t *testing.T) {
+		agentConn, _, host := newTerminalHostPair(t)
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+
+		require.NoError(t, handle.Kill(ctx))
+		exit, err := handle.WaitForExit(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, exit.Signal)
+		assert.Equal(t, "SIGKILL", *exit.Signal)
+		assert.Nil(t, exit.ExitCode)
+
+		// A killed terminal stays available until released.
+		assert.Equal(t, 1, host.Count())
+		require.NoError(t, handle.Release(ctx))
+		assert.Equal(t, 0, host.Count())
+	})
+
+	t.Run("ReleaseKillsProcess", func(t *testing.T) {
+		agentConn, _, host := newTerminalHostPair(t)
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+		terminal, exists := host.terminals.Load(handle.ID)
+		require.True(t, exists)
+
+		require.NoError(t, handle.Release(ctx))
+		assert.Equal(t, 0, host.Count())
+		require.NotNil(t, terminal.exitStatus())
+		assert.Equal(t, "SIGKILL", *terminal.exitStatus().Signal)
+
+		_, err = agentConn.TerminalOutput(ctx, &api.TerminalOutputRequest{SessionId: "s1", TerminalId: handle.ID})
+		AssertACPError(t, err, api.ErrorCodeNotFound)
+	})
+
+	t.Run("OtherSessionsCannotUseTerminal", func(t *testing.T) {
+		agentConn, _, _ := newTerminalHostPair(t)
+		handle, err := agentConn.CreateTerminalWithHandle(ctx, shell("true"))
+		require.NoError(t, err)
+		defer handle.Close()
+
+		err = agentConn.TerminalKill(ctx, &api.KillTerminalRequest{SessionId: "s2", TerminalId: handle.ID})
+		AssertACPError(t, err, api.ErrorCodeNotFound)
+	})
+
+	t.Run("ConnectionCloseReleases", func(t *testing.T) {
+		agentConn, clientConn, host := newTerminalHostPair(t)
+		_, err := agentConn.CreateTerminalWithHandle(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+		require.Equal(t, 1, host.Count())
+
+		require.NoError(t, clientConn.Close())
+		assert.Eventually(t, func() bool { return host.Count() == 0 }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("InvalidRequest", func(t *testing.T) {
+		agentConn, _, _ := newTerminalHostPair(t)
+		_, err := agentConn.TerminalCreate(ctx, &api.CreateTerminalRequest{SessionId: "s1"})
+		AssertACPError(t, err, api.CodeInvalidParams)
+		_, err = agentConn.TerminalCreate(ctx, &api.CreateTerminalRequest{SessionId: "s1", Command: "/nonexistent/cmd"})
+		AssertACPError(t, err, api.ErrorCodeInternalServerError)
+	})
+}
+
+func TestTerminalOutputTruncation(t *testing.T) {
+	output := &terminalOutput{limit: 5}
+	_, err := output.Write([]byte("ab"))
+	require.NoError(t, err)
+	text, truncated := output.snapshot()
+	assert.Equal(t, "ab", text)
+	assert.False(t, truncated)
+
+	// "é" and "ö" are two bytes each; the cut must not split them.
+	_, err = output.Write([]byte("cdéfö"))
+	require.NoError(t, err)
+	text, _ = output.snapshot()
+	assert.Equal(t, "éfö", text)
+
+	_, err = output.Write([]byte("g"))
+	require.NoError(t, err)
+	text, truncated = output.snapshot()
+	assert.True(t, truncated)
+	assert.True(t, utf8.ValidString(text))
+	assert.LessOrEqual(t, len(text), 5)
+	assert.True(t, strings.HasSuffix("abcdéfög", text))
+	assert.Equal(t, "fög", text)
+
+	// A write larger than the limit keeps only its tail.
+	_, err = output.Write([]byte("hijklémn"))
+	require.NoError(t, err)
+	text, _ = output.snapshot()
+	assert.Equal(t, "lémn", text)
+}
+
+func TestTerminalOutputCompaction(t *testing.T) {
+	output := &terminalOutput{limit: 100}
+	for i := range 1000 {
+		_, err := output.Write([]byte{byte('a' + i%26)})
+		require.NoError(t, err)
+		// Dropped output is compacted before the buffer doubles the limit.
+		assert.LessOrEqual(t, len(output.buf), 2*output.limit+1)
+	}
+	text, truncated := output.snapshot()
+	assert.True(t, truncated)
+	assert.Len(t, text, 100)
+	assert.Equal(t, byte('a'+999%26), text[99])
+}
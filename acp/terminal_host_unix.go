@@ -0,0 +1,85 @@
+//go:build unix
+
+package acp
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// signalNames maps the signals that commonly end a process to their names.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGUSR1: "SIGUSR1",
+	syscall.SIGUSR2: "SIGUSR2",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGXFSZ: "SIGXFSZ",
+}
+
+// configureTerminalProcess starts the command in its own process group, so
+// that killing the terminal also kills the processes it started.
+func configureTerminalProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killTerminalProcess kills the command's process group.
+func killTerminalProcess(cmd *exec.Cmd) error {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		if err == syscall.ESRCH {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
+
+// exitSignal returns the name of the signal that ended a process, or "" if
+// it exited normally.
+func exitSignal(state *os.ProcessState) string {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	if name, exists := signalNames[status.Signal()]; exists {
+		return name
+	}
+	return status.Signal().String()
+}
+
+// limitTerminalResources runs the command through sh, which sets the CPU time
+// and address space limits with ulimit before executing the command.
+func limitTerminalResources(cmd *exec.Cmd, cpu time.Duration, memory uint64) error {
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		return err
+	}
+
+	var limits []string
+	if cpu > 0 {
+		seconds := max(int64((cpu+time.Second-1)/time.Second), 1)
+		limits = append(limits, fmt.Sprintf("ulimit -t %d", seconds))
+	}
+	if memory > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -v %d", max(memory/1024, 1)))
+	}
+	script := strings.Join(append(limits, `exec "$0" "$@"`), " && ")
+
+	cmd.Args = append([]string{"sh", "-c", script, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shell
+	return nil
+}
@@ -0,0 +1,162 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// TerminalLeak describes a terminal handle that was never released.
+type TerminalLeak struct {
+	SessionID  api.SessionId
+	TerminalID string
+	// Command is the command line the terminal was created with.
+	Command string
+	// CreatedAt is when the terminal was created.
+	CreatedAt time.Time
+}
+
+// BindConnection ties the terminals to the lifecycle of the manager's
+// connection. Once bound, terminals created while their session has a prompt
+// turn in progress are killed when the client sends session/cancel (see
+// WithKillOnCancel), and all terminals are released when the connection
+// closes. Calling BindConnection again has no effect.
+//
+// BindConnection should be called before the connection starts serving
+// requests.
+func (stm *SessionTerminalManager) BindConnection() *SessionTerminalManager {
+	if !stm.bound.CompareAndSwap(false, true) {
+		return stm
+	}
+	stm.conn.core.intercept(stm.interceptCancel)
+	stm.conn.core.onClose(stm.releaseOnClose)
+	stm.conn.OnPromptTurnChange(stm.promptTurnChanged)
+	return stm
+}
+
+// WithKillOnCancel sets whether a manager bound with BindConnection kills
+// terminals created during a prompt turn when the client cancels the
+// session. It is enabled by default. Killed terminals keep their output and
+// must still be released.
+func (stm *SessionTerminalManager) WithKillOnCancel(enabled bool) *SessionTerminalManager {
+	stm.killOnCancel.Store(enabled)
+	return stm
+}
+
+// BindSessionManager releases a session's terminals when the session is
+// removed from the manager, whether it was deleted, reaped or detached
+// because its connection closed.
+func (stm *SessionTerminalManager) BindSessionManager(manager *SessionManager) {
+	manager.onDelete(func(session *SessionState, _ SessionDeleteReason) {
+		_ = stm.ReleaseSession(context.Background(), session.ID)
+	})
+}
+
+// LeakReport returns the terminals created through the managers that have not
+// been released, oldest first. Terminals released by a lifecycle event are
+// not reported.
+func (stm *SessionTerminalManager) LeakReport() []TerminalLeak {
+	var leaks []TerminalLeak
+	for sessionID, manager := range stm.managers.GetAll() {
+		for _, handle := range manager.ListTerminals() {
+			if handle.IsReleased() {
+				continue
+			}
+			leaks = append(leaks, TerminalLeak{
+				SessionID:  sessionID,
+				TerminalID: handle.ID,
+				Command:    handle.command,
+				CreatedAt:  handle.createdAt,
+			})
+		}
+	}
+	sort.Slice(leaks, func(i, j int) bool {
+		if !leaks[i].CreatedAt.Equal(leaks[j].CreatedAt) {
+			return leaks[i].CreatedAt.Before(leaks[j].CreatedAt)
+		}
+		return leaks[i].TerminalID < leaks[j].TerminalID
+	})
+	return leaks
+}
+
+// interceptCancel kills the terminals of the current prompt turn when a
+// session/cancel notification arrives.
+func (stm *SessionTerminalManager) interceptCancel(
+	ctx context.Context,
+	req *jsonrpc2.Request,
+	next dispatchFunc,
+) (interface{}, error) {
+	if !req.IsCall() && req.Method == api.MethodSessionCancel && stm.killOnCancel.Load() {
+		var params api.CancelNotification
+		if err := json.Unmarshal(req.Params, &params); err == nil {
+			if manager, exists := stm.managers.Load(params.SessionId); exists {
+				// Killing calls the client, which must not hold up message handling.
+				go func() { _ = manager.killTurnTerminals(context.WithoutCancel(ctx)) }()
+			}
+		}
+	}
+	return next(ctx, req)
+}
+
+// promptTurnChanged starts a new set of turn terminals when a session's
+// prompt turn begins. The tracker is re-read rather than trusting the
+// reported state, so that concurrent notifications converge on the latest
+// state.
+func (stm *SessionTerminalManager) promptTurnChanged(id api.SessionId, _ PromptTurnState) {
+	if manager, exists := stm.managers.Load(id); exists {
+		manager.setTurnActive(stm.conn.PromptTurnState(id).Active)
+	}
+}
+
+// releaseOnClose releases all terminals when the connection closes.
+func (stm *SessionTerminalManager) releaseOnClose() {
+	_ = stm.ReleaseAll(context.Background())
+}
+
+// addTurnTerminal records a terminal created during the current prompt turn.
+func (tm *TerminalManager) addTurnTerminal(handle *TerminalHandle) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if !tm.turnActive {
+		tm.turnActive = true
+		tm.turnTerminals = nil
+	}
+	tm.turnTerminals = append(tm.turnTerminals, handle)
+}
+
+// setTurnActive records whether the session has a prompt turn in progress.
+// Terminals of the previous turn are forgotten when a new turn begins; they
+// are kept after a turn ends so that a late session/cancel still kills them.
+func (tm *TerminalManager) setTurnActive(active bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if active && !tm.turnActive {
+		tm.turnTerminals = nil
+	}
+	tm.turnActive = active
+}
+
+// killTurnTerminals kills the terminals created during the current prompt
+// turn that have not been released.
+func (tm *TerminalManager) killTurnTerminals(ctx context.Context) error {
+	tm.mu.Lock()
+	handles := tm.turnTerminals
+	tm.turnTerminals = nil
+	tm.mu.Unlock()
+
+	var errs []error
+	for _, handle := range handles {
+		if handle.IsReleased() {
+			continue
+		}
+		if err := handle.Kill(ctx); err != nil && !handle.IsReleased() {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,176 @@
+package acp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lifecyclePair is a connection pair whose agent tracks terminals with a
+// SessionTerminalManager and whose client runs them with a TerminalHost.
+type lifecyclePair struct {
+	agentConn  *AgentConnection
+	clientConn *ClientConnection
+	host       *TerminalHost
+	terminals  *SessionTerminalManager
+
+	// Terminals created by prompt turns
+	created chan *TerminalHandle
+}
+
+// newLifecyclePair creates a lifecycle pair. Each prompt turn starts a
+// long-running terminal and waits to be cancelled.
+func newLifecyclePair(t *testing.T) *lifecyclePair {
+	t.Helper()
+	pair := &lifecyclePair{host: NewTerminalHost(), created: make(chan *TerminalHandle, 1)}
+	t.Cleanup(func() { _ = pair.host.Close() })
+
+	clientHandler := NewClientHandlerRegistry()
+	pair.host.Register(clientHandler)
+	agentHandler := NewAgentHandlerRegistry()
+	agentHandler.RegisterPromptTurnHandler(func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+		handle, err := pair.terminals.GetManager(turn.SessionID()).CreateTerminal(turn.Context(), shell("sleep 30"))
+		if err != nil {
+			return "", err
+		}
+		pair.created <- handle
+		<-turn.Context().Done()
+		return api.StopReasonCancelled, nil
+	})
+	pair.agentConn, pair.clientConn = NewRolePair(t, agentHandler, clientHandler)
+	pair.terminals = NewSessionTerminalManager(pair.agentConn).BindConnection()
+	return pair
+}
+
+// startTurn sends a prompt and returns the terminal its turn created.
+func (p *lifecyclePair) startTurn(t *testing.T) *TerminalHandle {
+	t.Helper()
+	go func() { _, _ = p.clientConn.SessionPrompt(context.Background(), SamplePromptRequest("s1")) }()
+	select {
+	case handle := <-p.created:
+		return handle
+	case <-time.After(5 * time.Second):
+		t.Fatal("prompt turn did not create a terminal")
+		return nil
+	}
+}
+
+// exited reports whether a terminal's command has exited.
+func exited(t *testing.T, handle *TerminalHandle) bool {
+	t.Helper()
+	output, err := handle.CurrentOutput(context.Background())
+	require.NoError(t, err)
+	return output.ExitStatus != nil
+}
+
+func TestSessionTerminalLifecycle(t *testing.T) {
+	ctx := context.Background()
+	cancel := &api.CancelNotification{SessionId: "s1"}
+
+	t.Run("KillsTurnTerminalsOnCancel", func(t *testing.T) {
+		pair := newLifecyclePair(t)
+		background, err := pair.terminals.GetManager("s1").CreateTerminal(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+		turnTerminal := pair.startTurn(t)
+
+		require.NoError(t, pair.clientConn.SessionCancel(ctx, cancel))
+		WaitWithTimeout(t, 5*time.Second, func() bool { return exited(t, turnTerminal) }, "turn terminal not killed")
+
+		// Killed terminals stay available until released.
+		output, err := turnTerminal.CurrentOutput(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, output.ExitStatus.Signal)
+		assert.Equal(t, "SIGKILL", *output.ExitStatus.Signal)
+		assert.False(t, exited(t, background))
+		assert.Equal(t, 2, pair.host.Count())
+	})
+
+	t.Run("KillOnCancelDisabled", func(t *testing.T) {
+		pair := newLifecyclePair(t)
+		pair.terminals.WithKillOnCancel(false)
+		turnTerminal := pair.startTurn(t)
+
+		require.NoError(t, pair.clientConn.SessionCancel(ctx, cancel))
+		WaitWithTimeout(t, 5*time.Second, func() bool {
+			return !pair.agentConn.PromptTurnState("s1").Active
+		}, "turn not cancelled")
+		assert.False(t, exited(t, turnTerminal))
+	})
+
+	t.Run("ReleasesOnSessionDelete", func(t *testing.T) {
+		pair := newLifecyclePair(t)
+		manager := NewSessionManager()
+		pair.terminals.BindSessionManager(manager)
+		_, err := manager.CreateSession("s1")
+		require.NoError(t, err)
+		handle, err := pair.terminals.GetManager("s1").CreateTerminal(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+
+		require.NoError(t, manager.DeleteSession("s1"))
+		WaitWithTimeout(t, 5*time.Second, func() bool { return pair.host.Count() == 0 }, "terminal not released")
+		assert.True(t, handle.IsReleased())
+		assert.Empty(t, pair.terminals.ActiveSessions())
+	})
+
+	t.Run("ReleasesOnReap", func(t *testing.T) {
+		pair := newLifecyclePair(t)
+		manager := NewSessionManager()
+		pair.terminals.BindSessionManager(manager)
+		_, err := manager.CreateSession("s1")
+		require.NoError(t, err)
+		_, err = pair.terminals.GetManager("s1").CreateTerminal(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+
+		clock := newFakeClock(time.Now().Add(time.Hour))
+		_, err = NewSessionReaper(manager, time.Minute, time.Minute).WithClock(clock).ReapNow(ctx)
+		require.NoError(t, err)
+		WaitWithTimeout(t, 5*time.Second, func() bool { return pair.host.Count() == 0 }, "terminal not released")
+	})
+
+	t.Run("ReleasesOnClose", func(t *testing.T) {
+		pair := newLifecyclePair(t)
+		handle, err := pair.terminals.GetManager("s1").CreateTerminal(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+
+		require.NoError(t, pair.agentConn.Close())
+		assert.True(t, handle.IsReleased())
+		assert.Empty(t, pair.terminals.ActiveSessions())
+		assert.Empty(t, pair.terminals.LeakReport())
+	})
+
+	t.Run("UnboundKeepsTerminals", func(t *testing.T) {
+		pair := newLifecyclePair(t)
+		unbound := NewSessionTerminalManager(pair.agentConn)
+		handle, err := unbound.GetManager("s1").CreateTerminal(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+
+		pair.terminals.BindConnection() // no-op once bound
+		require.NoError(t, pair.agentConn.Close())
+		assert.False(t, handle.IsReleased())
+		assert.Len(t, unbound.LeakReport(), 1)
+	})
+
+	t.Run("LeakReport", func(t *testing.T) {
+		pair := newLifecyclePair(t)
+		manager := pair.terminals.GetManager("s1")
+		released, err := manager.CreateTerminal(ctx, shell("true"))
+		require.NoError(t, err)
+		leaked, err := manager.CreateTerminal(ctx, shell("sleep 30"))
+		require.NoError(t, err)
+		require.NoError(t, released.Release(ctx))
+
+		leaks := pair.terminals.LeakReport()
+		require.Len(t, leaks, 1)
+		assert.Equal(t, api.SessionId("s1"), leaks[0].SessionID)
+		assert.Equal(t, leaked.ID, leaks[0].TerminalID)
+		assert.Equal(t, "sh -c sleep 30", leaks[0].Command)
+		assert.False(t, leaks[0].CreatedAt.IsZero())
+
+		require.NoError(t, pair.terminals.ReleaseAll(ctx))
+		assert.Empty(t, pair.terminals.LeakReport())
+	})
+}
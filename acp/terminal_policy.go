@@ -0,0 +1,292 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+)
+
+// CommandPattern matches a command line by prefix. The first element matches
+// the command and the following elements match the first arguments. Elements
+// are glob patterns in which "*" matches any text and "?" any character, so
+// {"rm", "-r*"} matches "rm -rf build".
+//
+// A command element without a path separator matches commands run by name. It
+// matches a command given as a path only if that path is the executable found
+// for its base name in PATH, so "git" matches "/usr/bin/git" but not
+// "/tmp/git". A command element with a path separator matches the command's
+// path, or the path PATH lookup resolves a command name to.
+//
+// Patterns only see the command line, so deny lists are easy to bypass: a
+// denied command can still run through "sh -c", "env", a copy of the binary
+// or any other program that runs commands. Prefer allow lists, which fail
+// closed.
+type CommandPattern []string
+
+// ParseCommandPattern splits a pattern such as "go test *" at spaces.
+func ParseCommandPattern(pattern string) CommandPattern {
+	return strings.Fields(pattern)
+}
+
+// Matches reports whether a command line starts with the pattern.
+func (p CommandPattern) Matches(command string, args []string) bool {
+	if len(p) == 0 || len(p) > len(args)+1 {
+		return false
+	}
+	if !matchCommand(p[0], command) {
+		return false
+	}
+	for i, pattern := range p[1:] {
+		if !matchGlob(pattern, args[i], false) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the pattern in the form accepted by ParseCommandPattern.
+func (p CommandPattern) String() string {
+	return strings.Join(p, " ")
+}
+
+// matchCommand matches the command element of a pattern against a command.
+func matchCommand(pattern, command string) bool {
+	if !hasPathSeparator(pattern) && !hasPathSeparator(command) {
+		return matchGlob(pattern, command, false)
+	}
+
+	resolved, found := resolveCommand(command)
+	if hasPathSeparator(pattern) {
+		return matchGlob(pattern, command, false) || found && matchGlob(pattern, resolved, false)
+	}
+	if !found || !matchGlob(pattern, filepath.Base(command), false) {
+		return false
+	}
+	onPath, found := resolveCommand(filepath.Base(command))
+	return found && onPath == resolved
+}
+
+// resolveCommand returns the absolute path of the executable a command runs,
+// looking names up in PATH and resolving symbolic links.
+func resolveCommand(command string) (string, bool) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return "", false
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return "", false
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// hasPathSeparator reports whether a command or pattern is a path.
+func hasPathSeparator(command string) bool {
+	return strings.ContainsRune(command, '/') || strings.ContainsRune(command, filepath.Separator)
+}
+
+// TerminalPolicy restricts the commands a TerminalHost runs.
+//
+// Commands matching a Deny pattern are always rejected. When Allow is set,
+// other commands must match one of its patterns. Commands that are not
+// allowed are escalated to the Prompter if there is one, and rejected
+// otherwise. Rejections are forbidden errors whose data holds the command
+// and the reason. See CommandPattern for why deny lists alone are not a
+// sandbox.
+//
+// The working directory must lie inside one of the Roots, or inside the
+// session's Cwd when Roots is empty; commands without a working directory
+// run in the first root.
+type TerminalPolicy struct {
+	// Allow lists the commands that may run without asking.
+	Allow []CommandPattern
+	// Deny lists the commands that may never run.
+	Deny []CommandPattern
+	// Prompter, if set, asks the user about commands that are not allowed.
+	Prompter Prompter
+
+	// Roots are the directories commands may run in.
+	Roots []string
+
+	// EnvAllow, if set, lists the only environment variables passed to
+	// commands, as glob patterns over variable names. It applies to the
+	// host's environment and the variables in the request alike.
+	EnvAllow []string
+	// EnvDeny lists environment variables removed before commands run, such
+	// as "*_TOKEN" or "AWS_*".
+	EnvDeny []string
+
+	// Timeout kills commands that run longer. Zero means no limit.
+	Timeout time.Duration
+	// MaxCPUTime limits the CPU time of commands. Zero means no limit.
+	MaxCPUTime time.Duration
+	// MaxMemoryBytes limits the address space of commands. Zero means no
+	// limit.
+	MaxMemoryBytes uint64
+}
+
+// apply checks a terminal/create request against the policy and adjusts the
+// command to be started.
+func (p *TerminalPolicy) apply(
+	ctx context.Context,
+	params *api.CreateTerminalRequest,
+	sessionCwd string,
+	cmd *exec.Cmd,
+) error {
+	if err := p.authorize(ctx, params); err != nil {
+		return err
+	}
+
+	dir, err := p.confine(params, cmd.Dir, sessionCwd)
+	if err != nil {
+		return err
+	}
+	cmd.Dir = dir
+	cmd.Env = p.filterEnv(cmd.Env)
+
+	if p.MaxCPUTime > 0 || p.MaxMemoryBytes > 0 {
+		if err = limitTerminalResources(cmd, p.MaxCPUTime, p.MaxMemoryBytes); err != nil {
+			return WrapError(err, api.ErrorCodeInternalServerError, "failed to apply resource limits")
+		}
+	}
+	return nil
+}
+
+// authorize checks the command against the allow and deny lists, asking the
+// Prompter about commands that are not allowed.
+func (p *TerminalPolicy) authorize(ctx context.Context, params *api.CreateTerminalRequest) error {
+	for _, pattern := range p.Deny {
+		if pattern.Matches(params.Command, params.Args) {
+			return newTerminalDeniedError(params, fmt.Sprintf("matches deny pattern %q", pattern))
+		}
+	}
+
+	if len(p.Allow) == 0 && p.Prompter == nil {
+		return nil
+	}
+	for _, pattern := range p.Allow {
+		if pattern.Matches(params.Command, params.Args) {
+			return nil
+		}
+	}
+	if p.Prompter == nil {
+		return newTerminalDeniedError(params, "not on the allow list")
+	}
+
+	request := &api.RequestPermissionRequest{
+		SessionId: params.SessionId,
+		ToolCall: api.ToolCallUpdate{
+			Kind:     api.ToolKindExecute,
+			Title:    StringPtr("Run " + commandLine(params)),
+			RawInput: params,
+		},
+		Options: OncePermissionOptions(),
+	}
+	option, err := p.Prompter.PromptPermission(ctx, request)
+	if err != nil {
+		return newTerminalDeniedError(params, fmt.Sprintf("permission request failed: %v", err))
+	}
+	if option == nil || option.Kind != api.PermissionOptionKindAllowOnce {
+		return newTerminalDeniedError(params, "rejected by the user")
+	}
+	return nil
+}
+
+// confine checks that the working directory is inside the allowed roots.
+func (p *TerminalPolicy) confine(params *api.CreateTerminalRequest, dir, sessionCwd string) (string, error) {
+	var roots []string
+	for _, root := range p.Roots {
+		resolved, err := resolveRoot(root)
+		if err != nil {
+			return "", WrapError(err, api.ErrorCodeInternalServerError, "invalid terminal root")
+		}
+		roots = append(roots, resolved)
+	}
+	if len(roots) == 0 && sessionCwd != "" {
+		resolved, err := resolveRoot(sessionCwd)
+		if err != nil {
+			return "", newTerminalDeniedError(params, fmt.Sprintf("invalid session directory: %v", err))
+		}
+		roots = []string{resolved}
+	}
+	if len(roots) == 0 {
+		return "", newTerminalDeniedError(params, "no allowed roots for the session")
+	}
+
+	if dir == "" {
+		return roots[0], nil
+	}
+	if !filepath.IsAbs(dir) {
+		return "", NewValidationError("cwd", "must be absolute")
+	}
+	resolved, err := resolvePath(filepath.Clean(dir))
+	if err != nil {
+		return "", newTerminalDeniedError(params, fmt.Sprintf("invalid working directory: %v", err))
+	}
+	for _, root := range roots {
+		if pathWithin(root, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", newTerminalDeniedError(params, fmt.Sprintf("working directory %q is outside the allowed roots", dir))
+}
+
+// filterEnv applies EnvAllow and EnvDeny to an environment.
+func (p *TerminalPolicy) filterEnv(env []string) []string {
+	if len(p.EnvAllow) == 0 && len(p.EnvDeny) == 0 {
+		return env
+	}
+
+	filtered := make([]string, 0, len(env))
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		if len(p.EnvAllow) > 0 && !matchAnyGlob(p.EnvAllow, name) {
+			continue
+		}
+		if matchAnyGlob(p.EnvDeny, name) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
+
+// NewTerminalHostWithPolicy creates a terminal host that applies a policy to
+// every terminal/create request before starting the command.
+func NewTerminalHostWithPolicy(policy *TerminalPolicy) *TerminalHost {
+	host := NewTerminalHost()
+	host.policy = policy
+	return host
+}
+
+// newTerminalDeniedError creates the forbidden error for a rejected command.
+func newTerminalDeniedError(params *api.CreateTerminalRequest, reason string) *api.ACPError {
+	command := commandLine(params)
+	data := map[string]interface{}{
+		"command": command,
+		"reason":  reason,
+	}
+	return api.NewACPError(api.ErrorCodeForbidden, fmt.Sprintf("command %q denied: %s", command, reason), data)
+}
+
+// commandLine formats a command and its arguments for display.
+func commandLine(params *api.CreateTerminalRequest) string {
+	return strings.Join(append([]string{params.Command}, params.Args...), " ")
+}
+
+// matchAnyGlob reports whether name matches any of the patterns.
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name, false) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package acp
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		command string
+		args    []string
+		matches bool
+	}{
+		{pattern: "git", command: "git", args: []string{"status"}, matches: true},
+		{pattern: "git status", command: "git", args: []string{"status", "-s"}, matches: true},
+		{pattern: "git status", command: "git", args: []string{"push"}, matches: false},
+		{pattern: "git status", command: "git", matches: false},
+		{pattern: "rm -r*", command: "rm", args: []string{"-rf", "build"}, matches: true},
+		{pattern: "rm -r*", command: "rm", args: []string{"file"}, matches: false},
+		{pattern: "/usr/bin/*", command: "/usr/bin/env", matches: true},
+		{pattern: "py*", command: "python3", args: []string{"x.py"}, matches: true},
+		{pattern: "", command: "ls", matches: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.command, func(t *testing.T) {
+			assert.Equal(t, tt.matches, ParseCommandPattern(tt.pattern).Matches(tt.command, tt.args))
+		})
+	}
+
+	t.Run("Paths", func(t *testing.T) {
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		require.NoError(t, err)
+		bin, other := filepath.Join(dir, "bin"), filepath.Join(dir, "other")
+		for _, path := range []string{bin, other} {
+			require.NoError(t, os.Mkdir(path, 0o750))
+			//nolint:gosec // The test command must be executable.
+			require.NoError(t, os.WriteFile(filepath.Join(path, "tool"), []byte("#!/bin/sh\n"), 0o700))
+		}
+		t.Setenv("PATH", bin)
+
+		tool := CommandPattern{"tool"}
+		assert.True(t, tool.Matches(filepath.Join(bin, "tool"), nil))
+		assert.True(t, tool.Matches(filepath.Join(bin, ".", "tool"), nil))
+		assert.False(t, tool.Matches(filepath.Join(other, "tool"), nil))
+		assert.False(t, tool.Matches(filepath.Join(other, "missing"), nil))
+
+		assert.True(t, CommandPattern{bin + "/*"}.Matches("tool", nil))
+		assert.False(t, CommandPattern{other + "/*"}.Matches("tool", nil))
+		assert.True(t, CommandPattern{other + "/*"}.Matches(filepath.Join(other, "tool"), nil))
+	})
+}
+
+// runPolicyCommand starts a command on a host with a policy, waits for it and
+// returns its output.
+func runPolicyCommand(
+	t *testing.T,
+	policy *TerminalPolicy,
+	params *api.CreateTerminalRequest,
+) (*api.TerminalOutputResponse, error) {
+	t.Helper()
+	ctx := context.Background()
+	host := NewTerminalHostWithPolicy(policy)
+	t.Cleanup(func() { _ = host.Close() })
+
+	created, err := host.HandleCreate(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	_, err = host.HandleWaitForExit(ctx, &api.WaitForTerminalExitRequest{
+		SessionId:  params.SessionId,
+		TerminalId: created.TerminalId,
+	})
+	require.NoError(t, err)
+	return host.HandleOutput(ctx, &api.TerminalOutputRequest{
+		SessionId:  params.SessionId,
+		TerminalId: created.TerminalId,
+	})
+}
+
+// assertDenied checks that a command was rejected with the given reason.
+func assertDenied(t *testing.T, err error, reason string) {
+	t.Helper()
+	AssertACPError(t, err, api.ErrorCodeForbidden)
+	acpErr, _ := AsACPError(err)
+	data, ok := acpErr.Data.(map[string]interface{})
+	require.True(t, ok)
+	assert.Contains(t, data["reason"], reason)
+}
+
+func TestTerminalPolicy(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	t.Run("AllowAndDenyLists", func(t *testing.T) {
+		policy := &TerminalPolicy{
+			Roots: []string{root},
+			Allow: []CommandPattern{ParseCommandPattern("echo"), ParseCommandPattern("sh -c")},
+			Deny:  []CommandPattern{ParseCommandPattern("echo secret*")},
+		}
+
+		output, err := runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "echo", Args: []string{"hi"}})
+		require.NoError(t, err)
+		assert.Equal(t, "hi\n", output.Output)
+
+		_, err = runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "echo", Args: []string{"secrets"}})
+		assertDenied(t, err, "deny pattern")
+
+		_, err = runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "ls"})
+		assertDenied(t, err, "not on the allow list")
+	})
+
+	t.Run("EscalatesToPrompter", func(t *testing.T) {
+		prompter := &scriptedPrompter{
+			answers: []api.PermissionOptionId{PermissionOptionAllowOnce, PermissionOptionRejectOnce},
+		}
+		policy := &TerminalPolicy{
+			Roots:    []string{root},
+			Allow:    []CommandPattern{ParseCommandPattern("true")},
+			Prompter: prompter,
+		}
+
+		_, err := runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "true"})
+		require.NoError(t, err)
+		assert.Equal(t, 0, prompter.asked)
+
+		_, err = runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "echo", Args: []string{"asked"}})
+		require.NoError(t, err)
+		_, err = runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "echo", Args: []string{"again"}})
+		assertDenied(t, err, "rejected by the user")
+		assert.Equal(t, 2, prompter.asked)
+	})
+
+	t.Run("ConfinesCwd", func(t *testing.T) {
+		sub := filepath.Join(root, "sub")
+		require.NoError(t, exec.Command("mkdir", sub).Run())
+		policy := &TerminalPolicy{Roots: []string{root}}
+
+		output, err := runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "pwd"})
+		require.NoError(t, err)
+		assert.Equal(t, root+"\n", output.Output)
+
+		output, err = runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "pwd", Cwd: &sub})
+		require.NoError(t, err)
+		assert.Equal(t, sub+"\n", output.Output)
+
+		escape := filepath.Join(root, "..")
+		_, err = runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "pwd", Cwd: &escape})
+		assertDenied(t, err, "outside the allowed roots")
+
+		_, err = runPolicyCommand(t, &TerminalPolicy{}, &api.CreateTerminalRequest{Command: "pwd"})
+		assertDenied(t, err, "no allowed roots")
+	})
+
+	t.Run("FiltersEnv", func(t *testing.T) {
+		t.Setenv("ACP_TEST_TOKEN", "host-secret")
+		params := &api.CreateTerminalRequest{
+			Command: "env",
+			Env: []api.EnvVariable{
+				{Name: "ACP_TEST_KEEP", Value: "kept"},
+				{Name: "ACP_TEST_API_TOKEN", Value: "request-secret"},
+			},
+		}
+
+		output, err := runPolicyCommand(t, &TerminalPolicy{Roots: []string{root}, EnvDeny: []string{"*TOKEN"}}, params)
+		require.NoError(t, err)
+		assert.Contains(t, output.Output, "ACP_TEST_KEEP=kept")
+		assert.NotContains(t, output.Output, "secret")
+		assert.Contains(t, output.Output, "PATH=")
+
+		output, err = runPolicyCommand(t, &TerminalPolicy{Roots: []string{root}, EnvAllow: []string{"ACP_TEST_*"}}, params)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{
+			"ACP_TEST_TOKEN=host-secret",
+			"ACP_TEST_KEEP=kept",
+			"ACP_TEST_API_TOKEN=request-secret",
+		}, strings.Fields(output.Output))
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		policy := &TerminalPolicy{Roots: []string{root}, Timeout: 100 * time.Millisecond}
+		start := time.Now()
+		output, err := runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "sleep", Args: []string{"30"}})
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), 10*time.Second)
+		require.NotNil(t, output.ExitStatus)
+		require.NotNil(t, output.ExitStatus.Signal)
+		assert.Equal(t, "SIGKILL", *output.ExitStatus.Signal)
+	})
+
+	t.Run("CPULimit", func(t *testing.T) {
+		policy := &TerminalPolicy{Roots: []string{root}, MaxCPUTime: time.Second}
+		output, err := runPolicyCommand(t, policy, &api.CreateTerminalRequest{
+			Command: "sh",
+			Args:    []string{"-c", "while :; do :; done"},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, output.ExitStatus)
+		require.NotNil(t, output.ExitStatus.Signal)
+		assert.Contains(t, []string{"SIGXCPU", "SIGKILL"}, *output.ExitStatus.Signal)
+	})
+
+	t.Run("MemoryLimit", func(t *testing.T) {
+		cmd := exec.Command("echo", "hi")
+		require.NoError(t, limitTerminalResources(cmd, 0, 64<<20))
+		assert.Equal(t, []string{"sh", "-c", `ulimit -v 65536 && exec "$0" "$@"`, cmd.Args[3], "hi"}, cmd.Args)
+
+		policy := &TerminalPolicy{Roots: []string{root}, MaxMemoryBytes: 256 << 20}
+		output, err := runPolicyCommand(t, policy, &api.CreateTerminalRequest{Command: "echo", Args: []string{"hi"}})
+		require.NoError(t, err)
+		assert.Equal(t, "hi\n", output.Output)
+	})
+}
@@ -214,19 +214,6 @@ func (c *TestClient) HandleTerminalWaitForExit(
 	}, nil
 }
 
-func NewPermissionCancelledOutcome() api.RequestPermissionResponseOutcome {
-	return map[string]interface{}{
-		"outcome": "cancelled",
-	}
-}
-
-func NewPermissionSelectedOutcome(optionID string) api.RequestPermissionResponseOutcome {
-	return map[string]interface{}{
-		"outcome":  "selected",
-		"optionId": optionID,
-	}
-}
-
 const (
 	StopReasonEndTurn         = "end_turn"
 	StopReasonMaxTokens       = "max_tokens"
@@ -0,0 +1,258 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+)
+
+// ErrToolCallClosed is returned when updating a tool call that already
+// completed or failed.
+var ErrToolCallClosed = errors.New("tool call is already completed or failed")
+
+// ToolCallHandle reports the progress of a tool call started with
+// TurnContext.StartToolCall.
+//
+// The handle tracks the state the client has been sent. Updates are only sent
+// if their status transition is allowed by CanTransition, and the local state
+// only changes once an update was sent successfully.
+type ToolCallHandle struct {
+	conn      *AgentConnection
+	sessionID api.SessionId
+	id        api.ToolCallId
+
+	// Turn that tracks the tool call while it is open, if any
+	turn *TurnContext
+
+	mu        sync.Mutex
+	title     string
+	status    api.ToolCallStatus
+	content   []api.ToolCallUpdateContentElem
+	locations []api.ToolCallLocation
+}
+
+// newToolCallHandle creates a handle for a tool call that was sent to the
+// client. turn is nil for tool calls reported outside a prompt turn.
+func newToolCallHandle(
+	conn *AgentConnection,
+	sessionID api.SessionId,
+	turn *TurnContext,
+	toolCall api.ToolCall,
+) *ToolCallHandle {
+	content := make([]api.ToolCallUpdateContentElem, len(toolCall.Content))
+	for i, elem := range toolCall.Content {
+		content[i] = elem
+	}
+	return &ToolCallHandle{
+		conn:      conn,
+		sessionID: sessionID,
+		id:        toolCall.ToolCallId,
+		turn:      turn,
+		title:     toolCall.Title,
+		status:    toolCall.Status,
+		content:   content,
+		locations: toolCall.Locations,
+	}
+}
+
+// ID returns the tool call's ID.
+func (h *ToolCallHandle) ID() api.ToolCallId {
+	return h.id
+}
+
+// Title returns the tool call's current title.
+func (h *ToolCallHandle) Title() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.title
+}
+
+// Status returns the tool call's current status.
+func (h *ToolCallHandle) Status() api.ToolCallStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// Content returns the tool call's current content.
+func (h *ToolCallHandle) Content() []api.ToolCallUpdateContentElem {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]api.ToolCallUpdateContentElem(nil), h.content...)
+}
+
+// Locations returns the tool call's current locations.
+func (h *ToolCallHandle) Locations() []api.ToolCallLocation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]api.ToolCallLocation(nil), h.locations...)
+}
+
+// Done reports whether the tool call completed or failed.
+func (h *ToolCallHandle) Done() bool {
+	return isTerminalToolCallStatus(h.Status())
+}
+
+// Update sends a tool call update and applies it to the handle's state. The
+// update's ToolCallId is set to the handle's ID.
+//
+// An update whose status is not a valid transition from the current status is
+// rejected without being sent. Once the tool call completed or failed, every
+// update returns ErrToolCallClosed.
+func (h *ToolCallHandle) Update(update api.ToolCallUpdate) error {
+	update.ToolCallId = h.id
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if isTerminalToolCallStatus(h.status) {
+		return ErrToolCallClosed
+	}
+
+	status := h.status
+	if update.Status != nil {
+		next, err := toolCallStatusValue(update.Status)
+		if err != nil {
+			return err
+		}
+		// Repeating the current status is allowed for content-only updates.
+		if next != h.status && !CanTransition(h.status, next) {
+			reason := fmt.Sprintf("invalid status transition from %s to %s", h.status, next)
+			return NewValidationError("status", reason)
+		}
+		status = next
+	}
+
+	if err := h.conn.SendToolCallUpdate(h.sendCtx(), h.sessionID, update); err != nil {
+		return err
+	}
+
+	h.status = status
+	if update.Title != nil {
+		h.title = *update.Title
+	}
+	if update.Content != nil {
+		h.content = update.Content
+	}
+	if update.Locations != nil {
+		h.locations = update.Locations
+	}
+	if isTerminalToolCallStatus(status) && h.turn != nil {
+		h.turn.removeToolCall(h)
+	}
+	return nil
+}
+
+// sendCtx returns the context used to send updates, which are still
+// delivered after the turn is cancelled.
+func (h *ToolCallHandle) sendCtx() context.Context {
+	if h.turn != nil {
+		return h.turn.sendCtx()
+	}
+	return context.Background()
+}
+
+// SetStatus sends a status update.
+func (h *ToolCallHandle) SetStatus(status api.ToolCallStatus) error {
+	return h.Update(NewToolCallUpdate(h.id).WithStatus(status).Build())
+}
+
+// Start marks the tool call in progress.
+func (h *ToolCallHandle) Start() error {
+	return h.SetStatus(api.ToolCallStatusInProgress)
+}
+
+// SetContent replaces the tool call's content.
+func (h *ToolCallHandle) SetContent(content ...api.ToolCallUpdateContentElem) error {
+	return h.Update(NewToolCallUpdate(h.id).WithContent(content).Build())
+}
+
+// AppendContent adds content after the tool call's current content. The
+// protocol replaces content collections, so the full content is sent.
+func (h *ToolCallHandle) AppendContent(content ...api.ToolCallUpdateContentElem) error {
+	return h.SetContent(append(h.Content(), content...)...)
+}
+
+// SetLocations replaces the tool call's locations.
+func (h *ToolCallHandle) SetLocations(locations ...api.ToolCallLocation) error {
+	return h.Update(NewToolCallUpdate(h.id).WithLocations(locations).Build())
+}
+
+// Complete marks the tool call completed, optionally replacing its content.
+func (h *ToolCallHandle) Complete(content ...api.ToolCallUpdateContentElem) error {
+	return h.finish(api.ToolCallStatusCompleted, content)
+}
+
+// Fail marks the tool call failed, optionally replacing its content.
+func (h *ToolCallHandle) Fail(content ...api.ToolCallUpdateContentElem) error {
+	return h.finish(api.ToolCallStatusFailed, content)
+}
+
+// finish sends a final status with optional content.
+func (h *ToolCallHandle) finish(status api.ToolCallStatus, content []api.ToolCallUpdateContentElem) error {
+	builder := NewToolCallUpdate(h.id).WithStatus(status)
+	if len(content) > 0 {
+		builder.WithContent(content)
+	}
+	return h.Update(builder.Build())
+}
+
+// OpenToolCalls returns the tool calls of the session's active prompt turn
+// that have not yet completed or failed. It returns nil if the session has no
+// active turn handled by a PromptTurnHandler.
+func (a *AgentConnection) OpenToolCalls(sessionID api.SessionId) []*ToolCallHandle {
+	turn, exists := a.turnContexts.Load(sessionID)
+	if !exists {
+		return nil
+	}
+	return turn.OpenToolCalls()
+}
+
+// startToolCall reports a new tool call and returns a handle for it. The tool
+// call is tracked by the session's running prompt turn, if any, so that it is
+// listed by OpenToolCalls and failed if the turn ends while it is open.
+func (a *AgentConnection) startToolCall(
+	ctx context.Context,
+	sessionID api.SessionId,
+	toolCall api.ToolCall,
+) (*ToolCallHandle, error) {
+	if turn, exists := a.turnContexts.Load(sessionID); exists {
+		return turn.startToolCall(toolCall)
+	}
+	if err := a.SendNewToolCall(ctx, sessionID, toolCall); err != nil {
+		return nil, err
+	}
+	return newToolCallHandle(a, sessionID, nil, toolCall), nil
+}
+
+// newToolCallID returns a tool call ID that is unique on the connection.
+func (a *AgentConnection) newToolCallID() api.ToolCallId {
+	return api.ToolCallId(fmt.Sprintf("call_%d", a.ids.Add(1)))
+}
+
+// isTerminalToolCallStatus reports whether no further transitions are allowed
+// from status.
+func isTerminalToolCallStatus(status api.ToolCallStatus) bool {
+	return status == api.ToolCallStatusCompleted || status == api.ToolCallStatusFailed
+}
+
+// toolCallStatusValue converts the status of a tool call update, which may be
+// an api.ToolCallStatus or its string form.
+func toolCallStatusValue(status interface{}) (api.ToolCallStatus, error) {
+	var value api.ToolCallStatus
+	switch s := status.(type) {
+	case api.ToolCallStatus:
+		value = s
+	case string:
+		value = api.ToolCallStatus(s)
+	default:
+		return "", NewValidationError("status", fmt.Sprintf("unsupported status type %T", status))
+	}
+	if !value.IsValid() {
+		return "", NewValidationError("status", fmt.Sprintf("unknown status %q", value))
+	}
+	return value, nil
+}
@@ -0,0 +1,147 @@
+package acp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toolCallUpdates returns the tool call updates of a streamed turn.
+func toolCallUpdates(events []PromptEvent) []*api.SessionUpdateToolCallUpdate {
+	var updates []*api.SessionUpdateToolCallUpdate
+	for _, event := range events {
+		if event.Update != nil && event.Update.ToolCallUpdate != nil {
+			updates = append(updates, event.Update.ToolCallUpdate)
+		}
+	}
+	return updates
+}
+
+func TestToolCallHandle(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("TracksState", func(t *testing.T) {
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			call, err := turn.StartToolCall("Read main.go", api.ToolKindRead)
+			require.NoError(t, err)
+			assert.Equal(t, api.ToolCallStatusPending, call.Status())
+			assert.Equal(t, "Read main.go", call.Title())
+
+			require.NoError(t, call.Start())
+			require.NoError(t, call.SetLocations(CreateLocationSimple("main.go")))
+			require.NoError(t, call.AppendContent(api.NewToolCallContentContent(textChunk("first"))))
+			require.NoError(t, call.AppendContent(api.NewToolCallContentContent(textChunk("second"))))
+			assert.Equal(t, api.ToolCallStatusInProgress, call.Status())
+			assert.Len(t, call.Locations(), 1)
+			assert.Len(t, call.Content(), 2)
+			assert.False(t, call.Done())
+
+			require.NoError(t, call.Complete())
+			assert.True(t, call.Done())
+			assert.ErrorIs(t, call.SetContent(api.NewToolCallContentContent(textChunk("late"))), ErrToolCallClosed)
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		updates := toolCallUpdates(streamEvents(ctx, clientConn, "s1"))
+		require.Len(t, updates, 5)
+		// Appending resends the full content collection.
+		assert.Len(t, updates[3].Content, 2)
+		assert.Equal(t, string(api.ToolCallStatusCompleted), updates[4].Status)
+	})
+
+	t.Run("RejectsInvalidTransitions", func(t *testing.T) {
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			call, err := turn.StartToolCall("Run", api.ToolKindExecute)
+			require.NoError(t, err)
+			require.NoError(t, call.Start())
+
+			err = call.SetStatus(api.ToolCallStatusPending)
+			AssertACPError(t, err, api.CodeInvalidParams)
+			assert.Equal(t, api.ToolCallStatusInProgress, call.Status())
+
+			err = call.Update(api.ToolCallUpdate{Status: "bogus"})
+			AssertACPError(t, err, api.CodeInvalidParams)
+
+			// Repeating the current status is allowed.
+			require.NoError(t, call.SetStatus(api.ToolCallStatusInProgress))
+			require.NoError(t, call.Fail())
+			assert.ErrorIs(t, call.Complete(), ErrToolCallClosed)
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		updates := toolCallUpdates(streamEvents(ctx, clientConn, "s1"))
+		require.Len(t, updates, 3)
+		assert.Equal(t, string(api.ToolCallStatusFailed), updates[2].Status)
+	})
+
+	t.Run("OpenToolCalls", func(t *testing.T) {
+		clientConn := newTurnPair(t, func(turn *TurnContext, params *api.PromptRequest) (api.StopReason, error) {
+			first, err := turn.StartToolCall("First", api.ToolKindRead)
+			require.NoError(t, err)
+			second, err := turn.StartToolCall("Second", api.ToolKindRead)
+			require.NoError(t, err)
+
+			assert.Equal(t, []*ToolCallHandle{first, second}, turn.Connection().OpenToolCalls(params.SessionId))
+			assert.Empty(t, turn.Connection().OpenToolCalls("other"))
+
+			require.NoError(t, first.Complete())
+			assert.Equal(t, []*ToolCallHandle{second}, turn.OpenToolCalls())
+			require.NoError(t, second.Complete())
+			assert.Empty(t, turn.OpenToolCalls())
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		events := streamEvents(ctx, clientConn, "s1")
+		require.NoError(t, events[len(events)-1].Err)
+	})
+
+	t.Run("CancelFailsOpenCalls", func(t *testing.T) {
+		started := make(chan struct{})
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			call, err := turn.StartToolCall("Long task", api.ToolKindExecute)
+			require.NoError(t, err)
+			require.NoError(t, call.Start())
+			close(started)
+
+			<-turn.Context().Done()
+			return "", turn.Context().Err()
+		}, NewClientHandlerRegistry())
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		events := streamEvents(streamCtx, clientConn, "s1")
+		updates := toolCallUpdates(events)
+		require.Len(t, updates, 2)
+		assert.Equal(t, string(api.ToolCallStatusFailed), updates[1].Status)
+		assert.Equal(t, api.StopReasonCancelled, events[len(events)-1].StopReason)
+	})
+
+	t.Run("PanicFailsOpenCalls", func(t *testing.T) {
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			done, err := turn.StartToolCall("Done", api.ToolKindRead)
+			require.NoError(t, err)
+			require.NoError(t, done.Complete())
+			_, err = turn.StartToolCall("Crash", api.ToolKindExecute)
+			require.NoError(t, err)
+			panic("tool crashed")
+		}, NewClientHandlerRegistry())
+
+		events := streamEvents(ctx, clientConn, "s1")
+		updates := toolCallUpdates(events)
+		require.Len(t, updates, 2)
+		assert.Equal(t, api.ToolCallId("call_2"), *updates[1].Toolcallid)
+		assert.Equal(t, string(api.ToolCallStatusFailed), updates[1].Status)
+
+		final := events[len(events)-1]
+		require.Error(t, final.Err)
+		assert.Contains(t, final.Err.Error(), "tool crashed")
+	})
+}
@@ -0,0 +1,488 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+)
+
+// Errors for session update decoding.
+var (
+	ErrUnsupportedSessionUpdate = errors.New("unsupported session update type")
+)
+
+// DecodeSessionUpdate converts the untyped Update of a session notification
+// into an api.SessionUpdate.
+//
+// Update types this library does not model return an error wrapping
+// ErrUnsupportedSessionUpdate so callers can skip them.
+func DecodeSessionUpdate(notification *api.SessionNotification) (*api.SessionUpdate, error) {
+	switch update := notification.Update.(type) {
+	case *api.SessionUpdate:
+		return update, nil
+	case api.SessionUpdate:
+		return &update, nil
+	}
+
+	data, err := json.Marshal(notification.Update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode session update: %w", err)
+	}
+
+	var discriminator struct {
+		Type api.SessionUpdateType `json:"sessionUpdate"`
+	}
+	if unmarshalErr := json.Unmarshal(data, &discriminator); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to decode session update: %w", unmarshalErr)
+	}
+	if !discriminator.Type.IsValid() {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedSessionUpdate, discriminator.Type)
+	}
+
+	var update api.SessionUpdate
+	if unmarshalErr := json.Unmarshal(data, &update); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to decode session update: %w", unmarshalErr)
+	}
+	return &update, nil
+}
+
+// TranscriptEntryKind identifies the kind of a transcript entry.
+type TranscriptEntryKind int
+
+const (
+	// TranscriptEntryUserMessage is a message from the user.
+	TranscriptEntryUserMessage TranscriptEntryKind = iota
+	// TranscriptEntryAgentMessage is a message from the agent.
+	TranscriptEntryAgentMessage
+	// TranscriptEntryAgentThought is the agent's internal reasoning.
+	TranscriptEntryAgentThought
+	// TranscriptEntryToolCall is a tool call. Its current state is available
+	// through Transcript.ToolCall.
+	TranscriptEntryToolCall
+)
+
+// String returns the string representation of the entry kind.
+func (k TranscriptEntryKind) String() string {
+	switch k {
+	case TranscriptEntryUserMessage:
+		return "user_message"
+	case TranscriptEntryAgentMessage:
+		return "agent_message"
+	case TranscriptEntryAgentThought:
+		return "agent_thought"
+	case TranscriptEntryToolCall:
+		return "tool_call"
+	default:
+		return "unknown"
+	}
+}
+
+// TranscriptEntry is a single ordered item of a transcript.
+type TranscriptEntry struct {
+	Kind TranscriptEntryKind
+	// Content holds the merged chunks of a message or thought.
+	Content []api.ContentBlock
+	// ToolCallID identifies the tool call for TranscriptEntryToolCall entries.
+	ToolCallID api.ToolCallId
+}
+
+// Text returns the text content of the entry.
+func (e TranscriptEntry) Text() string {
+	return ExtractText(e.Content)
+}
+
+// TranscriptToolCall is the current merged state of a tool call.
+type TranscriptToolCall struct {
+	api.ToolCall
+	// Cancelled is true if the turn was cancelled while the tool call was
+	// still pending or in progress.
+	Cancelled bool
+}
+
+// TranscriptChangeType identifies what changed in a transcript.
+type TranscriptChangeType int
+
+const (
+	// TranscriptChangeEntryAdded indicates a new entry was appended.
+	TranscriptChangeEntryAdded TranscriptChangeType = iota
+	// TranscriptChangeEntryUpdated indicates a chunk was merged into an existing entry.
+	TranscriptChangeEntryUpdated
+	// TranscriptChangeToolCallUpdated indicates a tool call's state changed.
+	TranscriptChangeToolCallUpdated
+	// TranscriptChangePlanReplaced indicates the plan was replaced.
+	TranscriptChangePlanReplaced
+	// TranscriptChangeTurnEnded indicates a prompt turn ended.
+	TranscriptChangeTurnEnded
+)
+
+// TranscriptChange describes a single change to a transcript.
+type TranscriptChange struct {
+	Type TranscriptChangeType
+	// EntryIndex is the index of the affected entry, or -1.
+	EntryIndex int
+	// ToolCallID is set for tool call changes.
+	ToolCallID api.ToolCallId
+	// StopReason is set for TranscriptChangeTurnEnded.
+	StopReason api.StopReason
+}
+
+// TranscriptChangeCallback is called after a transcript changes.
+type TranscriptChangeCallback func(change TranscriptChange)
+
+// Transcript aggregates the session/update notifications of one session into
+// a live conversation model.
+//
+// Message and thought chunks are concatenated into ordered entries, tool call
+// updates are merged into the tool call with the same ID, and each plan update
+// replaces the previous plan. A Transcript is safe for concurrent use.
+type Transcript struct {
+	sessionID api.SessionId
+
+	mu        sync.RWMutex
+	entries   []TranscriptEntry
+	toolCalls map[api.ToolCallId]*TranscriptToolCall
+	plan      *api.Plan
+
+	callbacks *util.CallbackRegistry[TranscriptChangeCallback]
+}
+
+// NewTranscript creates an empty transcript for a session.
+func NewTranscript(sessionID api.SessionId) *Transcript {
+	return &Transcript{
+		sessionID: sessionID,
+		toolCalls: make(map[api.ToolCallId]*TranscriptToolCall),
+		callbacks: util.NewCallbackRegistry[TranscriptChangeCallback](),
+	}
+}
+
+// SessionID returns the session this transcript belongs to.
+func (t *Transcript) SessionID() api.SessionId {
+	return t.sessionID
+}
+
+// OnChange registers a callback that is invoked after every change.
+// Callbacks run synchronously on the goroutine that applied the change.
+func (t *Transcript) OnChange(callback TranscriptChangeCallback) {
+	t.callbacks.Register(callback)
+}
+
+// HandleSessionUpdate applies a session/update notification. It has the
+// signature expected by HandlerRegistry.RegisterSessionUpdateHandler.
+//
+// Notifications for other sessions and unsupported update types are ignored.
+func (t *Transcript) HandleSessionUpdate(_ context.Context, notification *api.SessionNotification) error {
+	if notification.SessionId != t.sessionID {
+		return nil
+	}
+
+	update, err := DecodeSessionUpdate(notification)
+	if errors.Is(err, ErrUnsupportedSessionUpdate) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return t.Apply(update)
+}
+
+// Apply merges a single session update into the transcript.
+func (t *Transcript) Apply(update *api.SessionUpdate) error {
+	var changes []TranscriptChange
+	var err error
+
+	t.mu.Lock()
+	switch update.Type {
+	case api.SessionUpdateTypeUserMessageChunk:
+		if update.UserMessageChunk != nil {
+			changes = t.appendChunkLocked(TranscriptEntryUserMessage, update.UserMessageChunk.Content)
+		}
+	case api.SessionUpdateTypeAgentMessageChunk:
+		if update.AgentMessageChunk != nil {
+			changes = t.appendChunkLocked(TranscriptEntryAgentMessage, update.AgentMessageChunk.Content)
+		}
+	case api.SessionUpdateTypeAgentThoughtChunk:
+		if update.AgentThoughtChunk != nil {
+			changes = t.appendChunkLocked(TranscriptEntryAgentThought, update.AgentThoughtChunk.Content)
+		}
+	case api.SessionUpdateTypeToolCall:
+		changes, err = t.applyToolCallLocked(update.ToolCall)
+	case api.SessionUpdateTypeToolCallUpdate:
+		changes, err = t.applyToolCallUpdateLocked(update.ToolCallUpdate)
+	case api.SessionUpdateTypePlan:
+		changes, err = t.applyPlanLocked(update.Plan)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnsupportedSessionUpdate, update.Type)
+	}
+	t.mu.Unlock()
+
+	t.notify(changes)
+	return err
+}
+
+// AppendUserMessage records a prompt sent by the client. Prompts are not
+// echoed back as session updates, so clients call this before SessionPrompt.
+func (t *Transcript) AppendUserMessage(content []api.ContentBlock) {
+	t.mu.Lock()
+	// A new prompt always starts a new entry.
+	t.entries = append(t.entries, TranscriptEntry{
+		Kind:    TranscriptEntryUserMessage,
+		Content: append([]api.ContentBlock(nil), content...),
+	})
+	index := len(t.entries) - 1
+	t.mu.Unlock()
+
+	t.notify([]TranscriptChange{{Type: TranscriptChangeEntryAdded, EntryIndex: index}})
+}
+
+// EndTurn records the end of a prompt turn. When the turn was cancelled,
+// tool calls that are still pending or in progress are marked cancelled.
+func (t *Transcript) EndTurn(stopReason api.StopReason) {
+	var changes []TranscriptChange
+
+	t.mu.Lock()
+	if stopReason == api.StopReasonCancelled {
+		for _, entry := range t.entries {
+			if entry.Kind != TranscriptEntryToolCall {
+				continue
+			}
+			toolCall := t.toolCalls[entry.ToolCallID]
+			if toolCall.Cancelled || !isToolCallInFlight(toolCall.Status) {
+				continue
+			}
+			toolCall.Cancelled = true
+			changes = append(changes, TranscriptChange{
+				Type:       TranscriptChangeToolCallUpdated,
+				EntryIndex: t.toolCallIndexLocked(entry.ToolCallID),
+				ToolCallID: entry.ToolCallID,
+			})
+		}
+	}
+	t.mu.Unlock()
+
+	changes = append(changes, TranscriptChange{
+		Type:       TranscriptChangeTurnEnded,
+		EntryIndex: -1,
+		StopReason: stopReason,
+	})
+	t.notify(changes)
+}
+
+// Entries returns a snapshot of the transcript entries in order.
+func (t *Transcript) Entries() []TranscriptEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	entries := make([]TranscriptEntry, len(t.entries))
+	for i, entry := range t.entries {
+		entries[i] = entry
+		entries[i].Content = append([]api.ContentBlock(nil), entry.Content...)
+	}
+	return entries
+}
+
+// ToolCall returns the current state of a tool call.
+func (t *Transcript) ToolCall(id api.ToolCallId) (TranscriptToolCall, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	toolCall, exists := t.toolCalls[id]
+	if !exists {
+		return TranscriptToolCall{}, false
+	}
+	return copyTranscriptToolCall(toolCall), true
+}
+
+// ToolCalls returns the current state of all tool calls in the order they started.
+func (t *Transcript) ToolCalls() []TranscriptToolCall {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	toolCalls := make([]TranscriptToolCall, 0, len(t.toolCalls))
+	for _, entry := range t.entries {
+		if entry.Kind == TranscriptEntryToolCall {
+			toolCalls = append(toolCalls, copyTranscriptToolCall(t.toolCalls[entry.ToolCallID]))
+		}
+	}
+	return toolCalls
+}
+
+// Plan returns the latest plan, or nil if the agent has not sent one.
+func (t *Transcript) Plan() *api.Plan {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.plan == nil {
+		return nil
+	}
+	return &api.Plan{Entries: append([]api.PlanEntry(nil), t.plan.Entries...)}
+}
+
+// appendChunkLocked merges a content chunk into the last entry if it has the
+// same kind, or starts a new entry.
+func (t *Transcript) appendChunkLocked(kind TranscriptEntryKind, block *api.ContentBlock) []TranscriptChange {
+	if block == nil {
+		return nil
+	}
+
+	last := len(t.entries) - 1
+	if last < 0 || t.entries[last].Kind != kind {
+		t.entries = append(t.entries, TranscriptEntry{Kind: kind, Content: []api.ContentBlock{*block}})
+		return []TranscriptChange{{Type: TranscriptChangeEntryAdded, EntryIndex: last + 1}}
+	}
+
+	entry := &t.entries[last]
+	n := len(entry.Content)
+	if block.Type == api.ContentBlockTypeText && block.Text != nil &&
+		n > 0 && entry.Content[n-1].Type == api.ContentBlockTypeText && entry.Content[n-1].Text != nil {
+		merged := *entry.Content[n-1].Text
+		merged.Text += block.Text.Text
+		entry.Content[n-1] = api.ContentBlock{Type: api.ContentBlockTypeText, Text: &merged}
+	} else {
+		entry.Content = append(entry.Content, *block)
+	}
+	return []TranscriptChange{{Type: TranscriptChangeEntryUpdated, EntryIndex: last}}
+}
+
+// applyToolCallLocked records a new tool call, replacing any previous state with the same ID.
+func (t *Transcript) applyToolCallLocked(update *api.SessionUpdateToolCall) ([]TranscriptChange, error) {
+	var toolCall api.ToolCall
+	if err := remarshal(update, &toolCall); err != nil {
+		return nil, fmt.Errorf("failed to decode tool call: %w", err)
+	}
+	if toolCall.ToolCallId == "" {
+		return nil, errors.New("tool call is missing toolCallId")
+	}
+
+	if existing, exists := t.toolCalls[toolCall.ToolCallId]; exists {
+		existing.ToolCall = toolCall
+		return []TranscriptChange{{
+			Type:       TranscriptChangeToolCallUpdated,
+			EntryIndex: t.toolCallIndexLocked(toolCall.ToolCallId),
+			ToolCallID: toolCall.ToolCallId,
+		}}, nil
+	}
+
+	return t.addToolCallLocked(toolCall), nil
+}
+
+// applyToolCallUpdateLocked merges a tool call update into the existing tool call.
+//
+// Updates for unknown tool calls create the tool call, so a transcript that
+// starts mid-turn still tracks it.
+func (t *Transcript) applyToolCallUpdateLocked(update *api.SessionUpdateToolCallUpdate) ([]TranscriptChange, error) {
+	var delta api.ToolCallUpdate
+	if err := remarshal(update, &delta); err != nil {
+		return nil, fmt.Errorf("failed to decode tool call update: %w", err)
+	}
+	if delta.ToolCallId == "" {
+		return nil, errors.New("tool call update is missing toolCallId")
+	}
+
+	existing, exists := t.toolCalls[delta.ToolCallId]
+	if !exists {
+		toolCall := api.ToolCall{ToolCallId: delta.ToolCallId, Status: api.ToolCallStatusPending}
+		mergeToolCallUpdate(&toolCall, &delta)
+		return t.addToolCallLocked(toolCall), nil
+	}
+
+	mergeToolCallUpdate(&existing.ToolCall, &delta)
+	return []TranscriptChange{{
+		Type:       TranscriptChangeToolCallUpdated,
+		EntryIndex: t.toolCallIndexLocked(delta.ToolCallId),
+		ToolCallID: delta.ToolCallId,
+	}}, nil
+}
+
+// addToolCallLocked appends a tool call entry.
+func (t *Transcript) addToolCallLocked(toolCall api.ToolCall) []TranscriptChange {
+	t.toolCalls[toolCall.ToolCallId] = &TranscriptToolCall{ToolCall: toolCall}
+	t.entries = append(t.entries, TranscriptEntry{Kind: TranscriptEntryToolCall, ToolCallID: toolCall.ToolCallId})
+	return []TranscriptChange{{
+		Type:       TranscriptChangeEntryAdded,
+		EntryIndex: len(t.entries) - 1,
+		ToolCallID: toolCall.ToolCallId,
+	}}
+}
+
+// applyPlanLocked replaces the plan.
+func (t *Transcript) applyPlanLocked(update *api.SessionUpdatePlan) ([]TranscriptChange, error) {
+	var plan api.Plan
+	if err := remarshal(update, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+	if plan.Entries == nil {
+		plan.Entries = []api.PlanEntry{}
+	}
+	t.plan = &plan
+	return []TranscriptChange{{Type: TranscriptChangePlanReplaced, EntryIndex: -1}}, nil
+}
+
+// toolCallIndexLocked returns the entry index of a tool call.
+func (t *Transcript) toolCallIndexLocked(id api.ToolCallId) int {
+	for i, entry := range t.entries {
+		if entry.Kind == TranscriptEntryToolCall && entry.ToolCallID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// notify invokes the change callbacks.
+func (t *Transcript) notify(changes []TranscriptChange) {
+	if len(changes) == 0 {
+		return
+	}
+	callbacks := t.callbacks.GetAll()
+	for _, change := range changes {
+		for _, callback := range callbacks {
+			callback(change)
+		}
+	}
+}
+
+// mergeToolCallUpdate applies the fields present in delta to toolCall.
+func mergeToolCallUpdate(toolCall *api.ToolCall, delta *api.ToolCallUpdate) {
+	if delta.Title != nil {
+		toolCall.Title = *delta.Title
+	}
+	if delta.Kind != nil {
+		toolCall.Kind = delta.Kind
+	}
+	if status, ok := delta.Status.(string); ok && api.ToolCallStatus(status).IsValid() {
+		toolCall.Status = api.ToolCallStatus(status)
+	}
+	if delta.Content != nil {
+		content := make([]api.ToolCallContentElem, len(delta.Content))
+		for i, elem := range delta.Content {
+			content[i] = elem
+		}
+		toolCall.Content = content
+	}
+	if delta.Locations != nil {
+		toolCall.Locations = append([]api.ToolCallLocation(nil), delta.Locations...)
+	}
+	if delta.RawInput != nil {
+		toolCall.RawInput = delta.RawInput
+	}
+	if delta.RawOutput != nil {
+		toolCall.RawOutput = delta.RawOutput
+	}
+}
+
+// isToolCallInFlight reports whether a tool call has not reached a final status.
+func isToolCallInFlight(status api.ToolCallStatus) bool {
+	return status == "" || status == api.ToolCallStatusPending || status == api.ToolCallStatusInProgress
+}
+
+// copyTranscriptToolCall returns a copy that does not share slices with the transcript.
+func copyTranscriptToolCall(toolCall *TranscriptToolCall) TranscriptToolCall {
+	result := *toolCall
+	result.Content = append([]api.ToolCallContentElem(nil), toolCall.Content...)
+	result.Locations = append([]api.ToolCallLocation(nil), toolCall.Locations...)
+	return result
+}
@@ -0,0 +1,536 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/joshgarnett/agent-client-protocol-go/acp/diff"
+)
+
+// transcriptExportPlanKind is the entry kind used for plan snapshots in exports.
+const transcriptExportPlanKind = "plan"
+
+// TranscriptExport is a serializable snapshot of a session's conversation,
+// built from its ordered session/update notifications.
+//
+// Plans are kept as snapshots at the position they arrived, so the export shows
+// how the plan evolved. Tool calls appear where they started, with their final
+// merged state.
+type TranscriptExport struct {
+	SessionID api.SessionId           `json:"sessionId"`
+	Entries   []TranscriptExportEntry `json:"entries"`
+}
+
+// TranscriptExportEntry is a single item of an exported transcript.
+type TranscriptExportEntry struct {
+	// Kind is "user_message", "agent_message", "agent_thought", "tool_call" or "plan".
+	Kind     string                    `json:"kind"`
+	Content  []api.ContentBlock        `json:"content,omitempty"`
+	ToolCall *TranscriptExportToolCall `json:"toolCall,omitempty"`
+	Plan     *api.Plan                 `json:"plan,omitempty"`
+}
+
+// TranscriptExportToolCall is the final state of a tool call in an export.
+type TranscriptExportToolCall struct {
+	ToolCallID api.ToolCallId         `json:"toolCallId"`
+	Title      string                 `json:"title"`
+	Kind       string                 `json:"kind,omitempty"`
+	Status     api.ToolCallStatus     `json:"status"`
+	Cancelled  bool                   `json:"cancelled,omitempty"`
+	Locations  []api.ToolCallLocation `json:"locations,omitempty"`
+	Content    []api.ToolCallContent  `json:"content,omitempty"`
+	RawInput   interface{}            `json:"rawInput,omitempty"`
+	RawOutput  interface{}            `json:"rawOutput,omitempty"`
+}
+
+// NewTranscriptExport builds an export from a session's notifications in the
+// order they were received. The session is taken from the first notification;
+// notifications for other sessions and unsupported update types are skipped.
+func NewTranscriptExport(notifications []*api.SessionNotification) (*TranscriptExport, error) {
+	export := &TranscriptExport{Entries: []TranscriptExportEntry{}}
+	if len(notifications) == 0 {
+		return export, nil
+	}
+	export.SessionID = notifications[0].SessionId
+
+	type planSnapshot struct {
+		position int
+		plan     *api.Plan
+	}
+
+	transcript := NewTranscript(export.SessionID)
+	var plans []planSnapshot
+	entryCount := 0
+	transcript.OnChange(func(change TranscriptChange) {
+		switch change.Type {
+		case TranscriptChangeEntryAdded:
+			entryCount++
+		case TranscriptChangePlanReplaced:
+			plans = append(plans, planSnapshot{position: entryCount, plan: transcript.Plan()})
+		}
+	})
+
+	for i, notification := range notifications {
+		if err := transcript.HandleSessionUpdate(context.Background(), notification); err != nil {
+			return nil, fmt.Errorf("notification %d: %w", i, err)
+		}
+	}
+
+	for i, entry := range transcript.Entries() {
+		for len(plans) > 0 && plans[0].position <= i {
+			export.Entries = append(export.Entries, TranscriptExportEntry{
+				Kind: transcriptExportPlanKind,
+				Plan: plans[0].plan,
+			})
+			plans = plans[1:]
+		}
+
+		exported := TranscriptExportEntry{Kind: entry.Kind.String()}
+		if entry.Kind == TranscriptEntryToolCall {
+			toolCall, _ := transcript.ToolCall(entry.ToolCallID)
+			converted, err := exportToolCall(toolCall)
+			if err != nil {
+				return nil, err
+			}
+			exported.ToolCall = converted
+		} else {
+			exported.Content = entry.Content
+		}
+		export.Entries = append(export.Entries, exported)
+	}
+	for _, snapshot := range plans {
+		export.Entries = append(export.Entries, TranscriptExportEntry{
+			Kind: transcriptExportPlanKind,
+			Plan: snapshot.plan,
+		})
+	}
+
+	return export, nil
+}
+
+// WriteJSON writes the export as indented JSON.
+func (e *TranscriptExport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(e); err != nil {
+		return fmt.Errorf("failed to encode transcript: %w", err)
+	}
+	return nil
+}
+
+// WriteMarkdown writes the export as a Markdown document.
+func (e *TranscriptExport) WriteMarkdown(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Session %s\n", e.SessionID)
+
+	for _, entry := range e.Entries {
+		sb.WriteString("\n")
+		switch entry.Kind {
+		case TranscriptEntryUserMessage.String():
+			sb.WriteString("## User\n\n")
+			writeMarkdownContent(&sb, entry.Content)
+		case TranscriptEntryAgentMessage.String():
+			sb.WriteString("## Agent\n\n")
+			writeMarkdownContent(&sb, entry.Content)
+		case TranscriptEntryAgentThought.String():
+			var thought strings.Builder
+			writeMarkdownContent(&thought, entry.Content)
+			sb.WriteString("> **Thought**\n>\n")
+			for _, line := range strings.Split(strings.TrimRight(thought.String(), "\n"), "\n") {
+				sb.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+			}
+		case TranscriptEntryToolCall.String():
+			writeMarkdownToolCall(&sb, entry.ToolCall)
+		case transcriptExportPlanKind:
+			sb.WriteString("### Plan\n\n")
+			for _, planEntry := range entry.Plan.Entries {
+				check := " "
+				if planEntry.Status == api.PlanEntryStatusCompleted {
+					check = "x"
+				}
+				fmt.Fprintf(&sb, "- [%s] %s (%s, %s)\n", check, planEntry.Content, planEntry.Priority, planEntry.Status)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteHTML writes the export as a self-contained HTML page. Images are
+// embedded as data URIs and all text is escaped.
+func (e *TranscriptExport) WriteHTML(w io.Writer) error {
+	var sb strings.Builder
+	title := html.EscapeString(fmt.Sprintf("Session %s", e.SessionID))
+	sb.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&sb, "<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n", title, transcriptHTMLStyle)
+	fmt.Fprintf(&sb, "<h1>%s</h1>\n", title)
+
+	for _, entry := range e.Entries {
+		switch entry.Kind {
+		case TranscriptEntryUserMessage.String():
+			sb.WriteString("<section class=\"user\">\n<h2>User</h2>\n")
+			writeHTMLContent(&sb, entry.Content)
+			sb.WriteString("</section>\n")
+		case TranscriptEntryAgentMessage.String():
+			sb.WriteString("<section class=\"agent\">\n<h2>Agent</h2>\n")
+			writeHTMLContent(&sb, entry.Content)
+			sb.WriteString("</section>\n")
+		case TranscriptEntryAgentThought.String():
+			sb.WriteString("<details class=\"thought\">\n<summary>Thought</summary>\n")
+			writeHTMLContent(&sb, entry.Content)
+			sb.WriteString("</details>\n")
+		case TranscriptEntryToolCall.String():
+			writeHTMLToolCall(&sb, entry.ToolCall)
+		case transcriptExportPlanKind:
+			sb.WriteString("<section class=\"plan\">\n<h3>Plan</h3>\n<ul>\n")
+			for _, planEntry := range entry.Plan.Entries {
+				fmt.Fprintf(&sb, "<li class=\"%s\">%s <small>(%s, %s)</small></li>\n",
+					html.EscapeString(string(planEntry.Status)), html.EscapeString(planEntry.Content),
+					html.EscapeString(string(planEntry.Priority)), html.EscapeString(string(planEntry.Status)))
+			}
+			sb.WriteString("</ul>\n</section>\n")
+		}
+	}
+
+	sb.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// transcriptHTMLStyle is the inline stylesheet of HTML exports.
+const transcriptHTMLStyle = `body { font-family: sans-serif; max-width: 50em; margin: 2em auto; line-height: 1.5; }
+section, details { margin: 1em 0; padding: 0.5em 1em; border-radius: 4px; }
+.user { background: #eef4ff; }
+.agent { background: #f6f6f6; }
+.thought { color: #555; font-style: italic; }
+.tool-call { border: 1px solid #ddd; }
+.plan li.completed { text-decoration: line-through; }
+pre { background: #272822; color: #f8f8f2; padding: 0.5em; overflow-x: auto; }
+.del { color: #f92672; }
+.add { color: #a6e22e; }
+`
+
+// exportToolCall converts a transcript tool call into its export form.
+func exportToolCall(toolCall TranscriptToolCall) (*TranscriptExportToolCall, error) {
+	exported := &TranscriptExportToolCall{
+		ToolCallID: toolCall.ToolCallId,
+		Title:      toolCall.Title,
+		Status:     toolCall.Status,
+		Cancelled:  toolCall.Cancelled,
+		Locations:  toolCall.Locations,
+		RawInput:   toolCall.RawInput,
+		RawOutput:  toolCall.RawOutput,
+	}
+	if kind, ok := toolCall.Kind.(string); ok {
+		exported.Kind = kind
+	} else if kind, ok := toolCall.Kind.(api.ToolKind); ok {
+		exported.Kind = string(kind)
+	}
+
+	for i, elem := range toolCall.Content {
+		content, err := decodeToolCallContent(elem)
+		if err != nil {
+			return nil, fmt.Errorf("tool call %s content %d: %w", toolCall.ToolCallId, i, err)
+		}
+		exported.Content = append(exported.Content, content)
+	}
+	return exported, nil
+}
+
+// decodeToolCallContent converts an untyped tool call content element. Plain
+// strings are treated as text content.
+func decodeToolCallContent(elem api.ToolCallContentElem) (api.ToolCallContent, error) {
+	switch v := elem.(type) {
+	case api.ToolCallContent:
+		return v, nil
+	case *api.ToolCallContent:
+		return *v, nil
+	case string:
+		block := NewTextContent(v)
+		return api.ToolCallContent{
+			Type:    api.ToolCallContentTypeContent,
+			Content: &api.ToolCallContentContent{Content: &block},
+		}, nil
+	}
+
+	var content api.ToolCallContent
+	if err := remarshal(elem, &content); err != nil {
+		return api.ToolCallContent{}, fmt.Errorf("failed to decode tool call content: %w", err)
+	}
+	return content, nil
+}
+
+// exportedResource is the decoded form of an embedded resource.
+type exportedResource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Blob     string `json:"blob"`
+}
+
+// decodeResource decodes the resource of an embedded resource content block.
+func decodeResource(block *api.ContentBlockResource) exportedResource {
+	var resource exportedResource
+	if block.Resource != nil {
+		_ = remarshal(*block.Resource, &resource)
+	}
+	return resource
+}
+
+// stringValue returns v if it is a non-empty string, or fallback.
+func stringValue(v interface{}, fallback string) string {
+	if s, ok := v.(string); ok && s != "" {
+		return s
+	}
+	return fallback
+}
+
+// writeMarkdownContent renders content blocks as Markdown paragraphs.
+func writeMarkdownContent(sb *strings.Builder, blocks []api.ContentBlock) {
+	for i, block := range blocks {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		switch {
+		case block.Type == api.ContentBlockTypeText && block.Text != nil:
+			sb.WriteString(block.Text.Text + "\n")
+		case block.Type == api.ContentBlockTypeImage && block.Image != nil:
+			if uri := stringValue(block.Image.Uri, ""); safeURL(uri, true) {
+				fmt.Fprintf(sb, "![image](%s)\n", markdownURL(uri))
+			} else if uri != "" {
+				fmt.Fprintf(sb, "*[image: %s]*\n", markdownCode(uri))
+			} else {
+				fmt.Fprintf(sb, "*[image: %s]*\n", block.Image.Mimetype)
+			}
+		case block.Type == api.ContentBlockTypeAudio && block.Audio != nil:
+			fmt.Fprintf(sb, "*[audio: %s]*\n", block.Audio.Mimetype)
+		case block.Type == api.ContentBlockTypeResourceLink && block.ResourceLink != nil:
+			name := stringValue(block.ResourceLink.Title, block.ResourceLink.Name)
+			if !safeURL(block.ResourceLink.Uri, false) {
+				fmt.Fprintf(sb, "%s %s\n", markdownLinkText(name), markdownCode(block.ResourceLink.Uri))
+				continue
+			}
+			fmt.Fprintf(sb, "[%s](%s)\n", markdownLinkText(name), markdownURL(block.ResourceLink.Uri))
+		case block.Type == api.ContentBlockTypeResource && block.Resource != nil:
+			resource := decodeResource(block.Resource)
+			if resource.Blob != "" || resource.Text == "" {
+				fmt.Fprintf(sb, "*[resource: %s]*\n", markdownCode(resource.URI))
+				continue
+			}
+			text := strings.TrimRight(resource.Text, "\n")
+			fence := markdownFence(text)
+			fmt.Fprintf(sb, "%s\n\n%s\n%s\n%s\n", markdownCode(resource.URI), fence, text, fence)
+		}
+	}
+}
+
+// markdownFence returns a code fence longer than any run of backticks in
+// text, so the text cannot close the fence early.
+func markdownFence(text string) string {
+	return strings.Repeat("`", max(3, longestBacktickRun(text)+1))
+}
+
+// markdownCode renders text as an inline code span that its own backticks
+// cannot close.
+func markdownCode(text string) string {
+	ticks := strings.Repeat("`", longestBacktickRun(text)+1)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		return ticks + " " + text + " " + ticks
+	}
+	return ticks + text + ticks
+}
+
+// markdownText renders text on a single line with the characters that could
+// add links, HTML or formatting escaped.
+func markdownText(text string) string {
+	return markdownEscape(markdownLine(text))
+}
+
+// markdownLine replaces line breaks with spaces.
+var markdownLine = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace
+
+// markdownEscape backslash-escapes Markdown's inline syntax characters.
+var markdownEscape = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`<`, `\<`, `>`, `\>`, `!`, `\!`, `#`, `\#`, `|`, `\|`, `~`, `\~`, `&`, `\&`,
+).Replace
+
+// longestBacktickRun returns the length of the longest run of backticks in text.
+func longestBacktickRun(text string) int {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// markdownLinkText escapes the characters that would end a link's text early.
+var markdownLinkText = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`).Replace
+
+// markdownURL percent-encodes the characters that would end a link
+// destination early.
+var markdownURL = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E", "\n", "%0A").Replace
+
+// writeMarkdownToolCall renders a tool call as a Markdown section.
+func writeMarkdownToolCall(sb *strings.Builder, toolCall *TranscriptExportToolCall) {
+	fmt.Fprintf(sb, "### Tool call: %s\n\n", markdownText(toolCall.Title))
+
+	status := string(toolCall.Status)
+	if toolCall.Cancelled {
+		status += " (cancelled)"
+	}
+	fmt.Fprintf(sb, "- Status: %s\n", status)
+	if toolCall.Kind != "" {
+		fmt.Fprintf(sb, "- Kind: %s\n", toolCall.Kind)
+	}
+	for _, location := range toolCall.Locations {
+		fmt.Fprintf(sb, "- Location: %s\n", markdownCode(markdownLine(formatLocation(location))))
+	}
+
+	for _, content := range toolCall.Content {
+		sb.WriteString("\n")
+		switch {
+		case content.Type == api.ToolCallContentTypeContent && content.Content != nil && content.Content.Content != nil:
+			writeMarkdownContent(sb, []api.ContentBlock{*content.Content.Content})
+		case content.Type == api.ToolCallContentTypeDiff && content.Diff != nil:
+			text := formatDiff(content.Diff)
+			fence := markdownFence(text)
+			fmt.Fprintf(sb, "%sdiff\n%s%s\n", fence, text, fence)
+		case content.Type == api.ToolCallContentTypeTerminal && content.Terminal != nil:
+			fmt.Fprintf(sb, "*[terminal: %s]*\n", content.Terminal.Terminalid)
+		}
+	}
+}
+
+// writeHTMLContent renders content blocks as HTML.
+func writeHTMLContent(sb *strings.Builder, blocks []api.ContentBlock) {
+	for _, block := range blocks {
+		switch {
+		case block.Type == api.ContentBlockTypeText && block.Text != nil:
+			fmt.Fprintf(sb, "<p>%s</p>\n",
+				strings.ReplaceAll(html.EscapeString(block.Text.Text), "\n", "<br>\n"))
+		case block.Type == api.ContentBlockTypeImage && block.Image != nil:
+			src := stringValue(block.Image.Uri, "")
+			if block.Image.Data != "" && strings.HasPrefix(block.Image.Mimetype, "image/") {
+				src = "data:" + block.Image.Mimetype + ";base64," + block.Image.Data
+			}
+			if !safeURL(src, true) {
+				fmt.Fprintf(sb, "<p><em>[image: %s]</em></p>\n", html.EscapeString(src))
+				continue
+			}
+			fmt.Fprintf(sb, "<img src=\"%s\" alt=\"image\">\n", html.EscapeString(src))
+		case block.Type == api.ContentBlockTypeAudio && block.Audio != nil:
+			fmt.Fprintf(sb, "<p><em>[audio: %s]</em></p>\n", html.EscapeString(block.Audio.Mimetype))
+		case block.Type == api.ContentBlockTypeResourceLink && block.ResourceLink != nil:
+			name := stringValue(block.ResourceLink.Title, block.ResourceLink.Name)
+			if !safeURL(block.ResourceLink.Uri, false) {
+				fmt.Fprintf(sb, "<p>%s <code>%s</code></p>\n",
+					html.EscapeString(name), html.EscapeString(block.ResourceLink.Uri))
+				continue
+			}
+			fmt.Fprintf(sb, "<p><a href=\"%s\">%s</a></p>\n",
+				html.EscapeString(block.ResourceLink.Uri), html.EscapeString(name))
+		case block.Type == api.ContentBlockTypeResource && block.Resource != nil:
+			resource := decodeResource(block.Resource)
+			if resource.Blob != "" || resource.Text == "" {
+				fmt.Fprintf(sb, "<p><em>[resource: %s]</em></p>\n", html.EscapeString(resource.URI))
+				continue
+			}
+			fmt.Fprintf(sb, "<p><code>%s</code></p>\n<pre>%s</pre>\n",
+				html.EscapeString(resource.URI), html.EscapeString(strings.TrimRight(resource.Text, "\n")))
+		}
+	}
+}
+
+// safeURL reports whether an agent-supplied URI may be used as a link, or as
+// an image source if image is set. Only http, https and file URIs, and
+// data:image URIs for images, are allowed; javascript: and other URIs that
+// could run script in the archived page are rendered as text instead.
+func safeURL(uri string, image bool) bool {
+	scheme, _, found := strings.Cut(uri, ":")
+	if !found {
+		return false
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "file":
+		return true
+	case "data":
+		return image && strings.HasPrefix(strings.ToLower(uri), "data:image/")
+	}
+	return false
+}
+
+// writeHTMLToolCall renders a tool call as an HTML section.
+func writeHTMLToolCall(sb *strings.Builder, toolCall *TranscriptExportToolCall) {
+	sb.WriteString("<section class=\"tool-call\">\n")
+	fmt.Fprintf(sb, "<h3>Tool call: %s</h3>\n<ul>\n", html.EscapeString(toolCall.Title))
+
+	status := string(toolCall.Status)
+	if toolCall.Cancelled {
+		status += " (cancelled)"
+	}
+	fmt.Fprintf(sb, "<li>Status: %s</li>\n", html.EscapeString(status))
+	if toolCall.Kind != "" {
+		fmt.Fprintf(sb, "<li>Kind: %s</li>\n", html.EscapeString(toolCall.Kind))
+	}
+	for _, location := range toolCall.Locations {
+		fmt.Fprintf(sb, "<li>Location: <code>%s</code></li>\n", html.EscapeString(formatLocation(location)))
+	}
+	sb.WriteString("</ul>\n")
+
+	for _, content := range toolCall.Content {
+		switch {
+		case content.Type == api.ToolCallContentTypeContent && content.Content != nil && content.Content.Content != nil:
+			writeHTMLContent(sb, []api.ContentBlock{*content.Content.Content})
+		case content.Type == api.ToolCallContentTypeDiff && content.Diff != nil:
+			sb.WriteString("<pre class=\"diff\">")
+			for _, line := range strings.SplitAfter(formatDiff(content.Diff), "\n") {
+				switch {
+				case line == "":
+				case strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++"):
+					sb.WriteString(html.EscapeString(line))
+				case strings.HasPrefix(line, "-"):
+					fmt.Fprintf(sb, "<span class=\"del\">%s</span>", html.EscapeString(line))
+				case strings.HasPrefix(line, "+"):
+					fmt.Fprintf(sb, "<span class=\"add\">%s</span>", html.EscapeString(line))
+				default:
+					sb.WriteString(html.EscapeString(line))
+				}
+			}
+			sb.WriteString("</pre>\n")
+		case content.Type == api.ToolCallContentTypeTerminal && content.Terminal != nil:
+			fmt.Fprintf(sb, "<p><em>[terminal: %s]</em></p>\n", html.EscapeString(content.Terminal.Terminalid))
+		}
+	}
+	sb.WriteString("</section>\n")
+}
+
+// formatLocation renders a tool call location as path or path:line.
+func formatLocation(location api.ToolCallLocation) string {
+	if location.Line != nil {
+		return fmt.Sprintf("%s:%d", location.Path, *location.Line)
+	}
+	return location.Path
+}
+
+// formatDiff renders a diff in unified format. A missing old text is shown as
+// a new file.
+func formatDiff(content *api.ToolCallContentDiff) string {
+	d := diff.NewFile(content.Path, content.Newtext)
+	if content.Oldtext != nil {
+		d = diff.New(content.Path, stringValue(content.Oldtext, ""), content.Newtext)
+	}
+	return d.Unified(diff.DefaultContextLines)
+}
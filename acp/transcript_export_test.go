@@ -0,0 +1,215 @@
+package acp
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// assertGolden compares output with testdata/name, rewriting the file when -update is set.
+func assertGolden(t *testing.T, name string, output []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll("testdata", 0o755))
+		require.NoError(t, os.WriteFile(path, output, 0o600))
+	}
+
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test -update to create golden files")
+	assert.Equal(t, string(expected), string(output))
+}
+
+// sampleTranscriptNotifications returns a session stream covering every
+// exported entry kind. Updates are sent as maps, as they arrive over the wire.
+func sampleTranscriptNotifications() []*api.SessionNotification {
+	updates := []map[string]interface{}{
+		{"sessionUpdate": "user_message_chunk", "content": map[string]interface{}{
+			"type": "text", "text": "Rename the <Config> type in config.go.",
+		}},
+		{"sessionUpdate": "agent_thought_chunk", "content": map[string]interface{}{
+			"type": "text", "text": "I should read the file first.\n",
+		}},
+		{"sessionUpdate": "agent_thought_chunk", "content": map[string]interface{}{
+			"type": "text", "text": "Then update the references.",
+		}},
+		{"sessionUpdate": "plan", "entries": []interface{}{
+			map[string]interface{}{"content": "Read config.go", "priority": "high", "status": "in_progress"},
+			map[string]interface{}{"content": "Rename the type", "priority": "high", "status": "pending"},
+		}},
+		{"sessionUpdate": "tool_call", "toolCallId": "call-1", "title": "Read config.go",
+			"kind": "read", "status": "pending",
+			"locations": []interface{}{map[string]interface{}{"path": "/src/config.go", "line": 3}}},
+		{"sessionUpdate": "tool_call_update", "toolCallId": "call-1", "status": "completed",
+			"content": []interface{}{map[string]interface{}{
+				"type": "content", "content": map[string]interface{}{"type": "text", "text": "12 lines"},
+			}}},
+		{"sessionUpdate": "tool_call", "toolCallId": "call-2", "title": "Edit config.go",
+			"kind": "edit", "status": "in_progress",
+			"content": []interface{}{map[string]interface{}{
+				"type": "diff", "path": "/src/config.go",
+				"oldText": "type Config struct{}\n", "newText": "type Settings struct{}\n",
+			}}},
+		{"sessionUpdate": "tool_call_update", "toolCallId": "call-2", "status": "completed"},
+		{"sessionUpdate": "tool_call", "toolCallId": "call-3", "title": "Run go test",
+			"kind": "execute", "status": "failed",
+			"content":  []interface{}{map[string]interface{}{"type": "terminal", "terminalId": "term-1"}},
+			"rawInput": map[string]interface{}{"command": "go", "args": []interface{}{"test", "./..."}}},
+		{"sessionUpdate": "plan", "entries": []interface{}{
+			map[string]interface{}{"content": "Read config.go", "priority": "high", "status": "completed"},
+			map[string]interface{}{"content": "Rename the type", "priority": "high", "status": "completed"},
+		}},
+		{"sessionUpdate": "agent_message_chunk", "content": map[string]interface{}{
+			"type": "text", "text": "Renamed `Config` to `Settings`.\n",
+		}},
+		{"sessionUpdate": "agent_message_chunk", "content": map[string]interface{}{
+			"type": "text", "text": "Tests are failing & need a look.",
+		}},
+		{"sessionUpdate": "agent_message_chunk", "content": map[string]interface{}{
+			"type": "resource_link", "uri": "file:///src/config.go", "name": "config.go",
+		}},
+		{"sessionUpdate": "available_commands_update", "availableCommands": []interface{}{}},
+	}
+
+	notifications := make([]*api.SessionNotification, 0, len(updates)+1)
+	for _, update := range updates {
+		notifications = append(notifications, &api.SessionNotification{SessionId: "sess-1", Update: update})
+	}
+	// Notifications for other sessions are skipped.
+	notifications = append(notifications, &api.SessionNotification{
+		SessionId: "sess-2",
+		Update:    api.NewSessionUpdateAgentMessageChunk(textChunk("other session")),
+	})
+	return notifications
+}
+
+func TestTranscriptExport(t *testing.T) {
+	export, err := NewTranscriptExport(sampleTranscriptNotifications())
+	require.NoError(t, err)
+
+	assert.Equal(t, api.SessionId("sess-1"), export.SessionID)
+	kinds := make([]string, len(export.Entries))
+	for i, entry := range export.Entries {
+		kinds[i] = entry.Kind
+	}
+	assert.Equal(t, []string{
+		"user_message", "agent_thought", "plan", "tool_call", "tool_call", "tool_call", "plan", "agent_message",
+	}, kinds)
+
+	t.Run("Markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, export.WriteMarkdown(&buf))
+		assertGolden(t, "transcript.golden.md", buf.Bytes())
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, export.WriteJSON(&buf))
+		assertGolden(t, "transcript.golden.json", buf.Bytes())
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, export.WriteHTML(&buf))
+		assertGolden(t, "transcript.golden.html", buf.Bytes())
+		assert.NotContains(t, buf.String(), "<Config>")
+	})
+}
+
+func TestTranscriptExportUnsafeURIs(t *testing.T) {
+	contents := []map[string]interface{}{
+		{"type": "resource_link", "uri": "javascript:alert(document.cookie)", "name": "click me"},
+		{"type": "resource_link", "uri": " JavaScript:alert(1)", "name": "spaced"},
+		{"type": "resource_link", "uri": "https://example.com/docs", "name": "docs"},
+		{"type": "image", "uri": "javascript:alert(1)"},
+		{"type": "image", "uri": "data:text/html,<script>alert(1)</script>"},
+		{"type": "image", "uri": "vbscript:msgbox(1)"},
+		{"type": "image", "uri": "data:image/png;base64,aW1n"},
+		{"type": "image", "data": "aW1n", "mimeType": "image/png"},
+	}
+	notifications := make([]*api.SessionNotification, 0, len(contents))
+	for _, content := range contents {
+		notifications = append(notifications, &api.SessionNotification{
+			SessionId: "sess-1",
+			Update:    map[string]interface{}{"sessionUpdate": "agent_message_chunk", "content": content},
+		})
+	}
+	export, err := NewTranscriptExport(notifications)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteHTML(&buf))
+	assertGolden(t, "transcript_unsafe.golden.html", buf.Bytes())
+	assert.NotContains(t, buf.String(), `href="javascript:`)
+	assert.NotContains(t, buf.String(), `href=" JavaScript:`)
+	assert.NotContains(t, buf.String(), `src="javascript:`)
+	assert.NotContains(t, buf.String(), `src="vbscript:`)
+	assert.NotContains(t, buf.String(), `src="data:text/html`)
+
+	buf.Reset()
+	require.NoError(t, export.WriteMarkdown(&buf))
+	assertGolden(t, "transcript_unsafe.golden.md", buf.Bytes())
+	assert.NotContains(t, buf.String(), `](javascript:`)
+	assert.NotContains(t, buf.String(), `]( JavaScript:`)
+	assert.NotContains(t, buf.String(), `](vbscript:`)
+	assert.NotContains(t, buf.String(), `](data:text/html`)
+}
+
+func TestTranscriptExportMarkdownFences(t *testing.T) {
+	text := "before\n```\n[escaped](javascript:alert(1))\n````\nafter"
+	updates := []map[string]interface{}{
+		{"sessionUpdate": "agent_message_chunk", "content": map[string]interface{}{
+			"type": "resource", "resource": map[string]interface{}{"uri": "file:///notes.md", "text": text},
+		}},
+		{"sessionUpdate": "tool_call", "toolCallId": "call-1", "title": "Edit notes.md",
+			"kind": "edit", "status": "completed",
+			"content": []interface{}{map[string]interface{}{
+				"type": "diff", "path": "/notes.md", "oldText": "before\n", "newText": text + "\n",
+			}}},
+		{"sessionUpdate": "tool_call", "toolCallId": "call-2",
+			"title": "Run `x`\n# Owned\n[click](javascript:alert(1))",
+			"kind":  "execute", "status": "completed",
+			"locations": []interface{}{map[string]interface{}{"path": "/src/a`b.go"}}},
+	}
+	notifications := make([]*api.SessionNotification, 0, len(updates))
+	for _, update := range updates {
+		notifications = append(notifications, &api.SessionNotification{SessionId: "sess-1", Update: update})
+	}
+	export, err := NewTranscriptExport(notifications)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteMarkdown(&buf))
+	assertGolden(t, "transcript_fences.golden.md", buf.Bytes())
+	assert.Contains(t, buf.String(), "`````\n"+text+"\n`````\n")
+	assert.Contains(t, buf.String(), "`````diff\n")
+	assert.Contains(t, buf.String(), "### Tool call: Run \\`x\\` \\# Owned \\[click\\](javascript:alert(1))\n")
+	assert.NotContains(t, buf.String(), "\n# Owned")
+	assert.Contains(t, buf.String(), "- Location: ``/src/a`b.go``\n")
+}
+
+func TestTranscriptExportEmpty(t *testing.T) {
+	export, err := NewTranscriptExport(nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, export.WriteJSON(&buf))
+	assert.JSONEq(t, `{"sessionId": "", "entries": []}`, buf.String())
+}
+
+func TestTranscriptExportInvalidUpdate(t *testing.T) {
+	_, err := NewTranscriptExport([]*api.SessionNotification{
+		{SessionId: "sess-1", Update: map[string]interface{}{"sessionUpdate": "tool_call"}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "notification 0")
+}
@@ -0,0 +1,260 @@
+package acp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func textChunk(text string) *api.ContentBlock {
+	block := NewTextContent(text)
+	return &block
+}
+
+func TestTranscriptMessages(t *testing.T) {
+	transcript := NewTranscript("s1")
+
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateAgentThoughtChunk(textChunk("Let me "))))
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateAgentThoughtChunk(textChunk("think."))))
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateAgentMessageChunk(textChunk("Hello, "))))
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateAgentMessageChunk(textChunk("world"))))
+	image := NewImageContent([]byte{1, 2, 3}, "image/png")
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateAgentMessageChunk(&image)))
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateAgentMessageChunk(textChunk("!"))))
+
+	entries := transcript.Entries()
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, TranscriptEntryAgentThought, entries[0].Kind)
+	assert.Equal(t, "Let me think.", entries[0].Text())
+
+	assert.Equal(t, TranscriptEntryAgentMessage, entries[1].Kind)
+	require.Len(t, entries[1].Content, 3)
+	assert.Equal(t, "Hello, world", entries[1].Content[0].Text.Text)
+	assert.Equal(t, api.ContentBlockTypeImage, entries[1].Content[1].Type)
+	assert.Equal(t, "!", entries[1].Content[2].Text.Text)
+
+	// A user prompt starts a new entry even after another user message.
+	transcript.AppendUserMessage([]api.ContentBlock{NewTextContent("first")})
+	transcript.AppendUserMessage([]api.ContentBlock{NewTextContent("second")})
+	entries = transcript.Entries()
+	require.Len(t, entries, 4)
+	assert.Equal(t, "first", entries[2].Text())
+	assert.Equal(t, "second", entries[3].Text())
+}
+
+func TestTranscriptToolCalls(t *testing.T) {
+	transcript := NewTranscript("s1")
+
+	id := api.ToolCallId("call-1")
+	kind := api.ToolKindRead
+	status := api.ToolCallStatusPending
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateToolCall(
+		nil, &kind, []interface{}{CreateLocationSimple("/a.go")}, nil, nil, &status, "Read a.go", &id,
+	)))
+
+	toolCall, exists := transcript.ToolCall(id)
+	require.True(t, exists)
+	assert.Equal(t, "Read a.go", toolCall.Title)
+	assert.Equal(t, api.ToolCallStatusPending, toolCall.Status)
+	assert.Equal(t, "read", toolCall.Kind)
+
+	// Only the fields present in the update change.
+	update := NewToolCallUpdate(id).
+		WithStatus(api.ToolCallStatusInProgress).
+		Build()
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateToolCallUpdate(
+		update.Content, update.Kind, update.Locations, update.RawInput, update.RawOutput,
+		update.Status, update.Title, &update.ToolCallId,
+	)))
+
+	toolCall, _ = transcript.ToolCall(id)
+	assert.Equal(t, api.ToolCallStatusInProgress, toolCall.Status)
+	assert.Equal(t, "Read a.go", toolCall.Title)
+	require.Len(t, toolCall.Locations, 1)
+	assert.Equal(t, "/a.go", toolCall.Locations[0].Path)
+
+	update = NewToolCallUpdate(id).
+		WithTitle("Read a.go (42 lines)").
+		WithStatus(api.ToolCallStatusCompleted).
+		WithContent([]api.ToolCallUpdateContentElem{"package main"}).
+		Build()
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateToolCallUpdate(
+		update.Content, update.Kind, update.Locations, update.RawInput, update.RawOutput,
+		update.Status, update.Title, &update.ToolCallId,
+	)))
+
+	toolCall, _ = transcript.ToolCall(id)
+	assert.Equal(t, api.ToolCallStatusCompleted, toolCall.Status)
+	assert.Equal(t, "Read a.go (42 lines)", toolCall.Title)
+	assert.Equal(t, []api.ToolCallContentElem{"package main"}, toolCall.Content)
+
+	// An update for an unknown tool call starts tracking it.
+	unknown := api.ToolCallId("call-2")
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateToolCallUpdate(
+		nil, nil, nil, nil, nil, "in_progress", nil, &unknown,
+	)))
+
+	toolCalls := transcript.ToolCalls()
+	require.Len(t, toolCalls, 2)
+	assert.Equal(t, id, toolCalls[0].ToolCallId)
+	assert.Equal(t, unknown, toolCalls[1].ToolCallId)
+
+	entries := transcript.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, TranscriptEntryToolCall, entries[0].Kind)
+	assert.Equal(t, id, entries[0].ToolCallID)
+
+	// A tool call update without an ID is rejected.
+	require.Error(t, transcript.Apply(api.NewSessionUpdateToolCallUpdate(nil, nil, nil, nil, nil, nil, nil, nil)))
+}
+
+func TestTranscriptPlan(t *testing.T) {
+	transcript := NewTranscript("s1")
+	assert.Nil(t, transcript.Plan())
+
+	plan := CreateSimplePlan([]string{"one", "two"})
+	entries := make([]interface{}, len(plan.Entries))
+	for i, entry := range plan.Entries {
+		entries[i] = entry
+	}
+	require.NoError(t, transcript.Apply(api.NewSessionUpdatePlan(entries)))
+	require.Len(t, transcript.Plan().Entries, 2)
+
+	// Each plan replaces the previous one wholesale.
+	require.NoError(t, transcript.Apply(api.NewSessionUpdatePlan(entries[:1])))
+	require.Len(t, transcript.Plan().Entries, 1)
+	assert.Equal(t, "one", transcript.Plan().Entries[0].Content)
+
+	// Plans are not part of the ordered entries.
+	assert.Empty(t, transcript.Entries())
+}
+
+func TestTranscriptEndTurn(t *testing.T) {
+	transcript := NewTranscript("s1")
+
+	var changes []TranscriptChange
+	transcript.OnChange(func(change TranscriptChange) {
+		changes = append(changes, change)
+	})
+
+	for _, call := range []struct {
+		id     api.ToolCallId
+		status api.ToolCallStatus
+	}{
+		{"pending", api.ToolCallStatusPending},
+		{"running", api.ToolCallStatusInProgress},
+		{"done", api.ToolCallStatusCompleted},
+	} {
+		require.NoError(t, transcript.Apply(api.NewSessionUpdateToolCall(
+			nil, nil, nil, nil, nil, &call.status, string(call.id), &call.id,
+		)))
+	}
+
+	transcript.EndTurn(api.StopReasonEndTurn)
+	for _, toolCall := range transcript.ToolCalls() {
+		assert.False(t, toolCall.Cancelled)
+	}
+
+	changes = nil
+	transcript.EndTurn(api.StopReasonCancelled)
+
+	pending, _ := transcript.ToolCall("pending")
+	running, _ := transcript.ToolCall("running")
+	done, _ := transcript.ToolCall("done")
+	assert.True(t, pending.Cancelled)
+	assert.True(t, running.Cancelled)
+	assert.False(t, done.Cancelled)
+
+	require.Len(t, changes, 3)
+	assert.Equal(t, TranscriptChange{
+		Type: TranscriptChangeToolCallUpdated, EntryIndex: 0, ToolCallID: "pending",
+	}, changes[0])
+	assert.Equal(t, TranscriptChange{
+		Type: TranscriptChangeToolCallUpdated, EntryIndex: 1, ToolCallID: "running",
+	}, changes[1])
+	assert.Equal(t, TranscriptChange{
+		Type: TranscriptChangeTurnEnded, EntryIndex: -1, StopReason: api.StopReasonCancelled,
+	}, changes[2])
+}
+
+func TestTranscriptChanges(t *testing.T) {
+	transcript := NewTranscript("s1")
+
+	var changes []TranscriptChange
+	transcript.OnChange(func(change TranscriptChange) {
+		changes = append(changes, change)
+	})
+
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateAgentMessageChunk(textChunk("a"))))
+	require.NoError(t, transcript.Apply(api.NewSessionUpdateAgentMessageChunk(textChunk("b"))))
+	require.NoError(t, transcript.Apply(api.NewSessionUpdatePlan([]interface{}{})))
+
+	assert.Equal(t, []TranscriptChange{
+		{Type: TranscriptChangeEntryAdded, EntryIndex: 0},
+		{Type: TranscriptChangeEntryUpdated, EntryIndex: 0},
+		{Type: TranscriptChangePlanReplaced, EntryIndex: -1},
+	}, changes)
+}
+
+func TestTranscriptHandleSessionUpdate(t *testing.T) {
+	transcript := NewTranscript("s1")
+
+	clientHandler := NewClientHandlerRegistry()
+	var mu sync.Mutex
+	clientHandler.RegisterSessionUpdateHandler(func(ctx context.Context, params *api.SessionNotification) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return transcript.HandleSessionUpdate(ctx, params)
+	})
+	agentConn, _ := NewRolePair(t, NewAgentHandlerRegistry(), clientHandler)
+
+	ctx := context.Background()
+	for _, notification := range []*api.SessionNotification{
+		{SessionId: "s1", Update: api.NewSessionUpdateAgentMessageChunk(textChunk("Hi"))},
+		{SessionId: "s1", Update: api.NewSessionUpdateAgentMessageChunk(textChunk(" there"))},
+		// Other sessions and unknown update types are ignored.
+		{SessionId: "s2", Update: api.NewSessionUpdateAgentMessageChunk(textChunk("other"))},
+		{SessionId: "s1", Update: map[string]interface{}{"sessionUpdate": "available_commands_update"}},
+	} {
+		require.NoError(t, agentConn.SendSessionUpdate(ctx, notification))
+	}
+
+	require.NoError(t, agentConn.SendToolCallUpdate(ctx, "s1",
+		NewToolCallUpdate("call-1").WithStatus(api.ToolCallStatusFailed).Build()))
+
+	WaitWithTimeout(t, time.Second, func() bool {
+		return len(transcript.ToolCalls()) == 1
+	}, "tool call received")
+
+	entries := transcript.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Hi there", entries[0].Text())
+	toolCall, _ := transcript.ToolCall("call-1")
+	assert.Equal(t, api.ToolCallStatusFailed, toolCall.Status)
+}
+
+func TestDecodeSessionUpdate(t *testing.T) {
+	typed := api.NewSessionUpdateAgentMessageChunk(textChunk("x"))
+
+	update, err := DecodeSessionUpdate(&api.SessionNotification{Update: typed})
+	require.NoError(t, err)
+	assert.Same(t, typed, update)
+
+	update, err = DecodeSessionUpdate(&api.SessionNotification{Update: map[string]interface{}{
+		"sessionUpdate": "agent_message_chunk",
+		"content":       map[string]interface{}{"type": "text", "text": "x"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "x", update.AgentMessageChunk.Content.Text.Text)
+
+	_, err = DecodeSessionUpdate(&api.SessionNotification{Update: map[string]interface{}{
+		"sessionUpdate": "something_new",
+	}})
+	require.ErrorIs(t, err, ErrUnsupportedSessionUpdate)
+}
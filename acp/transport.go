@@ -3,6 +3,7 @@ package acp
 import (
 	"context"
 	"io"
+	"sync"
 
 	"golang.org/x/exp/jsonrpc2"
 )
@@ -26,22 +27,120 @@ type callResult struct {
 type binder struct {
 	handler Handler
 	core    *ConnectionCore
+	serve   serveFunc
 }
 
 // Bind is called by the jsonrpc2 library to bind the handler to the connection.
-func (b *binder) Bind(_ context.Context, _ *jsonrpc2.Connection) (jsonrpc2.ConnectionOptions, error) {
+func (b *binder) Bind(_ context.Context, conn *jsonrpc2.Connection) (jsonrpc2.ConnectionOptions, error) {
 	wrappedHandler := func(ctx context.Context, req *jsonrpc2.Request) (interface{}, error) {
-		// We pass a dummy AgentConnection here since the Handler interface expects it
-		// This will be cleaned up when we refactor the Handler interface
-		dummyAgent := &AgentConnection{core: b.core}
-		return b.handler.Handle(ctx, dummyAgent, req)
+		defer b.core.incoming.markDelivered()
+		return b.serve(ctx, conn, req, b.handler.Handle)
 	}
 
 	return jsonrpc2.ConnectionOptions{
+		Framer:  countingFramer{Framer: jsonrpc2.HeaderFramer(), barrier: b.core.incoming},
 		Handler: jsonrpc2.HandlerFunc(wrappedHandler),
 	}, nil
 }
 
+// deliveryBarrier tracks incoming requests and notifications from the moment
+// they are read until their handler returns.
+//
+// jsonrpc2 routes responses to outgoing calls directly from the reader, while
+// requests and notifications are handled later in order. A caller that wants
+// everything the peer sent before a response to be handled waits on the barrier.
+//
+// jsonrpc2 skips the handler of a message whose context is already cancelled,
+// so such a message is read but never delivered. Every handler context derives
+// from the context the connection reads with, so once that context is done the
+// barrier stops waiting for messages that will never be delivered.
+type deliveryBarrier struct {
+	mu        sync.Mutex
+	read      uint64
+	delivered uint64
+	changed   chan struct{}
+	abandoned <-chan struct{}
+}
+
+// newDeliveryBarrier creates an empty barrier for a connection that reads
+// with ctx.
+func newDeliveryBarrier(ctx context.Context) *deliveryBarrier {
+	return &deliveryBarrier{changed: make(chan struct{}), abandoned: ctx.Done()}
+}
+
+// markRead records that a request or notification was read.
+func (d *deliveryBarrier) markRead() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.read++
+}
+
+// markDelivered records that the handler for a request or notification returned.
+func (d *deliveryBarrier) markDelivered() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.delivered++
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// readCount returns the number of requests and notifications read so far.
+func (d *deliveryBarrier) readCount() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.read
+}
+
+// wait blocks until at least n requests and notifications have been handled,
+// or until the messages not handled yet can no longer be delivered.
+func (d *deliveryBarrier) wait(ctx context.Context, n uint64, closed <-chan struct{}) error {
+	for {
+		d.mu.Lock()
+		delivered, changed := d.delivered, d.changed
+		d.mu.Unlock()
+
+		if delivered >= n {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.abandoned:
+			return nil
+		case <-closed:
+			return ErrConnectionClosed
+		}
+	}
+}
+
+// countingFramer wraps a framer and marks incoming requests and notifications
+// on a deliveryBarrier as they are read.
+type countingFramer struct {
+	jsonrpc2.Framer
+	barrier *deliveryBarrier
+}
+
+// Reader wraps the reader of the underlying framer.
+func (f countingFramer) Reader(r io.Reader) jsonrpc2.Reader {
+	return countingReader{Reader: f.Framer.Reader(r), barrier: f.barrier}
+}
+
+// countingReader marks each request read on a deliveryBarrier.
+type countingReader struct {
+	jsonrpc2.Reader
+	barrier *deliveryBarrier
+}
+
+// Read reads the next message.
+func (r countingReader) Read(ctx context.Context) (jsonrpc2.Message, int64, error) {
+	msg, n, err := r.Reader.Read(ctx)
+	if _, ok := msg.(*jsonrpc2.Request); ok && err == nil {
+		r.barrier.markRead()
+	}
+	return msg, n, err
+}
+
 // stdioDialer is a custom dialer that uses an existing io.ReadWriteCloser (like stdin/stdout).
 type stdioDialer struct {
 	rwc io.ReadWriteCloser
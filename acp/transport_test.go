@@ -1,11 +1,13 @@
 package acp
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -184,6 +186,55 @@ func (s *TransportTestSuite) TestMockTransportConcurrentAccess() {
 	s.Equal(numMessages, receivedCount)
 }
 
+func (s *TransportTestSuite) TestDeliveryBarrierWaits() {
+	barrier := newDeliveryBarrier(context.Background())
+	closed := make(chan struct{})
+	barrier.markRead()
+	barrier.markRead()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- barrier.wait(context.Background(), barrier.readCount(), closed)
+	}()
+
+	barrier.markDelivered()
+	select {
+	case <-done:
+		s.Fail("wait returned before every message was delivered")
+	case <-time.After(50 * time.Millisecond):
+	}
+	barrier.markDelivered()
+	s.Require().NoError(<-done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	barrier.markRead()
+	s.Require().ErrorIs(barrier.wait(ctx, barrier.readCount(), closed), context.Canceled)
+	close(closed)
+	s.Require().ErrorIs(barrier.wait(context.Background(), barrier.readCount(), closed), ErrConnectionClosed)
+}
+
+func (s *TransportTestSuite) TestDeliveryBarrierAbandoned() {
+	// jsonrpc2 skips the handlers of messages read after the connection's
+	// context is cancelled, so they are never delivered.
+	connCtx, cancel := context.WithCancel(context.Background())
+	barrier := newDeliveryBarrier(connCtx)
+	barrier.markRead()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- barrier.wait(context.Background(), barrier.readCount(), make(chan struct{}))
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		s.Require().NoError(err)
+	case <-time.After(5 * time.Second):
+		s.Fail("wait blocked on a message that cannot be delivered")
+	}
+}
+
 func TestTransportTestSuite(t *testing.T) {
 	suite.Run(t, new(TransportTestSuite))
 }
@@ -0,0 +1,245 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"golang.org/x/exp/jsonrpc2"
+)
+
+// agentConnectionKey is the context key for the connection serving a request.
+type agentConnectionKey struct{}
+
+// withAgentConnection returns a context carrying the connection serving a request.
+func withAgentConnection(ctx context.Context, conn *AgentConnection) context.Context {
+	return context.WithValue(ctx, agentConnectionKey{}, conn)
+}
+
+// AgentConnectionFromContext returns the agent connection serving a request,
+// if any. Handlers use it to call back to the client.
+func AgentConnectionFromContext(ctx context.Context) *AgentConnection {
+	conn, _ := ctx.Value(agentConnectionKey{}).(*AgentConnection)
+	return conn
+}
+
+// PromptTurnHandler handles a session/prompt request using a TurnContext and
+// returns the reason the turn stopped.
+type PromptTurnHandler func(turn *TurnContext, params *api.PromptRequest) (api.StopReason, error)
+
+// TurnContext is passed to a PromptTurnHandler and binds agent-side helpers to
+// the session and connection of a single prompt turn.
+//
+// Its context is cancelled when the client sends session/cancel for the
+// session, so long-running work should select on Context().Done(). Updates
+// can still be sent after cancellation so the agent can report the final
+// state of its tool calls before the turn ends.
+//
+// Tool calls that are still open when a cancelled or panicking handler
+// returns are reported as failed.
+type TurnContext struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	conn      *AgentConnection
+	sessionID api.SessionId
+
+	mu        sync.Mutex
+	toolCalls []*ToolCallHandle
+}
+
+// newTurnContext creates a turn context whose context is cancelled by cancel
+// or by the parent context.
+func newTurnContext(ctx context.Context, conn *AgentConnection, sessionID api.SessionId) *TurnContext {
+	turnCtx, cancel := context.WithCancel(ctx)
+	return &TurnContext{
+		ctx:       turnCtx,
+		cancel:    cancel,
+		conn:      conn,
+		sessionID: sessionID,
+	}
+}
+
+// Context returns the cancellation-aware context of the turn.
+func (t *TurnContext) Context() context.Context {
+	return t.ctx
+}
+
+// SessionID returns the session of the turn.
+func (t *TurnContext) SessionID() api.SessionId {
+	return t.sessionID
+}
+
+// Connection returns the agent connection serving the turn.
+func (t *TurnContext) Connection() *AgentConnection {
+	return t.conn
+}
+
+// Cancelled reports whether the turn was cancelled.
+func (t *TurnContext) Cancelled() bool {
+	return t.ctx.Err() != nil
+}
+
+// NewID returns an identifier with the given prefix that is unique on the
+// connection, for example "call_7".
+func (t *TurnContext) NewID(prefix string) string {
+	return fmt.Sprintf("%s_%d", prefix, t.conn.ids.Add(1))
+}
+
+// sendCtx returns the context used for outgoing notifications, which are
+// still delivered after the turn is cancelled.
+func (t *TurnContext) sendCtx() context.Context {
+	return context.WithoutCancel(t.ctx)
+}
+
+// SendUpdate sends a session update for the turn's session.
+func (t *TurnContext) SendUpdate(update *api.SessionUpdate) error {
+	return t.conn.SendSessionUpdate(t.sendCtx(), &api.SessionNotification{
+		SessionId: t.sessionID,
+		Update:    update,
+	})
+}
+
+// SendText sends a chunk of the agent's response.
+func (t *TurnContext) SendText(text string) error {
+	return t.SendUpdate(api.NewSessionUpdateAgentMessageChunk(api.NewContentBlockText(nil, text)))
+}
+
+// SendThought sends a chunk of the agent's reasoning.
+func (t *TurnContext) SendThought(text string) error {
+	return t.SendUpdate(api.NewSessionUpdateAgentThoughtChunk(api.NewContentBlockText(nil, text)))
+}
+
+// UpdatePlan sends the agent's current plan, replacing any previous plan.
+func (t *TurnContext) UpdatePlan(plan *api.Plan) error {
+	return t.conn.SendPlanUpdate(t.sendCtx(), t.sessionID, plan)
+}
+
+// StartToolCall reports a new pending tool call with a generated ID and
+// returns a handle for reporting its progress.
+func (t *TurnContext) StartToolCall(
+	title string,
+	kind api.ToolKind,
+	locations ...api.ToolCallLocation,
+) (*ToolCallHandle, error) {
+	id := api.ToolCallId(t.NewID("call"))
+	toolCall := NewToolCall(id, title).
+		WithKind(string(kind)).
+		WithLocations(locations).
+		Build()
+	return t.startToolCall(toolCall)
+}
+
+// startToolCall reports a new tool call and tracks it until it completes or
+// fails.
+func (t *TurnContext) startToolCall(toolCall api.ToolCall) (*ToolCallHandle, error) {
+	if err := t.conn.SendNewToolCall(t.sendCtx(), t.sessionID, toolCall); err != nil {
+		return nil, err
+	}
+
+	handle := newToolCallHandle(t.conn, t.sessionID, t, toolCall)
+	t.mu.Lock()
+	t.toolCalls = append(t.toolCalls, handle)
+	t.mu.Unlock()
+	return handle, nil
+}
+
+// OpenToolCalls returns the turn's tool calls that have not yet completed or
+// failed, in the order they were started.
+func (t *TurnContext) OpenToolCalls() []*ToolCallHandle {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*ToolCallHandle(nil), t.toolCalls...)
+}
+
+// removeToolCall forgets a tool call that reached a terminal status.
+func (t *TurnContext) removeToolCall(handle *ToolCallHandle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, open := range t.toolCalls {
+		if open == handle {
+			t.toolCalls = append(t.toolCalls[:i], t.toolCalls[i+1:]...)
+			return
+		}
+	}
+}
+
+// failOpenToolCalls reports every open tool call of the turn as failed.
+func (t *TurnContext) failOpenToolCalls() {
+	for _, handle := range t.OpenToolCalls() {
+		_ = handle.Fail()
+	}
+}
+
+// RequestPermission asks the client for permission to run a tool call. The
+// request is abandoned if the turn is cancelled.
+func (t *TurnContext) RequestPermission(
+	toolCall api.ToolCallUpdate,
+	options []api.PermissionOption,
+) (*api.RequestPermissionResponse, error) {
+	return t.conn.SessionRequestPermission(t.ctx, &api.RequestPermissionRequest{
+		SessionId: t.sessionID,
+		ToolCall:  toolCall,
+		Options:   options,
+	})
+}
+
+// runPromptTurnHandler runs a PromptTurnHandler for a session/prompt request.
+//
+// A handler that returns an error after its turn was cancelled ends the turn
+// with StopReasonCancelled, as required by the protocol. A handler panic is
+// recovered and returned as an internal error.
+func runPromptTurnHandler(
+	ctx context.Context,
+	handler PromptTurnHandler,
+	params *api.PromptRequest,
+) (resp *api.PromptResponse, err error) {
+	conn := AgentConnectionFromContext(ctx)
+	if conn == nil {
+		return nil, errors.New("prompt turn handler requires an agent connection")
+	}
+
+	turn := newTurnContext(ctx, conn, params.SessionId)
+	defer turn.cancel()
+
+	conn.turnContexts.Store(params.SessionId, turn)
+	defer conn.turnContexts.CompareAndDelete(params.SessionId, turn)
+
+	defer func() {
+		if r := recover(); r != nil {
+			turn.failOpenToolCalls()
+			resp = nil
+			err = api.NewACPError(
+				api.ErrorCodeInternalServerError,
+				fmt.Sprintf("prompt handler panicked: %v", r),
+				nil,
+			)
+		}
+	}()
+
+	stopReason, err := handler(turn, params)
+	if turn.Cancelled() {
+		turn.failOpenToolCalls()
+	}
+	if err != nil {
+		if turn.Cancelled() {
+			return &api.PromptResponse{StopReason: api.StopReasonCancelled}, nil
+		}
+		return nil, err
+	}
+	return &api.PromptResponse{StopReason: stopReason}, nil
+}
+
+// cancelTurnContext cancels the TurnContext of the session named by a
+// session/cancel notification.
+func (a *AgentConnection) cancelTurnContext(req *jsonrpc2.Request) {
+	var params api.CancelNotification
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return
+	}
+	if turn, exists := a.turnContexts.Load(params.SessionId); exists {
+		turn.cancel()
+	}
+}
@@ -0,0 +1,186 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTurnPair creates a connection pair whose agent handles prompts with a PromptTurnHandler.
+func newTurnPair(t *testing.T, handler PromptTurnHandler, clientHandler Handler) *ClientConnection {
+	t.Helper()
+
+	agentHandler := NewAgentHandlerRegistry()
+	agentHandler.RegisterPromptTurnHandler(handler)
+	_, clientConn := NewRolePair(t, agentHandler, clientHandler)
+	return clientConn
+}
+
+// streamEvents runs a prompt through PromptStream and collects its events.
+func streamEvents(ctx context.Context, clientConn *ClientConnection, sessionID string) []PromptEvent {
+	var events []PromptEvent
+	for event := range clientConn.PromptStream(ctx, SamplePromptRequest(sessionID)) {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestTurnContext(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("SendsSessionBoundUpdates", func(t *testing.T) {
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			require.NoError(t, turn.SendThought("thinking"))
+			require.NoError(t, turn.UpdatePlan(CreateSimplePlan([]string{"read"})))
+
+			call, err := turn.StartToolCall("Read main.go", api.ToolKindRead, CreateLocationSimple("main.go"))
+			require.NoError(t, err)
+			require.NoError(t, call.SetStatus(api.ToolCallStatusInProgress))
+			require.NoError(t, call.Complete("done"))
+
+			require.NoError(t, turn.SendText("finished"))
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		events := streamEvents(ctx, clientConn, "s1")
+		require.Len(t, events, 7)
+
+		var types []api.SessionUpdateType
+		for _, event := range events[:6] {
+			types = append(types, event.Update.Type)
+		}
+		assert.Equal(t, []api.SessionUpdateType{
+			api.SessionUpdateTypeAgentThoughtChunk,
+			api.SessionUpdateTypePlan,
+			api.SessionUpdateTypeToolCall,
+			api.SessionUpdateTypeToolCallUpdate,
+			api.SessionUpdateTypeToolCallUpdate,
+			api.SessionUpdateTypeAgentMessageChunk,
+		}, types)
+		assert.Equal(t, api.StopReasonEndTurn, events[6].StopReason)
+
+		toolCall := events[2].Update.ToolCall
+		require.NotNil(t, toolCall.Kind)
+		assert.Equal(t, api.ToolKindRead, *toolCall.Kind)
+		assert.Equal(t, "Read main.go", toolCall.Title)
+	})
+
+	t.Run("GeneratesUniqueIDs", func(t *testing.T) {
+		ids := make(chan api.ToolCallId, 4)
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			for range 2 {
+				call, err := turn.StartToolCall("Run", api.ToolKindExecute)
+				require.NoError(t, err)
+				ids <- call.ID()
+			}
+			return api.StopReasonEndTurn, nil
+		}, NewClientHandlerRegistry())
+
+		streamEvents(ctx, clientConn, "s1")
+		streamEvents(ctx, clientConn, "s1")
+		close(ids)
+
+		seen := make(map[api.ToolCallId]bool)
+		for id := range ids {
+			assert.False(t, seen[id], "duplicate tool call ID %s", id)
+			seen[id] = true
+		}
+		assert.Len(t, seen, 4)
+	})
+
+	t.Run("SessionCancelCancelsContext", func(t *testing.T) {
+		started := make(chan struct{})
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			call, err := turn.StartToolCall("Long task", api.ToolKindExecute)
+			require.NoError(t, err)
+			close(started)
+
+			<-turn.Context().Done()
+			// Updates still reach the client after cancellation.
+			require.NoError(t, call.Fail())
+			return "", turn.Context().Err()
+		}, NewClientHandlerRegistry())
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		events := streamEvents(streamCtx, clientConn, "s1")
+		require.Len(t, events, 3)
+		assert.Equal(t, api.SessionUpdateTypeToolCallUpdate, events[1].Update.Type)
+		require.NoError(t, events[2].Err)
+		assert.Equal(t, api.StopReasonCancelled, events[2].StopReason)
+	})
+
+	t.Run("CancelForOtherSessionIsIgnored", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			close(started)
+			select {
+			case <-release:
+				return api.StopReasonEndTurn, nil
+			case <-turn.Context().Done():
+				return api.StopReasonCancelled, nil
+			}
+		}, NewClientHandlerRegistry())
+
+		go func() {
+			<-started
+			_ = clientConn.SessionCancel(ctx, &api.CancelNotification{SessionId: "other"})
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+		}()
+
+		resp, err := clientConn.SessionPrompt(ctx, SamplePromptRequest("s1"))
+		require.NoError(t, err)
+		assert.Equal(t, string(api.StopReasonEndTurn), resp.StopReason)
+	})
+
+	t.Run("RequestPermission", func(t *testing.T) {
+		clientHandler := NewClientHandlerRegistry()
+		clientHandler.RegisterSessionRequestPermissionHandler(
+			func(_ context.Context, params *api.RequestPermissionRequest) (*api.RequestPermissionResponse, error) {
+				assert.Equal(t, api.SessionId("s1"), params.SessionId)
+				return &api.RequestPermissionResponse{
+					Outcome: NewPermissionSelectedOutcome(string(params.Options[0].OptionId)),
+				}, nil
+			},
+		)
+
+		clientConn := newTurnPair(t, func(turn *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			call, err := turn.StartToolCall("Write config", api.ToolKindEdit)
+			require.NoError(t, err)
+
+			resp, err := turn.RequestPermission(
+				NewToolCallUpdate(call.ID()).WithTitle("Write config").Build(),
+				[]api.PermissionOption{{Kind: api.PermissionOptionKindAllowOnce, Name: "Allow", OptionId: "allow"}},
+			)
+			require.NoError(t, err)
+			assert.Equal(t, NewPermissionSelectedOutcome("allow"), resp.Outcome)
+			return api.StopReasonEndTurn, nil
+		}, clientHandler)
+
+		events := streamEvents(ctx, clientConn, "s1")
+		require.NotEmpty(t, events)
+		assert.Equal(t, api.StopReasonEndTurn, events[len(events)-1].StopReason)
+	})
+
+	t.Run("HandlerError", func(t *testing.T) {
+		clientConn := newTurnPair(t, func(_ *TurnContext, _ *api.PromptRequest) (api.StopReason, error) {
+			return "", errors.New("boom")
+		}, NewClientHandlerRegistry())
+
+		_, err := clientConn.SessionPrompt(ctx, SamplePromptRequest("s1"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "boom")
+	})
+}
@@ -0,0 +1,231 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/internal/atomicfile"
+	"github.com/joshgarnett/agent-client-protocol-go/util"
+)
+
+const (
+	newTextFilePerm = 0o600
+	newTextDirPerm  = 0o750
+)
+
+// ErrNotRegularFile is returned when a text file request names a directory or
+// another non-regular file.
+var ErrNotRegularFile = errors.New("not a regular file")
+
+// WorkspaceFS is the file system behind FSHandlers. Paths are absolute, clean
+// and already confined to the allowed roots.
+//
+// Errors wrapping fs.ErrNotExist, fs.ErrPermission and ErrNotRegularFile are
+// reported to the agent as not found, forbidden and invalid params errors.
+type WorkspaceFS interface {
+	// OpenTextFile opens a file for reading.
+	OpenTextFile(ctx context.Context, path string) (io.ReadCloser, error)
+	// WriteTextFile replaces the content of a file, creating it if needed.
+	WriteTextFile(ctx context.Context, path string, content string) error
+}
+
+// workspaceRootKey is the context key for the allowed root FSHandlers
+// confined a request's path to.
+type workspaceRootKey struct{}
+
+// withWorkspaceRoot returns a context carrying the allowed root of a request's path.
+func withWorkspaceRoot(ctx context.Context, root string) context.Context {
+	return context.WithValue(ctx, workspaceRootKey{}, root)
+}
+
+// openWorkspaceRoot opens the allowed root carried by ctx, or the root of
+// path's volume if there is none, and returns path relative to it.
+func openWorkspaceRoot(ctx context.Context, path string) (*os.Root, string, error) {
+	root, _ := ctx.Value(workspaceRootKey{}).(string)
+	if root == "" {
+		root = filepath.VolumeName(path) + string(filepath.Separator)
+	}
+	name, err := filepath.Rel(root, path)
+	if err != nil || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return nil, "", fmt.Errorf("%s is outside %s: %w", path, root, fs.ErrPermission)
+	}
+	dir, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, "", err
+	}
+	return dir, name, nil
+}
+
+// DiskFS is a WorkspaceFS that reads and writes files on disk.
+//
+// Files of requests from FSHandlers are opened through os.Root at the
+// request's allowed root, so symbolic links cannot lead out of it. Writes go
+// to a temporary file that is renamed over the target, keep the mode of an
+// existing file, and create missing parent directories.
+type DiskFS struct{}
+
+// OpenTextFile opens a regular file on disk.
+func (DiskFS) OpenTextFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	dir, name, err := openWorkspaceRoot(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	file, err := dir.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		_ = file.Close()
+		return nil, fmt.Errorf("%s: %w", path, ErrNotRegularFile)
+	}
+	return file, nil
+}
+
+// WriteTextFile atomically replaces a file on disk.
+func (DiskFS) WriteTextFile(ctx context.Context, path string, content string) error {
+	dir, name, err := openWorkspaceRoot(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	perm := fs.FileMode(newTextFilePerm)
+	info, err := dir.Stat(name)
+	switch {
+	case err == nil && !info.Mode().IsRegular():
+		return fmt.Errorf("%s: %w", path, ErrNotRegularFile)
+	case err == nil:
+		perm = info.Mode().Perm()
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	if err = dir.MkdirAll(filepath.Dir(name), newTextDirPerm); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return atomicfile.WriteFileIn(dir, name, []byte(content), perm)
+}
+
+// BufferChangeCallback is called when an agent write changes a buffer of an
+// OverlayFS.
+type BufferChangeCallback func(path string, content string)
+
+// OverlayFS is a WorkspaceFS that lets agents see an editor's unsaved state.
+//
+// The host application registers the contents of its open buffers with
+// OpenBuffer. Reads of a path with a buffer return the buffer's content;
+// other reads fall through to the base file system. Writes never reach the
+// base file system: they replace the buffer's content, opening a buffer for
+// files that had none, and notify the OnChange callbacks so the host can
+// update its editor and decide when to save.
+type OverlayFS struct {
+	base WorkspaceFS
+
+	mu      sync.RWMutex
+	buffers map[string]string
+
+	callbacks *util.CallbackRegistry[BufferChangeCallback]
+}
+
+// NewOverlayFS creates an overlay over base. A nil base uses DiskFS.
+func NewOverlayFS(base WorkspaceFS) *OverlayFS {
+	if base == nil {
+		base = DiskFS{}
+	}
+	return &OverlayFS{
+		base:      base,
+		buffers:   make(map[string]string),
+		callbacks: util.NewCallbackRegistry[BufferChangeCallback](),
+	}
+}
+
+// OpenBuffer registers or replaces the content of the buffer for path.
+func (o *OverlayFS) OpenBuffer(path string, content string) {
+	key := bufferKey(path)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buffers[key] = content
+}
+
+// CloseBuffer removes the buffer for path, so reads see the base file system
+// again.
+func (o *OverlayFS) CloseBuffer(path string) {
+	key := bufferKey(path)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.buffers, key)
+}
+
+// Buffer returns the content of the buffer for path.
+func (o *OverlayFS) Buffer(path string) (string, bool) {
+	key := bufferKey(path)
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	content, exists := o.buffers[key]
+	return content, exists
+}
+
+// Buffers returns the paths of all buffers, sorted.
+func (o *OverlayFS) Buffers() []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	paths := make([]string, 0, len(o.buffers))
+	for path := range o.buffers {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// OnChange registers a callback for buffer changes made by agent writes.
+func (o *OverlayFS) OnChange(callback BufferChangeCallback) {
+	o.callbacks.Register(callback)
+}
+
+// OpenTextFile returns the buffer for path, or opens the file in the base file
+// system.
+func (o *OverlayFS) OpenTextFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	if content, exists := o.Buffer(path); exists {
+		return io.NopCloser(strings.NewReader(content)), nil
+	}
+	return o.base.OpenTextFile(ctx, path)
+}
+
+// WriteTextFile replaces the buffer for path and notifies the OnChange
+// callbacks.
+func (o *OverlayFS) WriteTextFile(_ context.Context, path string, content string) error {
+	key := bufferKey(path)
+	o.mu.Lock()
+	o.buffers[key] = content
+	o.mu.Unlock()
+
+	for _, callback := range o.callbacks.GetAll() {
+		callback(key, content)
+	}
+	return nil
+}
+
+// bufferKey returns the path buffers are stored under, with symbolic links
+// resolved as FSHandlers resolves request paths.
+func bufferKey(path string) string {
+	path = filepath.Clean(path)
+	if resolved, err := resolvePath(path); err == nil {
+		return resolved
+	}
+	return path
+}
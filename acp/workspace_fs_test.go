@@ -0,0 +1,142 @@
+package acp
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAll reads a file through a WorkspaceFS.
+func readAll(t *testing.T, fsys WorkspaceFS, path string) string {
+	t.Helper()
+	file, err := fsys.OpenTextFile(context.Background(), path)
+	require.NoError(t, err)
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestDiskFS(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	path := filepath.Join(root, "dir", "a.txt")
+
+	require.NoError(t, DiskFS{}.WriteTextFile(ctx, path, "hello"))
+	assert.Equal(t, "hello", readAll(t, DiskFS{}, path))
+
+	_, err := DiskFS{}.OpenTextFile(ctx, filepath.Join(root, "dir"))
+	require.ErrorIs(t, err, ErrNotRegularFile)
+	err = DiskFS{}.WriteTextFile(ctx, filepath.Join(root, "dir"), "x")
+	require.ErrorIs(t, err, ErrNotRegularFile)
+	_, err = DiskFS{}.OpenTextFile(ctx, filepath.Join(root, "missing.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDiskFSConfinedToRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o600))
+	// A link swapped in after FSHandlers resolved the path must not be followed out of the root.
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+	ctx := withWorkspaceRoot(context.Background(), root)
+
+	_, err := DiskFS{}.OpenTextFile(ctx, filepath.Join(root, "link", "secret.txt"))
+	require.Error(t, err)
+	err = DiskFS{}.WriteTextFile(ctx, filepath.Join(root, "link", "new.txt"), "x")
+	require.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(outside, "new.txt"))
+	_, err = DiskFS{}.OpenTextFile(ctx, filepath.Join(outside, "secret.txt"))
+	require.ErrorIs(t, err, os.ErrPermission)
+
+	require.NoError(t, DiskFS{}.WriteTextFile(ctx, filepath.Join(root, "dir", "a.txt"), "hello"))
+	file, err := DiskFS{}.OpenTextFile(ctx, filepath.Join(root, "dir", "a.txt"))
+	require.NoError(t, err)
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestOverlayFS(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ReadsBuffersBeforeDisk", func(t *testing.T) {
+		root := t.TempDir()
+		path := filepath.Join(root, "main.go")
+		require.NoError(t, os.WriteFile(path, []byte("saved"), 0o600))
+		overlay := NewOverlayFS(nil)
+
+		assert.Equal(t, "saved", readAll(t, overlay, path))
+
+		overlay.OpenBuffer(path, "unsaved")
+		assert.Equal(t, "unsaved", readAll(t, overlay, path))
+
+		overlay.CloseBuffer(path)
+		assert.Equal(t, "saved", readAll(t, overlay, path))
+	})
+
+	t.Run("WritesUpdateBuffers", func(t *testing.T) {
+		root, err := filepath.EvalSymlinks(t.TempDir())
+		require.NoError(t, err)
+		path := filepath.Join(root, "main.go")
+		require.NoError(t, os.WriteFile(path, []byte("saved"), 0o600))
+		newPath := filepath.Join(root, "new.go")
+
+		overlay := NewOverlayFS(nil)
+		overlay.OpenBuffer(path, "unsaved")
+		type change struct{ path, content string }
+		var changes []change
+		overlay.OnChange(func(path string, content string) {
+			changes = append(changes, change{path, content})
+		})
+
+		require.NoError(t, overlay.WriteTextFile(ctx, path, "edited"))
+		require.NoError(t, overlay.WriteTextFile(ctx, newPath, "created"))
+
+		assert.Equal(t, []change{{path, "edited"}, {newPath, "created"}}, changes)
+		assert.Equal(t, "edited", readAll(t, overlay, path))
+		content, exists := overlay.Buffer(newPath)
+		assert.True(t, exists)
+		assert.Equal(t, "created", content)
+		assert.Equal(t, []string{path, newPath}, overlay.Buffers())
+
+		// Disk is untouched.
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "saved", string(data))
+		assert.NoFileExists(t, newPath)
+	})
+
+	t.Run("BehindFSHandlers", func(t *testing.T) {
+		root, err := filepath.EvalSymlinks(t.TempDir())
+		require.NoError(t, err)
+		path := filepath.Join(root, "main.go")
+		overlay := NewOverlayFS(nil)
+		overlay.OpenBuffer(path, "one\ntwo\nthree\n")
+
+		handlers, err := NewFSHandlers(FSHandlerOptions{Roots: []string{root}, FS: overlay})
+		require.NoError(t, err)
+
+		resp, err := handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: path, Line: IntPtr(2), Limit: IntPtr(1)})
+		require.NoError(t, err)
+		assert.Equal(t, "two\n", resp.Content)
+
+		require.NoError(t, handlers.HandleWriteTextFile(ctx, &api.WriteTextFileRequest{Path: path, Content: "new"}))
+		content, _ := overlay.Buffer(path)
+		assert.Equal(t, "new", content)
+		assert.NoFileExists(t, path)
+
+		// Buffers outside the roots stay unreachable.
+		outside := filepath.Join(filepath.Dir(root), "outside.go")
+		overlay.OpenBuffer(outside, "secret")
+		_, err = handlers.HandleReadTextFile(ctx, &api.ReadTextFileRequest{Path: outside})
+		AssertACPError(t, err, api.ErrorCodeForbidden)
+	})
+}
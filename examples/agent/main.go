@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,7 +12,6 @@ import (
 
 	"github.com/joshgarnett/agent-client-protocol-go/acp"
 	"github.com/joshgarnett/agent-client-protocol-go/acp/api"
-	"github.com/joshgarnett/agent-client-protocol-go/util"
 )
 
 // ============================================================================
@@ -51,12 +49,6 @@ func (s stdioReadWriteCloser) Close() error {
 // Global State
 // ============================================================================
 
-// activePrompts tracks ongoing prompts for cancellation support.
-var activePrompts = util.NewSyncMap[string, context.CancelFunc]()
-
-// Global agent connection for handlers
-var agentConn *acp.AgentConnection
-
 // Global client capabilities received during initialization
 var clientCapabilities *api.ClientCapabilities
 
@@ -68,11 +60,11 @@ var clientCapabilities *api.ClientCapabilities
 func main() {
 	ctx := context.Background()
 
-	registry := acp.NewHandlerRegistry()
+	registry := acp.NewAgentHandlerRegistry()
 	registry.RegisterInitializeHandler(handleInitialize)
 	registry.RegisterAuthenticateHandler(handleAuthenticate)
 	registry.RegisterSessionNewHandler(handleSessionNew)
-	registry.RegisterSessionPromptHandler(handleSessionPrompt)
+	registry.RegisterPromptTurnHandler(handleSessionPrompt)
 	registry.RegisterSessionCancelHandler(handleSessionCancel)
 
 	stdio := stdioReadWriteCloser{Reader: os.Stdin, Writer: os.Stdout}
@@ -88,8 +80,6 @@ func main() {
 		log.Fatalf("Failed to create agent connection: %v", err)
 	}
 
-	agentConn = conn
-
 	log.Printf("Agent started (PID: %d), waiting for connection...\n", os.Getpid())
 	if waitErr := conn.Wait(); waitErr != nil {
 		log.Printf("Connection closed: %v\n", waitErr)
@@ -155,42 +145,23 @@ func handleSessionNew(_ context.Context, params *api.NewSessionRequest) (*api.Ne
 }
 
 // handleSessionPrompt processes user prompts and demonstrates agent workflow.
-func handleSessionPrompt(_ context.Context, params *api.PromptRequest) (*api.PromptResponse, error) {
+func handleSessionPrompt(turn *acp.TurnContext, params *api.PromptRequest) (api.StopReason, error) {
 	log.Printf("[PROMPT] Processing prompt for session: %s\n", params.SessionId)
 
-	if agentConn == nil {
-		log.Println("[ERROR] Agent connection not available")
-		return &api.PromptResponse{StopReason: api.StopReasonRefusal}, errors.New("agent connection not available")
-	}
-
-	promptCtx, promptCancel := context.WithCancel(context.Background())
-	activePrompts.Store(string(params.SessionId), promptCancel)
-
-	defer func() {
-		activePrompts.Delete(string(params.SessionId))
-	}()
-
-	stopReason, err := simulateAgentTurn(promptCtx, agentConn, params)
+	stopReason, err := simulateAgentTurn(turn)
 	if err != nil {
 		log.Printf("[PROMPT] Error during agent simulation: %v\n", err)
-		return &api.PromptResponse{StopReason: api.StopReasonRefusal}, err
+		return api.StopReasonRefusal, err
 	}
 
 	log.Printf("[PROMPT] Agent turn completed with stop reason: %s\n", stopReason)
-	return &api.PromptResponse{StopReason: api.StopReasonEndTurn}, nil
+	return stopReason, nil
 }
 
-// handleSessionCancel handles session cancellation requests.
+// handleSessionCancel logs session cancellation requests. The library cancels
+// the session's TurnContext before this handler runs.
 func handleSessionCancel(_ context.Context, params *api.CancelNotification) error {
 	log.Printf("[CANCEL] Cancellation requested for session: %s\n", params.SessionId)
-
-	if cancel, exists := activePrompts.LoadAndDelete(string(params.SessionId)); exists {
-		cancel()
-		log.Printf("[CANCEL] Successfully cancelled session: %s\n", params.SessionId)
-	} else {
-		log.Printf("[CANCEL] No active prompt found for session: %s\n", params.SessionId)
-	}
-
 	return nil
 }
 
@@ -199,13 +170,11 @@ func handleSessionCancel(_ context.Context, params *api.CancelNotification) erro
 // ============================================================================
 
 // simulateAgentTurn executes the agent workflow including file operations.
-func simulateAgentTurn(
-	ctx context.Context,
-	conn *acp.AgentConnection,
-	params *api.PromptRequest,
-) (api.StopReason, error) {
+func simulateAgentTurn(turn *acp.TurnContext) (api.StopReason, error) {
+	ctx := turn.Context()
+
 	message := "I'll help you with that. Let me start by analyzing the request and reading some files to understand the current situation."
-	err := sendAgentMessage(ctx, conn, params.SessionId, message)
+	err := sendAgentMessage(turn, message)
 	if err != nil {
 		return api.StopReasonRefusal, err
 	}
@@ -214,7 +183,7 @@ func simulateAgentTurn(
 		return api.StopReasonCancelled, simErr
 	}
 
-	toolErr := performFileReadOperation(ctx, conn, params.SessionId, "call_1")
+	toolErr := performFileReadOperation(turn)
 	if toolErr != nil {
 		if ctx.Err() == context.Canceled {
 			return api.StopReasonCancelled, nil
@@ -227,7 +196,7 @@ func simulateAgentTurn(
 	}
 
 	progressMsg := " Based on my analysis, I need to make some changes. Let me modify a configuration file."
-	err = sendAgentMessage(ctx, conn, params.SessionId, progressMsg)
+	err = sendAgentMessage(turn, progressMsg)
 	if err != nil {
 		return api.StopReasonRefusal, err
 	}
@@ -236,7 +205,7 @@ func simulateAgentTurn(
 		return api.StopReasonCancelled, simErr
 	}
 
-	toolErr = performFileWriteOperation(ctx, conn, params.SessionId, "call_2")
+	toolErr = performFileWriteOperation(turn)
 	if toolErr != nil {
 		if ctx.Err() == context.Canceled {
 			return api.StopReasonCancelled, nil
@@ -249,7 +218,7 @@ func simulateAgentTurn(
 	}
 
 	completionMsg := " Perfect! I've successfully completed the requested changes. The configuration has been updated and the project is ready."
-	err = sendAgentMessage(ctx, conn, params.SessionId, completionMsg)
+	err = sendAgentMessage(turn, completionMsg)
 	if err != nil {
 		return api.StopReasonRefusal, err
 	}
@@ -258,15 +227,8 @@ func simulateAgentTurn(
 }
 
 // sendAgentMessage sends a message chunk to the client.
-func sendAgentMessage(ctx context.Context, conn *acp.AgentConnection, sessionID api.SessionId, text string) error {
-	textContent := api.NewContentBlockText(nil, text)
-	agentMessageUpdate := api.NewSessionUpdateAgentMessageChunk(textContent)
-
-	err := conn.SendSessionUpdate(ctx, &api.SessionNotification{
-		SessionId: sessionID,
-		Update:    agentMessageUpdate,
-	})
-	if err != nil {
+func sendAgentMessage(turn *acp.TurnContext, text string) error {
+	if err := turn.SendText(text); err != nil {
 		log.Printf("[ERROR] Failed to send agent message: %v\n", err)
 		return err
 	}
@@ -325,26 +287,22 @@ func discoverOutputFilePath() (string, error) {
 }
 
 // performFileReadOperation reads test files created by the client.
-func performFileReadOperation(
-	ctx context.Context,
-	conn *acp.AgentConnection,
-	sessionID api.SessionId,
-	toolCallID string,
-) error {
-	log.Printf("[FILE] Starting file read operation (%s)\n", toolCallID)
+func performFileReadOperation(turn *acp.TurnContext) error {
+	ctx := turn.Context()
+
+	call, err := sendToolCallStart(turn, "Reading project files", api.ToolKindRead)
+	if err != nil {
+		return err
+	}
+	log.Printf("[FILE] Starting file read operation (%s)\n", call.ID())
 
 	if clientCapabilities == nil || !clientCapabilities.Fs.ReadTextFile {
 		log.Printf("[FILE] Client does not support file reading\n")
-		return sendToolCallComplete(
-			ctx, conn, sessionID, toolCallID,
+		return sendToolCallComplete(call,
 			"Reading project files (skipped)",
 			"Client does not support file reading", "")
 	}
 
-	if err := sendToolCallStart(ctx, conn, sessionID, toolCallID, "Reading project files", api.ToolKindRead); err != nil {
-		return err
-	}
-
 	filesToRead, err := discoverTestFiles()
 	if err != nil {
 		log.Printf("[FILE] Failed to discover test files: %v\n", err)
@@ -357,8 +315,8 @@ func performFileReadOperation(
 	for _, filePath := range filesToRead {
 		log.Printf("[FILE] Attempting to read: %s\n", filePath)
 
-		response, readErr := conn.FsReadTextFile(ctx, &api.ReadTextFileRequest{
-			SessionId: sessionID,
+		response, readErr := turn.Connection().FsReadTextFile(ctx, &api.ReadTextFileRequest{
+			SessionId: turn.SessionID(),
 			Path:      filePath,
 		})
 
@@ -385,10 +343,7 @@ func performFileReadOperation(
 	}
 
 	return sendToolCallComplete(
-		ctx,
-		conn,
-		sessionID,
-		toolCallID,
+		call,
 		"Reading project files",
 		resultMessage,
 		totalContent.String(),
@@ -396,27 +351,24 @@ func performFileReadOperation(
 }
 
 // performFileWriteOperation writes files after requesting user permission.
-func performFileWriteOperation(
-	ctx context.Context,
-	conn *acp.AgentConnection,
-	sessionID api.SessionId,
-	toolCallID string,
-) error {
-	log.Printf("[FILE] Starting file write operation (%s)\n", toolCallID)
+func performFileWriteOperation(turn *acp.TurnContext) error {
+	ctx := turn.Context()
+	sessionID := turn.SessionID()
+
+	call, err := sendToolCallStart(turn, "Writing configuration file", api.ToolKindEdit)
+	if err != nil {
+		return err
+	}
+	log.Printf("[FILE] Starting file write operation (%s)\n", call.ID())
 
 	if clientCapabilities == nil || !clientCapabilities.Fs.WriteTextFile {
 		log.Printf("[FILE] Client does not support file writing\n")
-		return sendToolCallComplete(
-			ctx, conn, sessionID, toolCallID,
+		return sendToolCallComplete(call,
 			"Writing configuration file (skipped)",
 			"Client does not support file writing", "")
 	}
 
-	if err := sendToolCallStart(ctx, conn, sessionID, toolCallID, "Writing configuration file", api.ToolKindEdit); err != nil {
-		return err
-	}
-
-	granted, err := requestFileWritePermission(ctx, conn, sessionID, toolCallID)
+	granted, err := requestFileWritePermission(turn, call)
 	if err != nil {
 		return fmt.Errorf("permission request failed: %w", err)
 	}
@@ -424,10 +376,7 @@ func performFileWriteOperation(
 	if !granted {
 		log.Printf("[FILE] Permission denied\n")
 		return sendToolCallComplete(
-			ctx,
-			conn,
-			sessionID,
-			toolCallID,
+			call,
 			"Writing configuration file (skipped)",
 			"Permission denied",
 			"",
@@ -438,10 +387,7 @@ func performFileWriteOperation(
 	if err != nil {
 		log.Printf("[FILE] Failed to determine output path: %v\n", err)
 		return sendToolCallComplete(
-			ctx,
-			conn,
-			sessionID,
-			toolCallID,
+			call,
 			"Writing configuration file (failed)",
 			"Failed to determine output path",
 			"",
@@ -466,7 +412,7 @@ func performFileWriteOperation(
 
 	log.Printf("[FILE] Writing configuration to: %s\n", configPath)
 
-	err = conn.FsWriteTextFile(ctx, &api.WriteTextFileRequest{
+	err = turn.Connection().FsWriteTextFile(ctx, &api.WriteTextFileRequest{
 		SessionId: sessionID,
 		Path:      configPath,
 		Content:   configContent,
@@ -475,10 +421,7 @@ func performFileWriteOperation(
 	if err != nil {
 		log.Printf("[FILE] Failed to write %s: %v\n", configPath, err)
 		return sendToolCallComplete(
-			ctx,
-			conn,
-			sessionID,
-			toolCallID,
+			call,
 			"Writing configuration file (failed)",
 			fmt.Sprintf("Write failed: %v", err),
 			"",
@@ -487,10 +430,7 @@ func performFileWriteOperation(
 
 	log.Printf("[FILE] Successfully wrote configuration file: %s\n", configPath)
 	return sendToolCallComplete(
-		ctx,
-		conn,
-		sessionID,
-		toolCallID,
+		call,
 		"Writing configuration file (completed)",
 		fmt.Sprintf("Successfully wrote %s (%d bytes)", configPath, len(configContent)),
 		configContent[:minInt(maxDisplayContentLength, len(configContent))],
@@ -502,63 +442,25 @@ func performFileWriteOperation(
 // ============================================================================
 
 // sendToolCallStart notifies client of tool execution start.
-func sendToolCallStart(
-	ctx context.Context,
-	conn *acp.AgentConnection,
-	sessionID api.SessionId,
-	toolCallID, title string,
-	kind api.ToolKind,
-) error {
-	toolStatus := api.ToolCallStatusPending
-	location := api.ToolCallLocation{Path: "/project/"}
-
-	toolCall := api.NewSessionUpdateToolCall(
-		[]interface{}{}, // initial content empty
-		&kind,
-		[]interface{}{location},
-		map[string]interface{}{"operation": title},
-		nil, // rawOutput - nil initially
-		&toolStatus,
-		title,
-		(*api.ToolCallId)(&toolCallID),
-	)
-
-	return conn.SendSessionUpdate(ctx, &api.SessionNotification{
-		SessionId: sessionID,
-		Update:    toolCall,
-	})
+func sendToolCallStart(turn *acp.TurnContext, title string, kind api.ToolKind) (*acp.ToolCallHandle, error) {
+	return turn.StartToolCall(title, kind, api.ToolCallLocation{Path: "/project/"})
 }
 
 // sendToolCallComplete notifies client of tool execution completion.
-func sendToolCallComplete(
-	ctx context.Context,
-	conn *acp.AgentConnection,
-	sessionID api.SessionId,
-	toolCallID, title, message, content string,
-) error {
-	completedStatus := api.ToolCallStatusCompleted
-	var contentBlocks []interface{}
+func sendToolCallComplete(call *acp.ToolCallHandle, title, message, content string) error {
+	var contentBlocks []api.ToolCallUpdateContentElem
 
 	if message != "" {
 		textBlock := api.NewContentBlockText(nil, message)
 		contentBlocks = append(contentBlocks, *textBlock)
 	}
 
-	toolCallUpdate := api.NewSessionUpdateToolCallUpdate(
-		contentBlocks,
-		nil, // kind
-		nil, // locations
-		nil, // rawInput
-		map[string]interface{}{"success": true, "content": content}, // rawOutput
-		&completedStatus,
-		title+" (completed)",
-		(*api.ToolCallId)(&toolCallID),
-	)
-
-	return conn.SendSessionUpdate(ctx, &api.SessionNotification{
-		SessionId: sessionID,
-		Update:    toolCallUpdate,
-	})
+	return call.Update(acp.NewToolCallUpdate(call.ID()).
+		WithTitle(title + " (completed)").
+		WithStatus(api.ToolCallStatusCompleted).
+		WithContent(contentBlocks).
+		WithRawOutput(map[string]interface{}{"success": true, "content": content}).
+		Build())
 }
 
 // ============================================================================
@@ -566,13 +468,8 @@ func sendToolCallComplete(
 // ============================================================================
 
 // requestFileWritePermission requests user consent for file writes.
-func requestFileWritePermission(
-	ctx context.Context,
-	conn *acp.AgentConnection,
-	sessionID api.SessionId,
-	toolCallID string,
-) (bool, error) {
-	log.Printf("[PERMISSION] Requesting write permission for tool call: %s\n", toolCallID)
+func requestFileWritePermission(turn *acp.TurnContext, call *acp.ToolCallHandle) (bool, error) {
+	log.Printf("[PERMISSION] Requesting write permission for tool call: %s\n", call.ID())
 
 	// Create permission options
 	allowOption := api.PermissionOption{
@@ -596,7 +493,7 @@ func requestFileWritePermission(
 		Kind:       api.ToolKindEdit,
 		Status:     api.ToolCallStatusPending,
 		Title:      stringPtr("Writing configuration file"),
-		ToolCallId: api.ToolCallId(toolCallID),
+		ToolCallId: call.ID(),
 		Locations:  []api.ToolCallLocation{{Path: configPath}},
 		RawInput: map[string]interface{}{
 			"path":      configPath,
@@ -605,45 +502,18 @@ func requestFileWritePermission(
 		},
 	}
 
-	permissionRequest := &api.RequestPermissionRequest{
-		SessionId: sessionID,
-		ToolCall:  toolCall,
-		Options:   []api.PermissionOption{allowOption, rejectOption},
-	}
-
-	response, err := conn.SessionRequestPermission(ctx, permissionRequest)
+	decision, err := turn.AskPermission(toolCall, allowOption, rejectOption)
 	if err != nil {
 		return false, fmt.Errorf("permission request call failed: %w", err)
 	}
 
-	outcomeMap, ok := response.Outcome.(map[string]interface{})
-	if !ok {
-		return false, errors.New("invalid permission response format")
-	}
-
-	outcome, ok := outcomeMap["outcome"].(string)
-	if !ok {
-		return false, errors.New("invalid permission response format")
-	}
-
-	if outcome == "cancelled" {
+	if decision.Outcome == acp.PermissionOutcomeCancelled {
 		log.Printf("[PERMISSION] Request was cancelled\n")
 		return false, nil
 	}
 
-	if outcome == "selected" {
-		optionID, optionOk := outcomeMap["optionId"].(string)
-		if !optionOk {
-			return false, errors.New("invalid permission option ID format")
-		}
-
-		granted := optionID == "allow"
-		log.Printf("[PERMISSION] Permission %s (option: %s)\n",
-			map[bool]string{true: "granted", false: "denied"}[granted], optionID)
-		return granted, nil
-	}
-
-	return false, fmt.Errorf("unexpected permission outcome: %s", outcome)
+	log.Printf("[PERMISSION] Permission %s (option: %s)\n", decision.Outcome, decision.OptionID)
+	return decision.Allowed(), nil
 }
 
 // ============================================================================
@@ -8,7 +8,6 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -39,8 +38,8 @@ func (s stdioReadWriteCloser) Close() error {
 	return nil
 }
 
-// Global input manager
-var inputManager *InputManager
+// Global terminal prompter, shared by the prompt loop and permission requests
+var prompter *acp.TTYPrompter
 
 // Test file paths (set by createTestFiles)
 var (
@@ -268,16 +267,27 @@ func runClient() error {
 		return fmt.Errorf("failed to create test files: %w", err)
 	}
 
-	// Initialize input manager
-	inputManager = NewInputManager()
-	inputManager.Start()
-	defer inputManager.Stop()
+	// Initialize the terminal prompter and permission policy
+	prompter = acp.NewTTYPrompter(os.Stdin, os.Stdout)
+	permissions := acp.NewPermissionPolicy(prompter)
+
+	// Confine agent file access to the working directory and the temp
+	// directory holding the test files
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	fsHandlers, err := acp.NewFSHandlers(acp.FSHandlerOptions{
+		Roots: []string{currentDir, os.TempDir()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create file system handlers: %w", err)
+	}
 
 	// Set up handler registry
-	registry := acp.NewHandlerRegistry()
-	registry.RegisterFsReadTextFileHandler(handleFsReadTextFile)
-	registry.RegisterFsWriteTextFileHandler(handleFsWriteTextFile)
-	registry.RegisterSessionRequestPermissionHandler(handleSessionRequestPermission)
+	registry := acp.NewClientHandlerRegistry()
+	fsHandlers.Register(registry)
+	registry.RegisterSessionRequestPermissionHandler(permissions.HandleRequestPermission)
 	registry.RegisterSessionUpdateHandler(handleSessionUpdate)
 
 	// Set up agent connection
@@ -307,7 +317,12 @@ func runClient() error {
 
 	// Interactive prompt loop
 	for {
-		input, inputErr := inputManager.RequestInput("You: ")
+		input, inputErr := prompter.ReadLine(ctx, "You: ")
+		if errors.Is(inputErr, io.EOF) {
+			fmt.Println()
+			fmt.Println("[CLIENT] End of input, shutting down...")
+			break
+		}
 		if inputErr != nil {
 			fmt.Printf("[CLIENT] Error reading input: %v\n", inputErr)
 			break
@@ -377,123 +392,3 @@ func main() {
 		log.Fatalf("Client error: %v", err)
 	}
 }
-
-// ============================================================================
-// ACP Protocol Handlers
-// ============================================================================
-
-// handleFsReadTextFile processes agent file read requests.
-func handleFsReadTextFile(_ context.Context, params *api.ReadTextFileRequest) (*api.ReadTextFileResponse, error) {
-	fmt.Printf("[FILE] Agent requested to read file: %s\n", params.Path)
-
-	// Convert relative paths
-	path := params.Path
-	if !filepath.IsAbs(path) {
-		if cwd, err := os.Getwd(); err == nil {
-			path = filepath.Join(cwd, path)
-		}
-	}
-	content, err := os.ReadFile(path)
-	if err != nil {
-		fmt.Printf("[FILE] Error reading file %s: %v\n", params.Path, err)
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-
-	fmt.Printf("[FILE] Successfully read file %s (%d bytes)\n", params.Path, len(content))
-
-	return &api.ReadTextFileResponse{
-		Content: string(content),
-	}, nil
-}
-
-// handleFsWriteTextFile processes agent file write requests.
-func handleFsWriteTextFile(_ context.Context, params *api.WriteTextFileRequest) error {
-	fmt.Printf("[FILE] Agent requested to write file: %s (%d bytes)\n", params.Path, len(params.Content))
-
-	// Convert relative paths
-	path := params.Path
-	if !filepath.IsAbs(path) {
-		if cwd, err := os.Getwd(); err == nil {
-			path = filepath.Join(cwd, path)
-		}
-	}
-
-	// Ensure parent directories exist
-	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
-		fmt.Printf("[FILE] Error creating directory for %s: %v\n", params.Path, err)
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-	err := os.WriteFile(path, []byte(params.Content), 0600)
-	if err != nil {
-		fmt.Printf("[FILE] Error writing file %s: %v\n", params.Path, err)
-		return fmt.Errorf("failed to write file: %w", err)
-	}
-
-	fmt.Printf("[FILE] Successfully wrote file %s\n", params.Path)
-	return nil
-}
-
-// handleSessionRequestPermission processes permission requests from the agent.
-func handleSessionRequestPermission(
-	_ context.Context,
-	params *api.RequestPermissionRequest,
-) (*api.RequestPermissionResponse, error) {
-	fmt.Printf("\n[PERMISSION] Agent requested permission for: %v\n", params.ToolCall.Title)
-
-	if kindVal := params.ToolCall.Kind; kindVal != nil {
-		if kindStr, ok := kindVal.(string); ok {
-			fmt.Printf("    Tool kind: %s\n", kindStr)
-		} else {
-			fmt.Printf("    Tool kind: %v\n", kindVal)
-		}
-	}
-
-	if len(params.ToolCall.Locations) > 0 {
-		fmt.Println("    Affected locations:")
-		for _, loc := range params.ToolCall.Locations {
-			fmt.Printf("      - %s\n", loc.Path)
-		}
-	}
-
-	if len(params.Options) == 0 {
-		fmt.Println("No options available, cancelling")
-		return &api.RequestPermissionResponse{
-			Outcome: map[string]interface{}{"outcome": "cancelled"},
-		}, nil
-	}
-
-	// Present options to user
-	var optionNames []string
-	for _, option := range params.Options {
-		optionNames = append(optionNames, option.Name)
-	}
-
-	choice, err := inputManager.RequestInputWithOptions("", optionNames)
-	if err != nil {
-		fmt.Printf("Input error: %v\n", err)
-		return &api.RequestPermissionResponse{
-			Outcome: map[string]interface{}{"outcome": "cancelled"},
-		}, nil
-	}
-
-	// Parse choice and get selected option
-	choiceIdx := 0
-	_, parseErr := fmt.Sscanf(choice, "%d", &choiceIdx)
-	if parseErr != nil || choiceIdx < 1 || choiceIdx > len(params.Options) {
-		fmt.Println("Invalid choice, cancelling")
-		//nolint:nilerr // Intentionally return nil error with cancelled outcome
-		return &api.RequestPermissionResponse{
-			Outcome: map[string]interface{}{"outcome": "cancelled"},
-		}, nil
-	}
-
-	selectedOption := params.Options[choiceIdx-1]
-	fmt.Printf("Selected: %s\n\n", selectedOption.Name)
-
-	return &api.RequestPermissionResponse{
-		Outcome: map[string]interface{}{
-			"outcome":  "selected",
-			"optionId": selectedOption.OptionId,
-		},
-	}, nil
-}